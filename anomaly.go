@@ -0,0 +1,73 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"strings"
+
+	"github.com/jmbds/unbabel-backend-engineering-challenge/internal/anomaly"
+	"github.com/jmbds/unbabel-backend-engineering-challenge/internal/output"
+	"github.com/jmbds/unbabel-backend-engineering-challenge/pkg/movingaverage"
+)
+
+/*
+A function that calculates the moving average and writes it to the output file annotated with anomaly scores, along with the anomalies report.
+
+Both files only replace the previous ones once every line was written, or once the context is cancelled,
+in which case the lines written before stopping replace them, like writeMovingAverage does.
+Receives the context, the aggregator, the anomaly detector, the function observing each value as it is written or nil, the paths to the output and report files and how to write them, and the events grouped by minute.
+Returns an error.
+*/
+func writeAnomalies(ctx context.Context, aggregator *movingaverage.Aggregator, detector *anomaly.Detector, observe func(point movingaverage.Point), outputFilepath, anomalyFilepath string, outputMode output.Mode, eventsGroupedByMinute movingaverage.Dataset) error {
+	file, err := output.Create(outputFilepath, outputMode)
+	if err != nil {
+		return err
+	}
+
+	report := strings.Builder{}
+	written := 0
+	anomalies := 0
+	buffer := make([]byte, 0, 128)
+
+	err = aggregator.Iterate(ctx, eventsGroupedByMinute, func(point movingaverage.Point) error {
+		result := detector.Observe(point)
+		if observe != nil {
+			observe(point)
+		}
+
+		buffer = anomaly.AppendRecord(buffer[:0], point, result)
+		if _, err := file.Write(buffer); err != nil {
+			return err
+		}
+
+		if result.Anomaly {
+			line, err := anomaly.MarshalAnomaly(detector.Method, point, result)
+			if err != nil {
+				return err
+			}
+			report.Write(line)
+			report.WriteByte('\n')
+			anomalies++
+		}
+		written++
+		return nil
+	})
+	if err != nil && !errors.Is(err, context.Canceled) {
+		file.Abort()
+		return err
+	}
+
+	if err := file.Commit(); err != nil {
+		return err
+	}
+	if err := output.WriteStringToFile(anomalyFilepath, report.String(), outputMode); err != nil {
+		return err
+	}
+	if err != nil {
+		return &interruptedError{summary: fmt.Sprintf("Wrote %d minutes to %s and %d anomalies to %s before stopping.", written, outputFilepath, anomalies, anomalyFilepath)}
+	}
+
+	fmt.Printf("Found %d anomalies.\n", anomalies)
+	return nil
+}
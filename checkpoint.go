@@ -0,0 +1,187 @@
+package main
+
+import (
+	"bufio"
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"time"
+
+	"github.com/jmbds/unbabel-backend-engineering-challenge/internal/checkpoint"
+	"github.com/jmbds/unbabel-backend-engineering-challenge/internal/events"
+	"github.com/jmbds/unbabel-backend-engineering-challenge/internal/statistics"
+)
+
+/*
+A function that creates the deduplicator of the events aggregated with checkpoints.
+
+Memory is bounded by only remembering keys for the dedupe window.
+Returns the deduplicator, or nil when events are not deduplicated.
+*/
+func newDeduplicator(dedupeKey string, dedupeWindow time.Duration) *events.Deduplicator {
+	if dedupeKey == "" {
+		return nil
+	}
+	return events.NewDeduplicator(dedupeWindow)
+}
+
+/*
+A function that calculates the moving average while the input is read, saving checkpoints to resume from.
+
+Receives the context, the paths to the input, output and checkpoint files, the window size, the number of input records between checkpoints,
+whether to resume from the checkpoint and an optional deduplicator dropping duplicate events. When resuming, the output is truncated to its size at the checkpoint, so buckets
+written after it are not duplicated. Without a checkpoint to resume from, the aggregation starts from the beginning.
+The checkpoint is removed once the aggregation completes. When the context is cancelled, the completed buckets are flushed
+and a checkpoint is saved at the last event aggregated, so the aggregation can be resumed.
+Returns an error.
+*/
+func RunWithCheckpoints(ctx context.Context, inputFilepath, outputFilepath, checkpointFilepath string, windowSize, checkpointInterval int, resume bool, deduplicator *events.Deduplicator) error {
+	if checkpointInterval < 1 {
+		return errors.New("Checkpoint interval has to be equal or greater than 1, please provide a valid checkpoint interval.")
+	}
+
+	input, err := os.Open(inputFilepath)
+	if err != nil {
+		return err
+	}
+	defer input.Close()
+
+	aggregator, err := events.NewStreamAggregator(windowSize, time.Minute, nil)
+	if err != nil {
+		return err
+	}
+
+	/* Restore the aggregation from the checkpoint */
+	state := checkpoint.State{}
+	if resume {
+		state, err = checkpoint.Load(checkpointFilepath)
+		if err != nil && !errors.Is(err, os.ErrNotExist) {
+			return err
+		}
+	}
+	if state.Started {
+		if state.Window.Size != windowSize {
+			return errors.New("Checkpoint was saved with a different window size. Please provide the same window size to resume.")
+		}
+
+		aggregator.Window = &state.Window
+		aggregator.Pending = state.Pending
+		aggregator.Next = state.LastBucket.Add(time.Minute)
+		aggregator.Started = true
+
+		if deduplicator != nil {
+			deduplicator.Restore(state.SeenTranslationIds, state.DuplicatesDropped)
+		}
+
+		_, err = input.Seek(state.InputOffset, io.SeekStart)
+		if err != nil {
+			return err
+		}
+	}
+
+	/* Discard any output written after the checkpoint */
+	output, err := os.OpenFile(outputFilepath, os.O_CREATE|os.O_WRONLY, 0644)
+	if err != nil {
+		return err
+	}
+	defer output.Close()
+
+	err = output.Truncate(state.OutputSize)
+	if err != nil {
+		return err
+	}
+
+	_, err = output.Seek(state.OutputSize, io.SeekStart)
+	if err != nil {
+		return err
+	}
+
+	writer := bufio.NewWriter(output)
+	recordWriter := events.NewRecordWriter(writer)
+	recordWriter.Written = state.OutputSize
+	aggregator.Emit = func(point statistics.Point) error {
+		return point.Each(aggregator.Unit, recordWriter.WritePoint)
+	}
+
+	/* Flush the output to disk before saving the checkpoint, so it never points past the written output */
+	saveCheckpoint := func(inputOffset int64) error {
+		if err := writer.Flush(); err != nil {
+			return err
+		}
+		if err := output.Sync(); err != nil {
+			return err
+		}
+
+		state := checkpoint.State{
+			InputOffset: inputOffset,
+			OutputSize:  recordWriter.Written,
+			Window:      *aggregator.Window,
+			Pending:     aggregator.Pending,
+			LastBucket:  aggregator.Next.Add(-time.Minute),
+			Started:     aggregator.Started,
+		}
+		if deduplicator != nil {
+			state.SeenTranslationIds = deduplicator.Seen()
+			state.DuplicatesDropped = deduplicator.Dropped
+		}
+
+		return checkpoint.Save(checkpointFilepath, state)
+	}
+
+	/* Aggregate an input record, skipping it unless it is a translation_delivered event that is not a duplicate */
+	aggregate := func(event events.EventTranslationDelivered) error {
+		if !events.IsDelivered(event) {
+			return nil
+		}
+
+		if deduplicator != nil {
+			duplicate, err := deduplicator.Duplicate(event)
+			if err != nil || duplicate {
+				return err
+			}
+		}
+
+		return aggregator.Add(event)
+	}
+
+	/* Every input record counts towards the checkpoint interval, even the skipped ones */
+	scanner := events.NewEventScanner(input, state.InputOffset)
+	for count := 1; scanner.Scan(); count++ {
+		if err := aggregate(scanner.Event()); err != nil {
+			return err
+		}
+
+		if count%checkpointInterval == 0 {
+			if err := saveCheckpoint(scanner.Offset()); err != nil {
+				return err
+			}
+		}
+
+		if ctx.Err() != nil {
+			if err := saveCheckpoint(scanner.Offset()); err != nil {
+				return err
+			}
+			return &interruptedError{summary: fmt.Sprintf("Read %d events and wrote %d minutes before saving a checkpoint. Run again with --resume to continue.", count, recordWriter.Records)}
+		}
+	}
+	if err := scanner.Err(); err != nil {
+		return err
+	}
+
+	if err := aggregator.Close(); err != nil {
+		return err
+	}
+
+	if err := writer.Flush(); err != nil {
+		return err
+	}
+
+	err = os.Remove(checkpointFilepath)
+	if err != nil && !errors.Is(err, os.ErrNotExist) {
+		return err
+	}
+
+	return nil
+}
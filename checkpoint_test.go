@@ -0,0 +1,164 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+func TestRunWithCheckpoints(t *testing.T) {
+	directory := t.TempDir()
+	inputFilepath := filepath.Join(directory, "events.json")
+	outputFilepath := filepath.Join(directory, "aggregated_events.out.json")
+	checkpointFilepath := filepath.Join(directory, "checkpoint.json")
+
+	content, err := os.ReadFile("events.json")
+	if err != nil {
+		t.Fatal(err)
+	}
+	lines := strings.SplitAfter(string(content), "\n")
+
+	expected := "{\"date\": \"2018-12-26 18:11:00\", \"average_delivery_time\": 0}\n" +
+		"{\"date\": \"2018-12-26 18:12:00\", \"average_delivery_time\": 20}\n" +
+		"{\"date\": \"2018-12-26 18:13:00\", \"average_delivery_time\": 20}\n" +
+		"{\"date\": \"2018-12-26 18:14:00\", \"average_delivery_time\": 20}\n" +
+		"{\"date\": \"2018-12-26 18:15:00\", \"average_delivery_time\": 20}\n" +
+		"{\"date\": \"2018-12-26 18:16:00\", \"average_delivery_time\": 25.5}\n" +
+		"{\"date\": \"2018-12-26 18:17:00\", \"average_delivery_time\": 25.5}\n" +
+		"{\"date\": \"2018-12-26 18:18:00\", \"average_delivery_time\": 25.5}\n" +
+		"{\"date\": \"2018-12-26 18:19:00\", \"average_delivery_time\": 25.5}\n" +
+		"{\"date\": \"2018-12-26 18:20:00\", \"average_delivery_time\": 25.5}\n" +
+		"{\"date\": \"2018-12-26 18:21:00\", \"average_delivery_time\": 25.5}\n" +
+		"{\"date\": \"2018-12-26 18:22:00\", \"average_delivery_time\": 31}\n" +
+		"{\"date\": \"2018-12-26 18:23:00\", \"average_delivery_time\": 31}\n" +
+		"{\"date\": \"2018-12-26 18:24:00\", \"average_delivery_time\": 42.5}\n"
+
+	/* Crash on the third line, after a checkpoint was saved on the second one */
+	crashingInput := lines[0] + lines[1] + "crash\n"
+	if err := os.WriteFile(inputFilepath, []byte(crashingInput), 0644); err != nil {
+		t.Fatal(err)
+	}
+	if err := RunWithCheckpoints(context.Background(), inputFilepath, outputFilepath, checkpointFilepath, 10, 2, false, nil); err == nil {
+		t.Fatal("expected the run to fail on invalid content")
+	}
+	if _, err := os.Stat(checkpointFilepath); err != nil {
+		t.Fatalf("expected a checkpoint to be saved: %s", err)
+	}
+
+	/* Simulate output written after the checkpoint, before the crash */
+	output, err := os.OpenFile(outputFilepath, os.O_APPEND|os.O_WRONLY, 0644)
+	if err != nil {
+		t.Fatal(err)
+	}
+	output.WriteString("{\"date\": \"2018-12-26 18:16:00\", \"aver")
+	output.Close()
+
+	/* Resume with the fixed input */
+	if err := os.WriteFile(inputFilepath, content, 0644); err != nil {
+		t.Fatal(err)
+	}
+	if err := RunWithCheckpoints(context.Background(), inputFilepath, outputFilepath, checkpointFilepath, 10, 2, true, nil); err != nil {
+		t.Fatal(err)
+	}
+
+	got, err := os.ReadFile(outputFilepath)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if string(got) != expected {
+		t.Errorf("expected %v, got %v", expected, string(got))
+	}
+
+	if _, err := os.Stat(checkpointFilepath); !os.IsNotExist(err) {
+		t.Errorf("expected the checkpoint to be removed, got %v", err)
+	}
+
+	/* Resuming with a different window size is refused */
+	if err := os.WriteFile(inputFilepath, []byte(crashingInput), 0644); err != nil {
+		t.Fatal(err)
+	}
+	RunWithCheckpoints(context.Background(), inputFilepath, outputFilepath, checkpointFilepath, 10, 2, false, nil)
+	if err := RunWithCheckpoints(context.Background(), inputFilepath, outputFilepath, checkpointFilepath, 5, 2, true, nil); err == nil {
+		t.Errorf("expected an error resuming with a different window size")
+	}
+}
+
+func TestRunWithCheckpointsInterrupted(t *testing.T) {
+	directory := t.TempDir()
+	expectedFilepath := filepath.Join(directory, "expected.json")
+	outputFilepath := filepath.Join(directory, "aggregated_events.out.json")
+	checkpointFilepath := filepath.Join(directory, "checkpoint.json")
+
+	if err := RunWithCheckpoints(context.Background(), "events.json", expectedFilepath, checkpointFilepath, 10, 100, false, nil); err != nil {
+		t.Fatal(err)
+	}
+	expected, err := os.ReadFile(expectedFilepath)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	/* An interrupted run stops after the first event, flushing its minutes and saving a checkpoint */
+	ctx, cancel := context.WithCancel(context.Background())
+	cancel()
+	err = RunWithCheckpoints(ctx, "events.json", outputFilepath, checkpointFilepath, 10, 100, false, nil)
+	if !errors.Is(err, context.Canceled) {
+		t.Fatalf("expected %v, got %v", context.Canceled, err)
+	}
+	if _, err := os.Stat(checkpointFilepath); err != nil {
+		t.Fatalf("expected a checkpoint to be saved: %s", err)
+	}
+
+	got, err := os.ReadFile(outputFilepath)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !strings.HasPrefix(string(expected), string(got)) {
+		t.Errorf("expected a prefix of %v, got %v", string(expected), string(got))
+	}
+
+	/* Resuming completes the output */
+	if err := RunWithCheckpoints(context.Background(), "events.json", outputFilepath, checkpointFilepath, 10, 100, true, nil); err != nil {
+		t.Fatal(err)
+	}
+	got, err = os.ReadFile(outputFilepath)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if string(got) != string(expected) {
+		t.Errorf("expected %v, got %v", string(expected), string(got))
+	}
+}
+
+func TestRunWithCheckpointsSkippedEvents(t *testing.T) {
+	directory := t.TempDir()
+	inputFilepath := filepath.Join(directory, "events.json")
+	outputFilepath := filepath.Join(directory, "aggregated_events.out.json")
+	checkpointFilepath := filepath.Join(directory, "checkpoint.json")
+
+	requested := `{"timestamp": "2018-12-26 18:10:48.509654","translation_id": "5aa5b2f39f7254a75aa5","source_language": "en","target_language": "fr","client_name": "airliberty","event_name": "translation_requested","nr_words": 30}` + "\n"
+
+	/* A checkpoint is saved on a skipped event at the interval, before crashing on the next line */
+	if err := os.WriteFile(inputFilepath, []byte(requested+"crash\n"), 0644); err != nil {
+		t.Fatal(err)
+	}
+	if err := RunWithCheckpoints(context.Background(), inputFilepath, outputFilepath, checkpointFilepath, 10, 1, false, nil); err == nil {
+		t.Fatal("expected the run to fail on invalid content")
+	}
+	if _, err := os.Stat(checkpointFilepath); err != nil {
+		t.Fatalf("expected a checkpoint to be saved: %s", err)
+	}
+
+	/* Cancellation is noticed on skipped events too */
+	if err := os.WriteFile(inputFilepath, []byte(requested+requested), 0644); err != nil {
+		t.Fatal(err)
+	}
+	ctx, cancel := context.WithCancel(context.Background())
+	cancel()
+	err := RunWithCheckpoints(ctx, inputFilepath, outputFilepath, checkpointFilepath, 10, 100, false, nil)
+	if !errors.Is(err, context.Canceled) {
+		t.Errorf("expected %v, got %v", context.Canceled, err)
+	}
+}
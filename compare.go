@@ -0,0 +1,167 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"flag"
+	"fmt"
+	"time"
+
+	"github.com/jmbds/unbabel-backend-engineering-challenge/internal/compare"
+	"github.com/jmbds/unbabel-backend-engineering-challenge/internal/events"
+	"github.com/jmbds/unbabel-backend-engineering-challenge/internal/output"
+	"github.com/jmbds/unbabel-backend-engineering-challenge/pkg/movingaverage"
+)
+
+/*
+A function that runs the compare subcommand, writing the aligned moving averages of two inputs, periods, clients or language pairs with their differences, and a summary.
+
+Options of B that are not provided are the same as the ones of A, so only what differs between them has to be provided.
+Receives the context and the subcommand arguments.
+Returns an error.
+*/
+func runCompare(ctx context.Context, args []string) error {
+	var (
+		inputFilesA     = inputFilesFlag{values: []string{"events.json"}}
+		inputFilesB     inputFilesFlag
+		clientA         string
+		clientB         string
+		sourceA         string
+		sourceB         string
+		targetA         string
+		targetB         string
+		fromA, toA      string
+		fromB, toB      string
+		windowSize      int
+		outputFilepath  string
+		summaryFilepath string
+	)
+
+	flags := flag.NewFlagSet("unbabel_cli compare", flag.ExitOnError)
+	flags.Var(&inputFilesA, "input_file", "path or glob pattern of input files of A, can be repeated")
+	flags.Var(&inputFilesB, "input_file_b", "path or glob pattern of input files of B, can be repeated, the ones of A by default")
+	flags.StringVar(&clientA, "client_a", "", "client of A, every client by default")
+	flags.StringVar(&clientB, "client_b", "", "client of B, the one of A by default")
+	flags.StringVar(&sourceA, "source_language_a", "", "source language of A, every source language by default")
+	flags.StringVar(&sourceB, "source_language_b", "", "source language of B, the one of A by default")
+	flags.StringVar(&targetA, "target_language_a", "", "target language of A, every target language by default")
+	flags.StringVar(&targetB, "target_language_b", "", "target language of B, the one of A by default")
+	flags.StringVar(&fromA, "from_a", "", "start of the period of A, as YYYY-MM-DD or YYYY-MM-DD HH:MM:SS")
+	flags.StringVar(&toA, "to_a", "", "end of the period of A, exclusive, as YYYY-MM-DD or YYYY-MM-DD HH:MM:SS")
+	flags.StringVar(&fromB, "from_b", "", "start of the period of B, aligned with the start of the period of A")
+	flags.StringVar(&toB, "to_b", "", "end of the period of B, exclusive")
+	flags.IntVar(&windowSize, "window_size", 10, "size of time window for moving average")
+	flags.StringVar(&outputFilepath, "output_file", "comparison.out.json", "path to comparison output file")
+	flags.StringVar(&summaryFilepath, "summary_file", "comparison_summary.out.json", "path to comparison summary file")
+	if err := flags.Parse(args); err != nil {
+		return err
+	}
+
+	if !inputFilesB.set {
+		inputFilesB.values = inputFilesA.values
+	}
+	if clientB == "" {
+		clientB = clientA
+	}
+	if sourceB == "" {
+		sourceB = sourceA
+	}
+	if targetB == "" {
+		targetB = targetA
+	}
+
+	selectionA := compare.Selection{Client: clientA, SourceLanguage: sourceA, TargetLanguage: targetA}
+	var err error
+	if selectionA.From, err = parseQueryTime(fromA); err != nil {
+		return err
+	}
+	if selectionA.To, err = parseQueryTime(toA); err != nil {
+		return err
+	}
+
+	/* Without a period of its own, B is the same period as A */
+	selectionB := compare.Selection{Client: clientB, SourceLanguage: sourceB, TargetLanguage: targetB, From: selectionA.From, To: selectionA.To}
+	if fromB != "" || toB != "" {
+		if selectionB.From, err = parseQueryTime(fromB); err != nil {
+			return err
+		}
+		if selectionB.To, err = parseQueryTime(toB); err != nil {
+			return err
+		}
+	}
+	if selectionB.From.IsZero() != selectionA.From.IsZero() {
+		return errors.New("The period of B is aligned with the one of A. Please provide both --from_a and --from_b.")
+	}
+	shift := selectionB.From.Sub(selectionA.From)
+
+	eventsA, err := readCompareEvents(ctx, inputFilesA.values, selectionA)
+	if err != nil {
+		return err
+	}
+	eventsB, err := readCompareEvents(ctx, inputFilesB.values, selectionB)
+	if err != nil {
+		return err
+	}
+
+	file, err := output.Create(outputFilepath, output.ModeTruncate)
+	if err != nil {
+		return err
+	}
+	buffer := make([]byte, 0, 192)
+	written := 0
+	summary, err := compare.Compare(ctx, eventsA, eventsB, shift, time.Minute, windowSize, func(row compare.Row) error {
+		buffer = compare.AppendRecord(buffer[:0], row)
+		if _, err := file.Write(buffer); err != nil {
+			return err
+		}
+		written++
+		return nil
+	})
+
+	/* The buckets compared before stopping replace the previous comparison, like writeMovingAverage does, but the summary is not written */
+	if errors.Is(err, context.Canceled) {
+		if err := file.Commit(); err != nil {
+			return err
+		}
+		return &interruptedError{summary: fmt.Sprintf("Wrote %d buckets to %s before stopping, without a summary.", written, outputFilepath)}
+	}
+	if err != nil {
+		file.Abort()
+		return err
+	}
+	if err := file.Commit(); err != nil {
+		return err
+	}
+
+	line, err := compare.MarshalSummary(summary)
+	if err != nil {
+		return err
+	}
+	if err := output.WriteStringToFile(summaryFilepath, string(line)+"\n", output.ModeTruncate); err != nil {
+		return err
+	}
+
+	fmt.Printf("Compared %d of %d buckets of %d and %d events, with a mean difference of %.1f.\n", summary.Compared, summary.Buckets, summary.EventsA, summary.EventsB, summary.MeanDifference)
+	return nil
+}
+
+/*
+A function that reads the events of an input of a comparison and selects the ones to compare.
+*/
+func readCompareEvents(ctx context.Context, patterns []string, selection compare.Selection) ([]events.EventTranslationDelivered, error) {
+	inputFilepaths, err := movingaverage.ExpandInputFiles(patterns)
+	if err != nil {
+		return []events.EventTranslationDelivered{}, err
+	}
+
+	aggregator, err := movingaverage.New(movingaverage.WithFields(movingaverage.FieldClientName | movingaverage.FieldSourceLanguage | movingaverage.FieldTargetLanguage))
+	if err != nil {
+		return []events.EventTranslationDelivered{}, err
+	}
+	batch, err := aggregator.Read(ctx, inputFilepaths...)
+	if err != nil {
+		return []events.EventTranslationDelivered{}, interrupted(err, "No comparison was written.")
+	}
+
+	return compare.Select(batch.Events, selection)
+}
@@ -0,0 +1,85 @@
+package main
+
+import (
+	"bufio"
+	"context"
+	"errors"
+	"flag"
+	"fmt"
+	"os"
+	"strings"
+	"time"
+
+	"github.com/jmbds/unbabel-backend-engineering-challenge/pkg/kafka"
+	"github.com/jmbds/unbabel-backend-engineering-challenge/pkg/movingaverage"
+)
+
+/* A function that connects to the brokers of a Kafka cluster, replaced in tests by an in-process broker */
+var newBroker = func(addresses []string) kafka.Broker {
+	return kafka.NewKafkaBroker(addresses...)
+}
+
+/*
+A function that runs the consume subcommand, calculating the moving average of the events of a Kafka topic as a member of a consumer group.
+
+The moving average of each minute is appended to the output file, and made durable before the offsets of its events are committed,
+so after a restart or a rebalance the aggregation resumes from the last commit, appending the minutes written after it again.
+Receives the context, which stops consuming when cancelled, and the subcommand arguments.
+Returns an error, which is an interruption once consuming started.
+*/
+func runConsume(ctx context.Context, args []string) error {
+	var (
+		brokers        string
+		topic          string
+		group          string
+		member         string
+		outputFilepath string
+		windowSize     int
+		pollInterval   time.Duration
+	)
+
+	hostname, _ := os.Hostname()
+
+	flags := flag.NewFlagSet("unbabel_cli consume", flag.ExitOnError)
+	flags.StringVar(&brokers, "brokers", "localhost:9092", "comma separated addresses of the Kafka brokers")
+	flags.StringVar(&topic, "topic", "events", "topic to consume events from")
+	flags.StringVar(&group, "group", "unbabel_cli", "consumer group sharing the partitions of the topic")
+	flags.StringVar(&member, "member", hostname, "name of this member of the consumer group")
+	flags.StringVar(&outputFilepath, "output_file", "aggregated_events.out.json", "path to aggregated output file, appended to")
+	flags.IntVar(&windowSize, "window_size", 10, "size of time window for moving average")
+	flags.DurationVar(&pollInterval, "poll_interval", time.Second, "wait before fetching again from partitions without new events")
+	if err := flags.Parse(args); err != nil {
+		return err
+	}
+	if pollInterval <= 0 {
+		return errors.New("Poll interval has to be greater than 0, please provide a valid poll interval.")
+	}
+	if member == "" {
+		return errors.New("Member name is empty. Please provide --member.")
+	}
+
+	output, err := os.OpenFile(outputFilepath, os.O_WRONLY|os.O_APPEND|os.O_CREATE, 0644)
+	if err != nil {
+		return err
+	}
+	defer output.Close()
+
+	consumer := kafka.NewConsumer(newBroker(strings.Split(brokers, ",")), group, topic, member)
+	consumer.PollInterval = pollInterval
+	defer consumer.Close()
+
+	written := 0
+	writer := bufio.NewWriter(output)
+	encoder := movingaverage.NewEncoder(writer)
+	err = kafka.Aggregate(ctx, consumer, windowSize, func(point movingaverage.Point) error {
+		written++
+		return encoder.Encode(point)
+	}, func() error {
+		if err := writer.Flush(); err != nil {
+			return err
+		}
+		return output.Sync()
+	})
+
+	return interrupted(err, fmt.Sprintf("Wrote %d minutes to %s, dropping %d late events.", written, outputFilepath, consumer.Late))
+}
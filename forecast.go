@@ -0,0 +1,99 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"flag"
+	"fmt"
+	"time"
+
+	"github.com/jmbds/unbabel-backend-engineering-challenge/internal/forecast"
+	"github.com/jmbds/unbabel-backend-engineering-challenge/internal/output"
+	"github.com/jmbds/unbabel-backend-engineering-challenge/pkg/movingaverage"
+)
+
+/* Length of the season of the forecasts, as delivery times follow the hours of the day */
+const forecastSeason = 24 * time.Hour
+
+/*
+A function that runs the forecast subcommand, writing the predicted delivery time of the buckets following the events, with their prediction intervals.
+
+Receives the context and the subcommand arguments.
+Returns an error.
+*/
+func runForecast(ctx context.Context, args []string) error {
+	var (
+		inputFiles     = inputFilesFlag{values: []string{"events.json"}}
+		outputFilepath string
+		unit           time.Duration
+		horizon        time.Duration
+		confidence     float64
+	)
+
+	flags := flag.NewFlagSet("unbabel_cli forecast", flag.ExitOnError)
+	flags.Var(&inputFiles, "input_file", "path or glob pattern of input files containing events, can be repeated")
+	flags.StringVar(&outputFilepath, "output_file", "forecast.out.json", "path to forecast output file")
+	flags.DurationVar(&unit, "unit", time.Hour, "interval of each bucket, dividing a day")
+	flags.DurationVar(&horizon, "horizon", 6*time.Hour, "how far after the last event to forecast, a multiple of the unit")
+	flags.Float64Var(&confidence, "confidence", 0.95, "confidence of the prediction intervals, between 0 and 1")
+	if err := flags.Parse(args); err != nil {
+		return err
+	}
+
+	if unit < time.Minute || forecastSeason%unit != 0 {
+		return errors.New("Unit has to be a multiple of a minute dividing a day, please provide a valid unit.")
+	}
+	if horizon < unit || horizon%unit != 0 {
+		return errors.New("Horizon has to be a multiple of the unit, please provide a valid horizon.")
+	}
+
+	inputFilepaths, err := movingaverage.ExpandInputFiles(inputFiles.values)
+	if err != nil {
+		return err
+	}
+
+	aggregator, err := movingaverage.New(movingaverage.WithUnit(unit))
+	if err != nil {
+		return err
+	}
+	batch, err := aggregator.Read(ctx, inputFilepaths...)
+	if err != nil {
+		return interrupted(err, "No forecast was written.")
+	}
+
+	model, err := forecast.Fit(batch.Dataset, int(forecastSeason/unit))
+	if err != nil {
+		return err
+	}
+	predictions, err := model.Forecast(int(horizon/unit), confidence)
+	if err != nil {
+		return err
+	}
+
+	file, err := output.Create(outputFilepath, output.ModeTruncate)
+	if err != nil {
+		return err
+	}
+	buffer := make([]byte, 0, 128)
+	for written, prediction := range predictions {
+		/* The predictions written before stopping replace the previous forecast, like writeMovingAverage does */
+		if ctx.Err() != nil {
+			if err := file.Commit(); err != nil {
+				return err
+			}
+			return &interruptedError{summary: fmt.Sprintf("Wrote %d buckets to %s before stopping.", written, outputFilepath)}
+		}
+
+		buffer = forecast.AppendRecord(buffer[:0], prediction)
+		if _, err := file.Write(buffer); err != nil {
+			file.Abort()
+			return err
+		}
+	}
+	if err := file.Commit(); err != nil {
+		return err
+	}
+
+	fmt.Printf("Forecast %d buckets with alpha %.2f, beta %.2f and gamma %.2f.\n", len(predictions), model.Alpha, model.Beta, model.Gamma)
+	return nil
+}
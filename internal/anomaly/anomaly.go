@@ -0,0 +1,291 @@
+/*
+Package anomaly detects values of the moving average that deviate from their recent or seasonal baseline,
+catching regressions that stay below a fixed SLA threshold.
+*/
+package anomaly
+
+import (
+	"encoding/json"
+	"errors"
+	"math"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/jmbds/unbabel-backend-engineering-challenge/internal/events"
+	"github.com/jmbds/unbabel-backend-engineering-challenge/internal/statistics"
+)
+
+/*
+A type that selects how the baseline of a value and its deviation are calculated.
+*/
+type Method string
+
+const (
+	/* Deviation from the mean of the previous values of the window, in standard deviations */
+	MethodZScore Method = "zscore"
+	/* Deviation from the median of the previous values of the window, in median absolute deviations scaled to standard deviations */
+	MethodMAD Method = "mad"
+	/* Deviation from the mean of the values of the same hour of the week in earlier weeks, in standard deviations */
+	MethodSeasonal Method = "seasonal"
+)
+
+/* Scale of the median absolute deviation that makes it match the standard deviation of normally distributed values */
+const madScale = 1.4826
+
+/* Number of hours in a week, the number of seasonal baselines */
+const hoursPerWeek = 7 * 24
+
+/*
+A function that parses the name of a method.
+
+Receives the name, zscore, mad or seasonal.
+Returns the method and an error if the name is unknown.
+*/
+func ParseMethod(name string) (Method, error) {
+	switch method := Method(strings.ToLower(name)); method {
+	case MethodZScore, MethodMAD, MethodSeasonal:
+		return method, nil
+	}
+	return "", errors.New("Unknown anomaly method " + name + ". Please provide zscore, mad or seasonal.")
+}
+
+/*
+A struct that holds the result of observing a value.
+
+Score is the deviation of the value from its Baseline, positive above it, and 0 until there are enough previous values
+or while they don't vary, as there is nothing to deviate from.
+Anomaly is set when the absolute Score reaches the threshold of the detector.
+*/
+type Result struct {
+	Score    float64
+	Baseline float64
+	Anomaly  bool
+}
+
+/*
+A struct that holds the running mean and variance of the values of a seasonal baseline, by Welford's algorithm.
+*/
+type runningStats struct {
+	count int
+	mean  float64
+	m2    float64
+}
+
+func (s *runningStats) add(value float64) {
+	s.count++
+	delta := value - s.mean
+	s.mean += delta / float64(s.count)
+	s.m2 += delta * (value - s.mean)
+}
+
+/*
+A function that adds the values of other running stats, by the parallel variant of Welford's algorithm.
+*/
+func (s *runningStats) merge(other runningStats) {
+	if other.count == 0 {
+		return
+	}
+	count := s.count + other.count
+	delta := other.mean - s.mean
+	s.mean += delta * float64(other.count) / float64(count)
+	s.m2 += other.m2 + delta*delta*float64(s.count)*float64(other.count)/float64(count)
+	s.count = count
+}
+
+/*
+A struct that holds the seasonal baseline of an hour of the week.
+
+Past holds the values of the hour in earlier weeks, which the values are scored against,
+and current the values of the hour starting at hour, which only join past once a later week of the hour is observed,
+so values are never compared with earlier values of the same hour.
+*/
+type season struct {
+	past    runningStats
+	current runningStats
+	hour    time.Time
+}
+
+/*
+A struct that scores each value of a moving average against the values observed before it.
+
+Window is the number of previous values the zscore and mad methods compare with, and Threshold the absolute score from which a value is an anomaly.
+*/
+type Detector struct {
+	Method    Method
+	Window    int
+	Threshold float64
+
+	history []float64
+	seasons [hoursPerWeek]season
+}
+
+/*
+A function that creates a Detector.
+
+Receives the method, the window and the threshold.
+Returns the Detector and an error if the window is lower than 2 or the threshold is not positive.
+*/
+func NewDetector(method Method, window int, threshold float64) (*Detector, error) {
+	if _, err := ParseMethod(string(method)); err != nil {
+		return nil, err
+	}
+	if window < 2 {
+		return nil, errors.New("Anomaly window has to be equal or greater than 2, please provide a valid anomaly window.")
+	}
+	if threshold <= 0 {
+		return nil, errors.New("Anomaly threshold has to be greater than 0, please provide a valid anomaly threshold.")
+	}
+
+	return &Detector{Method: method, Window: window, Threshold: threshold, history: make([]float64, 0, window+1)}, nil
+}
+
+/*
+A function that scores a value against the values observed before it, and then adds it to them.
+
+Receives the moving average value and its interval, whose start selects its hour of the week for the seasonal method,
+which only scores it against the same hour of earlier weeks.
+Returns the result.
+*/
+func (d *Detector) Observe(point statistics.Point) Result {
+	var baseline, spread float64
+	enough := false
+
+	switch d.Method {
+	case MethodSeasonal:
+		season := &d.seasons[hourOfWeek(point.Start)]
+		if hour := point.Start.UTC().Truncate(time.Hour); !hour.Equal(season.hour) {
+			season.past.merge(season.current)
+			season.current = runningStats{}
+			season.hour = hour
+		}
+		if season.past.count >= 2 {
+			baseline, spread, enough = season.past.mean, math.Sqrt(season.past.m2/float64(season.past.count-1)), true
+		}
+		season.current.add(point.Value)
+	case MethodMAD:
+		if len(d.history) >= 2 {
+			baseline = median(d.history)
+			deviations := make([]float64, len(d.history))
+			for i, value := range d.history {
+				deviations[i] = math.Abs(value - baseline)
+			}
+			spread, enough = madScale*median(deviations), true
+		}
+		d.push(point.Value)
+	default:
+		if len(d.history) >= 2 {
+			baseline, spread = meanAndDeviation(d.history)
+			enough = true
+		}
+		d.push(point.Value)
+	}
+
+	result := Result{Baseline: baseline}
+	if enough && spread > 0 {
+		result.Score = (point.Value - baseline) / spread
+		result.Anomaly = math.Abs(result.Score) >= d.Threshold
+	}
+	return result
+}
+
+/*
+A function that adds a value to the window of previous values, dropping the oldest one once it is full.
+*/
+func (d *Detector) push(value float64) {
+	d.history = append(d.history, value)
+	if len(d.history) > d.Window {
+		d.history = d.history[1:]
+	}
+}
+
+/*
+A function that returns the hour of the week of a time, in UTC, counting from Sunday at midnight.
+*/
+func hourOfWeek(timestamp time.Time) int {
+	timestamp = timestamp.UTC()
+	return int(timestamp.Weekday())*24 + timestamp.Hour()
+}
+
+/*
+A function that returns the mean and sample standard deviation of values.
+*/
+func meanAndDeviation(values []float64) (float64, float64) {
+	mean := 0.0
+	for _, value := range values {
+		mean += value
+	}
+	mean /= float64(len(values))
+
+	variance := 0.0
+	for _, value := range values {
+		variance += (value - mean) * (value - mean)
+	}
+	variance /= float64(len(values) - 1)
+
+	return mean, math.Sqrt(variance)
+}
+
+/*
+A function that returns the median of values, without changing their order.
+*/
+func median(values []float64) float64 {
+	sorted := append([]float64{}, values...)
+	sort.Float64s(sorted)
+
+	middle := len(sorted) / 2
+	if len(sorted)%2 == 0 {
+		return (sorted[middle-1] + sorted[middle]) / 2
+	}
+	return sorted[middle]
+}
+
+/*
+A function that formats a moving average value as an output line annotated with its anomaly score and flag, appending it to a buffer.
+
+Receives the buffer, the moving average value, reported at the end of its interval, and its result.
+Returns the buffer with the line appended, including the trailing newline.
+*/
+func AppendRecord(buffer []byte, point statistics.Point, result Result) []byte {
+	buffer = events.AppendMovingAverageRecord(buffer, point.End, point.Value)
+
+	/* Replace the closing brace and newline of the record with the annotations */
+	buffer = buffer[:len(buffer)-2]
+	buffer = append(buffer, ", \"anomaly_score\": "...)
+	buffer = strconv.AppendFloat(buffer, roundScore(result.Score), 'f', -1, 64)
+	buffer = append(buffer, ", \"anomaly\": "...)
+	buffer = strconv.AppendBool(buffer, result.Anomaly)
+	return append(buffer, "}\n"...)
+}
+
+/*
+A function that serializes an anomaly into its JSON representation for the anomalies report.
+
+Receives the method, the moving average value, reported at the end of its interval, and its result.
+Returns the JSON line for the anomaly, without a trailing newline, and an error.
+*/
+func MarshalAnomaly(method Method, point statistics.Point, result Result) ([]byte, error) {
+	type anomalyRecord struct {
+		Date     string  `json:"date"`
+		Average  float64 `json:"average_delivery_time"`
+		Baseline float64 `json:"baseline"`
+		Score    float64 `json:"anomaly_score"`
+		Method   Method  `json:"method"`
+	}
+
+	return json.Marshal(anomalyRecord{
+		Date:     point.End.Format(events.OutputTimestampFormat),
+		Average:  point.Value,
+		Baseline: result.Baseline,
+		Score:    roundScore(result.Score),
+		Method:   method,
+	})
+}
+
+/*
+A function that rounds a score to two decimal places, which is all the precision it is meaningful to.
+*/
+func roundScore(score float64) float64 {
+	return math.Round(score*100) / 100
+}
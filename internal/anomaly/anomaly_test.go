@@ -0,0 +1,161 @@
+package anomaly_test
+
+import (
+	"errors"
+	"reflect"
+	"testing"
+	"time"
+
+	"github.com/jmbds/unbabel-backend-engineering-challenge/internal/anomaly"
+	"github.com/jmbds/unbabel-backend-engineering-challenge/internal/statistics"
+)
+
+/*
+A function that observes values of consecutive intervals of a unit, returning the flag of each.
+*/
+func observe(t *testing.T, detector *anomaly.Detector, start time.Time, unit time.Duration, values []float64) []bool {
+	flags := make([]bool, len(values))
+	for i, value := range values {
+		pointStart := start.Add(time.Duration(i) * unit)
+		flags[i] = detector.Observe(statistics.Point{Start: pointStart, End: pointStart.Add(unit), Value: value}).Anomaly
+	}
+	return flags
+}
+
+func TestDetector(t *testing.T) {
+	start := time.Date(2018, 12, 23, 0, 0, 0, 0, time.UTC)
+
+	/* Three weeks of hourly values following a daily pattern, slightly higher every other week, and a spike on the last Monday at 09:00 */
+	seasonal := make([]float64, 0, 4*7*24)
+	for week := 0; week < 4; week++ {
+		for hour := 0; hour < 7*24; hour++ {
+			value := float64(10+hour%24) + float64(week%2)
+			if week == 3 && hour == 24+9 {
+				value += 20
+			}
+			seasonal = append(seasonal, value)
+		}
+	}
+	expectedSeasonal := make([]bool, len(seasonal))
+	expectedSeasonal[3*7*24+24+9] = true
+
+	/* Three weeks of alternating values every minute, with a whole hour of higher values on the last Monday at 09:00 */
+	minutes := make([]float64, 0, 3*7*24*60)
+	expectedMinutes := make([]bool, 0, 3*7*24*60)
+	for minute := 0; minute < 3*7*24*60; minute++ {
+		shifted := minute >= (2*7*24+24+9)*60 && minute < (2*7*24+24+10)*60
+		value := float64(10 + 2*(minute%2))
+		if shifted {
+			value = 40
+		}
+		minutes = append(minutes, value)
+		expectedMinutes = append(expectedMinutes, shifted)
+	}
+
+	testcases := []struct {
+		name     string
+		method   anomaly.Method
+		window   int
+		unit     time.Duration
+		values   []float64
+		expected []bool
+	}{
+		{
+			"zscore spike",
+			anomaly.MethodZScore, 6, time.Minute,
+			[]float64{10, 12, 10, 12, 10, 12, 40},
+			[]bool{false, false, false, false, false, false, true},
+		},
+		{
+			"zscore drop",
+			anomaly.MethodZScore, 6, time.Minute,
+			[]float64{10, 12, 10, 12, 10, 12, 0},
+			[]bool{false, false, false, false, false, false, true},
+		},
+		{
+			"mad ignores the spike in its window",
+			anomaly.MethodMAD, 6, time.Minute,
+			[]float64{10, 12, 11, 10, 12, 11, 100, 11, 60},
+			[]bool{false, false, false, false, false, false, true, false, true},
+		},
+		{
+			"values without variation",
+			anomaly.MethodZScore, 6, time.Minute,
+			[]float64{20, 20, 20, 20, 20},
+			[]bool{false, false, false, false, false},
+		},
+		{
+			"seasonal baseline by hour of the week",
+			anomaly.MethodSeasonal, 2, time.Hour,
+			seasonal,
+			expectedSeasonal,
+		},
+		{
+			"seasonal baseline without earlier minutes of the same hour",
+			anomaly.MethodSeasonal, 2, time.Minute,
+			minutes,
+			expectedMinutes,
+		},
+	}
+
+	for _, tc := range testcases {
+		t.Run(tc.name, func(t *testing.T) {
+			detector, err := anomaly.NewDetector(tc.method, tc.window, 3)
+			if err != nil {
+				t.Fatal(err)
+			}
+
+			got := observe(t, detector, start, tc.unit, tc.values)
+			if !reflect.DeepEqual(got, tc.expected) {
+				t.Errorf("expected %v, got %v", tc.expected, got)
+			}
+		})
+	}
+}
+
+func TestNewDetector(t *testing.T) {
+	testcases := []struct {
+		name          string
+		method        string
+		window        int
+		threshold     float64
+		expectedError error
+	}{
+		{"valid", "ZScore", 60, 3, nil},
+		{"unknown method", "ewma", 60, 3, errors.New("Unknown anomaly method ewma. Please provide zscore, mad or seasonal.")},
+		{"window too small", "mad", 1, 3, errors.New("Anomaly window has to be equal or greater than 2, please provide a valid anomaly window.")},
+		{"threshold not positive", "seasonal", 60, 0, errors.New("Anomaly threshold has to be greater than 0, please provide a valid anomaly threshold.")},
+	}
+
+	for _, tc := range testcases {
+		t.Run(tc.name, func(t *testing.T) {
+			method, err := anomaly.ParseMethod(tc.method)
+			if err == nil {
+				_, err = anomaly.NewDetector(method, tc.window, tc.threshold)
+			}
+			if (err != nil) != (tc.expectedError != nil) || (err != nil && err.Error() != tc.expectedError.Error()) {
+				t.Errorf("expected error %v, got %v", tc.expectedError, err)
+			}
+		})
+	}
+}
+
+func TestRecords(t *testing.T) {
+	end := time.Date(2018, 12, 26, 18, 12, 0, 0, time.UTC)
+	point := statistics.Point{Start: end.Add(-time.Minute), End: end, Value: 25.5}
+	result := anomaly.Result{Score: 3.14159, Baseline: 20, Anomaly: true}
+
+	expected := `{"date": "2018-12-26 18:12:00", "average_delivery_time": 25.5, "anomaly_score": 3.14, "anomaly": true}` + "\n"
+	if got := string(anomaly.AppendRecord(nil, point, result)); got != expected {
+		t.Errorf("expected %s, got %s", expected, got)
+	}
+
+	expected = `{"date":"2018-12-26 18:12:00","average_delivery_time":25.5,"baseline":20,"anomaly_score":3.14,"method":"zscore"}`
+	got, err := anomaly.MarshalAnomaly(anomaly.MethodZScore, point, result)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if string(got) != expected {
+		t.Errorf("expected %s, got %s", expected, got)
+	}
+}
@@ -0,0 +1,85 @@
+package checkpoint
+
+import (
+	"encoding/json"
+	"errors"
+	"os"
+	"path/filepath"
+	"time"
+
+	"github.com/jmbds/unbabel-backend-engineering-challenge/internal/statistics"
+)
+
+/*
+A struct that holds the progress of an aggregation, so it can be resumed.
+
+InputOffset is the byte offset of the first input line not yet aggregated.
+OutputSize is the size of the output once every emitted bucket was written.
+Window holds the buckets in the moving window, and Pending the bucket being filled.
+LastBucket is the timestamp of the last bucket emitted, and Started is false if no event was aggregated yet.
+SeenTranslationIds and DuplicatesDropped hold the state of deduplication, when enabled.
+*/
+type State struct {
+	InputOffset int64                   `json:"input_offset"`
+	OutputSize  int64                   `json:"output_size"`
+	Window      statistics.MovingWindow `json:"window"`
+	Pending     statistics.DataPoint    `json:"pending"`
+	LastBucket  time.Time               `json:"last_bucket"`
+	Started     bool                    `json:"started"`
+
+	SeenTranslationIds map[string]time.Time `json:"seen_translation_ids,omitempty"`
+	DuplicatesDropped  int                  `json:"duplicates_dropped,omitempty"`
+}
+
+/*
+A function that writes the state to the checkpoint file.
+
+The state is written to a temporary file that then replaces the checkpoint,
+so a crash while saving leaves the previous checkpoint intact.
+Returns an error.
+*/
+func Save(path string, state State) error {
+	content, err := json.Marshal(state)
+	if err != nil {
+		return err
+	}
+
+	file, err := os.CreateTemp(filepath.Dir(path), filepath.Base(path)+".*.tmp")
+	if err != nil {
+		return err
+	}
+	defer os.Remove(file.Name())
+
+	_, err = file.Write(content)
+	if err == nil {
+		err = file.Sync()
+	}
+	if closeErr := file.Close(); err == nil {
+		err = closeErr
+	}
+	if err != nil {
+		return err
+	}
+
+	return os.Rename(file.Name(), path)
+}
+
+/*
+A function that reads the state from the checkpoint file.
+
+Returns the state and an error.
+*/
+func Load(path string) (State, error) {
+	content, err := os.ReadFile(path)
+	if err != nil {
+		return State{}, err
+	}
+
+	state := State{}
+	err = json.Unmarshal(content, &state)
+	if err != nil {
+		return State{}, errors.New("Checkpoint is invalid. Please remove it and run without --resume.")
+	}
+
+	return state, nil
+}
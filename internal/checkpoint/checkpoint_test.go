@@ -0,0 +1,76 @@
+package checkpoint_test
+
+import (
+	"errors"
+	"os"
+	"path/filepath"
+	"reflect"
+	"testing"
+	"time"
+
+	"github.com/jmbds/unbabel-backend-engineering-challenge/internal/checkpoint"
+	"github.com/jmbds/unbabel-backend-engineering-challenge/internal/statistics"
+)
+
+func TestSaveAndLoad(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "checkpoint.json")
+
+	state := checkpoint.State{
+		InputOffset: 242,
+		OutputSize:  380,
+		Window: statistics.MovingWindow{
+			Size:  3,
+			Queue: []statistics.DataPoint{{Total: 20, Count: 1}, {}, {}},
+			Data:  statistics.DataPoint{Total: 20, Count: 1},
+		},
+		Pending:    statistics.DataPoint{Total: 31, Count: 1},
+		LastBucket: time.Date(2018, 12, 26, 18, 14, 0, 0, time.UTC),
+		Started:    true,
+	}
+
+	if err := checkpoint.Save(path, state); err != nil {
+		t.Fatal(err)
+	}
+
+	got, err := checkpoint.Load(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if !reflect.DeepEqual(got, state) {
+		t.Errorf("expected %v, got %v", state, got)
+	}
+
+	entries, err := os.ReadDir(filepath.Dir(path))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(entries) != 1 {
+		t.Errorf("expected only the checkpoint file, got %d files", len(entries))
+	}
+}
+
+func TestLoad(t *testing.T) {
+	invalid := filepath.Join(t.TempDir(), "invalid.json")
+	if err := os.WriteFile(invalid, []byte("input_offset: 242"), 0644); err != nil {
+		t.Fatal(err)
+	}
+
+	testcases := []struct {
+		name          string
+		path          string
+		expectedError error
+	}{
+		{"invalid case - file not found", "testcases/not_found.json", errors.New("open testcases/not_found.json: no such file or directory")},
+		{"invalid case - invalid format", invalid, errors.New("Checkpoint is invalid. Please remove it and run without --resume.")},
+	}
+
+	for _, tc := range testcases {
+		t.Run(tc.name, func(t *testing.T) {
+			_, err := checkpoint.Load(tc.path)
+			if err == nil || err.Error() != tc.expectedError.Error() {
+				t.Errorf("expected error %v, got %v", tc.expectedError, err)
+			}
+		})
+	}
+}
@@ -0,0 +1,335 @@
+/*
+Package compare aligns the moving averages of two sets of events, like two periods or two clients, and measures their differences.
+*/
+package compare
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"math"
+	"strconv"
+	"time"
+
+	"github.com/jmbds/unbabel-backend-engineering-challenge/internal/events"
+	"github.com/jmbds/unbabel-backend-engineering-challenge/internal/statistics"
+)
+
+/*
+A struct that holds which events of an input are compared.
+
+Client, SourceLanguage and TargetLanguage are the client and language pair of the events, or an empty string for any of them.
+From and To bound the timestamps of the events, from inclusive to exclusive, and are unbounded when zero.
+*/
+type Selection struct {
+	Client         string
+	SourceLanguage string
+	TargetLanguage string
+	From           time.Time
+	To             time.Time
+}
+
+/*
+A function that selects the events of an input to compare.
+
+Receives the events and the selection.
+Returns the events selected, in the same order, and an error if a timestamp is invalid.
+*/
+func Select(transactionDeliveredEvents []events.EventTranslationDelivered, selection Selection) ([]events.EventTranslationDelivered, error) {
+	if selection.Client != "" {
+		transactionDeliveredEvents = events.FilterEventsByClient(transactionDeliveredEvents, selection.Client)
+	}
+	if selection.SourceLanguage == "" && selection.TargetLanguage == "" && selection.From.IsZero() && selection.To.IsZero() {
+		return transactionDeliveredEvents, nil
+	}
+
+	selected := make([]events.EventTranslationDelivered, 0, len(transactionDeliveredEvents))
+	for _, event := range transactionDeliveredEvents {
+		if (selection.SourceLanguage != "" && event.SourceLanguage != selection.SourceLanguage) || (selection.TargetLanguage != "" && event.TargetLanguage != selection.TargetLanguage) {
+			continue
+		}
+		if selection.From.IsZero() && selection.To.IsZero() {
+			selected = append(selected, event)
+			continue
+		}
+
+		timestamp, err := time.Parse(events.InputTimestampFormat, event.Timestamp)
+		if err != nil {
+			return []events.EventTranslationDelivered{}, errors.New("Invalid date format. Please provide dates in the following format: " + events.InputTimestampFormat + "\n")
+		}
+		if (!selection.From.IsZero() && timestamp.Before(selection.From)) || (!selection.To.IsZero() && !timestamp.Before(selection.To)) {
+			continue
+		}
+		selected = append(selected, event)
+	}
+	return selected, nil
+}
+
+/*
+A struct that holds the moving averages of both inputs for the same aligned bucket, and their differences.
+
+Difference is B minus A, which is only defined when the windows of both have events, as a window without events has no average to compare,
+and Relative the Difference over A, which is not defined either when A is 0.
+*/
+type Row struct {
+	A             statistics.Point
+	B             statistics.Point
+	Difference    float64
+	HasDifference bool
+	Relative      float64
+	HasRelative   bool
+}
+
+/*
+A struct that holds the summary statistics of a comparison.
+
+Buckets is the number of aligned buckets, and Compared the number of them with a difference, whose windows both have events.
+Means are over the buckets compared, except MeanRelativeDifference, which is over the buckets with a relative difference.
+MaxAbsoluteDifferenceDate is the date of the bucket of A with the largest absolute difference.
+*/
+type Summary struct {
+	Buckets                   int
+	Compared                  int
+	EventsA                   int
+	EventsB                   int
+	MeanA                     float64
+	MeanB                     float64
+	MeanDifference            float64
+	MeanAbsoluteDifference    float64
+	MeanRelativeDifference    float64
+	MaxAbsoluteDifference     float64
+	MaxAbsoluteDifferenceDate time.Time
+}
+
+/*
+A function that compares the moving averages of two sets of events, over the same grid of buckets.
+
+The events of B are moved back by shift, so the buckets of B are aligned with the ones of A that start shift earlier,
+like the same minute of the previous week when comparing this week with the last one.
+Both moving averages are calculated over every bucket from one before the first event of either input to the last one,
+so both windows see the same buckets, even where one of the inputs has no events.
+The events of each input have to be ordered by timestamp, like the moving average of the events.
+Receives the context, the events of A and B, the shift, the unit of the buckets, the window size and the function called with each aligned row.
+Returns the summary and an error if either input has no events or their events are not ordered.
+*/
+func Compare(ctx context.Context, a, b []events.EventTranslationDelivered, shift time.Duration, unit time.Duration, windowSize int, emit func(row Row) error) (Summary, error) {
+	if len(a) == 0 {
+		return Summary{}, errors.New("No events of A to compare. Please provide a selection of A with events.")
+	}
+	if len(b) == 0 {
+		return Summary{}, errors.New("No events of B to compare. Please provide a selection of B with events.")
+	}
+
+	b, err := shiftEvents(ctx, b, -shift)
+	if err != nil {
+		return Summary{}, err
+	}
+
+	/* The window covers the events of both inputs, so both datasets share the same buckets */
+	var windowStart, windowEnd time.Time
+	for _, input := range [][]events.EventTranslationDelivered{a, b} {
+		start, end, err := events.GetEventWindowByUnit(input, unit)
+		if err != nil {
+			return Summary{}, err
+		}
+		if windowStart.IsZero() || start.Before(windowStart) {
+			windowStart = start
+		}
+		if end.After(windowEnd) {
+			windowEnd = end
+		}
+	}
+
+	aDataset, err := events.GroupEventsInWindow(ctx, a, windowStart, windowEnd, unit)
+	if err != nil {
+		return Summary{}, err
+	}
+	bDataset, err := events.GroupEventsInWindow(ctx, b, windowStart, windowEnd, unit)
+	if err != nil {
+		return Summary{}, err
+	}
+	length := aDataset.Length
+
+	aSeries, aCounts, err := movingWindows(aDataset, windowSize)
+	if err != nil {
+		return Summary{}, err
+	}
+	bSeries, bCounts, err := movingWindows(bDataset, windowSize)
+	if err != nil {
+		return Summary{}, err
+	}
+
+	summary := Summary{Buckets: length, EventsA: len(a), EventsB: len(b)}
+	relatives := 0
+	for i := 0; i < length; i++ {
+		if err := ctx.Err(); err != nil {
+			return Summary{}, err
+		}
+
+		row := Row{A: aSeries.At(i), B: bSeries.At(i)}
+		row.B.Start, row.B.End = row.B.Start.Add(shift), row.B.End.Add(shift)
+
+		/* A window without events has no average, so there is nothing to compare it with */
+		if aCounts.At(i).Value > 0 && bCounts.At(i).Value > 0 {
+			row.Difference, row.HasDifference = row.B.Value-row.A.Value, true
+			if row.A.Value != 0 {
+				row.Relative, row.HasRelative = row.Difference/row.A.Value, true
+				summary.MeanRelativeDifference += row.Relative
+				relatives++
+			}
+
+			summary.Compared++
+			summary.MeanA += row.A.Value
+			summary.MeanB += row.B.Value
+			summary.MeanDifference += row.Difference
+			summary.MeanAbsoluteDifference += math.Abs(row.Difference)
+			if math.Abs(row.Difference) > summary.MaxAbsoluteDifference {
+				summary.MaxAbsoluteDifference = math.Abs(row.Difference)
+				summary.MaxAbsoluteDifferenceDate = row.A.End
+			}
+		}
+
+		if err := emit(row); err != nil {
+			return Summary{}, err
+		}
+	}
+
+	if summary.Compared > 0 {
+		summary.MeanA /= float64(summary.Compared)
+		summary.MeanB /= float64(summary.Compared)
+		summary.MeanDifference /= float64(summary.Compared)
+		summary.MeanAbsoluteDifference /= float64(summary.Compared)
+	}
+	if relatives > 0 {
+		summary.MeanRelativeDifference /= float64(relatives)
+	}
+
+	return summary, nil
+}
+
+/*
+A function that calculates the moving average of a dataset, along with the number of events in the window of each value.
+
+Returns the moving average, the number of events of each window, over the same intervals, and an error.
+*/
+func movingWindows(dataset statistics.SparseDataset, windowSize int) (statistics.TimeSeries, statistics.TimeSeries, error) {
+	averages := statistics.TimeSeries{Start: dataset.Start, Unit: dataset.Unit, Runs: make([]statistics.Run, 0)}
+	counts := statistics.TimeSeries{Start: dataset.Start, Unit: dataset.Unit, Runs: make([]statistics.Run, 0)}
+
+	err := statistics.IterateMovingWindowRuns(dataset, windowSize, func(run statistics.Run, data statistics.DataPoint) error {
+		averages.Append(run.Value, run.Length)
+		counts.Append(float64(data.Count), run.Length)
+		return nil
+	})
+	return averages, counts, err
+}
+
+/*
+A function that moves the timestamps of events by a duration, returning them in new events.
+*/
+func shiftEvents(ctx context.Context, transactionDeliveredEvents []events.EventTranslationDelivered, shift time.Duration) ([]events.EventTranslationDelivered, error) {
+	if shift == 0 {
+		return transactionDeliveredEvents, nil
+	}
+
+	shifted := make([]events.EventTranslationDelivered, len(transactionDeliveredEvents))
+	for i, event := range transactionDeliveredEvents {
+		if i%4096 == 0 {
+			if err := ctx.Err(); err != nil {
+				return []events.EventTranslationDelivered{}, err
+			}
+		}
+
+		timestamp, err := time.Parse(events.InputTimestampFormat, event.Timestamp)
+		if err != nil {
+			return []events.EventTranslationDelivered{}, errors.New("Invalid date format. Please provide dates in the following format: " + events.InputTimestampFormat + "\n")
+		}
+		event.Timestamp = timestamp.Add(shift).Format(events.InputTimestampFormat)
+		shifted[i] = event
+	}
+
+	return shifted, nil
+}
+
+/*
+A function that formats a row as an output line, with the dates and moving averages of both inputs and their differences, appending it to a buffer.
+
+Receives the buffer and the row, whose values are reported at the end of their intervals, and whose differences are left out when not defined.
+Returns the buffer with the line appended, including the trailing newline.
+*/
+func AppendRecord(buffer []byte, row Row) []byte {
+	buffer = append(buffer, "{\"date\": \""...)
+	buffer = row.A.End.AppendFormat(buffer, events.OutputTimestampFormat)
+	buffer = append(buffer, "\", \"date_b\": \""...)
+	buffer = row.B.End.AppendFormat(buffer, events.OutputTimestampFormat)
+	buffer = append(buffer, "\", \"average_delivery_time_a\": "...)
+	buffer = appendValue(buffer, row.A.Value)
+	buffer = append(buffer, ", \"average_delivery_time_b\": "...)
+	buffer = appendValue(buffer, row.B.Value)
+	if row.HasDifference {
+		buffer = append(buffer, ", \"difference\": "...)
+		buffer = appendValue(buffer, row.Difference)
+	}
+	if row.HasRelative {
+		buffer = append(buffer, ", \"relative_difference\": "...)
+		buffer = strconv.AppendFloat(buffer, round(row.Relative, 1000), 'f', -1, 64)
+	}
+	return append(buffer, "}\n"...)
+}
+
+/*
+A function that formats a delivery time like the moving average values, without decimal places when it is whole.
+*/
+func appendValue(buffer []byte, value float64) []byte {
+	if value == float64(int(value)) {
+		return strconv.AppendInt(buffer, int64(int(value)), 10)
+	}
+	return strconv.AppendFloat(buffer, value, 'f', 1, 64)
+}
+
+/*
+A function that rounds a value to the given fraction, like 1000 for three decimal places.
+*/
+func round(value, fraction float64) float64 {
+	return math.Round(value*fraction) / fraction
+}
+
+/*
+A function that serializes the summary of a comparison into its JSON representation.
+
+Receives the summary.
+Returns the JSON line of the summary, without a trailing newline, and an error.
+*/
+func MarshalSummary(summary Summary) ([]byte, error) {
+	type summaryRecord struct {
+		Buckets                   int     `json:"buckets"`
+		Compared                  int     `json:"compared_buckets"`
+		EventsA                   int     `json:"events_a"`
+		EventsB                   int     `json:"events_b"`
+		MeanA                     float64 `json:"mean_average_delivery_time_a"`
+		MeanB                     float64 `json:"mean_average_delivery_time_b"`
+		MeanDifference            float64 `json:"mean_difference"`
+		MeanAbsoluteDifference    float64 `json:"mean_absolute_difference"`
+		MeanRelativeDifference    float64 `json:"mean_relative_difference"`
+		MaxAbsoluteDifference     float64 `json:"max_absolute_difference"`
+		MaxAbsoluteDifferenceDate string  `json:"max_absolute_difference_date,omitempty"`
+	}
+
+	record := summaryRecord{
+		Buckets:                summary.Buckets,
+		Compared:               summary.Compared,
+		EventsA:                summary.EventsA,
+		EventsB:                summary.EventsB,
+		MeanA:                  round(summary.MeanA, 10),
+		MeanB:                  round(summary.MeanB, 10),
+		MeanDifference:         round(summary.MeanDifference, 10),
+		MeanAbsoluteDifference: round(summary.MeanAbsoluteDifference, 10),
+		MeanRelativeDifference: round(summary.MeanRelativeDifference, 1000),
+		MaxAbsoluteDifference:  round(summary.MaxAbsoluteDifference, 10),
+	}
+	if !summary.MaxAbsoluteDifferenceDate.IsZero() {
+		record.MaxAbsoluteDifferenceDate = summary.MaxAbsoluteDifferenceDate.Format(events.OutputTimestampFormat)
+	}
+
+	return json.Marshal(record)
+}
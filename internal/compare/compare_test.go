@@ -0,0 +1,194 @@
+package compare_test
+
+import (
+	"context"
+	"errors"
+	"reflect"
+	"testing"
+	"time"
+
+	"github.com/jmbds/unbabel-backend-engineering-challenge/internal/compare"
+	"github.com/jmbds/unbabel-backend-engineering-challenge/internal/events"
+	"github.com/jmbds/unbabel-backend-engineering-challenge/internal/statistics"
+)
+
+var testEvents = []events.EventTranslationDelivered{
+	{Timestamp: "2018-12-26 18:11:08.509654", SourceLanguage: "en", TargetLanguage: "fr", ClientName: "airliberty", Duration: 20},
+	{Timestamp: "2018-12-26 18:12:19.903159", SourceLanguage: "en", TargetLanguage: "fr", ClientName: "taxi-eats", Duration: 40},
+	{Timestamp: "2018-12-26 18:13:19.903159", SourceLanguage: "en", TargetLanguage: "de", ClientName: "airliberty", Duration: 30},
+}
+
+/*
+A function that moves events later by a duration, like the same events a week later.
+*/
+func shiftEvents(t *testing.T, transactionDeliveredEvents []events.EventTranslationDelivered, shift time.Duration) []events.EventTranslationDelivered {
+	shifted := make([]events.EventTranslationDelivered, len(transactionDeliveredEvents))
+	for i, event := range transactionDeliveredEvents {
+		timestamp, err := time.Parse(events.InputTimestampFormat, event.Timestamp)
+		if err != nil {
+			t.Fatal(err)
+		}
+		event.Timestamp = timestamp.Add(shift).Format(events.InputTimestampFormat)
+		shifted[i] = event
+	}
+	return shifted
+}
+
+/*
+A function that runs a comparison, returning every row emitted.
+*/
+func compareEvents(a, b []events.EventTranslationDelivered, shift time.Duration) ([]compare.Row, compare.Summary, error) {
+	rows := []compare.Row{}
+	summary, err := compare.Compare(context.Background(), a, b, shift, time.Minute, 2, func(row compare.Row) error {
+		rows = append(rows, row)
+		return nil
+	})
+	return rows, summary, err
+}
+
+func TestCompare(t *testing.T) {
+	at := func(value string) time.Time {
+		parsed, err := time.Parse(events.OutputTimestampFormat, value)
+		if err != nil {
+			t.Fatal(err)
+		}
+		return parsed
+	}
+	point := func(end string, value float64) statistics.Point {
+		return statistics.Point{Start: at(end).Add(-time.Minute), End: at(end), Value: value}
+	}
+
+	/* Each client over the same grid, from a minute before the first event of either */
+	airliberty, err := compare.Select(testEvents, compare.Selection{Client: "airliberty"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	taxiEats, err := compare.Select(testEvents, compare.Selection{Client: "taxi-eats"})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	rows, summary, err := compareEvents(airliberty, taxiEats, 0)
+	if err != nil {
+		t.Fatal(err)
+	}
+	expected := []compare.Row{
+		{A: point("2018-12-26 18:11:00", 0), B: point("2018-12-26 18:11:00", 0)},
+		{A: point("2018-12-26 18:12:00", 20), B: point("2018-12-26 18:12:00", 0)},
+		{A: point("2018-12-26 18:13:00", 20), B: point("2018-12-26 18:13:00", 40), Difference: 20, HasDifference: true, Relative: 1, HasRelative: true},
+		{A: point("2018-12-26 18:14:00", 30), B: point("2018-12-26 18:14:00", 40), Difference: 10, HasDifference: true, Relative: 1.0 / 3, HasRelative: true},
+	}
+	if !reflect.DeepEqual(rows, expected) {
+		t.Errorf("expected %v, got %v", expected, rows)
+	}
+	expectedSummary := compare.Summary{
+		Buckets: 4, Compared: 2, EventsA: 2, EventsB: 1,
+		MeanA: 25, MeanB: 40, MeanDifference: 15, MeanAbsoluteDifference: 15, MeanRelativeDifference: 2.0 / 3,
+		MaxAbsoluteDifference: 20, MaxAbsoluteDifferenceDate: at("2018-12-26 18:13:00"),
+	}
+	if !reflect.DeepEqual(summary, expectedSummary) {
+		t.Errorf("expected %v, got %v", expectedSummary, summary)
+	}
+
+	/* The same events a week later are aligned with the ones of the week before */
+	week := 7 * 24 * time.Hour
+	rows, summary, err = compareEvents(testEvents, shiftEvents(t, testEvents, week), week)
+	if err != nil {
+		t.Fatal(err)
+	}
+	for _, row := range rows {
+		if row.Difference != 0 || row.HasDifference != (row.A.Value != 0) || !row.B.End.Equal(row.A.End.Add(week)) {
+			t.Errorf("expected the same value a week later, got %v", row)
+		}
+	}
+	if summary.Buckets != 4 || summary.Compared != 3 || summary.MaxAbsoluteDifference != 0 {
+		t.Errorf("expected 3 of 4 buckets compared without differences, got %v", summary)
+	}
+
+	testcases := []struct {
+		name          string
+		a             []events.EventTranslationDelivered
+		b             []events.EventTranslationDelivered
+		expectedError error
+	}{
+		{"invalid case - no events of A", nil, testEvents, errors.New("No events of A to compare. Please provide a selection of A with events.")},
+		{"invalid case - no events of B", testEvents, []events.EventTranslationDelivered{}, errors.New("No events of B to compare. Please provide a selection of B with events.")},
+	}
+
+	for _, tc := range testcases {
+		t.Run(tc.name, func(t *testing.T) {
+			if _, _, err := compareEvents(tc.a, tc.b, 0); err == nil || err.Error() != tc.expectedError.Error() {
+				t.Errorf("expected %v, got %v", tc.expectedError, err)
+			}
+		})
+	}
+}
+
+func TestSelect(t *testing.T) {
+	from := time.Date(2018, 12, 26, 18, 12, 0, 0, time.UTC)
+	to := time.Date(2018, 12, 26, 18, 13, 19, 903159000, time.UTC)
+
+	testcases := []struct {
+		name      string
+		selection compare.Selection
+		expected  []events.EventTranslationDelivered
+	}{
+		{"everything", compare.Selection{}, testEvents},
+		{"a client", compare.Selection{Client: "airliberty"}, []events.EventTranslationDelivered{testEvents[0], testEvents[2]}},
+		{"a period", compare.Selection{From: from, To: to}, []events.EventTranslationDelivered{testEvents[1]}},
+		{"a client over a period", compare.Selection{Client: "airliberty", From: from}, []events.EventTranslationDelivered{testEvents[2]}},
+		{"a language pair", compare.Selection{SourceLanguage: "en", TargetLanguage: "fr"}, []events.EventTranslationDelivered{testEvents[0], testEvents[1]}},
+		{"a target language over a period", compare.Selection{TargetLanguage: "fr", From: from}, []events.EventTranslationDelivered{testEvents[1]}},
+	}
+
+	for _, tc := range testcases {
+		t.Run(tc.name, func(t *testing.T) {
+			got, err := compare.Select(testEvents, tc.selection)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if !reflect.DeepEqual(got, tc.expected) {
+				t.Errorf("expected %v, got %v", tc.expected, got)
+			}
+		})
+	}
+}
+
+func TestRecords(t *testing.T) {
+	end := time.Date(2018, 12, 26, 18, 14, 0, 0, time.UTC)
+	row := compare.Row{
+		A:             statistics.Point{Start: end.Add(-time.Minute), End: end, Value: 30},
+		B:             statistics.Point{Start: end.Add(-time.Minute), End: end, Value: 40.25},
+		Difference:    10.25,
+		HasDifference: true,
+		Relative:      10.25 / 30,
+		HasRelative:   true,
+	}
+
+	expected := `{"date": "2018-12-26 18:14:00", "date_b": "2018-12-26 18:14:00", "average_delivery_time_a": 30, "average_delivery_time_b": 40.2, "difference": 10.2, "relative_difference": 0.342}` + "\n"
+	if got := string(compare.AppendRecord(nil, row)); got != expected {
+		t.Errorf("expected %s, got %s", expected, got)
+	}
+
+	row.A.Value, row.Difference, row.HasRelative = 0, 40.25, false
+	expected = `{"date": "2018-12-26 18:14:00", "date_b": "2018-12-26 18:14:00", "average_delivery_time_a": 0, "average_delivery_time_b": 40.2, "difference": 40.2}` + "\n"
+	if got := string(compare.AppendRecord(nil, row)); got != expected {
+		t.Errorf("expected %s, got %s", expected, got)
+	}
+
+	row.B.Value, row.HasDifference = 0, false
+	expected = `{"date": "2018-12-26 18:14:00", "date_b": "2018-12-26 18:14:00", "average_delivery_time_a": 0, "average_delivery_time_b": 0}` + "\n"
+	if got := string(compare.AppendRecord(nil, row)); got != expected {
+		t.Errorf("expected %s, got %s", expected, got)
+	}
+
+	summary := compare.Summary{Buckets: 4, Compared: 3, EventsA: 2, EventsB: 1, MeanA: 17.5, MeanB: 20, MeanDifference: 2.5, MeanAbsoluteDifference: 12.5, MeanRelativeDifference: 1.0 / 9, MaxAbsoluteDifference: 20, MaxAbsoluteDifferenceDate: end}
+	expected = `{"buckets":4,"compared_buckets":3,"events_a":2,"events_b":1,"mean_average_delivery_time_a":17.5,"mean_average_delivery_time_b":20,"mean_difference":2.5,"mean_absolute_difference":12.5,"mean_relative_difference":0.111,"max_absolute_difference":20,"max_absolute_difference_date":"2018-12-26 18:14:00"}`
+	got, err := compare.MarshalSummary(summary)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if string(got) != expected {
+		t.Errorf("expected %s, got %s", expected, got)
+	}
+}
@@ -0,0 +1,487 @@
+package events
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"os"
+	"time"
+)
+
+/*
+A set of fields of EventTranslationDelivered, used to select which fields are decoded.
+*/
+type Field uint8
+
+const (
+	FieldTimestamp Field = 1 << iota
+	FieldTranslationId
+	FieldSourceLanguage
+	FieldTargetLanguage
+	FieldClientName
+	FieldEventName
+	FieldDuration
+	FieldNrWords
+
+	/* The fields required to calculate the moving average */
+	DefaultFields = FieldTimestamp | FieldDuration
+	AllFields     = FieldTimestamp | FieldTranslationId | FieldSourceLanguage | FieldTargetLanguage | FieldClientName | FieldEventName | FieldDuration | FieldNrWords
+)
+
+var (
+	errInvalidContent = errors.New("Content is invalid. Please provide a valid events file.")
+	errInvalidDate    = errors.New("Invalid date format. Please provide dates in the following format: " + InputTimestampFormat + "\n")
+)
+
+/* Number of lines or events processed between checks for cancellation */
+const cancelCheckInterval = 4096
+
+/*
+A function that returns the error of a cancelled context, only checking it once every cancelCheckInterval iterations.
+*/
+func checkCancelled(ctx context.Context, iteration int) error {
+	if iteration%cancelCheckInterval != 0 {
+		return nil
+	}
+	return ctx.Err()
+}
+
+/*
+A struct that holds the fields of an event as they appear in the input line.
+
+String fields point into the decoded line, so they are only valid until the line is overwritten.
+Fields that were not selected for decoding are left empty.
+*/
+type RawEvent struct {
+	Timestamp      []byte
+	TranslationId  []byte
+	SourceLanguage []byte
+	TargetLanguage []byte
+	ClientName     []byte
+	EventName      []byte
+	Duration       int
+	NrWords        int
+}
+
+/*
+A function that returns the timestamp of the event, parsed without allocating.
+
+Returns the timestamp and an error if it isn't in InputTimestampFormat.
+*/
+func (e *RawEvent) Time() (time.Time, error) {
+	/* Layout: 2006-01-02 15:04:05.000000 */
+	t := e.Timestamp
+	if len(t) != len(InputTimestampFormat) || t[4] != '-' || t[7] != '-' || t[10] != ' ' || t[13] != ':' || t[16] != ':' || t[19] != '.' {
+		return time.Time{}, errInvalidDate
+	}
+
+	year, ok1 := parseDigits(t[0:4])
+	month, ok2 := parseDigits(t[5:7])
+	day, ok3 := parseDigits(t[8:10])
+	hour, ok4 := parseDigits(t[11:13])
+	minute, ok5 := parseDigits(t[14:16])
+	second, ok6 := parseDigits(t[17:19])
+	microsecond, ok7 := parseDigits(t[20:26])
+	if !(ok1 && ok2 && ok3 && ok4 && ok5 && ok6 && ok7) {
+		return time.Time{}, errInvalidDate
+	}
+
+	/* Reject dates time.Parse would reject, instead of normalizing them */
+	daysInMonth := time.Date(year, time.Month(month)+1, 0, 0, 0, 0, 0, time.UTC).Day()
+	if month < 1 || month > 12 || day < 1 || day > daysInMonth || hour > 23 || minute > 59 || second > 59 {
+		return time.Time{}, errInvalidDate
+	}
+
+	return time.Date(year, time.Month(month), day, hour, minute, second, microsecond*1000, time.UTC), nil
+}
+
+/*
+A function that converts the raw event into an EventTranslationDelivered.
+*/
+func (e *RawEvent) Event() EventTranslationDelivered {
+	return EventTranslationDelivered{
+		Timestamp:      string(e.Timestamp),
+		TranslationId:  string(e.TranslationId),
+		SourceLanguage: string(e.SourceLanguage),
+		TargetLanguage: string(e.TargetLanguage),
+		ClientName:     string(e.ClientName),
+		EventName:      string(e.EventName),
+		Duration:       e.Duration,
+		NrWords:        e.NrWords,
+	}
+}
+
+/*
+A function that decodes a line into a RawEvent, reading only the selected fields.
+
+Unlike json.Unmarshal, it doesn't use reflection nor allocate, except for string values with escape sequences, which are decoded by encoding/json.
+Values of fields that were not selected are skipped, and only validated as far as needed to find where they end.
+Returns an error if the line is not a valid event.
+*/
+func DecodeRawEvent(line []byte, fields Field, event *RawEvent) error {
+	*event = RawEvent{}
+	d := decoder{data: line}
+
+	d.skipSpace()
+	if !d.consume('{') {
+		return errInvalidContent
+	}
+	d.skipSpace()
+	if d.consume('}') {
+		return d.end()
+	}
+
+	for {
+		d.skipSpace()
+		key, escaped, ok := d.readString()
+		if !ok {
+			return errInvalidContent
+		}
+		if escaped {
+			return decodeRawEventFallback(line, fields, event)
+		}
+
+		d.skipSpace()
+		if !d.consume(':') {
+			return errInvalidContent
+		}
+		d.skipSpace()
+
+		field := fieldForKey(key)
+		if field&fields == 0 {
+			if !d.skipValue() {
+				return errInvalidContent
+			}
+		} else if d.consumeLiteral("null") {
+			/* Like json.Unmarshal, null leaves the field untouched */
+		} else if field == FieldDuration || field == FieldNrWords {
+			value, ok := d.readInt()
+			if !ok {
+				return errInvalidContent
+			}
+			if field == FieldDuration {
+				event.Duration = value
+			} else {
+				event.NrWords = value
+			}
+		} else {
+			value, escaped, ok := d.readString()
+			if !ok {
+				return errInvalidContent
+			}
+			if escaped {
+				return decodeRawEventFallback(line, fields, event)
+			}
+			*event.stringField(field) = value
+		}
+
+		d.skipSpace()
+		if d.consume(',') {
+			continue
+		}
+		if d.consume('}') {
+			return d.end()
+		}
+		return errInvalidContent
+	}
+}
+
+/*
+A function that decodes a line with encoding/json, for the lines the fast path doesn't handle.
+*/
+func decodeRawEventFallback(line []byte, fields Field, event *RawEvent) error {
+	decoded := EventTranslationDelivered{}
+	if err := json.Unmarshal(line, &decoded); err != nil {
+		return errInvalidContent
+	}
+
+	*event = RawEvent{}
+	for _, field := range []Field{FieldTimestamp, FieldTranslationId, FieldSourceLanguage, FieldTargetLanguage, FieldClientName, FieldEventName} {
+		if field&fields != 0 {
+			*event.stringField(field) = []byte(*decoded.stringField(field))
+		}
+	}
+	if fields&FieldDuration != 0 {
+		event.Duration = decoded.Duration
+	}
+	if fields&FieldNrWords != 0 {
+		event.NrWords = decoded.NrWords
+	}
+
+	return nil
+}
+
+/*
+A function that reads a file and decodes its contents, line by line, reading only the selected fields.
+
+Receives the context, checked while reading, a path to a file containing the list of events and the fields to read.
+Returns a list of events, where fields that were not selected are empty, and an error.
+*/
+func ReadEventsFile(ctx context.Context, filepath string, fields Field) ([]EventTranslationDelivered, error) {
+	file, err := os.Open(filepath)
+	if err != nil {
+		return []EventTranslationDelivered{}, err
+	}
+	defer file.Close()
+
+	return ReadEventsSource(ctx, NewFileSource(file), fields)
+}
+
+/*
+A function that returns the string field of the raw event that corresponds to the given field.
+*/
+func (e *RawEvent) stringField(field Field) *[]byte {
+	switch field {
+	case FieldTimestamp:
+		return &e.Timestamp
+	case FieldTranslationId:
+		return &e.TranslationId
+	case FieldSourceLanguage:
+		return &e.SourceLanguage
+	case FieldTargetLanguage:
+		return &e.TargetLanguage
+	case FieldClientName:
+		return &e.ClientName
+	default:
+		return &e.EventName
+	}
+}
+
+/*
+A function that returns the string field of the event that corresponds to the given field.
+*/
+func (e *EventTranslationDelivered) stringField(field Field) *string {
+	switch field {
+	case FieldTimestamp:
+		return &e.Timestamp
+	case FieldTranslationId:
+		return &e.TranslationId
+	case FieldSourceLanguage:
+		return &e.SourceLanguage
+	case FieldTargetLanguage:
+		return &e.TargetLanguage
+	case FieldClientName:
+		return &e.ClientName
+	default:
+		return &e.EventName
+	}
+}
+
+/*
+A function that returns the field matching a JSON key, ignoring case like json.Unmarshal does, or 0 for unknown keys.
+*/
+func fieldForKey(key []byte) Field {
+	switch {
+	case equalFold(key, "timestamp"):
+		return FieldTimestamp
+	case equalFold(key, "translation_id"):
+		return FieldTranslationId
+	case equalFold(key, "source_language"):
+		return FieldSourceLanguage
+	case equalFold(key, "target_language"):
+		return FieldTargetLanguage
+	case equalFold(key, "client_name"):
+		return FieldClientName
+	case equalFold(key, "event_name"):
+		return FieldEventName
+	case equalFold(key, "duration"):
+		return FieldDuration
+	case equalFold(key, "nr_words"):
+		return FieldNrWords
+	}
+	return 0
+}
+
+/*
+A function that compares an ASCII key with a lowercase name, ignoring case.
+*/
+func equalFold(key []byte, name string) bool {
+	if len(key) != len(name) {
+		return false
+	}
+	for i := range key {
+		c := key[i]
+		if 'A' <= c && c <= 'Z' {
+			c += 'a' - 'A'
+		}
+		if c != name[i] {
+			return false
+		}
+	}
+	return true
+}
+
+/*
+A function that parses a fixed number of decimal digits.
+*/
+func parseDigits(digits []byte) (int, bool) {
+	value := 0
+	for _, c := range digits {
+		if c < '0' || c > '9' {
+			return 0, false
+		}
+		value = value*10 + int(c-'0')
+	}
+	return value, true
+}
+
+/*
+A struct that walks through a JSON line.
+*/
+type decoder struct {
+	data []byte
+	pos  int
+}
+
+func (d *decoder) skipSpace() {
+	for d.pos < len(d.data) {
+		switch d.data[d.pos] {
+		case ' ', '\t', '\r', '\n':
+			d.pos++
+		default:
+			return
+		}
+	}
+}
+
+func (d *decoder) consume(c byte) bool {
+	if d.pos < len(d.data) && d.data[d.pos] == c {
+		d.pos++
+		return true
+	}
+	return false
+}
+
+func (d *decoder) consumeLiteral(literal string) bool {
+	if len(d.data)-d.pos < len(literal) || string(d.data[d.pos:d.pos+len(literal)]) != literal {
+		return false
+	}
+	d.pos += len(literal)
+	return true
+}
+
+/*
+A function that checks nothing but whitespace follows the event.
+*/
+func (d *decoder) end() error {
+	d.skipSpace()
+	if d.pos != len(d.data) {
+		return errInvalidContent
+	}
+	return nil
+}
+
+/*
+A function that reads a string, returning its contents without quotes and whether it contains escape sequences.
+*/
+func (d *decoder) readString() ([]byte, bool, bool) {
+	if !d.consume('"') {
+		return nil, false, false
+	}
+
+	start, escaped := d.pos, false
+	for d.pos < len(d.data) {
+		c := d.data[d.pos]
+		switch {
+		case c == '"':
+			d.pos++
+			return d.data[start : d.pos-1], escaped, true
+		case c == '\\':
+			escaped = true
+			d.pos += 2
+		case c < 0x20:
+			return nil, false, false
+		default:
+			d.pos++
+		}
+	}
+	return nil, false, false
+}
+
+/*
+A function that reads an integer, failing on fractions and exponents like json.Unmarshal does for int fields.
+*/
+func (d *decoder) readInt() (int, bool) {
+	negative := d.consume('-')
+
+	start, value := d.pos, 0
+	for d.pos < len(d.data) && '0' <= d.data[d.pos] && d.data[d.pos] <= '9' {
+		digit := int(d.data[d.pos] - '0')
+		if value > (maxInt-digit)/10 {
+			return 0, false
+		}
+		value = value*10 + digit
+		d.pos++
+	}
+
+	/* No digits, leading zeros, fractions or exponents */
+	if d.pos == start || (d.data[start] == '0' && d.pos-start > 1) {
+		return 0, false
+	}
+	if d.pos < len(d.data) && (d.data[d.pos] == '.' || d.data[d.pos] == 'e' || d.data[d.pos] == 'E') {
+		return 0, false
+	}
+
+	if negative {
+		return -value, true
+	}
+	return value, true
+}
+
+const maxInt = int(^uint(0) >> 1)
+
+/*
+A function that skips a value of any type.
+*/
+func (d *decoder) skipValue() bool {
+	if d.pos >= len(d.data) {
+		return false
+	}
+
+	switch c := d.data[d.pos]; {
+	case c == '"':
+		_, _, ok := d.readString()
+		return ok
+	case c == '{' || c == '[':
+		return d.skipNested()
+	case d.consumeLiteral("true"), d.consumeLiteral("false"), d.consumeLiteral("null"):
+		return true
+	case c == '-' || ('0' <= c && c <= '9'):
+		start := d.pos
+		for d.pos < len(d.data) && isNumberByte(d.data[d.pos]) {
+			d.pos++
+		}
+		return d.pos > start
+	}
+	return false
+}
+
+/*
+A function that skips an object or an array, including any nested ones.
+*/
+func (d *decoder) skipNested() bool {
+	depth := 0
+	for d.pos < len(d.data) {
+		switch d.data[d.pos] {
+		case '"':
+			if _, _, ok := d.readString(); !ok {
+				return false
+			}
+			continue
+		case '{', '[':
+			depth++
+		case '}', ']':
+			depth--
+			if depth == 0 {
+				d.pos++
+				return true
+			}
+		}
+		d.pos++
+	}
+	return false
+}
+
+func isNumberByte(c byte) bool {
+	return ('0' <= c && c <= '9') || c == '-' || c == '+' || c == '.' || c == 'e' || c == 'E'
+}
@@ -0,0 +1,268 @@
+package events_test
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"os"
+	"reflect"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/jmbds/unbabel-backend-engineering-challenge/internal/events"
+)
+
+const eventLine = "{\"timestamp\": \"2018-12-26 18:11:08.509654\",\"translation_id\": \"5aa5b2f39f7254a75aa5\",\"source_language\": \"en\",\"target_language\": \"fr\",\"client_name\": \"airliberty\",\"event_name\": \"translation_delivered\",\"nr_words\": 30, \"duration\": 20}"
+
+func TestDecodeRawEvent(t *testing.T) {
+	testcases := []struct {
+		name          string
+		line          string
+		fields        events.Field
+		expected      events.EventTranslationDelivered
+		expectedError error
+	}{
+		{
+			"valid case - all fields",
+			eventLine,
+			events.AllFields,
+			events.EventTranslationDelivered{Timestamp: "2018-12-26 18:11:08.509654", TranslationId: "5aa5b2f39f7254a75aa5", SourceLanguage: "en", TargetLanguage: "fr", ClientName: "airliberty", EventName: "translation_delivered", Duration: 20, NrWords: 30},
+			errors.New(""),
+		},
+		{
+			"valid case - default fields",
+			eventLine,
+			events.DefaultFields,
+			events.EventTranslationDelivered{Timestamp: "2018-12-26 18:11:08.509654", Duration: 20},
+			errors.New(""),
+		},
+		{
+			"valid case - unknown fields and case insensitive keys",
+			"{\"meta\": {\"tags\": [\"a\", \"}\"], \"ok\": true}, \"Duration\": -3, \"extra\": null, \"TIMESTAMP\": \"2018-12-26 18:11:08.509654\", \"score\": 1.5e3}",
+			events.DefaultFields,
+			events.EventTranslationDelivered{Timestamp: "2018-12-26 18:11:08.509654", Duration: -3},
+			errors.New(""),
+		},
+		{
+			"valid case - escaped strings",
+			"{\"timestamp\": \"2018-12-26 18:11:08.509654\", \"client_name\": \"air\\\"liberty\\u00e9\", \"duration\": 20}",
+			events.DefaultFields | events.FieldClientName,
+			events.EventTranslationDelivered{Timestamp: "2018-12-26 18:11:08.509654", ClientName: "air\"libertyé", Duration: 20},
+			errors.New(""),
+		},
+		{
+			"valid case - null values",
+			"{\"timestamp\": null, \"duration\": null}",
+			events.DefaultFields,
+			events.EventTranslationDelivered{},
+			errors.New(""),
+		},
+		{
+			"invalid case - not an object",
+			"No events in this file. :)",
+			events.DefaultFields,
+			events.EventTranslationDelivered{},
+			errors.New("Content is invalid. Please provide a valid events file."),
+		},
+		{
+			"invalid case - fractional duration",
+			"{\"timestamp\": \"2018-12-26 18:11:08.509654\", \"duration\": 20.5}",
+			events.DefaultFields,
+			events.EventTranslationDelivered{},
+			errors.New("Content is invalid. Please provide a valid events file."),
+		},
+		{
+			"invalid case - string duration",
+			"{\"timestamp\": \"2018-12-26 18:11:08.509654\", \"duration\": \"20\"}",
+			events.DefaultFields,
+			events.EventTranslationDelivered{},
+			errors.New("Content is invalid. Please provide a valid events file."),
+		},
+		{
+			"invalid case - trailing content",
+			"{\"timestamp\": \"2018-12-26 18:11:08.509654\", \"duration\": 20} {}",
+			events.DefaultFields,
+			events.EventTranslationDelivered{},
+			errors.New("Content is invalid. Please provide a valid events file."),
+		},
+		{
+			"invalid case - unterminated string",
+			"{\"timestamp\": \"2018-12-26 18:11:08.509654, \"duration\": 20}",
+			events.DefaultFields,
+			events.EventTranslationDelivered{},
+			errors.New("Content is invalid. Please provide a valid events file."),
+		},
+	}
+
+	for _, tc := range testcases {
+		t.Run(tc.name, func(t *testing.T) {
+			raw := events.RawEvent{}
+			err := events.DecodeRawEvent([]byte(tc.line), tc.fields, &raw)
+			if err != nil && err.Error() != tc.expectedError.Error() {
+				t.Errorf("Unexpected error: %s", err.Error())
+			}
+			if err == nil && tc.expectedError.Error() != "" {
+				t.Errorf("expected error %v", tc.expectedError)
+			}
+
+			if got := raw.Event(); err == nil && !reflect.DeepEqual(got, tc.expected) {
+				t.Errorf("expected %v, got %v", tc.expected, got)
+			}
+		})
+	}
+}
+
+func TestRawEventTime(t *testing.T) {
+	testcases := []struct {
+		name          string
+		timestamp     string
+		expected      time.Time
+		expectedError error
+	}{
+		{"valid case", "2018-12-26 18:11:08.509654", time.Date(2018, 12, 26, 18, 11, 8, 509654000, time.UTC), errors.New("")},
+		{"valid case - leap day", "2020-02-29 00:00:00.000000", time.Date(2020, 2, 29, 0, 0, 0, 0, time.UTC), errors.New("")},
+		{"invalid case - wrong format", "26-12-2018 18:11:08.509654", time.Time{}, errors.New("Invalid date format. Please provide dates in the following format: " + InputTimestampFormat + "\n")},
+		{"invalid case - missing fraction", "2018-12-26 18:11:08", time.Time{}, errors.New("Invalid date format. Please provide dates in the following format: " + InputTimestampFormat + "\n")},
+		{"invalid case - day out of range", "2019-02-29 18:11:08.509654", time.Time{}, errors.New("Invalid date format. Please provide dates in the following format: " + InputTimestampFormat + "\n")},
+		{"invalid case - hour out of range", "2018-12-26 24:11:08.509654", time.Time{}, errors.New("Invalid date format. Please provide dates in the following format: " + InputTimestampFormat + "\n")},
+	}
+
+	for _, tc := range testcases {
+		t.Run(tc.name, func(t *testing.T) {
+			raw := events.RawEvent{Timestamp: []byte(tc.timestamp)}
+			got, err := raw.Time()
+			if err != nil && err.Error() != tc.expectedError.Error() {
+				t.Errorf("Unexpected error: %s", err.Error())
+			}
+
+			/* The fast path has to agree with time.Parse */
+			parsed, parseErr := time.Parse(InputTimestampFormat, tc.timestamp)
+			if (err == nil) != (parseErr == nil) || !got.Equal(parsed) && err == nil {
+				t.Errorf("expected %v (%v), got %v (%v)", parsed, parseErr, got, err)
+			}
+
+			if !got.Equal(tc.expected) {
+				t.Errorf("expected %v, got %v", tc.expected, got)
+			}
+		})
+	}
+}
+
+func TestDecodeRawEventAllocations(t *testing.T) {
+	line := []byte(eventLine)
+	raw := events.RawEvent{}
+
+	allocations := testing.AllocsPerRun(100, func() {
+		if err := events.DecodeRawEvent(line, events.DefaultFields, &raw); err != nil {
+			t.Fatal(err)
+		}
+		if _, err := raw.Time(); err != nil {
+			t.Fatal(err)
+		}
+	})
+
+	if allocations != 0 {
+		t.Errorf("expected no allocations, got %.1f", allocations)
+	}
+}
+
+func TestReadEventsFile(t *testing.T) {
+	for _, filepath := range []string{"testcases/events.json", writeEventsFile(t, 1000)} {
+		expected, err := unmarshalEventsFile(filepath)
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		got, err := events.ReadEventsFile(context.Background(), filepath, events.AllFields)
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		if !reflect.DeepEqual(got, expected) {
+			t.Errorf("expected %v, got %v", expected, got)
+		}
+	}
+
+	if _, err := events.ReadEventsFile(context.Background(), "testcases/invalid_events.json", events.AllFields); err == nil || err.Error() != "Content is invalid. Please provide a valid events file." {
+		t.Errorf("Unexpected error: %v", err)
+	}
+}
+
+/*
+A function that reads an events file with encoding/json, as a reference for the decoder.
+*/
+func unmarshalEventsFile(filepath string) ([]events.EventTranslationDelivered, error) {
+	content, err := os.ReadFile(filepath)
+	if err != nil {
+		return nil, err
+	}
+
+	transactionDeliveredEvents := make([]events.EventTranslationDelivered, 0)
+	for _, line := range strings.Split(strings.TrimSpace(string(content)), "\n") {
+		event := events.EventTranslationDelivered{}
+		if err := json.Unmarshal([]byte(line), &event); err != nil {
+			return nil, err
+		}
+		transactionDeliveredEvents = append(transactionDeliveredEvents, event)
+	}
+	return transactionDeliveredEvents, nil
+}
+
+func BenchmarkDecodeRawEvent(b *testing.B) {
+	line := []byte(eventLine)
+	raw := events.RawEvent{}
+	b.ReportAllocs()
+	b.SetBytes(int64(len(line)))
+
+	for i := 0; i < b.N; i++ {
+		if err := events.DecodeRawEvent(line, events.DefaultFields, &raw); err != nil {
+			b.Fatal(err)
+		}
+	}
+}
+
+func BenchmarkJSONUnmarshal(b *testing.B) {
+	line := []byte(eventLine)
+	b.ReportAllocs()
+	b.SetBytes(int64(len(line)))
+
+	for i := 0; i < b.N; i++ {
+		event := events.EventTranslationDelivered{}
+		if err := json.Unmarshal(line, &event); err != nil {
+			b.Fatal(err)
+		}
+	}
+}
+
+func BenchmarkReadEventsFile(b *testing.B) {
+	filepath := writeEventsFile(b, 100000)
+	b.ReportAllocs()
+
+	for i := 0; i < b.N; i++ {
+		if _, err := events.ReadEventsFile(context.Background(), filepath, events.DefaultFields); err != nil {
+			b.Fatal(err)
+		}
+	}
+}
+
+func TestReadCancelled(t *testing.T) {
+	ctx, cancel := context.WithCancel(context.Background())
+	cancel()
+
+	if _, err := events.ReadEventsFile(ctx, "testcases/events.json", events.AllFields); !errors.Is(err, context.Canceled) {
+		t.Errorf("expected %v, got %v", context.Canceled, err)
+	}
+	if _, err := events.MergeEventsFiles(ctx, []string{"testcases/rotated/events-1.json", "testcases/rotated/events-2.json"}, events.AllFields); !errors.Is(err, context.Canceled) {
+		t.Errorf("expected %v, got %v", context.Canceled, err)
+	}
+	if _, _, err := events.ReadAndGroupEventsFile(ctx, "testcases/events.json", time.Minute, 2, events.AllFields); !errors.Is(err, context.Canceled) {
+		t.Errorf("expected %v, got %v", context.Canceled, err)
+	}
+	if _, err := events.NewRegistry().ReadEventsFiles(ctx, []string{"testcases/requested_events.json"}); !errors.Is(err, context.Canceled) {
+		t.Errorf("expected %v, got %v", context.Canceled, err)
+	}
+	if _, err := events.GroupEventsByUnit(ctx, []events.EventTranslationDelivered{{Timestamp: "2018-12-26 18:11:08.509654", Duration: 20}}, time.Minute); !errors.Is(err, context.Canceled) {
+		t.Errorf("expected %v, got %v", context.Canceled, err)
+	}
+}
@@ -0,0 +1,140 @@
+package events
+
+import (
+	"errors"
+	"sort"
+	"time"
+)
+
+/* The keys events can be deduplicated by */
+const DedupeKeyTranslationId = "translation_id"
+
+/*
+A function that validates a deduplication key.
+
+Returns an error if the key is not empty nor a supported key.
+*/
+func ValidateDedupeKey(key string) error {
+	if key != "" && key != DedupeKeyTranslationId {
+		return errors.New("Invalid deduplication key " + key + ". Please provide " + DedupeKeyTranslationId + ".")
+	}
+	return nil
+}
+
+/*
+A function that removes events with a TranslationId that was already seen, keeping the first occurrence.
+Events without a TranslationId can't be told apart, so they are all kept.
+Receives a list of events.
+
+Returns the list of events without duplicates, in the same order, and the number of duplicates dropped.
+*/
+func DeduplicateEvents(events []EventTranslationDelivered) ([]EventTranslationDelivered, int) {
+	seen := make(map[string]bool, len(events))
+	deduplicated := make([]EventTranslationDelivered, 0, len(events))
+
+	for _, event := range events {
+		if event.TranslationId == "" {
+			deduplicated = append(deduplicated, event)
+			continue
+		}
+		if seen[event.TranslationId] {
+			continue
+		}
+		seen[event.TranslationId] = true
+		deduplicated = append(deduplicated, event)
+	}
+
+	return deduplicated, len(events) - len(deduplicated)
+}
+
+/*
+A struct that drops duplicate events while they are read, keeping its memory bounded.
+
+A TranslationId is only remembered for Retention after the event it was seen on, so duplicates further apart are not detected.
+Dropped is the number of duplicates found so far.
+*/
+type Deduplicator struct {
+	Retention time.Duration
+	Dropped   int
+
+	seen  map[string]time.Time
+	queue []seenTranslation
+}
+
+/*
+A struct that holds a TranslationId and when it was seen, kept in the order they were seen so they can be forgotten.
+*/
+type seenTranslation struct {
+	translationId string
+	timestamp     time.Time
+}
+
+/*
+A function that creates a Deduplicator.
+
+Receives how long each TranslationId is remembered for.
+Returns the Deduplicator.
+*/
+func NewDeduplicator(retention time.Duration) *Deduplicator {
+	return &Deduplicator{Retention: retention, seen: make(map[string]time.Time)}
+}
+
+/*
+A function that checks if an event is a duplicate of one seen within the retention.
+
+Events are expected in timestamp order, and TranslationIds seen more than Retention before the event are forgotten.
+Events without a TranslationId are never duplicates, as they can't be told apart.
+Returns true if the event is a duplicate, and an error if its timestamp is invalid.
+*/
+func (d *Deduplicator) Duplicate(event EventTranslationDelivered) (bool, error) {
+	timestamp, err := time.Parse(InputTimestampFormat, event.Timestamp)
+	if err != nil {
+		return false, errors.New("Invalid date format. Please provide dates in the following format: " + InputTimestampFormat + "\n")
+	}
+
+	/* Forget the TranslationIds that left the retention */
+	expired := 0
+	for expired < len(d.queue) && timestamp.Sub(d.queue[expired].timestamp) > d.Retention {
+		delete(d.seen, d.queue[expired].translationId)
+		expired++
+	}
+	d.queue = d.queue[expired:]
+
+	if event.TranslationId == "" {
+		return false, nil
+	}
+	if _, found := d.seen[event.TranslationId]; found {
+		d.Dropped++
+		return true, nil
+	}
+
+	d.seen[event.TranslationId] = timestamp
+	d.queue = append(d.queue, seenTranslation{translationId: event.TranslationId, timestamp: timestamp})
+	return false, nil
+}
+
+/*
+A function that returns the TranslationIds currently remembered and when they were seen, to be saved in a checkpoint.
+*/
+func (d *Deduplicator) Seen() map[string]time.Time {
+	seen := make(map[string]time.Time, len(d.seen))
+	for translationId, timestamp := range d.seen {
+		seen[translationId] = timestamp
+	}
+	return seen
+}
+
+/*
+A function that restores the TranslationIds remembered from a checkpoint, along with the number of duplicates dropped.
+*/
+func (d *Deduplicator) Restore(seen map[string]time.Time, dropped int) {
+	d.seen = make(map[string]time.Time, len(seen))
+	d.queue = make([]seenTranslation, 0, len(seen))
+	for translationId, timestamp := range seen {
+		d.seen[translationId] = timestamp
+		d.queue = append(d.queue, seenTranslation{translationId: translationId, timestamp: timestamp})
+	}
+
+	sort.Slice(d.queue, func(i, j int) bool { return d.queue[i].timestamp.Before(d.queue[j].timestamp) })
+	d.Dropped = dropped
+}
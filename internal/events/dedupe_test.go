@@ -0,0 +1,165 @@
+package events_test
+
+import (
+	"errors"
+	"reflect"
+	"testing"
+	"time"
+
+	"github.com/jmbds/unbabel-backend-engineering-challenge/internal/events"
+)
+
+func TestDeduplicateEvents(t *testing.T) {
+	testcases := []struct {
+		name               string
+		events             []events.EventTranslationDelivered
+		expected           []events.EventTranslationDelivered
+		expectedDuplicates int
+	}{
+		{
+			"no duplicates",
+			[]events.EventTranslationDelivered{
+				{Timestamp: "2018-12-26 18:11:08.509654", TranslationId: "5aa5b2f39f7254a75aa5", Duration: 20},
+				{Timestamp: "2018-12-26 18:15:19.903159", TranslationId: "5aa5b2f39f7254a75aa4", Duration: 31},
+			},
+			[]events.EventTranslationDelivered{
+				{Timestamp: "2018-12-26 18:11:08.509654", TranslationId: "5aa5b2f39f7254a75aa5", Duration: 20},
+				{Timestamp: "2018-12-26 18:15:19.903159", TranslationId: "5aa5b2f39f7254a75aa4", Duration: 31},
+			},
+			0,
+		},
+		{
+			"duplicates",
+			[]events.EventTranslationDelivered{
+				{Timestamp: "2018-12-26 18:11:08.509654", TranslationId: "5aa5b2f39f7254a75aa5", Duration: 20},
+				{Timestamp: "2018-12-26 18:11:09.509654", TranslationId: "5aa5b2f39f7254a75aa5", Duration: 20},
+				{Timestamp: "2018-12-26 18:15:19.903159", TranslationId: "5aa5b2f39f7254a75aa4", Duration: 31},
+				{Timestamp: "2018-12-27 18:15:19.903159", TranslationId: "5aa5b2f39f7254a75aa5", Duration: 20},
+			},
+			[]events.EventTranslationDelivered{
+				{Timestamp: "2018-12-26 18:11:08.509654", TranslationId: "5aa5b2f39f7254a75aa5", Duration: 20},
+				{Timestamp: "2018-12-26 18:15:19.903159", TranslationId: "5aa5b2f39f7254a75aa4", Duration: 31},
+			},
+			2,
+		},
+		{
+			"events without a translation_id",
+			[]events.EventTranslationDelivered{
+				{Timestamp: "2018-12-26 18:11:08.509654", Duration: 20},
+				{Timestamp: "2018-12-26 18:11:09.509654", Duration: 31},
+				{Timestamp: "2018-12-26 18:15:19.903159", TranslationId: "5aa5b2f39f7254a75aa4", Duration: 54},
+			},
+			[]events.EventTranslationDelivered{
+				{Timestamp: "2018-12-26 18:11:08.509654", Duration: 20},
+				{Timestamp: "2018-12-26 18:11:09.509654", Duration: 31},
+				{Timestamp: "2018-12-26 18:15:19.903159", TranslationId: "5aa5b2f39f7254a75aa4", Duration: 54},
+			},
+			0,
+		},
+	}
+
+	for _, tc := range testcases {
+		t.Run(tc.name, func(t *testing.T) {
+			got, duplicates := events.DeduplicateEvents(tc.events)
+
+			if !reflect.DeepEqual(got, tc.expected) {
+				t.Errorf("expected %v, got %v", tc.expected, got)
+			}
+
+			if duplicates != tc.expectedDuplicates {
+				t.Errorf("expected %d duplicates, got %d", tc.expectedDuplicates, duplicates)
+			}
+		})
+	}
+}
+
+func TestDeduplicator(t *testing.T) {
+	testcases := []struct {
+		name          string
+		events        []events.EventTranslationDelivered
+		expected      []bool
+		expectedError error
+	}{
+		{
+			"duplicates within retention",
+			[]events.EventTranslationDelivered{
+				{Timestamp: "2018-12-26 18:11:08.509654", TranslationId: "5aa5b2f39f7254a75aa5"},
+				{Timestamp: "2018-12-26 18:15:19.903159", TranslationId: "5aa5b2f39f7254a75aa4"},
+				{Timestamp: "2018-12-26 18:20:19.903159", TranslationId: "5aa5b2f39f7254a75aa5"},
+			},
+			[]bool{false, false, true},
+			errors.New(""),
+		},
+		{
+			"duplicates outside retention",
+			[]events.EventTranslationDelivered{
+				{Timestamp: "2018-12-26 18:11:08.509654", TranslationId: "5aa5b2f39f7254a75aa5"},
+				{Timestamp: "2018-12-26 18:25:19.903159", TranslationId: "5aa5b2f39f7254a75aa4"},
+				{Timestamp: "2018-12-26 18:26:19.903159", TranslationId: "5aa5b2f39f7254a75aa5"},
+				{Timestamp: "2018-12-26 18:27:19.903159", TranslationId: "5aa5b2f39f7254a75aa5"},
+			},
+			[]bool{false, false, false, true},
+			errors.New(""),
+		},
+		{
+			"events without a translation_id",
+			[]events.EventTranslationDelivered{
+				{Timestamp: "2018-12-26 18:11:08.509654"},
+				{Timestamp: "2018-12-26 18:12:08.509654"},
+			},
+			[]bool{false, false},
+			errors.New(""),
+		},
+		{
+			"invalid case - wrong date format",
+			[]events.EventTranslationDelivered{
+				{Timestamp: "26-12-2018 18:11:08.509654", TranslationId: "5aa5b2f39f7254a75aa5"},
+			},
+			[]bool{false},
+			errors.New("Invalid date format. Please provide dates in the following format: " + InputTimestampFormat + "\n"),
+		},
+	}
+
+	for _, tc := range testcases {
+		t.Run(tc.name, func(t *testing.T) {
+			deduplicator := events.NewDeduplicator(10 * time.Minute)
+
+			got := make([]bool, 0)
+			for _, event := range tc.events {
+				duplicate, err := deduplicator.Duplicate(event)
+				if err != nil && err.Error() != tc.expectedError.Error() {
+					t.Errorf("Unexpected error: %s", err.Error())
+				}
+				got = append(got, duplicate)
+			}
+
+			if !reflect.DeepEqual(got, tc.expected) {
+				t.Errorf("expected %v, got %v", tc.expected, got)
+			}
+		})
+	}
+}
+
+func TestDeduplicatorRestore(t *testing.T) {
+	deduplicator := events.NewDeduplicator(10 * time.Minute)
+	deduplicator.Duplicate(events.EventTranslationDelivered{Timestamp: "2018-12-26 18:11:08.509654", TranslationId: "5aa5b2f39f7254a75aa5"})
+	deduplicator.Duplicate(events.EventTranslationDelivered{Timestamp: "2018-12-26 18:12:08.509654", TranslationId: "5aa5b2f39f7254a75aa5"})
+	deduplicator.Duplicate(events.EventTranslationDelivered{Timestamp: "2018-12-26 18:15:19.903159", TranslationId: "5aa5b2f39f7254a75aa4"})
+
+	restored := events.NewDeduplicator(10 * time.Minute)
+	restored.Restore(deduplicator.Seen(), deduplicator.Dropped)
+
+	if restored.Dropped != 1 {
+		t.Errorf("expected 1 duplicate dropped, got %d", restored.Dropped)
+	}
+
+	/* The first TranslationId is forgotten first, and the second one is still remembered */
+	duplicate, _ := restored.Duplicate(events.EventTranslationDelivered{Timestamp: "2018-12-26 18:22:08.509654", TranslationId: "5aa5b2f39f7254a75aa5"})
+	if duplicate {
+		t.Errorf("expected 5aa5b2f39f7254a75aa5 to be forgotten")
+	}
+	duplicate, _ = restored.Duplicate(events.EventTranslationDelivered{Timestamp: "2018-12-26 18:22:08.509654", TranslationId: "5aa5b2f39f7254a75aa4"})
+	if !duplicate {
+		t.Errorf("expected 5aa5b2f39f7254a75aa4 to be a duplicate")
+	}
+}
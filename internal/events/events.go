@@ -1,6 +1,7 @@
 package events
 
 import (
+	"context"
 	"errors"
 	"time"
 
@@ -25,27 +26,46 @@ type EventTranslationDelivered struct {
 
 /*
 A function that aggregates the duration of events by time unit.
-Receives a list of events and a unit of time.
+Receives the context, checked while grouping, a list of events and a unit of time.
 
-Returns a list of data points, with the total duration of events and number of occurrences aggregated by time unit.
+Returns a sparse dataset of data points, with the total duration of events and number of occurrences aggregated by time unit.
+Only time units with events are stored, so large gaps between events don't take any memory.
 */
-func GroupEventsByUnit(events []EventTranslationDelivered, unit time.Duration) ([]statistics.DataPoint, error) {
+func GroupEventsByUnit(ctx context.Context, events []EventTranslationDelivered, unit time.Duration) (statistics.SparseDataset, error) {
 	/* Get the start and finish timestamps aka window. */
 	windowStart, windowEnd, err := GetEventWindowByUnit(events, unit)
 	if err != nil {
-		return []statistics.DataPoint{}, err
+		return statistics.SparseDataset{}, err
 	}
 
-	/*	Calculate number of time units in event input. */
-	datasetLength := calculateUnitDifference(windowStart, windowEnd, unit) + 1
+	return GroupEventsInWindow(ctx, events, windowStart, windowEnd, unit)
+}
 
-	dataset := make([]statistics.DataPoint, datasetLength, datasetLength)
+/*
+A function that aggregates the duration of events by time unit, over a given window.
+Receives the context, checked while grouping, a list of events, the start and end of the window, like the ones GetEventWindowByUnit returns, and a unit of time.
+
+Returns a sparse dataset like GroupEventsByUnit does, covering the whole window even where it has no events,
+so the datasets of different lists of events grouped over the same window share their buckets.
+*/
+func GroupEventsInWindow(ctx context.Context, events []EventTranslationDelivered, windowStart, windowEnd time.Time, unit time.Duration) (statistics.SparseDataset, error) {
+	/*	Calculate number of time units in event input. Each datapoint covers the unit before the time it's reported at. */
+	dataset := statistics.SparseDataset{
+		Length:  calculateUnitDifference(windowStart, windowEnd, unit) + 1,
+		Buckets: make([]statistics.Bucket, 0),
+		Start:   windowStart.Add(-unit),
+		Unit:    unit,
+	}
 
 	/* Iterate through events and group them by minute difference to start timestamp.	*/
-	for _, event := range events {
+	for i, event := range events {
+		if err := checkCancelled(ctx, i); err != nil {
+			return statistics.SparseDataset{}, err
+		}
+
 		timestamp, err := time.Parse(InputTimestampFormat, event.Timestamp)
 		if err != nil {
-			return []statistics.DataPoint{}, errors.New("Invalid date format. Please provide dates in the following format: " + InputTimestampFormat + "\n")
+			return statistics.SparseDataset{}, errors.New("Invalid date format. Please provide dates in the following format: " + InputTimestampFormat + "\n")
 		}
 
 		/*	Include an extra unit (second, minute, ...) in the calculation, as events are logged based on the unit immediately following their occurrence.	*/
@@ -53,11 +73,11 @@ func GroupEventsByUnit(events []EventTranslationDelivered, unit time.Duration) (
 
 		/* Calculate the corresponding index for the event, based on time unit difference to the window start. */
 		index := calculateUnitDifference(windowStart, timestamp, unit)
-
-		dataset[index] = statistics.DataPoint{
-			Total: dataset[index].Total + float64(event.Duration),
-			Count: dataset[index].Count + 1,
+		if index < 0 {
+			return statistics.SparseDataset{}, errors.New("Events are not ordered by timestamp. Please provide events ordered from oldest to newest.")
 		}
+
+		dataset.Add(index, statistics.DataPoint{Total: float64(event.Duration), Count: 1})
 	}
 	return dataset, nil
 }
@@ -98,3 +118,19 @@ Function to calculate the time difference in provided unit of time
 func calculateUnitDifference(start time.Time, end time.Time, unit time.Duration) int {
 	return int(end.Sub(start) / unit)
 }
+
+/*
+A function that filters a list of events by client.
+Receives a list of events and the client name.
+
+Returns the events of the given client, in the same order.
+*/
+func FilterEventsByClient(events []EventTranslationDelivered, client string) []EventTranslationDelivered {
+	filtered := make([]EventTranslationDelivered, 0)
+	for _, event := range events {
+		if event.ClientName == client {
+			filtered = append(filtered, event)
+		}
+	}
+	return filtered
+}
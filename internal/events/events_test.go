@@ -1,6 +1,7 @@
 package events_test
 
 import (
+	"context"
 	"errors"
 	"reflect"
 	"testing"
@@ -91,13 +92,14 @@ func TestGroupEventsByUnit(t *testing.T) {
 
 	for _, tc := range testcases {
 		t.Run(tc.name, func(t *testing.T) {
-			got, err := events.GroupEventsByUnit(tc.events, tc.unit)
+			dataset, err := events.GroupEventsByUnit(context.Background(), tc.events, tc.unit)
 			if err != nil && err.Error() != tc.expectedError.Error() {
 				t.Errorf("Unexpected error: %s", err.Error())
 			}
 
-			if !reflect.DeepEqual(got, tc.expected) {
-				t.Errorf("expected %v, got %v", tc.expected, got)
+			expected := statistics.NewSparseDataset(tc.expected)
+			if dataset.Length != expected.Length || len(dataset.Buckets) != len(expected.Buckets) || (len(expected.Buckets) > 0 && !reflect.DeepEqual(dataset.Buckets, expected.Buckets)) {
+				t.Errorf("expected %v, got %v", expected, dataset)
 			}
 		})
 	}
@@ -187,3 +189,92 @@ func TestGetEventWindowByUnit(t *testing.T) {
 		})
 	}
 }
+
+func TestFilterEventsByClient(t *testing.T) {
+	testcases := []struct {
+		name     string
+		events   []events.EventTranslationDelivered
+		client   string
+		expected []events.EventTranslationDelivered
+	}{
+		{
+			"valid case",
+			[]events.EventTranslationDelivered{
+				{Timestamp: "2018-12-26 18:11:08.509654", ClientName: "airliberty", Duration: 20},
+				{Timestamp: "2018-12-26 18:15:19.903159", ClientName: "airliberty", Duration: 31},
+				{Timestamp: "2018-12-26 18:23:19.903159", ClientName: "taxi-eats", Duration: 54},
+			},
+			"airliberty",
+			[]events.EventTranslationDelivered{
+				{Timestamp: "2018-12-26 18:11:08.509654", ClientName: "airliberty", Duration: 20},
+				{Timestamp: "2018-12-26 18:15:19.903159", ClientName: "airliberty", Duration: 31},
+			},
+		},
+		{
+			"unknown client",
+			[]events.EventTranslationDelivered{
+				{Timestamp: "2018-12-26 18:11:08.509654", ClientName: "airliberty", Duration: 20},
+			},
+			"taxi-eats",
+			[]events.EventTranslationDelivered{},
+		},
+	}
+
+	for _, tc := range testcases {
+		t.Run(tc.name, func(t *testing.T) {
+			got := events.FilterEventsByClient(tc.events, tc.client)
+
+			if !reflect.DeepEqual(got, tc.expected) {
+				t.Errorf("expected %v, got %v", tc.expected, got)
+			}
+		})
+	}
+}
+
+func TestGroupEventsByUnitSparse(t *testing.T) {
+	got, err := events.GroupEventsByUnit(context.Background(), []events.EventTranslationDelivered{
+		{Timestamp: "2018-12-26 18:11:08.509654", Duration: 20},
+		{Timestamp: "2019-12-26 18:11:08.509654", Duration: 31},
+	}, time.Second)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	expected := statistics.SparseDataset{Length: 31536002, Buckets: []statistics.Bucket{
+		{Index: 1, DataPoint: statistics.DataPoint{Total: 20, Count: 1}},
+		{Index: 31536001, DataPoint: statistics.DataPoint{Total: 31, Count: 1}},
+	}, Start: time.Date(2018, 12, 26, 18, 11, 7, 0, time.UTC), Unit: time.Second}
+	if !reflect.DeepEqual(got, expected) {
+		t.Errorf("expected %v, got %v", expected, got)
+	}
+}
+
+func TestGroupEventsInWindow(t *testing.T) {
+	windowStart := time.Date(2018, 12, 26, 18, 10, 0, 0, time.UTC)
+	windowEnd := time.Date(2018, 12, 26, 18, 15, 0, 0, time.UTC)
+
+	testcases := []struct {
+		name          string
+		events        []events.EventTranslationDelivered
+		expected      statistics.SparseDataset
+		expectedError error
+	}{
+		{"events within the window", []events.EventTranslationDelivered{{Timestamp: "2018-12-26 18:12:19.903159", Duration: 40}}, statistics.SparseDataset{Length: 6, Buckets: []statistics.Bucket{
+			{Index: 3, DataPoint: statistics.DataPoint{Total: 40, Count: 1}},
+		}, Start: windowStart.Add(-time.Minute), Unit: time.Minute}, nil},
+		{"no events", []events.EventTranslationDelivered{}, statistics.SparseDataset{Length: 6, Buckets: []statistics.Bucket{}, Start: windowStart.Add(-time.Minute), Unit: time.Minute}, nil},
+		{"events before the window", []events.EventTranslationDelivered{{Timestamp: "2018-12-26 18:08:19.903159", Duration: 40}}, statistics.SparseDataset{}, errors.New("Events are not ordered by timestamp. Please provide events ordered from oldest to newest.")},
+	}
+
+	for _, tc := range testcases {
+		t.Run(tc.name, func(t *testing.T) {
+			got, err := events.GroupEventsInWindow(context.Background(), tc.events, windowStart, windowEnd, time.Minute)
+			if (err != nil) != (tc.expectedError != nil) || (err != nil && err.Error() != tc.expectedError.Error()) {
+				t.Fatalf("expected error %v, got %v", tc.expectedError, err)
+			}
+			if !reflect.DeepEqual(got, tc.expected) {
+				t.Errorf("expected %v, got %v", tc.expected, got)
+			}
+		})
+	}
+}
@@ -0,0 +1,151 @@
+package events
+
+import (
+	"bufio"
+	"bytes"
+	"context"
+	"errors"
+	"io"
+	"io/fs"
+	"os"
+	"time"
+)
+
+/* Error returned when the followed file was rotated, once every line in it was emitted */
+var errRotated = errors.New("The followed file was rotated.")
+
+/*
+A function that reads the lines of an events file as they are appended to it, like tail -f.
+
+Once the end of the file is reached, it waits for the poll interval before reading again,
+and a line is only emitted once its newline was written, so lines being appended are never read in half.
+The last line is the exception when the context is cancelled at the end of the file, as nothing follows it then,
+so it is emitted even without a newline.
+Receives the context, which stops following when cancelled, the reader, the poll interval
+and a function called with each non-empty line, without its newline, which is only valid until the function returns.
+Returns the error of the cancelled context, or an error reading or emitting a line.
+*/
+func FollowEventsLines(ctx context.Context, reader io.Reader, pollInterval time.Duration, emit func(line []byte) error) error {
+	return followLines(ctx, reader, pollInterval, nil, emit)
+}
+
+/*
+A function that reads the lines of an events file as they are appended to it, following its path when the file is rotated, like tail -F.
+
+Lines are read like FollowEventsLines does. Once the end of the file is reached and another file was created at its path,
+the rest of the rotated file is read, its last line is emitted even without a newline, since nothing is appended to it anymore,
+and the new file is followed from its start.
+Receives the context, which stops following when cancelled, the path to the file, the poll interval
+and a function called with each non-empty line, without its newline, which is only valid until the function returns.
+Returns the error of the cancelled context, or an error opening the file, reading or emitting a line.
+*/
+func FollowEventsFile(ctx context.Context, path string, pollInterval time.Duration, emit func(line []byte) error) error {
+	for {
+		file, err := os.Open(path)
+		if err != nil {
+			return err
+		}
+
+		err = followLines(ctx, file, pollInterval, func() (bool, error) {
+			return rotated(file, path)
+		}, emit)
+		file.Close()
+		if err != errRotated {
+			return err
+		}
+	}
+}
+
+/*
+A function that checks whether the file at a path is another one than the file opened, once it was rotated.
+
+A path without a file is not rotated yet, as the new file is usually created right after the old one is renamed.
+*/
+func rotated(file *os.File, path string) (bool, error) {
+	current, err := os.Stat(path)
+	if errors.Is(err, fs.ErrNotExist) {
+		return false, nil
+	}
+	if err != nil {
+		return false, err
+	}
+
+	opened, err := file.Stat()
+	if err != nil {
+		return false, err
+	}
+	return !os.SameFile(current, opened), nil
+}
+
+/*
+A function that reads the lines of a reader as they are appended to it, until the context is cancelled or the reader was rotated.
+
+Receives the context, the reader, the poll interval, the function checking whether the reader was rotated, or nil if it never is,
+and the function called with each line.
+Returns the error of the cancelled context, errRotated once every line of a rotated reader was emitted, or an error reading or emitting a line.
+*/
+func followLines(ctx context.Context, reader io.Reader, pollInterval time.Duration, isRotated func() (bool, error), emit func(line []byte) error) error {
+	buffered := bufio.NewReader(reader)
+	pending := make([]byte, 0)
+	rotatedAway := false
+
+	lines := 0
+	emitPending := func() error {
+		line := bytes.TrimRight(pending, "\r\n")
+		pending = pending[:0]
+		if len(line) == 0 {
+			return nil
+		}
+		lines++
+		return emit(line)
+	}
+
+	for {
+		if err := checkCancelled(ctx, lines); err != nil {
+			return err
+		}
+
+		chunk, err := buffered.ReadSlice('\n')
+		pending = append(pending, chunk...)
+		switch err {
+		case nil:
+		case bufio.ErrBufferFull:
+			continue
+		case io.EOF:
+			/* Nothing is appended to a rotated file anymore, so its last line is complete even without a newline */
+			if rotatedAway {
+				if err := emitPending(); err != nil {
+					return err
+				}
+				return errRotated
+			}
+
+			/* Read a rotated file once more, for the lines appended before it was rotated */
+			if isRotated != nil {
+				if rotatedAway, err = isRotated(); err != nil {
+					return err
+				}
+				if rotatedAway {
+					continue
+				}
+			}
+
+			/* Wait for more lines to be appended, emitting the last line when stopping since nothing follows it */
+			select {
+			case <-ctx.Done():
+				if err := emitPending(); err != nil {
+					return err
+				}
+				return ctx.Err()
+			case <-time.After(pollInterval):
+			}
+			continue
+		default:
+			return err
+		}
+
+		if err := emitPending(); err != nil {
+			return err
+		}
+	}
+}
@@ -0,0 +1,188 @@
+package events_test
+
+import (
+	"context"
+	"errors"
+	"os"
+	"path/filepath"
+	"reflect"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/jmbds/unbabel-backend-engineering-challenge/internal/events"
+)
+
+func TestFollowEventsLines(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "events.json")
+	if err := os.WriteFile(path, []byte("{\"a\": 1}\n\n{\"b\""), 0644); err != nil {
+		t.Fatal(err)
+	}
+
+	file, err := os.Open(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer file.Close()
+
+	var (
+		mutex sync.Mutex
+		lines []string
+	)
+	appended := make(chan struct{})
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+
+	done := make(chan error)
+	go func() {
+		done <- events.FollowEventsLines(ctx, file, time.Millisecond, func(line []byte) error {
+			mutex.Lock()
+			defer mutex.Unlock()
+			lines = append(lines, string(line))
+			if len(lines) == 3 {
+				close(appended)
+			}
+			return nil
+		})
+	}()
+
+	/* Finish the line being written, and append another one */
+	time.Sleep(10 * time.Millisecond)
+	output, err := os.OpenFile(path, os.O_APPEND|os.O_WRONLY, 0644)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, err := output.WriteString(": 2}\r\n{\"c\": 3}\n"); err != nil {
+		t.Fatal(err)
+	}
+	output.Close()
+
+	select {
+	case <-appended:
+	case <-time.After(5 * time.Second):
+		t.Fatal("expected the appended lines to be read")
+	}
+	cancel()
+
+	if err := <-done; !errors.Is(err, context.Canceled) {
+		t.Errorf("expected %v, got %v", context.Canceled, err)
+	}
+
+	expected := []string{"{\"a\": 1}", "{\"b\": 2}", "{\"c\": 3}"}
+	if !reflect.DeepEqual(lines, expected) {
+		t.Errorf("expected %v, got %v", expected, lines)
+	}
+}
+
+func TestFollowEventsLinesEmitError(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "events.json")
+	if err := os.WriteFile(path, []byte("{\"a\": 1}\n"), 0644); err != nil {
+		t.Fatal(err)
+	}
+
+	file, err := os.Open(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer file.Close()
+
+	expectedError := errors.New("Emit failed.")
+	err = events.FollowEventsLines(context.Background(), file, time.Millisecond, func(line []byte) error {
+		return expectedError
+	})
+	if err != expectedError {
+		t.Errorf("expected %v, got %v", expectedError, err)
+	}
+}
+
+func TestFollowEventsLinesFlush(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "events.json")
+	if err := os.WriteFile(path, []byte("{\"a\": 1}\n{\"b\": 2}"), 0644); err != nil {
+		t.Fatal(err)
+	}
+
+	file, err := os.Open(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer file.Close()
+
+	/* Nothing follows the last line once following stops, so it is read without its newline */
+	ctx, cancel := context.WithCancel(context.Background())
+	lines := []string{}
+	err = events.FollowEventsLines(ctx, file, time.Millisecond, func(line []byte) error {
+		lines = append(lines, string(line))
+		cancel()
+		return nil
+	})
+	if !errors.Is(err, context.Canceled) {
+		t.Errorf("expected %v, got %v", context.Canceled, err)
+	}
+
+	expected := []string{"{\"a\": 1}", "{\"b\": 2}"}
+	if !reflect.DeepEqual(lines, expected) {
+		t.Errorf("expected %v, got %v", expected, lines)
+	}
+}
+
+func TestFollowEventsFile(t *testing.T) {
+	directory := t.TempDir()
+	path := filepath.Join(directory, "events.json")
+	if err := os.WriteFile(path, []byte("{\"a\": 1}\n{\"b\": 2}"), 0644); err != nil {
+		t.Fatal(err)
+	}
+
+	var (
+		mutex sync.Mutex
+		lines []string
+	)
+	first := make(chan struct{})
+	followed := make(chan struct{})
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+
+	done := make(chan error)
+	go func() {
+		done <- events.FollowEventsFile(ctx, path, time.Millisecond, func(line []byte) error {
+			mutex.Lock()
+			defer mutex.Unlock()
+			lines = append(lines, string(line))
+			switch len(lines) {
+			case 1:
+				close(first)
+			case 3:
+				close(followed)
+			}
+			return nil
+		})
+	}()
+
+	/* Rotate the file while its last line has no newline, and write to a new file at its path */
+	select {
+	case <-first:
+	case <-time.After(5 * time.Second):
+		t.Fatal("expected the first line to be read")
+	}
+	if err := os.Rename(path, filepath.Join(directory, "events.json.1")); err != nil {
+		t.Fatal(err)
+	}
+	if err := os.WriteFile(path, []byte("{\"c\": 3}\n"), 0644); err != nil {
+		t.Fatal(err)
+	}
+
+	select {
+	case <-followed:
+	case <-time.After(5 * time.Second):
+		t.Fatal("expected the new file to be followed")
+	}
+	cancel()
+
+	if err := <-done; !errors.Is(err, context.Canceled) {
+		t.Errorf("expected %v, got %v", context.Canceled, err)
+	}
+
+	expected := []string{"{\"a\": 1}", "{\"b\": 2}", "{\"c\": 3}"}
+	if !reflect.DeepEqual(lines, expected) {
+		t.Errorf("expected %v, got %v", expected, lines)
+	}
+}
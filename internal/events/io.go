@@ -4,68 +4,142 @@ import (
 	"bufio"
 	"encoding/json"
 	"errors"
-	"fmt"
-	"os"
+	"io"
+	"strconv"
 	"time"
+
+	"github.com/jmbds/unbabel-backend-engineering-challenge/internal/statistics"
 )
 
 /*
-A function that reads a file and unmarshalls its contents, line by line, into EventTranslationDelivered structs.
+A function that formats a single moving average value as an output line, appending it to a buffer.
 
-Receives a path to a file containing the list of events.
-Returns a list of events and an error.
+Receives the buffer, the timestamp of the value and the moving average value.
+Returns the buffer with the line appended, including the trailing newline.
 */
-func ReadAndUnmarshallEventsFile(filepath string) ([]EventTranslationDelivered, error) {
-	file, err := os.Open(filepath)
-	if err != nil {
-		return []EventTranslationDelivered{}, err
+func AppendMovingAverageRecord(buffer []byte, timestamp time.Time, average float64) []byte {
+	buffer = append(buffer, "{\"date\": \""...)
+	buffer = timestamp.AppendFormat(buffer, OutputTimestampFormat)
+	buffer = append(buffer, "\", \"average_delivery_time\": "...)
+
+	/* Check if we should remove decimal places of float value */
+	if average == float64(int(average)) {
+		buffer = strconv.AppendInt(buffer, int64(int(average)), 10)
+	} else {
+		buffer = strconv.AppendFloat(buffer, average, 'f', 1, 64)
 	}
-	defer file.Close()
 
-	events := make([]EventTranslationDelivered, 0)
-	scanner := bufio.NewScanner(file)
+	return append(buffer, "}\n"...)
+}
 
-	for scanner.Scan() {
-		event := EventTranslationDelivered{}
+/*
+A struct that writes moving average values as output lines, one at a time, as they are calculated.
 
-		err = json.Unmarshal(scanner.Bytes(), &event)
-		if err != nil {
-			return []EventTranslationDelivered{}, errors.New("Content is invalid. Please provide a valid events file.")
-		}
+Lines are formatted into a reused buffer and written straight to the underlying writer, which should be buffered.
+Written is the number of bytes written so far, and Records the number of lines.
+*/
+type RecordWriter struct {
+	Written int64
+	Records int
 
-		events = append(events, event)
-	}
+	writer io.Writer
+	buffer []byte
+}
 
-	return events, nil
+/*
+A function that creates a RecordWriter.
+
+Receives the writer the lines are written to.
+Returns the RecordWriter.
+*/
+func NewRecordWriter(writer io.Writer) *RecordWriter {
+	return &RecordWriter{writer: writer, buffer: make([]byte, 0, 64)}
 }
 
 /*
-A function that generates the string output with the desired format.
+A function that writes a single moving average value as an output line.
 
-Receives a list of events and the calculated moving average values.
-Returns the string output with date and average_delivery_time and an error.
+Receives the timestamp of the value and the moving average value.
+Returns an error.
 */
-func GenerateMinuteMovingAverageOutput(events []EventTranslationDelivered, average []float64) (string, error) {
-	startTimestamp, err := time.Parse(InputTimestampFormat, events[0].Timestamp)
-	if err != nil {
-		return "", errors.New("Invalid date format. Please provide dates in the following format: " + InputTimestampFormat + "\n")
+func (w *RecordWriter) WriteRecord(timestamp time.Time, average float64) error {
+	w.buffer = AppendMovingAverageRecord(w.buffer[:0], timestamp, average)
+	written, err := w.writer.Write(w.buffer)
+	w.Written += int64(written)
+	if err == nil {
+		w.Records++
 	}
-	startTimestamp = startTimestamp.Truncate(time.Minute)
-
-	textToOutput := ""
-	for i, average := range average {
-		/*	Calculate timestamp for current moving average	*/
-		timestamp := startTimestamp.Add(time.Duration(i) * 1 * time.Minute)
-		formattedTimestamp := timestamp.Format(OutputTimestampFormat)
-
-		/* Check if we should remove decimal places of float value */
-		if average == float64(int(average)) {
-			textToOutput += fmt.Sprintf("{\"date\": \"%s\", \"average_delivery_time\": %d}\n", formattedTimestamp, int(average))
-		} else {
-			textToOutput += fmt.Sprintf("{\"date\": \"%s\", \"average_delivery_time\": %.1f}\n", formattedTimestamp, average)
+	return err
+}
+
+/*
+A function that writes a moving average value as an output line, reported at the end of its interval.
+*/
+func (w *RecordWriter) WritePoint(point statistics.Point) error {
+	return w.WriteRecord(point.End, point.Value)
+}
+
+/*
+A struct that reads events one line at a time, keeping track of the byte offset of each line.
+*/
+type EventScanner struct {
+	reader *bufio.Reader
+	offset int64
+	event  EventTranslationDelivered
+	err    error
+}
+
+/*
+A function that creates an EventScanner.
+
+Receives the reader positioned at the first line to read and the byte offset of that position.
+Returns the EventScanner.
+*/
+func NewEventScanner(reader io.Reader, offset int64) *EventScanner {
+	return &EventScanner{reader: bufio.NewReader(reader), offset: offset}
+}
+
+/*
+A function that reads and unmarshalls the next event.
+
+Returns true if an event was read, and false when the input ended or an error occurred.
+*/
+func (s *EventScanner) Scan() bool {
+	line, err := s.reader.ReadBytes('\n')
+	if len(line) == 0 {
+		if err != io.EOF {
+			s.err = err
 		}
+		return false
+	}
 
+	s.event = EventTranslationDelivered{}
+	if err := json.Unmarshal(line, &s.event); err != nil {
+		s.err = errors.New("Content is invalid. Please provide a valid events file.")
+		return false
 	}
 
-	return textToOutput, nil
+	s.offset += int64(len(line))
+	return true
+}
+
+/*
+A function that returns the last event read.
+*/
+func (s *EventScanner) Event() EventTranslationDelivered {
+	return s.event
+}
+
+/*
+A function that returns the byte offset right after the last event read.
+*/
+func (s *EventScanner) Offset() int64 {
+	return s.offset
+}
+
+/*
+A function that returns the error that stopped the scanner, if any.
+*/
+func (s *EventScanner) Err() error {
+	return s.err
 }
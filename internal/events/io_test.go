@@ -2,96 +2,112 @@ package events_test
 
 import (
 	"errors"
+	"fmt"
 	"reflect"
+	"strings"
 	"testing"
+	"time"
 
 	"github.com/jmbds/unbabel-backend-engineering-challenge/internal/events"
 )
 
-func TestReadAndUnmarshallEventsFile(t *testing.T) {
+func TestAppendMovingAverageRecord(t *testing.T) {
+	timestamp := time.Date(2018, 12, 26, 18, 11, 0, 0, time.UTC)
+
 	testcases := []struct {
-		name          string
-		filepath      string
-		expected      []events.EventTranslationDelivered
-		expectedError error
+		name     string
+		average  float64
+		expected string
 	}{
-		{
-			"valid case",
-			"testcases/events.json",
-			[]events.EventTranslationDelivered{
-				{Timestamp: "2018-12-26 18:11:08.509654", TranslationId: "5aa5b2f39f7254a75aa5", SourceLanguage: "en", TargetLanguage: "fr", ClientName: "airliberty", EventName: "translation_delivered", Duration: 20, NrWords: 30},
-				{Timestamp: "2018-12-26 18:15:19.903159", TranslationId: "5aa5b2f39f7254a75aa4", SourceLanguage: "en", TargetLanguage: "fr", ClientName: "airliberty", EventName: "translation_delivered", Duration: 31, NrWords: 30},
-				{Timestamp: "2018-12-26 18:23:19.903159", TranslationId: "5aa5b2f39f7254a75bb3", SourceLanguage: "en", TargetLanguage: "fr", ClientName: "taxi-eats", EventName: "translation_delivered", Duration: 54, NrWords: 100},
-			},
-			errors.New(""),
-		},
-		{
-			"invalid case - file not found",
-			"testcases/not_found.json",
-			[]events.EventTranslationDelivered{},
-			errors.New("open testcases/not_found.json: no such file or directory"),
-		},
-		{
-			"invalid case - invalid format",
-			"testcases/invalid_events.json",
-			[]events.EventTranslationDelivered{},
-			errors.New("Content is invalid. Please provide a valid events file."),
-		},
+		{"integral value", 20, "{\"date\": \"2018-12-26 18:11:00\", \"average_delivery_time\": 20}\n"},
+		{"zero", 0, "{\"date\": \"2018-12-26 18:11:00\", \"average_delivery_time\": 0}\n"},
+		{"one decimal place", 25.5, "{\"date\": \"2018-12-26 18:11:00\", \"average_delivery_time\": 25.5}\n"},
+		{"rounded decimal places", 35.666666, "{\"date\": \"2018-12-26 18:11:00\", \"average_delivery_time\": 35.7}\n"},
 	}
 
 	for _, tc := range testcases {
 		t.Run(tc.name, func(t *testing.T) {
-			got, err := events.ReadAndUnmarshallEventsFile(tc.filepath)
-			if err != nil && err.Error() != tc.expectedError.Error() {
-				t.Errorf("Unexpected error: %s", err.Error())
-			}
-			if !reflect.DeepEqual(got, tc.expected) {
+			got := string(events.AppendMovingAverageRecord(nil, timestamp, tc.average))
+			if got != tc.expected {
 				t.Errorf("expected %v, got %v", tc.expected, got)
 			}
+
+			/* The formatting matches the original fmt based implementation */
+			fallback := fmt.Sprintf("{\"date\": \"%s\", \"average_delivery_time\": %.1f}\n", timestamp.Format(events.OutputTimestampFormat), tc.average)
+			if tc.average == float64(int(tc.average)) {
+				fallback = fmt.Sprintf("{\"date\": \"%s\", \"average_delivery_time\": %d}\n", timestamp.Format(events.OutputTimestampFormat), int(tc.average))
+			}
+			if got != fallback {
+				t.Errorf("expected %v, got %v", fallback, got)
+			}
 		})
 	}
 }
 
-func TestGenerateMinuteMovingAverageOutput(t *testing.T) {
+func TestEventScanner(t *testing.T) {
 	testcases := []struct {
-		name          string
-		events        []events.EventTranslationDelivered
-		average       []float64
-		expected      string
-		expectedError error
+		name            string
+		input           string
+		offset          int64
+		expected        []events.EventTranslationDelivered
+		expectedOffsets []int64
+		expectedError   error
 	}{
 		{
 			"valid case",
+			"{\"timestamp\": \"2018-12-26 18:11:08.509654\", \"duration\": 20}\n{\"timestamp\": \"2018-12-26 18:15:19.903159\", \"duration\": 31}",
+			0,
 			[]events.EventTranslationDelivered{
-				{Timestamp: "2018-12-26 18:11:08.509654"},
-				{Timestamp: "2018-12-26 18:12:19.903159"},
+				{Timestamp: "2018-12-26 18:11:08.509654", Duration: 20},
+				{Timestamp: "2018-12-26 18:15:19.903159", Duration: 31},
 			},
-			[]float64{0, 20, 20},
-			"{\"date\": \"2018-12-26 18:11:00\", \"average_delivery_time\": 0}\n{\"date\": \"2018-12-26 18:12:00\", \"average_delivery_time\": 20}\n{\"date\": \"2018-12-26 18:13:00\", \"average_delivery_time\": 20}\n",
+			[]int64{60, 119},
 			errors.New(""),
 		},
 		{
-			"invalid case - wrong timestamp format",
+			"valid case - starting offset",
+			"{\"timestamp\": \"2018-12-26 18:15:19.903159\", \"duration\": 31}\n",
+			60,
 			[]events.EventTranslationDelivered{
-				{Timestamp: "21-07-2016 14:51:08.509654"},
-				{Timestamp: "2016-07-22 14:52:19.903159"},
+				{Timestamp: "2018-12-26 18:15:19.903159", Duration: 31},
 			},
-			[]float64{31, 50, 88},
-			"",
-			errors.New("Invalid date format. Please provide dates in the following format: " + InputTimestampFormat + "\n"),
+			[]int64{120},
+			errors.New(""),
+		},
+		{
+			"invalid case - invalid format",
+			"{\"timestamp\": \"2018-12-26 18:11:08.509654\", \"duration\": 20}\nNo events in this file. :)",
+			0,
+			[]events.EventTranslationDelivered{
+				{Timestamp: "2018-12-26 18:11:08.509654", Duration: 20},
+			},
+			[]int64{60},
+			errors.New("Content is invalid. Please provide a valid events file."),
 		},
 	}
 
 	for _, tc := range testcases {
 		t.Run(tc.name, func(t *testing.T) {
-			got, err := events.GenerateMinuteMovingAverageOutput(tc.events, tc.average)
-			if err != nil && err.Error() != tc.expectedError.Error() {
+			scanner := events.NewEventScanner(strings.NewReader(tc.input), tc.offset)
+
+			got := []events.EventTranslationDelivered{}
+			gotOffsets := []int64{}
+			for scanner.Scan() {
+				got = append(got, scanner.Event())
+				gotOffsets = append(gotOffsets, scanner.Offset())
+			}
+
+			if err := scanner.Err(); err != nil && err.Error() != tc.expectedError.Error() {
 				t.Errorf("Unexpected error: %s", err.Error())
 			}
 
-			if got != tc.expected {
+			if !reflect.DeepEqual(got, tc.expected) {
 				t.Errorf("expected %v, got %v", tc.expected, got)
 			}
+
+			if !reflect.DeepEqual(gotOffsets, tc.expectedOffsets) {
+				t.Errorf("expected %v, got %v", tc.expectedOffsets, gotOffsets)
+			}
 		})
 	}
 }
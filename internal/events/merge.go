@@ -0,0 +1,197 @@
+package events
+
+import (
+	"container/heap"
+	"context"
+	"errors"
+	"io"
+	"os"
+	"path/filepath"
+	"sort"
+	"time"
+)
+
+/*
+A function that expands a list of paths and glob patterns into the files to read.
+
+Patterns are expanded in lexical order, and paths without any pattern are kept as they are.
+Receives the paths and patterns.
+Returns the list of files and an error if a pattern is malformed or matches no file.
+*/
+func ExpandInputFiles(patterns []string) ([]string, error) {
+	filepaths := make([]string, 0, len(patterns))
+
+	for _, pattern := range patterns {
+		if !hasGlobMeta(pattern) {
+			filepaths = append(filepaths, pattern)
+			continue
+		}
+
+		matches, err := filepath.Glob(pattern)
+		if err != nil {
+			return []string{}, errors.New("Invalid input file pattern " + pattern + ". Please provide a valid glob pattern.")
+		}
+		if len(matches) == 0 {
+			return []string{}, errors.New("No input files match " + pattern + ". Please provide a pattern matching at least one file.")
+		}
+
+		sort.Strings(matches)
+		filepaths = append(filepaths, matches...)
+	}
+
+	return filepaths, nil
+}
+
+/*
+A function that checks if a path has any of the special characters of a glob pattern.
+*/
+func hasGlobMeta(path string) bool {
+	for _, c := range path {
+		switch c {
+		case '*', '?', '[', '\\':
+			return true
+		}
+	}
+	return false
+}
+
+/*
+A struct that holds the next line of one of the files being merged.
+*/
+type mergeCursor struct {
+	source    *FileSource
+	line      []byte
+	index     int
+	timestamp time.Time
+}
+
+/*
+A min-heap of cursors, ordered by the timestamp of their next line.
+
+Lines with the same timestamp are taken from the files in the order they were given, so the merge is deterministic.
+*/
+type mergeHeap []*mergeCursor
+
+func (h mergeHeap) Len() int { return len(h) }
+func (h mergeHeap) Less(i, j int) bool {
+	if !h[i].timestamp.Equal(h[j].timestamp) {
+		return h[i].timestamp.Before(h[j].timestamp)
+	}
+	return h[i].index < h[j].index
+}
+func (h mergeHeap) Swap(i, j int)       { h[i], h[j] = h[j], h[i] }
+func (h *mergeHeap) Push(x interface{}) { *h = append(*h, x.(*mergeCursor)) }
+func (h *mergeHeap) Pop() interface{} {
+	old := *h
+	cursor := old[len(old)-1]
+	*h = old[:len(old)-1]
+	return cursor
+}
+
+/*
+A function that moves a cursor to the next line of its file, reading its timestamp.
+
+Returns true if a line was read, and an error if the line or its timestamp is invalid.
+*/
+func (c *mergeCursor) advance(ctx context.Context, raw *RawEvent) (bool, error) {
+	line, err := c.source.Next(ctx)
+	if err == io.EOF {
+		return false, nil
+	}
+	if err != nil {
+		return false, err
+	}
+	c.line = line
+
+	if err := DecodeRawEvent(line, FieldTimestamp, raw); err != nil {
+		return false, err
+	}
+
+	timestamp, err := raw.Time()
+	if err != nil {
+		return false, err
+	}
+
+	c.timestamp = timestamp
+	return true, nil
+}
+
+/*
+A function that merges the lines of several events files into a single stream ordered by timestamp.
+
+Each file has to be ordered by timestamp, and the next line of every file is kept in a heap,
+so only one line per file is held in memory.
+Receives the context, checked while merging, the paths to the files
+and a function called with each line, which is only valid until the function returns.
+Returns an error.
+*/
+func MergeEventsLines(ctx context.Context, filepaths []string, emit func(line []byte) error) error {
+	cursors := make(mergeHeap, 0, len(filepaths))
+	raw := RawEvent{}
+
+	for index, path := range filepaths {
+		file, err := os.Open(path)
+		if err != nil {
+			return err
+		}
+		defer file.Close()
+
+		cursor := &mergeCursor{source: NewFileSource(file), index: index}
+		found, err := cursor.advance(ctx, &raw)
+		if err != nil {
+			return err
+		}
+		if found {
+			cursors = append(cursors, cursor)
+		}
+	}
+	heap.Init(&cursors)
+
+	for lines := 0; cursors.Len() > 0; lines++ {
+		if err := checkCancelled(ctx, lines); err != nil {
+			return err
+		}
+
+		cursor := cursors[0]
+		if err := emit(cursor.line); err != nil {
+			return err
+		}
+
+		found, err := cursor.advance(ctx, &raw)
+		if err != nil {
+			return err
+		}
+		if found {
+			heap.Fix(&cursors, 0)
+		} else {
+			heap.Pop(&cursors)
+		}
+	}
+
+	return nil
+}
+
+/*
+A function that reads several events files, merging their events in timestamp order, reading only the selected fields.
+
+Receives the context, the paths to the files, each ordered by timestamp, and the fields to read.
+Returns the merged list of events and an error.
+*/
+func MergeEventsFiles(ctx context.Context, filepaths []string, fields Field) ([]EventTranslationDelivered, error) {
+	events := make([]EventTranslationDelivered, 0)
+	raw := RawEvent{}
+
+	err := MergeEventsLines(ctx, filepaths, func(line []byte) error {
+		if err := DecodeRawEvent(line, fields, &raw); err != nil {
+			return err
+		}
+
+		events = append(events, raw.Event())
+		return nil
+	})
+	if err != nil {
+		return []EventTranslationDelivered{}, err
+	}
+
+	return events, nil
+}
@@ -0,0 +1,115 @@
+package events_test
+
+import (
+	"context"
+	"errors"
+	"reflect"
+	"testing"
+
+	"github.com/jmbds/unbabel-backend-engineering-challenge/internal/events"
+)
+
+func TestExpandInputFiles(t *testing.T) {
+	testcases := []struct {
+		name          string
+		patterns      []string
+		expected      []string
+		expectedError error
+	}{
+		{
+			"valid case - paths",
+			[]string{"testcases/events.json", "testcases/not_found.json"},
+			[]string{"testcases/events.json", "testcases/not_found.json"},
+			errors.New(""),
+		},
+		{
+			"valid case - glob pattern",
+			[]string{"testcases/rotated/*.json", "testcases/events.json"},
+			[]string{"testcases/rotated/events-1.json", "testcases/rotated/events-2.json", "testcases/events.json"},
+			errors.New(""),
+		},
+		{
+			"invalid case - no matches",
+			[]string{"testcases/rotated/*.log"},
+			[]string{},
+			errors.New("No input files match testcases/rotated/*.log. Please provide a pattern matching at least one file."),
+		},
+		{
+			"invalid case - malformed pattern",
+			[]string{"testcases/[.json"},
+			[]string{},
+			errors.New("Invalid input file pattern testcases/[.json. Please provide a valid glob pattern."),
+		},
+	}
+
+	for _, tc := range testcases {
+		t.Run(tc.name, func(t *testing.T) {
+			got, err := events.ExpandInputFiles(tc.patterns)
+			if err != nil && err.Error() != tc.expectedError.Error() {
+				t.Errorf("Unexpected error: %s", err.Error())
+			}
+
+			if !reflect.DeepEqual(got, tc.expected) {
+				t.Errorf("expected %v, got %v", tc.expected, got)
+			}
+		})
+	}
+}
+
+func TestMergeEventsFiles(t *testing.T) {
+	expected, err := events.ReadEventsFile(context.Background(), "testcases/events.json", events.AllFields)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	testcases := []struct {
+		name          string
+		filepaths     []string
+		expected      []events.EventTranslationDelivered
+		expectedError error
+	}{
+		{
+			"valid case - interleaved files",
+			[]string{"testcases/rotated/events-1.json", "testcases/rotated/events-2.json"},
+			expected,
+			errors.New(""),
+		},
+		{
+			"valid case - single file",
+			[]string{"testcases/events.json"},
+			expected,
+			errors.New(""),
+		},
+		{
+			"valid case - same timestamps keep the file order",
+			[]string{"testcases/rotated/events-2.json", "testcases/events.json"},
+			[]events.EventTranslationDelivered{expected[0], expected[1], expected[1], expected[2]},
+			errors.New(""),
+		},
+		{
+			"invalid case - file not found",
+			[]string{"testcases/events.json", "testcases/not_found.json"},
+			[]events.EventTranslationDelivered{},
+			errors.New("open testcases/not_found.json: no such file or directory"),
+		},
+		{
+			"invalid case - invalid format",
+			[]string{"testcases/events.json", "testcases/invalid_events.json"},
+			[]events.EventTranslationDelivered{},
+			errors.New("Content is invalid. Please provide a valid events file."),
+		},
+	}
+
+	for _, tc := range testcases {
+		t.Run(tc.name, func(t *testing.T) {
+			got, err := events.MergeEventsFiles(context.Background(), tc.filepaths, events.AllFields)
+			if err != nil && err.Error() != tc.expectedError.Error() {
+				t.Errorf("Unexpected error: %s", err.Error())
+			}
+
+			if !reflect.DeepEqual(got, tc.expected) {
+				t.Errorf("expected %v, got %v", tc.expected, got)
+			}
+		})
+	}
+}
@@ -0,0 +1,155 @@
+package events
+
+import (
+	"bufio"
+	"context"
+	"errors"
+	"io"
+	"os"
+	"sync"
+	"time"
+
+	"github.com/jmbds/unbabel-backend-engineering-challenge/internal/statistics"
+)
+
+/*
+A struct that holds the result of reading a chunk of the events file.
+
+Events are the events in the chunk, and Dataset their durations grouped by unit, starting at the unit of the first event in the chunk.
+*/
+type chunkResult struct {
+	events  []EventTranslationDelivered
+	dataset statistics.SparseDataset
+	err     error
+}
+
+/*
+A function that reads a file and aggregates the duration of its events by time unit, using several workers.
+
+The file is split into as many newline-aligned chunks as workers, and each chunk is unmarshalled and grouped concurrently.
+Receives the context, checked by every worker, a path to a file containing the list of events, a unit of time,
+the number of workers and the fields to read.
+Returns the list of events and the dataset of data points, identical to ReadEventsFile followed by GroupEventsByUnit, and an error.
+*/
+func ReadAndGroupEventsFile(ctx context.Context, filepath string, unit time.Duration, workers int, fields Field) ([]EventTranslationDelivered, statistics.SparseDataset, error) {
+	if workers < 1 {
+		return []EventTranslationDelivered{}, statistics.SparseDataset{}, errors.New("Number of workers has to be equal or greater than 1, please provide a valid number of workers.")
+	}
+
+	file, err := os.Open(filepath)
+	if err != nil {
+		return []EventTranslationDelivered{}, statistics.SparseDataset{}, err
+	}
+	defer file.Close()
+
+	info, err := file.Stat()
+	if err != nil {
+		return []EventTranslationDelivered{}, statistics.SparseDataset{}, err
+	}
+
+	boundaries, err := splitIntoChunks(file, info.Size(), workers)
+	if err != nil {
+		return []EventTranslationDelivered{}, statistics.SparseDataset{}, err
+	}
+
+	/* Read and group each chunk concurrently. Results are kept in chunk order so the merge is deterministic. */
+	results := make([]chunkResult, len(boundaries)-1)
+	var wg sync.WaitGroup
+	for i := range results {
+		wg.Add(1)
+		go func(i int) {
+			defer wg.Done()
+			section := io.NewSectionReader(file, boundaries[i], boundaries[i+1]-boundaries[i])
+			results[i] = readAndGroupChunk(ctx, section, unit, fields|DefaultFields)
+		}(i)
+	}
+	wg.Wait()
+
+	/* Merge the partial datasets, shifting each one by the units between its start and the start of the first chunk */
+	events := make([]EventTranslationDelivered, 0)
+	dataset := statistics.SparseDataset{Buckets: make([]statistics.Bucket, 0)}
+	var windowStart time.Time
+
+	for _, result := range results {
+		if result.err != nil {
+			return []EventTranslationDelivered{}, statistics.SparseDataset{}, result.err
+		}
+		if len(result.events) == 0 {
+			continue
+		}
+
+		chunkStart, _, err := GetEventWindowByUnit(result.events, unit)
+		if err != nil {
+			return []EventTranslationDelivered{}, statistics.SparseDataset{}, err
+		}
+		if len(events) == 0 {
+			windowStart = chunkStart
+			dataset.Start, dataset.Unit = result.dataset.Start, result.dataset.Unit
+		}
+
+		offset := calculateUnitDifference(windowStart, chunkStart, unit)
+		if offset < 0 {
+			return []EventTranslationDelivered{}, statistics.SparseDataset{}, errors.New("Events are not ordered by timestamp. Please provide events ordered from oldest to newest.")
+		}
+
+		for _, bucket := range result.dataset.Buckets {
+			dataset.Add(offset+bucket.Index, bucket.DataPoint)
+		}
+		if length := offset + result.dataset.Length; length > dataset.Length {
+			dataset.Length = length
+		}
+
+		events = append(events, result.events...)
+	}
+
+	if len(events) == 0 {
+		return []EventTranslationDelivered{}, statistics.SparseDataset{}, errors.New("No events found. Please provide a valid list of events.")
+	}
+
+	return events, dataset, nil
+}
+
+/*
+A function that splits a file into newline-aligned chunks of roughly the same size.
+
+Returns the offsets where each chunk starts, followed by the size of the file, and an error.
+*/
+func splitIntoChunks(file *os.File, size int64, chunks int) ([]int64, error) {
+	boundaries := []int64{0}
+
+	for i := 1; i < chunks; i++ {
+		position := size * int64(i) / int64(chunks)
+		if previous := boundaries[len(boundaries)-1]; position < previous {
+			position = previous
+		}
+
+		/* Move the boundary to the start of the next line */
+		reader := bufio.NewReader(io.NewSectionReader(file, position, size-position))
+		line, err := reader.ReadBytes('\n')
+		if err != nil && err != io.EOF {
+			return nil, err
+		}
+
+		boundaries = append(boundaries, position+int64(len(line)))
+	}
+
+	return append(boundaries, size), nil
+}
+
+/*
+A function that unmarshalls and groups the events of a single chunk.
+*/
+func readAndGroupChunk(ctx context.Context, reader io.Reader, unit time.Duration, fields Field) chunkResult {
+	/* Chunks are read like the whole file is, so lines of any length are read by both */
+	events, err := ReadEventsSource(ctx, NewFileSource(reader), fields)
+	if err != nil {
+		return chunkResult{err: err}
+	}
+
+	if len(events) == 0 {
+		return chunkResult{}
+	}
+
+	dataset, err := GroupEventsByUnit(ctx, events, unit)
+	return chunkResult{events: events, dataset: dataset, err: err}
+}
@@ -0,0 +1,105 @@
+package events_test
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+	"reflect"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/jmbds/unbabel-backend-engineering-challenge/internal/events"
+	"github.com/jmbds/unbabel-backend-engineering-challenge/internal/statistics"
+)
+
+/*
+A function that writes a file with the given number of events, a few seconds apart, and returns its path.
+*/
+func writeEventsFile(t testing.TB, nrEvents int) string {
+	path := filepath.Join(t.TempDir(), "events.json")
+	file, err := os.Create(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer file.Close()
+
+	start := time.Date(2018, 12, 26, 18, 11, 8, 509654000, time.UTC)
+	for i := 0; i < nrEvents; i++ {
+		timestamp := start.Add(time.Duration(i*7) * time.Second).Format(events.InputTimestampFormat)
+		fmt.Fprintf(file, "{\"timestamp\": \"%s\",\"translation_id\": \"%020d\",\"source_language\": \"en\",\"target_language\": \"fr\",\"client_name\": \"airliberty\",\"event_name\": \"translation_delivered\",\"nr_words\": 30, \"duration\": %d}\n", timestamp, i, i%60)
+	}
+
+	return path
+}
+
+/*
+A function that writes a file of events with a line longer than a bufio.Scanner token in the middle, and returns its path.
+*/
+func writeLongLineEventsFile(t testing.TB) string {
+	content, err := os.ReadFile(writeEventsFile(t, 20))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	lines := strings.SplitAfter(string(content), "\n")
+	long := strings.Replace(lines[1], "\"nr_words\"", "\"padding\": \""+strings.Repeat("a", 70*1024)+"\", \"nr_words\"", 1)
+	path := filepath.Join(t.TempDir(), "events.json")
+	if err := os.WriteFile(path, []byte(lines[0]+long+strings.Join(lines[2:], "")), 0644); err != nil {
+		t.Fatal(err)
+	}
+	return path
+}
+
+func TestReadAndGroupEventsFile(t *testing.T) {
+	generated := writeEventsFile(t, 1000)
+
+	testcases := []struct {
+		name          string
+		filepath      string
+		workers       int
+		expectedError error
+	}{
+		{"valid case - one worker", "testcases/events.json", 1, errors.New("")},
+		{"valid case - more workers than lines", "testcases/events.json", 5, errors.New("")},
+		{"valid case - generated file", generated, 4, errors.New("")},
+		{"valid case - generated file with many workers", generated, 33, errors.New("")},
+		{"invalid case - file not found", "testcases/not_found.json", 2, errors.New("open testcases/not_found.json: no such file or directory")},
+		{"invalid case - invalid format", "testcases/invalid_events.json", 2, errors.New("Content is invalid. Please provide a valid events file.")},
+		{"valid case - lines longer than a scanner token", writeLongLineEventsFile(t), 2, errors.New("")},
+		{"invalid case - wrong number of workers", "testcases/events.json", 0, errors.New("Number of workers has to be equal or greater than 1, please provide a valid number of workers.")},
+	}
+
+	for _, tc := range testcases {
+		t.Run(tc.name, func(t *testing.T) {
+			/* The sequential path is the reference for the expected result */
+			expectedEvents, expectedDataset := []events.EventTranslationDelivered{}, statistics.SparseDataset{}
+			if tc.expectedError.Error() == "" {
+				var err error
+				expectedEvents, err = events.ReadEventsFile(context.Background(), tc.filepath, events.AllFields)
+				if err != nil {
+					t.Fatal(err)
+				}
+				expectedDataset, err = events.GroupEventsByUnit(context.Background(), expectedEvents, time.Minute)
+				if err != nil {
+					t.Fatal(err)
+				}
+			}
+
+			gotEvents, gotDataset, err := events.ReadAndGroupEventsFile(context.Background(), tc.filepath, time.Minute, tc.workers, events.AllFields)
+			if err != nil && err.Error() != tc.expectedError.Error() {
+				t.Errorf("Unexpected error: %s", err.Error())
+			}
+
+			if !reflect.DeepEqual(gotEvents, expectedEvents) {
+				t.Errorf("expected %v, got %v", expectedEvents, gotEvents)
+			}
+
+			if !reflect.DeepEqual(gotDataset, expectedDataset) {
+				t.Errorf("expected %v, got %v", expectedDataset, gotDataset)
+			}
+		})
+	}
+}
@@ -0,0 +1,283 @@
+package events
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"io"
+	"os"
+	"time"
+)
+
+const (
+	EventNameTranslationRequested = "translation_requested"
+	EventNameTranslationDelivered = "translation_delivered"
+)
+
+/*
+An event of any of the types known to a Registry.
+*/
+type Event interface {
+	Name() string
+}
+
+type EventTranslationRequested struct {
+	Timestamp      string `json:"timestamp"`
+	TranslationId  string `json:"translation_id"`
+	SourceLanguage string `json:"source_language"`
+	TargetLanguage string `json:"target_language"`
+	ClientName     string `json:"client_name"`
+	EventName      string `json:"event_name"`
+	NrWords        int    `json:"nr_words"`
+}
+
+func (e EventTranslationRequested) Name() string {
+	return EventNameTranslationRequested
+}
+
+func (e EventTranslationDelivered) Name() string {
+	return EventNameTranslationDelivered
+}
+
+/*
+A function that checks if an event is a translation_delivered event, which carries a delivery time.
+
+Events without an event name are considered delivered, as every event used to be, and are decoded as such by a Registry.
+*/
+func IsDelivered(event EventTranslationDelivered) bool {
+	return event.EventName == "" || event.EventName == EventNameTranslationDelivered
+}
+
+/*
+A function that decodes a line into an event of a given type.
+*/
+type EventDecoder func(line []byte) (Event, error)
+
+/*
+A struct that decodes events of several types, choosing the decoder by the event_name of each line.
+*/
+type Registry struct {
+	decoders map[string]EventDecoder
+}
+
+/*
+A function that creates a Registry with the translation_requested and translation_delivered events.
+*/
+func NewRegistry() *Registry {
+	registry := &Registry{decoders: make(map[string]EventDecoder)}
+
+	registry.Register(EventNameTranslationRequested, func(line []byte) (Event, error) {
+		event := EventTranslationRequested{}
+		err := json.Unmarshal(line, &event)
+		return event, err
+	})
+	registry.Register(EventNameTranslationDelivered, func(line []byte) (Event, error) {
+		event := EventTranslationDelivered{}
+		err := json.Unmarshal(line, &event)
+		return event, err
+	})
+
+	return registry
+}
+
+/*
+A function that registers the decoder of an event type, replacing any previous decoder for the same event name.
+*/
+func (r *Registry) Register(name string, decoder EventDecoder) {
+	r.decoders[name] = decoder
+}
+
+/*
+A function that decodes a line with the decoder registered for its event_name.
+
+Lines without an event_name are decoded as translation_delivered events, like IsDelivered considers them.
+Returns the event, or nil if no decoder is registered for its event name, and an error if the line is invalid.
+*/
+func (r *Registry) Decode(line []byte) (Event, error) {
+	raw := RawEvent{}
+	if err := DecodeRawEvent(line, FieldEventName, &raw); err != nil {
+		return nil, err
+	}
+
+	name := string(raw.EventName)
+	if name == "" {
+		name = EventNameTranslationDelivered
+	}
+
+	decoder, found := r.decoders[name]
+	if !found {
+		return nil, nil
+	}
+
+	event, err := decoder(line)
+	if err != nil {
+		return nil, errInvalidContent
+	}
+	return event, nil
+}
+
+/*
+A function that reads a file and decodes its contents, line by line, with the registered decoders.
+
+Receives the context, checked while reading, and a path to a file containing the list of events.
+Returns a list of events, skipping the events with no registered decoder, and an error.
+*/
+func (r *Registry) ReadEventsFile(ctx context.Context, filepath string) ([]Event, error) {
+	file, err := os.Open(filepath)
+	if err != nil {
+		return []Event{}, err
+	}
+	defer file.Close()
+
+	events := make([]Event, 0)
+	source := NewFileSource(file)
+
+	for {
+		line, err := source.Next(ctx)
+		if err == io.EOF {
+			return events, nil
+		}
+		if err != nil {
+			return []Event{}, err
+		}
+
+		event, err := r.Decode(line)
+		if err != nil {
+			return []Event{}, err
+		}
+
+		if event != nil {
+			events = append(events, event)
+		}
+	}
+}
+
+/*
+A function that reads several files, merging their events in timestamp order, and decodes them with the registered decoders.
+
+Receives the context, checked while reading, and the paths to the files, each ordered by timestamp.
+Returns the merged list of events, skipping the events with no registered decoder, and an error.
+*/
+func (r *Registry) ReadEventsFiles(ctx context.Context, filepaths []string) ([]Event, error) {
+	events := make([]Event, 0)
+
+	err := MergeEventsLines(ctx, filepaths, func(line []byte) error {
+		event, err := r.Decode(line)
+		if err != nil {
+			return err
+		}
+
+		if event != nil {
+			events = append(events, event)
+		}
+		return nil
+	})
+	if err != nil {
+		return []Event{}, err
+	}
+
+	return events, nil
+}
+
+/*
+A function that filters a list of events by event name, keeping only the translation_delivered events.
+Receives a list of events.
+
+Returns the delivered events, in the same order.
+*/
+func FilterDeliveredEvents(events []EventTranslationDelivered) []EventTranslationDelivered {
+	filtered := make([]EventTranslationDelivered, 0, len(events))
+	for _, event := range events {
+		if IsDelivered(event) {
+			filtered = append(filtered, event)
+		}
+	}
+	return filtered
+}
+
+/*
+A struct that holds a translation_requested event waiting for its delivery.
+*/
+type pendingRequest struct {
+	translationId string
+	timestamp     time.Time
+}
+
+/*
+A struct that holds the events dropped while joining requests and deliveries.
+
+Unmatched is the number of translation_delivered events without a request within the horizon,
+and Expired the number of translation_requested events without a delivery within the horizon.
+*/
+type JoinStats struct {
+	Unmatched int
+	Expired   int
+}
+
+/*
+A function that derives the delivery time of translations from their translation_requested and translation_delivered events.
+
+Each translation_delivered event is joined with the latest translation_requested event with the same translation_id before it,
+and its Duration replaced with the seconds between both events.
+Requests pending for longer than the horizon are evicted, so memory is bound by the requests within the horizon,
+counted as expired, and their deliveries counted as without a request.
+Receives a list of events, ordered by timestamp, and the horizon, which bounds the longest delivery time that can be derived.
+Returns the delivered events with the derived durations, the number of events dropped, and an error.
+*/
+func JoinDeliveryTimes(events []Event, horizon time.Duration) ([]EventTranslationDelivered, JoinStats, error) {
+	requested := make(map[string]time.Time)
+	pending := make([]pendingRequest, 0)
+	delivered := make([]EventTranslationDelivered, 0)
+	stats := JoinStats{}
+
+	/* Requests are pending in timestamp order, so the oldest are always at the front */
+	evict := func(now time.Time) {
+		evicted := 0
+		for evicted < len(pending) && now.Sub(pending[evicted].timestamp) > horizon {
+			request := pending[evicted]
+			if timestamp, found := requested[request.translationId]; found && timestamp.Equal(request.timestamp) {
+				delete(requested, request.translationId)
+				stats.Expired++
+			}
+			evicted++
+		}
+		pending = pending[evicted:]
+	}
+
+	for _, event := range events {
+		switch event := event.(type) {
+		case EventTranslationRequested:
+			timestamp, err := time.Parse(InputTimestampFormat, event.Timestamp)
+			if err != nil {
+				return []EventTranslationDelivered{}, JoinStats{}, errInvalidDate
+			}
+			evict(timestamp)
+
+			requested[event.TranslationId] = timestamp
+			pending = append(pending, pendingRequest{translationId: event.TranslationId, timestamp: timestamp})
+
+		case EventTranslationDelivered:
+			timestamp, err := time.Parse(InputTimestampFormat, event.Timestamp)
+			if err != nil {
+				return []EventTranslationDelivered{}, JoinStats{}, errInvalidDate
+			}
+			evict(timestamp)
+
+			requestTimestamp, found := requested[event.TranslationId]
+			if !found {
+				stats.Unmatched++
+				continue
+			}
+			delete(requested, event.TranslationId)
+
+			if timestamp.Before(requestTimestamp) {
+				return []EventTranslationDelivered{}, JoinStats{}, errors.New("Translation " + event.TranslationId + " was delivered before it was requested. Please provide events ordered from oldest to newest.")
+			}
+
+			event.Duration = int(timestamp.Sub(requestTimestamp) / time.Second)
+			delivered = append(delivered, event)
+		}
+	}
+
+	return delivered, stats, nil
+}
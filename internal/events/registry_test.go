@@ -0,0 +1,217 @@
+package events_test
+
+import (
+	"bufio"
+	"context"
+	"encoding/json"
+	"errors"
+	"os"
+	"reflect"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/jmbds/unbabel-backend-engineering-challenge/internal/events"
+)
+
+func TestRegistryReadEventsFile(t *testing.T) {
+	testcases := []struct {
+		name          string
+		filepath      string
+		expected      []events.Event
+		expectedError error
+	}{
+		{
+			"valid case",
+			"testcases/requested_events.json",
+			[]events.Event{
+				events.EventTranslationRequested{Timestamp: "2018-12-26 18:10:48.509654", TranslationId: "5aa5b2f39f7254a75aa5", SourceLanguage: "en", TargetLanguage: "fr", ClientName: "airliberty", EventName: "translation_requested", NrWords: 30},
+				events.EventTranslationDelivered{Timestamp: "2018-12-26 18:11:08.509654", TranslationId: "5aa5b2f39f7254a75aa5", SourceLanguage: "en", TargetLanguage: "fr", ClientName: "airliberty", EventName: "translation_delivered", Duration: 20, NrWords: 30},
+				events.EventTranslationRequested{Timestamp: "2018-12-26 18:14:48.903159", TranslationId: "5aa5b2f39f7254a75aa4", SourceLanguage: "en", TargetLanguage: "fr", ClientName: "airliberty", EventName: "translation_requested", NrWords: 30},
+				events.EventTranslationDelivered{Timestamp: "2018-12-26 18:15:19.903159", TranslationId: "5aa5b2f39f7254a75aa4", SourceLanguage: "en", TargetLanguage: "fr", ClientName: "airliberty", EventName: "translation_delivered", Duration: 0, NrWords: 30},
+				events.EventTranslationDelivered{Timestamp: "2018-12-26 18:23:19.903159", TranslationId: "5aa5b2f39f7254a75bb3", SourceLanguage: "en", TargetLanguage: "fr", ClientName: "taxi-eats", EventName: "translation_delivered", Duration: 54, NrWords: 100},
+			},
+			errors.New(""),
+		},
+		{
+			"valid case - events without an event name are delivered",
+			"testcases/unnamed_events.json",
+			[]events.Event{
+				events.EventTranslationDelivered{Timestamp: "2018-12-26 18:11:08.509654", TranslationId: "5aa5b2f39f7254a75aa5", SourceLanguage: "en", TargetLanguage: "fr", ClientName: "airliberty", Duration: 20, NrWords: 30},
+			},
+			errors.New(""),
+		},
+		{
+			"invalid case - file not found",
+			"testcases/not_found.json",
+			[]events.Event{},
+			errors.New("open testcases/not_found.json: no such file or directory"),
+		},
+		{
+			"invalid case - invalid format",
+			"testcases/invalid_events.json",
+			[]events.Event{},
+			errors.New("Content is invalid. Please provide a valid events file."),
+		},
+	}
+
+	for _, tc := range testcases {
+		t.Run(tc.name, func(t *testing.T) {
+			got, err := events.NewRegistry().ReadEventsFile(context.Background(), tc.filepath)
+			if err != nil && err.Error() != tc.expectedError.Error() {
+				t.Errorf("Unexpected error: %s", err.Error())
+			}
+
+			if !reflect.DeepEqual(got, tc.expected) {
+				t.Errorf("expected %v, got %v", tc.expected, got)
+			}
+		})
+	}
+}
+
+func TestRegistryReadEventsFileLongLine(t *testing.T) {
+	filepath := t.TempDir() + "/events.json"
+	translationId := strings.Repeat("a", bufio.MaxScanTokenSize)
+	line := "{\"event_name\": \"translation_delivered\", \"translation_id\": \"" + translationId + "\"}\n"
+	if err := os.WriteFile(filepath, []byte(line), 0644); err != nil {
+		t.Fatal(err)
+	}
+
+	/* Lines longer than a bufio.Scanner token are read like any other */
+	got, err := events.NewRegistry().ReadEventsFile(context.Background(), filepath)
+	if err != nil {
+		t.Fatal(err)
+	}
+	expected := []events.Event{events.EventTranslationDelivered{TranslationId: translationId, EventName: "translation_delivered"}}
+	if !reflect.DeepEqual(got, expected) {
+		t.Errorf("expected a single event with the long translation_id, got %d events", len(got))
+	}
+}
+
+type eventTranslationReviewed struct {
+	TranslationId string `json:"translation_id"`
+}
+
+func (e eventTranslationReviewed) Name() string {
+	return "translation_reviewed"
+}
+
+func TestRegistryRegister(t *testing.T) {
+	registry := events.NewRegistry()
+	registry.Register("translation_reviewed", func(line []byte) (events.Event, error) {
+		event := eventTranslationReviewed{}
+		err := json.Unmarshal(line, &event)
+		return event, err
+	})
+
+	got, err := registry.Decode([]byte("{\"event_name\": \"translation_reviewed\", \"translation_id\": \"5aa5b2f39f7254a75aa4\"}"))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	expected := eventTranslationReviewed{TranslationId: "5aa5b2f39f7254a75aa4"}
+	if !reflect.DeepEqual(got, expected) {
+		t.Errorf("expected %v, got %v", expected, got)
+	}
+}
+
+func TestJoinDeliveryTimes(t *testing.T) {
+	testcases := []struct {
+		name          string
+		events        []events.Event
+		horizon       time.Duration
+		expected      []events.EventTranslationDelivered
+		expectedStats events.JoinStats
+		expectedError error
+	}{
+		{
+			"valid case",
+			[]events.Event{
+				events.EventTranslationRequested{Timestamp: "2018-12-26 18:10:48.509654", TranslationId: "5aa5b2f39f7254a75aa5"},
+				events.EventTranslationDelivered{Timestamp: "2018-12-26 18:11:08.509654", TranslationId: "5aa5b2f39f7254a75aa5", Duration: 99},
+				events.EventTranslationRequested{Timestamp: "2018-12-26 18:14:48.903159", TranslationId: "5aa5b2f39f7254a75aa4"},
+				events.EventTranslationDelivered{Timestamp: "2018-12-26 18:15:19.903159", TranslationId: "5aa5b2f39f7254a75aa4"},
+				events.EventTranslationDelivered{Timestamp: "2018-12-26 18:23:19.903159", TranslationId: "5aa5b2f39f7254a75bb3", Duration: 54},
+			},
+			10 * time.Minute,
+			[]events.EventTranslationDelivered{
+				{Timestamp: "2018-12-26 18:11:08.509654", TranslationId: "5aa5b2f39f7254a75aa5", Duration: 20},
+				{Timestamp: "2018-12-26 18:15:19.903159", TranslationId: "5aa5b2f39f7254a75aa4", Duration: 31},
+			},
+			events.JoinStats{Unmatched: 1},
+			errors.New(""),
+		},
+		{
+			"valid case - requests older than the horizon are evicted",
+			[]events.Event{
+				events.EventTranslationRequested{Timestamp: "2018-12-26 18:10:48.509654", TranslationId: "5aa5b2f39f7254a75aa5"},
+				events.EventTranslationRequested{Timestamp: "2018-12-26 18:14:48.903159", TranslationId: "5aa5b2f39f7254a75aa4"},
+				events.EventTranslationDelivered{Timestamp: "2018-12-26 18:15:19.903159", TranslationId: "5aa5b2f39f7254a75aa4"},
+				events.EventTranslationDelivered{Timestamp: "2018-12-26 18:16:08.509654", TranslationId: "5aa5b2f39f7254a75aa5"},
+			},
+			5 * time.Minute,
+			[]events.EventTranslationDelivered{
+				{Timestamp: "2018-12-26 18:15:19.903159", TranslationId: "5aa5b2f39f7254a75aa4", Duration: 31},
+			},
+			events.JoinStats{Unmatched: 1, Expired: 1},
+			errors.New(""),
+		},
+		{
+			"valid case - a request repeated within the horizon is kept",
+			[]events.Event{
+				events.EventTranslationRequested{Timestamp: "2018-12-26 18:10:48.509654", TranslationId: "5aa5b2f39f7254a75aa5"},
+				events.EventTranslationRequested{Timestamp: "2018-12-26 18:14:48.903159", TranslationId: "5aa5b2f39f7254a75aa5"},
+				events.EventTranslationDelivered{Timestamp: "2018-12-26 18:16:19.903159", TranslationId: "5aa5b2f39f7254a75aa5"},
+			},
+			5 * time.Minute,
+			[]events.EventTranslationDelivered{
+				{Timestamp: "2018-12-26 18:16:19.903159", TranslationId: "5aa5b2f39f7254a75aa5", Duration: 91},
+			},
+			events.JoinStats{},
+			errors.New(""),
+		},
+		{
+			"invalid case - wrong date format",
+			[]events.Event{
+				events.EventTranslationRequested{Timestamp: "26-12-2018 18:10:48.509654", TranslationId: "5aa5b2f39f7254a75aa5"},
+			},
+			10 * time.Minute,
+			[]events.EventTranslationDelivered{},
+			events.JoinStats{},
+			errors.New("Invalid date format. Please provide dates in the following format: " + InputTimestampFormat + "\n"),
+		},
+	}
+
+	for _, tc := range testcases {
+		t.Run(tc.name, func(t *testing.T) {
+			got, stats, err := events.JoinDeliveryTimes(tc.events, tc.horizon)
+			if err != nil && err.Error() != tc.expectedError.Error() {
+				t.Errorf("Unexpected error: %s", err.Error())
+			}
+
+			if !reflect.DeepEqual(got, tc.expected) {
+				t.Errorf("expected %v, got %v", tc.expected, got)
+			}
+
+			if stats != tc.expectedStats {
+				t.Errorf("expected %v dropped, got %v", tc.expectedStats, stats)
+			}
+		})
+	}
+}
+
+func TestFilterDeliveredEvents(t *testing.T) {
+	got := events.FilterDeliveredEvents([]events.EventTranslationDelivered{
+		{Timestamp: "2018-12-26 18:10:48.509654", EventName: "translation_requested"},
+		{Timestamp: "2018-12-26 18:11:08.509654", EventName: "translation_delivered", Duration: 20},
+		{Timestamp: "2018-12-26 18:15:19.903159", Duration: 31},
+	})
+
+	expected := []events.EventTranslationDelivered{
+		{Timestamp: "2018-12-26 18:11:08.509654", EventName: "translation_delivered", Duration: 20},
+		{Timestamp: "2018-12-26 18:15:19.903159", Duration: 31},
+	}
+	if !reflect.DeepEqual(got, expected) {
+		t.Errorf("expected %v, got %v", expected, got)
+	}
+}
@@ -0,0 +1,107 @@
+package events
+
+import (
+	"bufio"
+	"bytes"
+	"context"
+	"io"
+)
+
+/*
+An interface of a source of events, read one line at a time, like a file or a message bus.
+
+Next returns the next line, which is only valid until Next is called again, and io.EOF once the source ended.
+Sources that never end, like a message bus, wait for the next line until the context is cancelled.
+*/
+type Source interface {
+	Next(ctx context.Context) ([]byte, error)
+}
+
+/*
+A struct that reads events from a file, or any other reader, one line at a time.
+
+Lines have no length limit: lines longer than the buffer of the reader are gathered in line, which is reused between them.
+*/
+type FileSource struct {
+	reader *bufio.Reader
+	line   []byte
+	lines  int
+}
+
+/*
+A function that creates a FileSource.
+
+Receives the reader positioned at the first line to read.
+Returns the FileSource.
+*/
+func NewFileSource(reader io.Reader) *FileSource {
+	return &FileSource{reader: bufio.NewReader(reader)}
+}
+
+/*
+A function that returns the next line of the file, without its newline, like a bufio.Scanner but of any length.
+
+Returns the line and an error, which is io.EOF at the end of the file, or the error of the context once cancelled.
+*/
+func (s *FileSource) Next(ctx context.Context) ([]byte, error) {
+	if err := checkCancelled(ctx, s.lines); err != nil {
+		return nil, err
+	}
+
+	/* Lines that fit in the buffer are returned from it, without copying them */
+	chunk, err := s.reader.ReadSlice('\n')
+	if err == nil {
+		s.lines++
+		return trimNewline(chunk), nil
+	}
+
+	s.line = append(s.line[:0], chunk...)
+	for err == bufio.ErrBufferFull {
+		chunk, err = s.reader.ReadSlice('\n')
+		s.line = append(s.line, chunk...)
+	}
+	if err == io.EOF && len(s.line) == 0 {
+		return nil, io.EOF
+	}
+	if err != nil && err != io.EOF {
+		return nil, err
+	}
+
+	s.lines++
+	return trimNewline(s.line), nil
+}
+
+/*
+A function that drops the newline ending a line, along with the carriage return before it.
+*/
+func trimNewline(line []byte) []byte {
+	line = bytes.TrimSuffix(line, []byte("\n"))
+	return bytes.TrimSuffix(line, []byte("\r"))
+}
+
+/*
+A function that reads a source until it ends and decodes its lines, reading only the selected fields.
+
+Receives the context, the source and the fields to read.
+Returns a list of events, where fields that were not selected are empty, and an error.
+*/
+func ReadEventsSource(ctx context.Context, source Source, fields Field) ([]EventTranslationDelivered, error) {
+	events := make([]EventTranslationDelivered, 0)
+	raw := RawEvent{}
+
+	for {
+		line, err := source.Next(ctx)
+		if err == io.EOF {
+			return events, nil
+		}
+		if err != nil {
+			return []EventTranslationDelivered{}, err
+		}
+
+		if err := DecodeRawEvent(line, fields, &raw); err != nil {
+			return []EventTranslationDelivered{}, err
+		}
+
+		events = append(events, raw.Event())
+	}
+}
@@ -0,0 +1,115 @@
+package events
+
+import (
+	"errors"
+	"time"
+
+	"github.com/jmbds/unbabel-backend-engineering-challenge/internal/statistics"
+)
+
+/* Error returned when an event is older than the buckets already emitted */
+var ErrUnorderedEvents = errors.New("Events are not ordered by timestamp. Please provide events ordered from oldest to newest.")
+
+/*
+A struct that calculates the moving average while events are read, emitting each value as soon as its bucket is complete.
+
+Window holds the buckets of the moving average emitted so far.
+Pending holds the bucket currently being filled, which is emitted at Next, the end of its interval.
+Started is false until the first event is added.
+Emit is called with the value of each bucket, and once the window only holds empty buckets,
+with the rest of an empty stretch as a single point spanning all of its buckets, like IterateMovingWindowRuns does.
+*/
+type StreamAggregator struct {
+	Unit    time.Duration
+	Window  *statistics.MovingWindow
+	Pending statistics.DataPoint
+	Next    time.Time
+	Started bool
+	Emit    func(point statistics.Point) error
+}
+
+/*
+A function that creates a StreamAggregator.
+
+Receives the window size, the unit of time of each bucket and the function called with each moving average value and its interval.
+Returns the StreamAggregator and an error.
+*/
+func NewStreamAggregator(windowSize int, unit time.Duration, emit func(statistics.Point) error) (*StreamAggregator, error) {
+	window, err := statistics.NewMovingWindow(windowSize)
+	if err != nil {
+		return nil, err
+	}
+
+	return &StreamAggregator{Unit: unit, Window: window, Emit: emit}, nil
+}
+
+/*
+A function that adds an event to the aggregation.
+
+Every bucket before the one the event belongs to is complete, so their moving average values are emitted, empty stretches as runs.
+Returns an error if the event is invalid, is older than the buckets already emitted, or emitting failed.
+*/
+func (a *StreamAggregator) Add(event EventTranslationDelivered) error {
+	timestamp, err := time.Parse(InputTimestampFormat, event.Timestamp)
+	if err != nil {
+		return errors.New("Invalid date format. Please provide dates in the following format: " + InputTimestampFormat + "\n")
+	}
+
+	/* The output starts at the unit of the first event, like GetEventWindowByUnit */
+	if !a.Started {
+		a.Next = timestamp.Truncate(a.Unit)
+		a.Started = true
+	}
+
+	/*	Events are logged based on the unit immediately following their occurrence.	*/
+	bucket := timestamp.Add(1 * a.Unit).Truncate(a.Unit)
+	if bucket.Before(a.Next) {
+		return ErrUnorderedEvents
+	}
+
+	for a.Next.Before(bucket) {
+		/* Empty buckets don't change an empty window, so the rest of the stretch is emitted as a single run of zeros */
+		if a.Pending.Count == 0 && a.Window.Empty() {
+			if err := a.Emit(statistics.Point{Start: a.Next.Add(-a.Unit), End: bucket.Add(-a.Unit), Value: 0}); err != nil {
+				return err
+			}
+			a.Next = bucket
+			break
+		}
+
+		if err := a.emitPending(); err != nil {
+			return err
+		}
+	}
+
+	a.Pending.Total += float64(event.Duration)
+	a.Pending.Count++
+	return nil
+}
+
+/*
+A function that emits the bucket of the last event added, which is only complete once the input ended.
+
+Returns an error if no events were added or emitting failed.
+*/
+func (a *StreamAggregator) Close() error {
+	if !a.Started {
+		return errors.New("No events found. Please provide a valid list of events.")
+	}
+
+	return a.emitPending()
+}
+
+/*
+A function that pushes the pending bucket into the window, emits its moving average and moves on to the next bucket.
+*/
+func (a *StreamAggregator) emitPending() error {
+	average := a.Window.Push(a.Pending)
+	if err := a.Emit(statistics.Point{Start: a.Next.Add(-a.Unit), End: a.Next, Value: average}); err != nil {
+		return err
+	}
+
+	a.Pending = statistics.DataPoint{}
+	a.Next = a.Next.Add(a.Unit)
+	return nil
+}
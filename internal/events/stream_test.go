@@ -0,0 +1,142 @@
+package events_test
+
+import (
+	"errors"
+	"testing"
+	"time"
+
+	"github.com/jmbds/unbabel-backend-engineering-challenge/internal/events"
+	"github.com/jmbds/unbabel-backend-engineering-challenge/internal/statistics"
+)
+
+func TestStreamAggregator(t *testing.T) {
+	testcases := []struct {
+		name            string
+		events          []events.EventTranslationDelivered
+		windowSize      int
+		expected        string
+		expectedEmitted int
+		expectedError   error
+	}{
+		{
+			"valid case",
+			[]events.EventTranslationDelivered{
+				{Timestamp: "2018-12-26 18:11:08.509654", Duration: 20},
+				{Timestamp: "2018-12-26 18:15:19.903159", Duration: 31},
+				{Timestamp: "2018-12-26 18:23:19.903159", Duration: 54},
+			},
+			10,
+			"{\"date\": \"2018-12-26 18:11:00\", \"average_delivery_time\": 0}\n" +
+				"{\"date\": \"2018-12-26 18:12:00\", \"average_delivery_time\": 20}\n" +
+				"{\"date\": \"2018-12-26 18:13:00\", \"average_delivery_time\": 20}\n" +
+				"{\"date\": \"2018-12-26 18:14:00\", \"average_delivery_time\": 20}\n" +
+				"{\"date\": \"2018-12-26 18:15:00\", \"average_delivery_time\": 20}\n" +
+				"{\"date\": \"2018-12-26 18:16:00\", \"average_delivery_time\": 25.5}\n" +
+				"{\"date\": \"2018-12-26 18:17:00\", \"average_delivery_time\": 25.5}\n" +
+				"{\"date\": \"2018-12-26 18:18:00\", \"average_delivery_time\": 25.5}\n" +
+				"{\"date\": \"2018-12-26 18:19:00\", \"average_delivery_time\": 25.5}\n" +
+				"{\"date\": \"2018-12-26 18:20:00\", \"average_delivery_time\": 25.5}\n" +
+				"{\"date\": \"2018-12-26 18:21:00\", \"average_delivery_time\": 25.5}\n" +
+				"{\"date\": \"2018-12-26 18:22:00\", \"average_delivery_time\": 31}\n" +
+				"{\"date\": \"2018-12-26 18:23:00\", \"average_delivery_time\": 31}\n" +
+				"{\"date\": \"2018-12-26 18:24:00\", \"average_delivery_time\": 42.5}\n",
+			14,
+			errors.New(""),
+		},
+		{
+			"valid case - empty stretches are emitted as a run once the window is empty",
+			[]events.EventTranslationDelivered{
+				{Timestamp: "2018-12-26 18:11:08.509654", Duration: 20},
+				{Timestamp: "2018-12-26 18:20:19.903159", Duration: 54},
+			},
+			2,
+			"{\"date\": \"2018-12-26 18:11:00\", \"average_delivery_time\": 0}\n" +
+				"{\"date\": \"2018-12-26 18:12:00\", \"average_delivery_time\": 20}\n" +
+				"{\"date\": \"2018-12-26 18:13:00\", \"average_delivery_time\": 20}\n" +
+				"{\"date\": \"2018-12-26 18:14:00\", \"average_delivery_time\": 0}\n" +
+				"{\"date\": \"2018-12-26 18:15:00\", \"average_delivery_time\": 0}\n" +
+				"{\"date\": \"2018-12-26 18:16:00\", \"average_delivery_time\": 0}\n" +
+				"{\"date\": \"2018-12-26 18:17:00\", \"average_delivery_time\": 0}\n" +
+				"{\"date\": \"2018-12-26 18:18:00\", \"average_delivery_time\": 0}\n" +
+				"{\"date\": \"2018-12-26 18:19:00\", \"average_delivery_time\": 0}\n" +
+				"{\"date\": \"2018-12-26 18:20:00\", \"average_delivery_time\": 0}\n" +
+				"{\"date\": \"2018-12-26 18:21:00\", \"average_delivery_time\": 54}\n",
+			6,
+			errors.New(""),
+		},
+		{
+			"invalid case - no dataset",
+			[]events.EventTranslationDelivered{},
+			10,
+			"",
+			0,
+			errors.New("No events found. Please provide a valid list of events."),
+		},
+		{
+			"invalid case - wrong window size",
+			[]events.EventTranslationDelivered{},
+			0,
+			"",
+			0,
+			errors.New("Window Size has to be equal or greater than 1, please provide a valid Window Size."),
+		},
+		{
+			"invalid case - wrong date format",
+			[]events.EventTranslationDelivered{
+				{Timestamp: "26-12-2018 18:11:08.509654", Duration: 20},
+			},
+			10,
+			"",
+			0,
+			errors.New("Invalid date format. Please provide dates in the following format: " + InputTimestampFormat + "\n"),
+		},
+		{
+			"invalid case - events out of order",
+			[]events.EventTranslationDelivered{
+				{Timestamp: "2018-12-26 18:15:19.903159", Duration: 31},
+				{Timestamp: "2018-12-26 18:11:08.509654", Duration: 20},
+			},
+			10,
+			"{\"date\": \"2018-12-26 18:15:00\", \"average_delivery_time\": 0}\n",
+			1,
+			errors.New("Events are not ordered by timestamp. Please provide events ordered from oldest to newest."),
+		},
+	}
+
+	for _, tc := range testcases {
+		t.Run(tc.name, func(t *testing.T) {
+			got := ""
+			emitted := 0
+			err := func() error {
+				aggregator, err := events.NewStreamAggregator(tc.windowSize, time.Minute, func(point statistics.Point) error {
+					emitted++
+					return point.Each(time.Minute, func(point statistics.Point) error {
+						got += string(events.AppendMovingAverageRecord(nil, point.End, point.Value))
+						return nil
+					})
+				})
+				if err != nil {
+					return err
+				}
+
+				for _, event := range tc.events {
+					if err := aggregator.Add(event); err != nil {
+						return err
+					}
+				}
+				return aggregator.Close()
+			}()
+			if err != nil && err.Error() != tc.expectedError.Error() {
+				t.Errorf("Unexpected error: %s", err.Error())
+			}
+
+			if got != tc.expected {
+				t.Errorf("expected %v, got %v", tc.expected, got)
+			}
+
+			if emitted != tc.expectedEmitted {
+				t.Errorf("expected %d values emitted, got %d", tc.expectedEmitted, emitted)
+			}
+		})
+	}
+}
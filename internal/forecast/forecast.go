@@ -0,0 +1,235 @@
+/*
+Package forecast predicts the delivery time of the next buckets with an additive Holt-Winters model,
+fitted to the average delivery time of each bucket of the events.
+*/
+package forecast
+
+import (
+	"errors"
+	"math"
+	"strconv"
+	"time"
+
+	"github.com/jmbds/unbabel-backend-engineering-challenge/internal/events"
+	"github.com/jmbds/unbabel-backend-engineering-challenge/internal/statistics"
+)
+
+/* Smoothing factors tried when fitting the level, trend and seasonal components of a model */
+var smoothingGrid = []float64{0.05, 0.1, 0.2, 0.3, 0.4, 0.5, 0.6, 0.7, 0.8, 0.9}
+
+/*
+A struct that holds a predicted delivery time and its prediction interval.
+
+Lower and Upper bound the interval in which the delivery time falls with the confidence of the forecast.
+*/
+type Prediction struct {
+	statistics.Point
+	Lower float64
+	Upper float64
+}
+
+/*
+A struct that holds a Holt-Winters model fitted to a series.
+
+Alpha, Beta and Gamma are the smoothing factors of the level, trend and seasonal components, and Season the number of buckets in a season.
+Deviation is the standard deviation of the errors of the one-step predictions of the observed buckets.
+*/
+type Model struct {
+	Alpha     float64
+	Beta      float64
+	Gamma     float64
+	Season    int
+	Deviation float64
+
+	level    float64
+	trend    float64
+	seasonal []float64
+	length   int
+	end      time.Time
+	unit     time.Duration
+}
+
+/*
+A function that fits a Holt-Winters model to the average delivery time of each bucket of a dataset.
+
+Buckets without events are missing values, which follow the prediction of the model, so they don't pull it towards zero.
+The smoothing factors are the ones with the lowest squared error of the one-step predictions of the observed buckets.
+Receives the dataset and the number of buckets in a season.
+Returns the model, fitted up to the last bucket, and an error if the dataset doesn't cover two seasons.
+*/
+func Fit(dataset statistics.SparseDataset, season int) (*Model, error) {
+	if season < 1 {
+		return nil, errors.New("Season has to be equal or greater than 1, please provide a valid season.")
+	}
+	if dataset.Length < 2*season {
+		return nil, errors.New("Forecasting needs at least two seasons of events. Please provide a longer input.")
+	}
+
+	values := make([]float64, dataset.Length)
+	observed := make([]bool, dataset.Length)
+	for _, bucket := range dataset.Buckets {
+		values[bucket.Index] = bucket.DataPoint.CalculateAverage()
+		observed[bucket.Index] = bucket.DataPoint.Count > 0
+	}
+
+	var best *Model
+	bestError := math.Inf(1)
+	for _, alpha := range smoothingGrid {
+		for _, beta := range smoothingGrid {
+			for _, gamma := range smoothingGrid {
+				model := &Model{Alpha: alpha, Beta: beta, Gamma: gamma, Season: season}
+				squaredError, count := model.run(values, observed)
+				if count > 0 && squaredError < bestError {
+					best, bestError = model, squaredError
+					best.Deviation = math.Sqrt(squaredError / float64(count))
+				}
+			}
+		}
+	}
+	if best == nil {
+		return nil, errors.New("Forecasting needs events after the first season. Please provide a longer input.")
+	}
+	best.length = dataset.Length
+	best.unit = dataset.Unit
+	best.end = dataset.Start.Add(time.Duration(dataset.Length) * dataset.Unit)
+
+	return best, nil
+}
+
+/*
+A function that initializes the model from the first two seasons and updates it with every bucket after the first season.
+
+Receives the values of the buckets and whether each was observed.
+Returns the sum of the squared errors of the one-step predictions of the observed buckets after the first season, and their number.
+*/
+func (m *Model) run(values []float64, observed []bool) (float64, int) {
+	first, firstOk := observedMean(values[:m.Season], observed[:m.Season])
+	second, secondOk := observedMean(values[m.Season:2*m.Season], observed[m.Season:2*m.Season])
+	if !firstOk {
+		first = second
+	}
+
+	m.level = first
+	m.trend = 0
+	if firstOk && secondOk {
+		m.trend = (second - first) / float64(m.Season)
+	}
+	m.seasonal = make([]float64, m.Season)
+	for i := 0; i < m.Season; i++ {
+		if observed[i] {
+			m.seasonal[i] = values[i] - first
+		}
+	}
+
+	squaredError := 0.0
+	count := 0
+	for t := m.Season; t < len(values); t++ {
+		position := t % m.Season
+		predicted := m.level + m.trend + m.seasonal[position]
+
+		value := predicted
+		if observed[t] {
+			value = values[t]
+			squaredError += (value - predicted) * (value - predicted)
+			count++
+		}
+
+		level := m.Alpha*(value-m.seasonal[position]) + (1-m.Alpha)*(m.level+m.trend)
+		m.trend = m.Beta*(level-m.level) + (1-m.Beta)*m.trend
+		m.seasonal[position] = m.Gamma*(value-level) + (1-m.Gamma)*m.seasonal[position]
+		m.level = level
+	}
+
+	return squaredError, count
+}
+
+/*
+A function that returns the mean of the observed values, and false if none was observed.
+*/
+func observedMean(values []float64, observed []bool) (float64, bool) {
+	total := 0.0
+	count := 0
+	for i, value := range values {
+		if observed[i] {
+			total += value
+			count++
+		}
+	}
+	if count == 0 {
+		return 0, false
+	}
+	return total / float64(count), true
+}
+
+/*
+A function that predicts the delivery time of the buckets following the dataset the model was fitted to.
+
+Delivery times can't be negative, so predictions and their bounds are at least 0.
+Receives the number of buckets to predict and the confidence of the prediction intervals, between 0 and 1.
+Returns the predictions, each reported at the end of its interval, and an error if the horizon or confidence are invalid.
+*/
+func (m *Model) Forecast(horizon int, confidence float64) ([]Prediction, error) {
+	if horizon < 1 {
+		return []Prediction{}, errors.New("Horizon has to be at least one bucket, please provide a valid horizon.")
+	}
+	if confidence <= 0 || confidence >= 1 {
+		return []Prediction{}, errors.New("Confidence has to be between 0 and 1, please provide a valid confidence.")
+	}
+
+	/* Number of standard deviations of a normal distribution around its mean holding the confidence */
+	z := math.Sqrt2 * math.Erfinv(confidence)
+
+	predictions := make([]Prediction, 0, horizon)
+	variance := 1.0
+	for h := 1; h <= horizon; h++ {
+		/* The error of each step ahead adds to the variance of the following ones */
+		if h > 1 {
+			j := h - 1
+			c := m.Alpha * (1 + float64(j)*m.Beta)
+			if j%m.Season == 0 {
+				c += m.Gamma
+			}
+			variance += c * c
+		}
+
+		value := m.level + float64(h)*m.trend + m.seasonal[(m.length-1+h)%m.Season]
+		margin := z * m.Deviation * math.Sqrt(variance)
+
+		start := m.end.Add(time.Duration(h-1) * m.unit)
+		predictions = append(predictions, Prediction{
+			Point: statistics.Point{Start: start, End: start.Add(m.unit), Value: math.Max(value, 0)},
+			Lower: math.Max(value-margin, 0),
+			Upper: math.Max(value+margin, 0),
+		})
+	}
+
+	return predictions, nil
+}
+
+/*
+A function that formats a prediction as an output line, like a moving average value with the bounds of its interval, appending it to a buffer.
+
+Receives the buffer and the prediction, reported at the end of its interval.
+Returns the buffer with the line appended, including the trailing newline.
+*/
+func AppendRecord(buffer []byte, prediction Prediction) []byte {
+	buffer = events.AppendMovingAverageRecord(buffer, prediction.End, prediction.Value)
+
+	/* Replace the closing brace and newline of the record with the bounds */
+	buffer = buffer[:len(buffer)-2]
+	buffer = append(buffer, ", \"lower_bound\": "...)
+	buffer = appendValue(buffer, prediction.Lower)
+	buffer = append(buffer, ", \"upper_bound\": "...)
+	buffer = appendValue(buffer, prediction.Upper)
+	return append(buffer, "}\n"...)
+}
+
+/*
+A function that formats a delivery time like the moving average values, without decimal places when it is whole.
+*/
+func appendValue(buffer []byte, value float64) []byte {
+	if value == float64(int(value)) {
+		return strconv.AppendInt(buffer, int64(int(value)), 10)
+	}
+	return strconv.AppendFloat(buffer, value, 'f', 1, 64)
+}
@@ -0,0 +1,119 @@
+package forecast_test
+
+import (
+	"errors"
+	"math"
+	"testing"
+	"time"
+
+	"github.com/jmbds/unbabel-backend-engineering-challenge/internal/forecast"
+	"github.com/jmbds/unbabel-backend-engineering-challenge/internal/statistics"
+)
+
+/*
+A function that builds an hourly dataset of days following a daily pattern, with a bucket without events every few hours.
+*/
+func dailyDataset(days int) statistics.SparseDataset {
+	start := time.Date(2018, 12, 24, 0, 0, 0, 0, time.UTC)
+	dataset := statistics.SparseDataset{Buckets: make([]statistics.Bucket, 0), Start: start, Unit: time.Hour}
+	for index := 0; index < days*24; index++ {
+		if index%7 == 3 {
+			dataset.Length = index + 1
+			continue
+		}
+		value := 30 + 20*math.Sin(2*math.Pi*float64(index%24)/24)
+		dataset.Add(index, statistics.DataPoint{Total: 2 * value, Count: 2})
+	}
+	return dataset
+}
+
+func TestForecast(t *testing.T) {
+	model, err := forecast.Fit(dailyDataset(4), 24)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	predictions, err := model.Forecast(6, 0.95)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(predictions) != 6 {
+		t.Fatalf("expected 6 predictions, got %d", len(predictions))
+	}
+
+	next := time.Date(2018, 12, 28, 0, 0, 0, 0, time.UTC)
+	for h, prediction := range predictions {
+		expectedStart := next.Add(time.Duration(h) * time.Hour)
+		if !prediction.Start.Equal(expectedStart) || !prediction.End.Equal(expectedStart.Add(time.Hour)) {
+			t.Errorf("expected the interval starting at %v, got %v to %v", expectedStart, prediction.Start, prediction.End)
+		}
+
+		/* The pattern repeats exactly, so it is predicted closely */
+		expected := 30 + 20*math.Sin(2*math.Pi*float64(h)/24)
+		if math.Abs(prediction.Value-expected) > 1 {
+			t.Errorf("expected about %v at %d hours, got %v", expected, h+1, prediction.Value)
+		}
+		if prediction.Lower > prediction.Value || prediction.Upper < prediction.Value {
+			t.Errorf("expected %v within its interval, got %v to %v", prediction.Value, prediction.Lower, prediction.Upper)
+		}
+		if h > 0 && prediction.Upper-prediction.Lower < predictions[h-1].Upper-predictions[h-1].Lower {
+			t.Errorf("expected intervals to widen with the horizon, got %v", predictions)
+		}
+	}
+}
+
+func TestForecastErrors(t *testing.T) {
+	model, err := forecast.Fit(dailyDataset(2), 24)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	testcases := []struct {
+		name          string
+		run           func() error
+		expectedError error
+	}{
+		{
+			"shorter than two seasons",
+			func() error { _, err := forecast.Fit(dailyDataset(1), 24); return err },
+			errors.New("Forecasting needs at least two seasons of events. Please provide a longer input."),
+		},
+		{
+			"invalid season",
+			func() error { _, err := forecast.Fit(dailyDataset(2), 0); return err },
+			errors.New("Season has to be equal or greater than 1, please provide a valid season."),
+		},
+		{
+			"invalid horizon",
+			func() error { _, err := model.Forecast(0, 0.95); return err },
+			errors.New("Horizon has to be at least one bucket, please provide a valid horizon."),
+		},
+		{
+			"invalid confidence",
+			func() error { _, err := model.Forecast(6, 1); return err },
+			errors.New("Confidence has to be between 0 and 1, please provide a valid confidence."),
+		},
+	}
+
+	for _, tc := range testcases {
+		t.Run(tc.name, func(t *testing.T) {
+			if err := tc.run(); err == nil || err.Error() != tc.expectedError.Error() {
+				t.Errorf("expected %v, got %v", tc.expectedError, err)
+			}
+		})
+	}
+}
+
+func TestAppendRecord(t *testing.T) {
+	end := time.Date(2018, 12, 27, 1, 0, 0, 0, time.UTC)
+	prediction := forecast.Prediction{
+		Point: statistics.Point{Start: end.Add(-time.Hour), End: end, Value: 29.54},
+		Lower: 27,
+		Upper: 31.84,
+	}
+
+	expected := `{"date": "2018-12-27 01:00:00", "average_delivery_time": 29.5, "lower_bound": 27, "upper_bound": 31.8}` + "\n"
+	if got := string(forecast.AppendRecord(nil, prediction)); got != expected {
+		t.Errorf("expected %s, got %s", expected, got)
+	}
+}
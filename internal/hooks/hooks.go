@@ -0,0 +1,254 @@
+package hooks
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"strings"
+	"time"
+
+	"github.com/jmbds/unbabel-backend-engineering-challenge/internal/events"
+	"github.com/jmbds/unbabel-backend-engineering-challenge/internal/sla"
+)
+
+/* Time a webhook has to respond before the delivery is failed and retried */
+const DefaultTimeout = 10 * time.Second
+
+/*
+A struct that notifies external systems of SLA breaches.
+
+URL is the endpoint the breach is POSTed to as JSON. Command is a shell command executed with the breach JSON on its stdin.
+Either or both can be set. Failed deliveries are retried Retries times, waiting Backoff before the first retry and doubling it on each attempt.
+Breaches are only delivered once to each of them, even if they are notified again.
+When StatePath is set, the breaches delivered are saved to it, so they are not delivered again by later runs.
+Horizon bounds how long they are remembered, so the state doesn't grow forever: breaches starting more than Horizon
+before the latest one delivered are forgotten, and notified again if a later run reads them again. They are remembered forever when it is 0.
+*/
+type Notifier struct {
+	URL       string
+	Command   string
+	Retries   int
+	Backoff   time.Duration
+	Client    *http.Client
+	StatePath string
+	Horizon   time.Duration
+
+	delivered map[string]bool
+}
+
+/*
+A function that creates a Notifier.
+
+Receives the webhook URL, the command, the number of retries, the initial backoff
+and the path to the file of the breaches already delivered, or an empty string to only remember them while running.
+Returns a Notifier using an HTTP client with DefaultTimeout, and an error if the file of the breaches delivered is invalid.
+*/
+func NewNotifier(url, command string, retries int, backoff time.Duration, statePath string) (*Notifier, error) {
+	notifier := &Notifier{
+		URL:       url,
+		Command:   command,
+		Retries:   retries,
+		Backoff:   backoff,
+		Client:    &http.Client{Timeout: DefaultTimeout},
+		StatePath: statePath,
+		delivered: make(map[string]bool),
+	}
+
+	if statePath == "" {
+		return notifier, nil
+	}
+	content, err := os.ReadFile(statePath)
+	if errors.Is(err, os.ErrNotExist) {
+		return notifier, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+	if err := json.Unmarshal(content, &notifier.delivered); err != nil {
+		return nil, errors.New("Notification state is invalid. Please remove " + statePath + " or provide a valid one.")
+	}
+
+	return notifier, nil
+}
+
+/*
+A function that notifies the webhook and the command of a breach.
+
+Receives the context, which stops waiting between retries and the deliveries in flight when cancelled, and a breach.
+Breaches with the same client and start time as one already delivered to the webhook or the command are not delivered to it again,
+so a failing command doesn't make the webhook receive the breach twice.
+Returns an error if the breach could not be delivered after all retries.
+*/
+func (n *Notifier) Notify(ctx context.Context, breach sla.Breach) error {
+	key := breach.Client + "|" + breach.Start.Format(events.OutputTimestampFormat)
+
+	payload, err := sla.MarshalBreach(breach)
+	if err != nil {
+		return err
+	}
+
+	if n.URL != "" {
+		err = n.deliverOnce(ctx, "webhook|"+key, func() error { return n.post(ctx, payload) })
+		if err != nil {
+			return err
+		}
+	}
+
+	if n.Command != "" {
+		err = n.deliverOnce(ctx, "command|"+key, func() error { return n.execute(ctx, payload) })
+		if err != nil {
+			return err
+		}
+	}
+
+	return nil
+}
+
+/*
+A function that delivers a breach unless it was already delivered under the same key, saving the key once it is.
+*/
+func (n *Notifier) deliverOnce(ctx context.Context, key string, deliver func() error) error {
+	if n.delivered[key] {
+		return nil
+	}
+
+	if err := n.withRetries(ctx, deliver); err != nil {
+		return err
+	}
+
+	n.delivered[key] = true
+	n.forget()
+	return n.save()
+}
+
+/*
+A function that forgets the breaches delivered that started more than Horizon before the latest one, keeping the state bounded.
+
+Keys end with the start of their breach, after the last separator.
+*/
+func (n *Notifier) forget() {
+	if n.Horizon <= 0 {
+		return
+	}
+
+	starts := make(map[string]time.Time, len(n.delivered))
+	latest := time.Time{}
+	for key := range n.delivered {
+		start, err := time.Parse(events.OutputTimestampFormat, key[strings.LastIndex(key, "|")+1:])
+		if err != nil {
+			continue
+		}
+		starts[key] = start
+		if start.After(latest) {
+			latest = start
+		}
+	}
+
+	for key, start := range starts {
+		if start.Before(latest.Add(-n.Horizon)) {
+			delete(n.delivered, key)
+		}
+	}
+}
+
+/*
+A function that writes the breaches delivered to the state file, replacing it only once it is fully written.
+*/
+func (n *Notifier) save() error {
+	if n.StatePath == "" {
+		return nil
+	}
+
+	content, err := json.Marshal(n.delivered)
+	if err != nil {
+		return err
+	}
+
+	file, err := os.CreateTemp(filepath.Dir(n.StatePath), filepath.Base(n.StatePath)+".*.tmp")
+	if err != nil {
+		return err
+	}
+	defer os.Remove(file.Name())
+
+	_, err = file.Write(content)
+	if err == nil {
+		err = file.Sync()
+	}
+	if closeErr := file.Close(); err == nil {
+		err = closeErr
+	}
+	if err != nil {
+		return err
+	}
+
+	return os.Rename(file.Name(), n.StatePath)
+}
+
+/*
+A function that calls deliver until it succeeds or the retries are exhausted, with exponential backoff between attempts.
+
+Waiting stops as soon as the context is cancelled, returning its error.
+*/
+func (n *Notifier) withRetries(ctx context.Context, deliver func() error) error {
+	backoff := n.Backoff
+
+	err := deliver()
+	for attempt := 0; err != nil && attempt < n.Retries; attempt++ {
+		timer := time.NewTimer(backoff)
+		select {
+		case <-ctx.Done():
+			timer.Stop()
+			return ctx.Err()
+		case <-timer.C:
+		}
+		backoff *= 2
+
+		err = deliver()
+	}
+
+	return err
+}
+
+/*
+A function that POSTs the payload to the webhook URL, failing on non 2xx responses.
+*/
+func (n *Notifier) post(ctx context.Context, payload []byte) error {
+	request, err := http.NewRequestWithContext(ctx, http.MethodPost, n.URL, bytes.NewReader(payload))
+	if err != nil {
+		return err
+	}
+	request.Header.Set("Content-Type", "application/json")
+
+	response, err := n.Client.Do(request)
+	if err != nil {
+		return err
+	}
+	defer response.Body.Close()
+
+	if response.StatusCode < 200 || response.StatusCode > 299 {
+		return fmt.Errorf("Webhook responded with status %d.", response.StatusCode)
+	}
+
+	return nil
+}
+
+/*
+A function that runs the command through the shell, with the payload on its stdin.
+*/
+func (n *Notifier) execute(ctx context.Context, payload []byte) error {
+	command := exec.CommandContext(ctx, "sh", "-c", n.Command)
+	command.Stdin = bytes.NewReader(append(payload, '\n'))
+
+	output, err := command.CombinedOutput()
+	if err != nil {
+		return fmt.Errorf("Command failed: %s: %s", err, bytes.TrimSpace(output))
+	}
+
+	return nil
+}
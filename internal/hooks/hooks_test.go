@@ -0,0 +1,219 @@
+package hooks_test
+
+import (
+	"context"
+	"errors"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/jmbds/unbabel-backend-engineering-challenge/internal/hooks"
+	"github.com/jmbds/unbabel-backend-engineering-challenge/internal/sla"
+)
+
+func TestNotifyWebhook(t *testing.T) {
+	start := time.Date(2018, 12, 26, 18, 22, 0, 0, time.UTC)
+	breach := sla.Breach{Client: "airliberty", Start: start, End: start.Add(3 * time.Minute), Peak: 42.5}
+
+	testcases := []struct {
+		name             string
+		failures         int
+		retries          int
+		notifications    int
+		expectedRequests int
+		expectedError    bool
+	}{
+		{"delivered on first attempt", 0, 3, 1, 1, false},
+		{"delivered after retries", 2, 3, 1, 3, false},
+		{"retries exhausted", 5, 2, 1, 3, true},
+		{"duplicate breaches are delivered once", 0, 3, 3, 1, false},
+	}
+
+	for _, tc := range testcases {
+		t.Run(tc.name, func(t *testing.T) {
+			requests := 0
+			body := ""
+			server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+				requests++
+				if requests <= tc.failures {
+					w.WriteHeader(http.StatusInternalServerError)
+					return
+				}
+				content, _ := io.ReadAll(r.Body)
+				body = string(content)
+			}))
+			defer server.Close()
+
+			notifier, err := hooks.NewNotifier(server.URL, "", tc.retries, time.Millisecond, "")
+			if err != nil {
+				t.Fatal(err)
+			}
+
+			for i := 0; i < tc.notifications; i++ {
+				err = notifier.Notify(context.Background(), breach)
+			}
+
+			if (err != nil) != tc.expectedError {
+				t.Errorf("Unexpected error: %v", err)
+			}
+
+			if requests != tc.expectedRequests {
+				t.Errorf("expected %d requests, got %d", tc.expectedRequests, requests)
+			}
+
+			expectedBody := "{\"client\":\"airliberty\",\"start\":\"2018-12-26 18:22:00\",\"end\":\"2018-12-26 18:25:00\",\"peak_average_delivery_time\":42.5,\"duration_minutes\":3}"
+			if !tc.expectedError && body != expectedBody {
+				t.Errorf("expected %v, got %v", expectedBody, body)
+			}
+		})
+	}
+}
+
+func TestNotifyCommand(t *testing.T) {
+	start := time.Date(2018, 12, 26, 18, 22, 0, 0, time.UTC)
+	breach := sla.Breach{Start: start, End: start.Add(time.Minute), Peak: 31}
+	output := filepath.Join(t.TempDir(), "breach.json")
+
+	notifier, err := hooks.NewNotifier("", "cat >> "+output, 0, time.Millisecond, "")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := notifier.Notify(context.Background(), breach); err != nil {
+		t.Fatal(err)
+	}
+
+	got, err := os.ReadFile(output)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	expected := "{\"start\":\"2018-12-26 18:22:00\",\"end\":\"2018-12-26 18:23:00\",\"peak_average_delivery_time\":31,\"duration_minutes\":1}\n"
+	if string(got) != expected {
+		t.Errorf("expected %v, got %v", expected, string(got))
+	}
+
+	failing, err := hooks.NewNotifier("", "exit 1", 1, time.Millisecond, "")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := failing.Notify(context.Background(), breach); err == nil {
+		t.Errorf("expected an error for a failing command")
+	}
+}
+
+func TestNotifyAcrossRuns(t *testing.T) {
+	start := time.Date(2018, 12, 26, 18, 22, 0, 0, time.UTC)
+	breach := sla.Breach{Client: "airliberty", Start: start, Peak: 42.5}
+	statePath := filepath.Join(t.TempDir(), "sla_notifications.json")
+
+	requests := 0
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		requests++
+	}))
+	defer server.Close()
+
+	/* The command fails after the webhook received the breach */
+	first, err := hooks.NewNotifier(server.URL, "exit 1", 0, time.Millisecond, statePath)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := first.Notify(context.Background(), breach); err == nil {
+		t.Errorf("expected an error for a failing command")
+	}
+
+	/* A later run retries the command without posting the breach again */
+	commandOutput := filepath.Join(t.TempDir(), "breach.json")
+	second, err := hooks.NewNotifier(server.URL, "cat >> "+commandOutput, 0, time.Millisecond, statePath)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := second.Notify(context.Background(), breach); err != nil {
+		t.Fatal(err)
+	}
+	if err := second.Notify(context.Background(), breach); err != nil {
+		t.Fatal(err)
+	}
+	if requests != 1 {
+		t.Errorf("expected the webhook to receive the breach once, got %d requests", requests)
+	}
+	got, err := os.ReadFile(commandOutput)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if lines := strings.Count(string(got), "\n"); lines != 1 {
+		t.Errorf("expected the command to receive the breach once, got %s", got)
+	}
+
+	if err := os.WriteFile(statePath, []byte("not json"), 0644); err != nil {
+		t.Fatal(err)
+	}
+	expectedError := errors.New("Notification state is invalid. Please remove " + statePath + " or provide a valid one.")
+	if _, err := hooks.NewNotifier(server.URL, "", 0, time.Millisecond, statePath); err == nil || err.Error() != expectedError.Error() {
+		t.Errorf("expected %v, got %v", expectedError, err)
+	}
+}
+
+func TestNotifyHorizon(t *testing.T) {
+	start := time.Date(2018, 12, 26, 18, 0, 0, 0, time.UTC)
+	statePath := filepath.Join(t.TempDir(), "sla_notifications.json")
+
+	requests := 0
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		requests++
+	}))
+	defer server.Close()
+
+	notifier, err := hooks.NewNotifier(server.URL, "", 0, time.Millisecond, statePath)
+	if err != nil {
+		t.Fatal(err)
+	}
+	notifier.Horizon = 10 * time.Minute
+
+	/* Breaches more than the horizon before the latest one are forgotten, and notified again */
+	for _, offset := range []time.Duration{0, 5 * time.Minute, 30 * time.Minute, 25 * time.Minute, 0} {
+		if err := notifier.Notify(context.Background(), sla.Breach{Start: start.Add(offset), Peak: 42.5}); err != nil {
+			t.Fatal(err)
+		}
+	}
+	if requests != 5 {
+		t.Errorf("expected 5 requests, got %d", requests)
+	}
+
+	content, err := os.ReadFile(statePath)
+	if err != nil {
+		t.Fatal(err)
+	}
+	expected := `{"webhook||2018-12-26 18:25:00":true,"webhook||2018-12-26 18:30:00":true}`
+	if string(content) != expected {
+		t.Errorf("expected %s, got %s", expected, content)
+	}
+}
+
+func TestNotifyCancelled(t *testing.T) {
+	breach := sla.Breach{Start: time.Date(2018, 12, 26, 18, 22, 0, 0, time.UTC), Peak: 42.5}
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.WriteHeader(http.StatusInternalServerError)
+	}))
+	defer server.Close()
+
+	notifier, err := hooks.NewNotifier(server.URL, "", 3, time.Hour, "")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	/* Waiting for the next retry stops as soon as the context is cancelled */
+	ctx, cancel := context.WithTimeout(context.Background(), 50*time.Millisecond)
+	defer cancel()
+	started := time.Now()
+	if err := notifier.Notify(ctx, breach); !errors.Is(err, context.DeadlineExceeded) {
+		t.Errorf("expected %v, got %v", context.DeadlineExceeded, err)
+	}
+	if elapsed := time.Since(started); elapsed > time.Second {
+		t.Errorf("expected retries to stop on cancellation, waited %v", elapsed)
+	}
+}
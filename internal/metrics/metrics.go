@@ -0,0 +1,225 @@
+package metrics
+
+import (
+	"bufio"
+	"fmt"
+	"io"
+	"net/http"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/jmbds/unbabel-backend-engineering-challenge/internal/events"
+	"github.com/jmbds/unbabel-backend-engineering-challenge/internal/statistics"
+)
+
+/* Reasons a line of the input was rejected, named after the validation rules they break */
+const (
+	ReasonInvalidJson        = "invalid_json"
+	ReasonInvalidTimestamp   = "invalid_timestamp"
+	ReasonUnorderedTimestamp = "unordered_timestamp"
+)
+
+/* Content type of the Prometheus text exposition format */
+const contentType = "text/plain; version=0.0.4; charset=utf-8"
+
+/*
+A struct that holds the labels events are counted by.
+*/
+type eventLabels struct {
+	client         string
+	sourceLanguage string
+	targetLanguage string
+}
+
+/*
+A struct that collects metrics of a live aggregation and exposes them in the Prometheus text format.
+
+It is safe to use from several goroutines, so it can be scraped while the aggregation is running.
+Now returns the current time, used to calculate the processing lag.
+*/
+type Collector struct {
+	WindowSize int
+	Now        func() time.Time
+
+	mutex          sync.Mutex
+	events         map[eventLabels]int
+	parseErrors    map[string]int
+	buckets        int
+	lastPoint      statistics.Point
+	window         statistics.DataPoint
+	lastEventTime  time.Time
+	lastEventFound bool
+}
+
+/*
+A function that creates a Collector.
+
+Receives the window size of the moving average, used as a label, and the function returning the current time.
+Returns the Collector.
+*/
+func NewCollector(windowSize int, now func() time.Time) *Collector {
+	return &Collector{
+		WindowSize:  windowSize,
+		Now:         now,
+		events:      make(map[eventLabels]int),
+		parseErrors: make(map[string]int),
+	}
+}
+
+/*
+A function that counts an event read, by client and language pair, and records its timestamp for the processing lag.
+*/
+func (c *Collector) ObserveEvent(event events.EventTranslationDelivered, timestamp time.Time) {
+	c.mutex.Lock()
+	defer c.mutex.Unlock()
+
+	c.events[eventLabels{client: event.ClientName, sourceLanguage: event.SourceLanguage, targetLanguage: event.TargetLanguage}]++
+	if !c.lastEventFound || timestamp.After(c.lastEventTime) {
+		c.lastEventTime = timestamp
+		c.lastEventFound = true
+	}
+}
+
+/*
+A function that counts a line of the input rejected for the given reason.
+*/
+func (c *Collector) ObserveParseError(reason string) {
+	c.mutex.Lock()
+	defer c.mutex.Unlock()
+
+	c.parseErrors[reason]++
+}
+
+/*
+A function that records the moving average of completed buckets.
+
+Receives the moving average value with its interval, which spans several buckets for a run of equal values, the number of buckets,
+and the total delivery time and number of events in the window it was calculated over.
+*/
+func (c *Collector) ObservePoint(point statistics.Point, buckets int, window statistics.DataPoint) {
+	c.mutex.Lock()
+	defer c.mutex.Unlock()
+
+	c.buckets += buckets
+	c.lastPoint = point
+	c.window = window
+}
+
+/*
+A function that writes every metric in the Prometheus text exposition format.
+
+Series of the same metric are sorted by their labels, so the output is deterministic.
+Returns the number of bytes written and an error.
+*/
+func (c *Collector) WriteTo(writer io.Writer) (int64, error) {
+	c.mutex.Lock()
+	defer c.mutex.Unlock()
+
+	counter := &countingWriter{writer: writer}
+	buffered := bufio.NewWriter(counter)
+	window := `{window="` + strconv.Itoa(c.WindowSize) + `"}`
+
+	writeHeader(buffered, "unbabel_moving_average_delivery_time", "gauge", "Moving average delivery time of the last completed bucket, in seconds.")
+	if c.buckets > 0 {
+		writeSample(buffered, "unbabel_moving_average_delivery_time"+window, c.lastPoint.Value)
+	}
+
+	writeHeader(buffered, "unbabel_window_delivery_time_total", "gauge", "Total delivery time of the events in the moving average window, in seconds.")
+	writeSample(buffered, "unbabel_window_delivery_time_total"+window, c.window.Total)
+
+	writeHeader(buffered, "unbabel_window_events", "gauge", "Number of events in the moving average window.")
+	writeSample(buffered, "unbabel_window_events"+window, float64(c.window.Count))
+
+	writeHeader(buffered, "unbabel_buckets_total", "counter", "Number of completed buckets.")
+	writeSample(buffered, "unbabel_buckets_total", float64(c.buckets))
+
+	writeHeader(buffered, "unbabel_last_bucket_timestamp_seconds", "gauge", "End of the interval of the last completed bucket, as a Unix timestamp.")
+	if c.buckets > 0 {
+		writeSample(buffered, "unbabel_last_bucket_timestamp_seconds", float64(c.lastPoint.End.Unix()))
+	}
+
+	writeHeader(buffered, "unbabel_events_total", "counter", "Number of translation_delivered events read, by client and language pair.")
+	labels := make([]eventLabels, 0, len(c.events))
+	for label := range c.events {
+		labels = append(labels, label)
+	}
+	sort.Slice(labels, func(i, j int) bool {
+		if labels[i].client != labels[j].client {
+			return labels[i].client < labels[j].client
+		}
+		if labels[i].sourceLanguage != labels[j].sourceLanguage {
+			return labels[i].sourceLanguage < labels[j].sourceLanguage
+		}
+		return labels[i].targetLanguage < labels[j].targetLanguage
+	})
+	for _, label := range labels {
+		name := `unbabel_events_total{client_name="` + escapeLabel(label.client) +
+			`",source_language="` + escapeLabel(label.sourceLanguage) +
+			`",target_language="` + escapeLabel(label.targetLanguage) + `"}`
+		writeSample(buffered, name, float64(c.events[label]))
+	}
+
+	writeHeader(buffered, "unbabel_parse_errors_total", "counter", "Number of input lines rejected, by reason.")
+	for _, reason := range []string{ReasonInvalidJson, ReasonInvalidTimestamp, ReasonUnorderedTimestamp} {
+		writeSample(buffered, `unbabel_parse_errors_total{reason="`+reason+`"}`, float64(c.parseErrors[reason]))
+	}
+
+	writeHeader(buffered, "unbabel_processing_lag_seconds", "gauge", "Time between now and the timestamp of the newest event read, in seconds.")
+	if c.lastEventFound {
+		writeSample(buffered, "unbabel_processing_lag_seconds", c.Now().Sub(c.lastEventTime).Seconds())
+	}
+
+	err := buffered.Flush()
+	return counter.written, err
+}
+
+/*
+A function that serves the metrics over HTTP, so the Collector can be registered as the handler of /metrics.
+*/
+func (c *Collector) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	w.Header().Set("Content-Type", contentType)
+	c.WriteTo(w)
+}
+
+/*
+A function that writes the HELP and TYPE lines of a metric.
+*/
+func writeHeader(writer *bufio.Writer, name, metricType, help string) {
+	fmt.Fprintf(writer, "# HELP %s %s\n# TYPE %s %s\n", name, help, name, metricType)
+}
+
+/*
+A function that writes a sample of a metric, with its labels already part of the name.
+*/
+func writeSample(writer *bufio.Writer, name string, value float64) {
+	writer.WriteString(name)
+	writer.WriteByte(' ')
+	writer.WriteString(strconv.FormatFloat(value, 'f', -1, 64))
+	writer.WriteByte('\n')
+}
+
+/*
+A function that escapes a label value, as required by the Prometheus text format.
+*/
+func escapeLabel(value string) string {
+	return labelEscaper.Replace(value)
+}
+
+var labelEscaper = strings.NewReplacer(`\`, `\\`, `"`, `\"`, "\n", `\n`)
+
+/*
+A writer that counts the bytes written through it.
+*/
+type countingWriter struct {
+	writer  io.Writer
+	written int64
+}
+
+func (w *countingWriter) Write(p []byte) (int, error) {
+	n, err := w.writer.Write(p)
+	w.written += int64(n)
+	return n, err
+}
@@ -0,0 +1,139 @@
+package metrics_test
+
+import (
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/jmbds/unbabel-backend-engineering-challenge/internal/events"
+	"github.com/jmbds/unbabel-backend-engineering-challenge/internal/metrics"
+	"github.com/jmbds/unbabel-backend-engineering-challenge/internal/statistics"
+)
+
+func TestCollector(t *testing.T) {
+	now := time.Date(2018, 12, 26, 18, 30, 0, 0, time.UTC)
+	bucket := time.Date(2018, 12, 26, 18, 24, 0, 0, time.UTC)
+
+	testcases := []struct {
+		name     string
+		observe  func(collector *metrics.Collector)
+		expected []string
+		missing  []string
+	}{
+		{
+			"no events",
+			func(collector *metrics.Collector) {},
+			[]string{
+				"# TYPE unbabel_moving_average_delivery_time gauge\n",
+				"unbabel_buckets_total 0\n",
+				"unbabel_parse_errors_total{reason=\"invalid_json\"} 0\n",
+			},
+			[]string{
+				"unbabel_moving_average_delivery_time{",
+				"\nunbabel_processing_lag_seconds ",
+			},
+		},
+		{
+			"events and buckets",
+			func(collector *metrics.Collector) {
+				collector.ObserveEvent(events.EventTranslationDelivered{ClientName: "taxi-eats", SourceLanguage: "en", TargetLanguage: "fr"}, time.Date(2018, 12, 26, 18, 23, 19, 0, time.UTC))
+				collector.ObserveEvent(events.EventTranslationDelivered{ClientName: "airliberty", SourceLanguage: "en", TargetLanguage: "fr"}, time.Date(2018, 12, 26, 18, 11, 8, 0, time.UTC))
+				collector.ObserveEvent(events.EventTranslationDelivered{ClientName: "airliberty", SourceLanguage: "en", TargetLanguage: "fr"}, time.Date(2018, 12, 26, 18, 15, 19, 0, time.UTC))
+				collector.ObservePoint(statistics.Point{Start: bucket.Add(-time.Minute), End: bucket, Value: 42.5}, 1, statistics.DataPoint{Total: 85, Count: 2})
+				collector.ObserveParseError(metrics.ReasonUnorderedTimestamp)
+			},
+			[]string{
+				"unbabel_moving_average_delivery_time{window=\"10\"} 42.5\n",
+				"unbabel_window_delivery_time_total{window=\"10\"} 85\n",
+				"unbabel_window_events{window=\"10\"} 2\n",
+				"unbabel_buckets_total 1\n",
+				"unbabel_last_bucket_timestamp_seconds 1545848640\n",
+				"unbabel_events_total{client_name=\"airliberty\",source_language=\"en\",target_language=\"fr\"} 2\n" +
+					"unbabel_events_total{client_name=\"taxi-eats\",source_language=\"en\",target_language=\"fr\"} 1\n",
+				"unbabel_parse_errors_total{reason=\"unordered_timestamp\"} 1\n",
+				"unbabel_processing_lag_seconds 401\n",
+			},
+			[]string{},
+		},
+		{
+			"a run of empty buckets",
+			func(collector *metrics.Collector) {
+				collector.ObservePoint(statistics.Point{Start: bucket.Add(-time.Minute), End: bucket, Value: 42.5}, 1, statistics.DataPoint{Total: 85, Count: 2})
+				collector.ObservePoint(statistics.Point{Start: bucket, End: bucket.Add(5 * time.Minute), Value: 0}, 5, statistics.DataPoint{})
+			},
+			[]string{
+				"unbabel_moving_average_delivery_time{window=\"10\"} 0\n",
+				"unbabel_buckets_total 6\n",
+				"unbabel_last_bucket_timestamp_seconds 1545848940\n",
+			},
+			[]string{},
+		},
+		{
+			"escaped labels",
+			func(collector *metrics.Collector) {
+				collector.ObserveEvent(events.EventTranslationDelivered{ClientName: "air\"liberty\\\n"}, now)
+			},
+			[]string{
+				"unbabel_events_total{client_name=\"air\\\"liberty\\\\\\n\",source_language=\"\",target_language=\"\"} 1\n",
+				"unbabel_processing_lag_seconds 0\n",
+			},
+			[]string{},
+		},
+	}
+
+	for _, tc := range testcases {
+		t.Run(tc.name, func(t *testing.T) {
+			collector := metrics.NewCollector(10, func() time.Time { return now })
+			tc.observe(collector)
+
+			output := strings.Builder{}
+			written, err := collector.WriteTo(&output)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if written != int64(output.Len()) {
+				t.Errorf("expected %d bytes written, got %d", output.Len(), written)
+			}
+
+			for _, expected := range tc.expected {
+				if !strings.Contains(output.String(), expected) {
+					t.Errorf("expected %q in %s", expected, output.String())
+				}
+			}
+			for _, missing := range tc.missing {
+				if strings.Contains(output.String(), missing) {
+					t.Errorf("unexpected %q in %s", missing, output.String())
+				}
+			}
+		})
+	}
+}
+
+func TestCollectorServeHTTP(t *testing.T) {
+	collector := metrics.NewCollector(10, time.Now)
+	collector.ObserveParseError(metrics.ReasonInvalidJson)
+
+	server := httptest.NewServer(collector)
+	defer server.Close()
+
+	response, err := http.Get(server.URL + "/metrics")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer response.Body.Close()
+
+	if contentType := response.Header.Get("Content-Type"); !strings.HasPrefix(contentType, "text/plain; version=0.0.4") {
+		t.Errorf("expected the Prometheus text format, got %s", contentType)
+	}
+
+	body, err := io.ReadAll(response.Body)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !strings.Contains(string(body), "unbabel_parse_errors_total{reason=\"invalid_json\"} 1\n") {
+		t.Errorf("expected the parse error to be counted, got %s", string(body))
+	}
+}
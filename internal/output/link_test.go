@@ -0,0 +1,74 @@
+package output
+
+import (
+	"errors"
+	"os"
+	"path/filepath"
+	"syscall"
+	"testing"
+)
+
+func TestCommitNoClobberWithoutLinks(t *testing.T) {
+	link = func(oldname, newname string) error {
+		return &os.LinkError{Op: "link", Old: oldname, New: newname, Err: syscall.EPERM}
+	}
+	defer func() { link = os.Link }()
+
+	testcases := []struct {
+		name          string
+		existing      string
+		expected      string
+		expectedError bool
+	}{
+		{"valid case - missing", "", "new\n", false},
+		{"invalid case - existing", "old\n", "old\n", true},
+	}
+
+	for _, tc := range testcases {
+		t.Run(tc.name, func(t *testing.T) {
+			directory := t.TempDir()
+			path := filepath.Join(directory, "aggregated_events.out.json")
+
+			file, err := Create(path, ModeNoClobber)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if _, err := file.WriteString("new\n"); err != nil {
+				t.Fatal(err)
+			}
+
+			/* The destination is created while the output is written */
+			if tc.existing != "" {
+				if err := os.WriteFile(path, []byte(tc.existing), 0644); err != nil {
+					t.Fatal(err)
+				}
+			}
+
+			err = file.Commit()
+			if tc.expectedError {
+				expected := errors.New("Output file " + path + " already exists. Please remove it or run without --no_clobber.")
+				if err == nil || err.Error() != expected.Error() {
+					t.Errorf("expected %v, got %v", expected, err)
+				}
+			} else if err != nil {
+				t.Fatal(err)
+			}
+
+			got, err := os.ReadFile(path)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if string(got) != tc.expected {
+				t.Errorf("expected %q, got %q", tc.expected, string(got))
+			}
+
+			entries, err := os.ReadDir(directory)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if len(entries) != 1 {
+				t.Errorf("expected only the output file, got %d files", len(entries))
+			}
+		})
+	}
+}
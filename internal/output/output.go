@@ -0,0 +1,297 @@
+package output
+
+import (
+	"bufio"
+	"errors"
+	"io"
+	"os"
+	"path/filepath"
+)
+
+/*
+How an output file is written when it already exists.
+*/
+type Mode int
+
+const (
+	/* Replace the existing file */
+	ModeTruncate Mode = iota
+	/* Keep the contents of the existing file and write after them */
+	ModeAppend
+	/* Fail instead of replacing an existing file */
+	ModeNoClobber
+)
+
+/*
+A function that returns the mode selected by the --append and --no_clobber flags.
+
+Returns the mode and an error if both flags are set.
+*/
+func ParseMode(appendOutput, noClobber bool) (Mode, error) {
+	switch {
+	case appendOutput && noClobber:
+		return ModeTruncate, errors.New("Appending and no clobbering are mutually exclusive. Please provide only one of --append or --no_clobber.")
+	case appendOutput:
+		return ModeAppend, nil
+	case noClobber:
+		return ModeNoClobber, nil
+	}
+	return ModeTruncate, nil
+}
+
+/*
+A struct that writes an output file atomically.
+
+Everything is written to a temporary file in the same directory, which only replaces the destination on Commit,
+so a crash while writing leaves the previous file intact and readers never see a partial file.
+In ModeAppend the output is written in place at the end of the destination instead, without copying its contents,
+and Abort truncates it back to its previous size.
+Appending is not atomic: a crash, or a SIGKILL, before Commit or Abort leaves whatever was flushed so far at the end of the destination,
+so the previous contents are intact, but may be followed by a partial output, whose last line may be cut in half.
+*/
+type File struct {
+	path   string
+	mode   Mode
+	temp   *os.File
+	writer *bufio.Writer
+
+	/* Size of the destination before appending to it, or -1 if it was created */
+	appendedAt int64
+}
+
+/* Function linking the temporary file to the destination, replaceable to test file systems without hard links */
+var link = os.Link
+
+/*
+A function that starts writing an output file.
+
+In ModeAppend the existing file is opened to write at its end, and in ModeNoClobber an existing file is an error.
+Receives the path to the destination and the mode.
+Returns the File and an error.
+*/
+func Create(path string, mode Mode) (*File, error) {
+	perm := os.FileMode(0644)
+
+	info, err := os.Stat(path)
+	switch {
+	case err == nil && mode == ModeNoClobber:
+		return nil, errors.New("Output file " + path + " already exists. Please remove it or run without --no_clobber.")
+	case err == nil:
+		perm = info.Mode().Perm()
+	case !errors.Is(err, os.ErrNotExist):
+		return nil, err
+	}
+
+	if mode == ModeAppend {
+		return createAppend(path, perm, info != nil)
+	}
+
+	temp, err := os.CreateTemp(filepath.Dir(path), filepath.Base(path)+".*.tmp")
+	if err != nil {
+		return nil, err
+	}
+
+	file := &File{path: path, mode: mode, temp: temp, writer: bufio.NewWriter(temp)}
+	if err := temp.Chmod(perm); err != nil {
+		file.Abort()
+		return nil, err
+	}
+
+	return file, nil
+}
+
+/*
+A function that opens the destination to write at its end, creating it if it doesn't exist.
+*/
+func createAppend(path string, perm os.FileMode, existed bool) (*File, error) {
+	destination, err := os.OpenFile(path, os.O_WRONLY|os.O_APPEND|os.O_CREATE, perm)
+	if err != nil {
+		return nil, err
+	}
+
+	file := &File{path: path, mode: ModeAppend, temp: destination, writer: bufio.NewWriter(destination), appendedAt: -1}
+	if !existed {
+		return file, nil
+	}
+
+	info, err := destination.Stat()
+	if err != nil {
+		destination.Close()
+		return nil, err
+	}
+	file.appendedAt = info.Size()
+
+	return file, nil
+}
+
+/*
+A function that writes bytes to the output.
+*/
+func (f *File) Write(p []byte) (int, error) {
+	return f.writer.Write(p)
+}
+
+/*
+A function that writes a string to the output.
+*/
+func (f *File) WriteString(s string) (int, error) {
+	return f.writer.WriteString(s)
+}
+
+/*
+A function that flushes and syncs everything written, then replaces the destination with it.
+
+In ModeAppend the destination was written in place, so it is only flushed and synced.
+In ModeNoClobber the destination is linked instead of renamed, so a file created meanwhile is not replaced either.
+On file systems without hard links, the destination is created exclusively and the output copied into it.
+Returns an error, in which case the destination is left untouched.
+*/
+func (f *File) Commit() error {
+	if f.mode == ModeAppend {
+		return f.commitAppend()
+	}
+
+	defer os.Remove(f.temp.Name())
+
+	err := f.writer.Flush()
+	if err == nil {
+		err = f.temp.Sync()
+	}
+	if closeErr := f.temp.Close(); err == nil {
+		err = closeErr
+	}
+	if err != nil {
+		return err
+	}
+
+	if f.mode == ModeNoClobber {
+		err := link(f.temp.Name(), f.path)
+		if err != nil && !errors.Is(err, os.ErrExist) {
+			err = f.copyExclusive()
+		}
+		if errors.Is(err, os.ErrExist) {
+			return errors.New("Output file " + f.path + " already exists. Please remove it or run without --no_clobber.")
+		}
+		if err != nil {
+			return err
+		}
+	} else if err := os.Rename(f.temp.Name(), f.path); err != nil {
+		return err
+	}
+
+	return syncDir(filepath.Dir(f.path))
+}
+
+/*
+A function that flushes and syncs the output appended to the destination.
+*/
+func (f *File) commitAppend() error {
+	err := f.writer.Flush()
+	if err == nil {
+		err = f.temp.Sync()
+	}
+	if closeErr := f.temp.Close(); err == nil {
+		err = closeErr
+	}
+	if err != nil {
+		f.truncate()
+		return err
+	}
+
+	/* A destination created by appending has to survive a crash too */
+	if f.appendedAt < 0 {
+		return syncDir(filepath.Dir(f.path))
+	}
+	return nil
+}
+
+/*
+A function that creates the destination, failing if it exists, and copies the temporary file into it.
+
+Returns an error, which is os.ErrExist if the destination exists. If the copy fails, the destination is removed.
+*/
+func (f *File) copyExclusive() error {
+	info, err := os.Stat(f.temp.Name())
+	if err != nil {
+		return err
+	}
+
+	destination, err := os.OpenFile(f.path, os.O_WRONLY|os.O_CREATE|os.O_EXCL, info.Mode().Perm())
+	if err != nil {
+		return err
+	}
+
+	temp, err := os.Open(f.temp.Name())
+	if err == nil {
+		_, err = io.Copy(destination, temp)
+		temp.Close()
+	}
+	if err == nil {
+		err = destination.Sync()
+	}
+	if closeErr := destination.Close(); err == nil {
+		err = closeErr
+	}
+	if err != nil {
+		os.Remove(f.path)
+		return err
+	}
+
+	return nil
+}
+
+/*
+A function that discards everything written, leaving the destination untouched.
+*/
+func (f *File) Abort() error {
+	if f.mode == ModeAppend {
+		f.temp.Close()
+		return f.truncate()
+	}
+
+	f.temp.Close()
+	return os.Remove(f.temp.Name())
+}
+
+/*
+A function that discards what was appended to the destination, removing it if it was created by appending.
+*/
+func (f *File) truncate() error {
+	if f.appendedAt < 0 {
+		return os.Remove(f.path)
+	}
+	return os.Truncate(f.path, f.appendedAt)
+}
+
+/*
+A function that syncs a directory, so a file renamed into it survives a crash.
+*/
+func syncDir(path string) error {
+	dir, err := os.Open(path)
+	if err != nil {
+		return err
+	}
+	defer dir.Close()
+
+	return dir.Sync()
+}
+
+/*
+A function that writes a string into a file atomically.
+
+Receives a path to a file, the string value to write to the file and how to handle an existing file.
+Returns an error.
+*/
+func WriteStringToFile(path, content string, mode Mode) error {
+	file, err := Create(path, mode)
+	if err != nil {
+		return err
+	}
+
+	if _, err := file.WriteString(content); err != nil {
+		file.Abort()
+		return err
+	}
+
+	return file.Commit()
+}
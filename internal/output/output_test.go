@@ -0,0 +1,195 @@
+package output_test
+
+import (
+	"errors"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/jmbds/unbabel-backend-engineering-challenge/internal/output"
+)
+
+func TestParseMode(t *testing.T) {
+	testcases := []struct {
+		name          string
+		appendOutput  bool
+		noClobber     bool
+		expected      output.Mode
+		expectedError error
+	}{
+		{"valid case - truncate", false, false, output.ModeTruncate, errors.New("")},
+		{"valid case - append", true, false, output.ModeAppend, errors.New("")},
+		{"valid case - no clobber", false, true, output.ModeNoClobber, errors.New("")},
+		{"invalid case - both", true, true, output.ModeTruncate, errors.New("Appending and no clobbering are mutually exclusive. Please provide only one of --append or --no_clobber.")},
+	}
+
+	for _, tc := range testcases {
+		t.Run(tc.name, func(t *testing.T) {
+			got, err := output.ParseMode(tc.appendOutput, tc.noClobber)
+			if err != nil && err.Error() != tc.expectedError.Error() {
+				t.Errorf("Unexpected error: %s", err.Error())
+			}
+
+			if got != tc.expected {
+				t.Errorf("expected %v, got %v", tc.expected, got)
+			}
+		})
+	}
+}
+
+func TestWriteStringToFile(t *testing.T) {
+	testcases := []struct {
+		name          string
+		existing      string
+		mode          output.Mode
+		expected      string
+		expectedError bool
+	}{
+		{"valid case - truncate existing", "old\n", output.ModeTruncate, "new\n", false},
+		{"valid case - truncate missing", "", output.ModeTruncate, "new\n", false},
+		{"valid case - append existing", "old\n", output.ModeAppend, "old\nnew\n", false},
+		{"valid case - append missing", "", output.ModeAppend, "new\n", false},
+		{"valid case - no clobber missing", "", output.ModeNoClobber, "new\n", false},
+		{"invalid case - no clobber existing", "old\n", output.ModeNoClobber, "old\n", true},
+	}
+
+	for _, tc := range testcases {
+		t.Run(tc.name, func(t *testing.T) {
+			directory := t.TempDir()
+			path := filepath.Join(directory, "aggregated_events.out.json")
+			if tc.existing != "" {
+				if err := os.WriteFile(path, []byte(tc.existing), 0644); err != nil {
+					t.Fatal(err)
+				}
+			}
+
+			if err := output.WriteStringToFile(path, "new\n", tc.mode); (err != nil) != tc.expectedError {
+				t.Errorf("Unexpected error: %v", err)
+			}
+
+			got, err := os.ReadFile(path)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if string(got) != tc.expected {
+				t.Errorf("expected %q, got %q", tc.expected, string(got))
+			}
+
+			/* No temporary file is left behind */
+			entries, err := os.ReadDir(directory)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if len(entries) != 1 {
+				t.Errorf("expected only the output file, got %d files", len(entries))
+			}
+		})
+	}
+}
+
+func TestFileAbort(t *testing.T) {
+	directory := t.TempDir()
+	path := filepath.Join(directory, "aggregated_events.out.json")
+	if err := os.WriteFile(path, []byte("old\n"), 0644); err != nil {
+		t.Fatal(err)
+	}
+
+	file, err := output.Create(path, output.ModeTruncate)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, err := file.WriteString("partial"); err != nil {
+		t.Fatal(err)
+	}
+
+	/* Until committed, the previous output is still in place */
+	got, err := os.ReadFile(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if string(got) != "old\n" {
+		t.Errorf("expected %q, got %q", "old\n", string(got))
+	}
+
+	if err := file.Abort(); err != nil {
+		t.Fatal(err)
+	}
+
+	entries, err := os.ReadDir(directory)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(entries) != 1 {
+		t.Errorf("expected only the output file, got %d files", len(entries))
+	}
+}
+
+func TestFileAppendInPlace(t *testing.T) {
+	testcases := []struct {
+		name     string
+		existing string
+		commit   bool
+		expected string
+	}{
+		{"valid case - commit", "old\n", true, "old\nnew\n"},
+		{"valid case - abort", "old\n", false, "old\n"},
+		{"valid case - abort missing", "", false, ""},
+	}
+
+	for _, tc := range testcases {
+		t.Run(tc.name, func(t *testing.T) {
+			directory := t.TempDir()
+			path := filepath.Join(directory, "aggregated_events.out.json")
+			var before os.FileInfo
+			if tc.existing != "" {
+				if err := os.WriteFile(path, []byte(tc.existing), 0644); err != nil {
+					t.Fatal(err)
+				}
+				info, err := os.Stat(path)
+				if err != nil {
+					t.Fatal(err)
+				}
+				before = info
+			}
+
+			file, err := output.Create(path, output.ModeAppend)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if _, err := file.WriteString("new\n"); err != nil {
+				t.Fatal(err)
+			}
+			if tc.commit {
+				err = file.Commit()
+			} else {
+				err = file.Abort()
+			}
+			if err != nil {
+				t.Fatal(err)
+			}
+
+			got, err := os.ReadFile(path)
+			if tc.existing == "" && !tc.commit {
+				if !errors.Is(err, os.ErrNotExist) {
+					t.Errorf("expected the output file to be removed, got %v", err)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatal(err)
+			}
+			if string(got) != tc.expected {
+				t.Errorf("expected %q, got %q", tc.expected, string(got))
+			}
+
+			/* The existing file is appended to, not replaced by a copy */
+			after, err := os.Stat(path)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if before != nil && !os.SameFile(before, after) {
+				t.Errorf("expected the output file to be appended in place")
+			}
+		})
+	}
+}
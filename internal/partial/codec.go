@@ -0,0 +1,245 @@
+package partial
+
+import (
+	"bufio"
+	"encoding/binary"
+	"encoding/json"
+	"errors"
+	"io"
+	"math"
+	"sort"
+	"strings"
+	"time"
+
+	"github.com/jmbds/unbabel-backend-engineering-challenge/internal/events"
+	"github.com/jmbds/unbabel-backend-engineering-challenge/internal/statistics"
+)
+
+/*
+A type that selects how a state is written.
+*/
+type Format int
+
+const (
+	/* A JSON document, readable and diffable */
+	FormatJSON Format = iota
+	/* A compact binary encoding, starting with binaryMagic */
+	FormatBinary
+)
+
+/* Bytes that start a state in the binary format, followed by its version */
+const (
+	binaryMagic   = "UBPS"
+	binaryVersion = 1
+)
+
+var errInvalidState = errors.New("Partial state is invalid. Please provide a state written by unbabel_cli partial.")
+
+/*
+A function that parses the name of a format.
+
+Receives the name, json or binary.
+Returns the format and an error if the name is unknown.
+*/
+func ParseFormat(name string) (Format, error) {
+	switch strings.ToLower(name) {
+	case "json":
+		return FormatJSON, nil
+	case "binary":
+		return FormatBinary, nil
+	}
+	return FormatJSON, errors.New("Unknown partial state format " + name + ". Please provide json or binary.")
+}
+
+/*
+Structs that hold a state as it is written in the JSON format.
+*/
+type jsonState struct {
+	Unit    string       `json:"unit"`
+	Buckets []jsonBucket `json:"buckets"`
+}
+
+type jsonBucket struct {
+	Start  string  `json:"start"`
+	Total  float64 `json:"total"`
+	Count  int     `json:"count"`
+	Sketch *Sketch `json:"sketch"`
+}
+
+/*
+A function that writes a state in the given format.
+
+Receives the writer, the state and the format.
+Returns an error.
+*/
+func Write(writer io.Writer, state *State, format Format) error {
+	if format == FormatBinary {
+		return writeBinary(writer, state)
+	}
+
+	document := jsonState{Unit: state.Unit.String(), Buckets: make([]jsonBucket, 0, len(state.Buckets))}
+	for _, bucket := range state.Buckets {
+		document.Buckets = append(document.Buckets, jsonBucket{
+			Start:  bucket.Start.Format(events.OutputTimestampFormat),
+			Total:  bucket.DataPoint.Total,
+			Count:  bucket.DataPoint.Count,
+			Sketch: bucket.Sketch,
+		})
+	}
+
+	return json.NewEncoder(writer).Encode(document)
+}
+
+/*
+A function that writes a state in the binary format.
+
+After the magic bytes and version, every number is a varint, except totals, which are the 8 bytes of their float64 in little endian.
+The unit is followed by the number of buckets, and each bucket by its start in nanoseconds since the Unix epoch,
+its total, count, number of values of zero and number of bins of its sketch, each an index and its count.
+*/
+func writeBinary(writer io.Writer, state *State) error {
+	buffer := append([]byte(binaryMagic), binaryVersion)
+	buffer = binary.AppendVarint(buffer, int64(state.Unit))
+	buffer = binary.AppendUvarint(buffer, uint64(len(state.Buckets)))
+
+	for _, bucket := range state.Buckets {
+		buffer = binary.AppendVarint(buffer, bucket.Start.UnixNano())
+		buffer = binary.LittleEndian.AppendUint64(buffer, math.Float64bits(bucket.DataPoint.Total))
+		buffer = binary.AppendVarint(buffer, int64(bucket.DataPoint.Count))
+		buffer = binary.AppendVarint(buffer, int64(bucket.Sketch.Zero))
+		buffer = binary.AppendUvarint(buffer, uint64(len(bucket.Sketch.Bins)))
+		for _, index := range bucket.Sketch.indexes() {
+			buffer = binary.AppendVarint(buffer, int64(index))
+			buffer = binary.AppendVarint(buffer, int64(bucket.Sketch.Bins[index]))
+		}
+	}
+
+	_, err := writer.Write(buffer)
+	return err
+}
+
+/*
+A function that reads a state, detecting its format.
+
+Receives the reader.
+Returns the state and an error if it is invalid.
+*/
+func Read(reader io.Reader) (*State, error) {
+	buffered := bufio.NewReader(reader)
+	magic, err := buffered.Peek(len(binaryMagic))
+	if err == nil && string(magic) == binaryMagic {
+		return readBinary(buffered)
+	}
+
+	document := jsonState{}
+	if err := json.NewDecoder(buffered).Decode(&document); err != nil {
+		return nil, errInvalidState
+	}
+
+	unit, err := time.ParseDuration(document.Unit)
+	if err != nil {
+		return nil, errInvalidState
+	}
+	state, err := NewState(unit)
+	if err != nil {
+		return nil, errInvalidState
+	}
+
+	for _, bucket := range document.Buckets {
+		start, err := time.Parse(events.OutputTimestampFormat, bucket.Start)
+		if err != nil {
+			return nil, errInvalidState
+		}
+		sketch := bucket.Sketch
+		if sketch == nil {
+			sketch = NewSketch()
+		}
+		if sketch.Bins == nil {
+			sketch.Bins = make(map[int]int)
+		}
+		state.Buckets = append(state.Buckets, Bucket{Start: start, DataPoint: statistics.DataPoint{Total: bucket.Total, Count: bucket.Count}, Sketch: sketch})
+	}
+
+	return sorted(state)
+}
+
+/*
+A function that reads a state in the binary format, described in writeBinary.
+*/
+func readBinary(reader *bufio.Reader) (*State, error) {
+	header := make([]byte, len(binaryMagic)+1)
+	if _, err := io.ReadFull(reader, header); err != nil || header[len(binaryMagic)] != binaryVersion {
+		return nil, errInvalidState
+	}
+
+	/* Any read past the end of the state leaves an error, checked once it was read */
+	var readErr error
+	readVarint := func() int64 {
+		value, err := binary.ReadVarint(reader)
+		if err != nil && readErr == nil {
+			readErr = err
+		}
+		return value
+	}
+	readUvarint := func() uint64 {
+		value, err := binary.ReadUvarint(reader)
+		if err != nil && readErr == nil {
+			readErr = err
+		}
+		return value
+	}
+
+	state, err := NewState(time.Duration(readVarint()))
+	if err != nil {
+		return nil, errInvalidState
+	}
+
+	buckets := readUvarint()
+	for i := uint64(0); i < buckets && readErr == nil; i++ {
+		start := time.Unix(0, readVarint()).UTC()
+		total := make([]byte, 8)
+		if _, err := io.ReadFull(reader, total); err != nil {
+			return nil, errInvalidState
+		}
+		count := readVarint()
+
+		sketch := NewSketch()
+		sketch.Zero = int(readVarint())
+		bins := readUvarint()
+		for j := uint64(0); j < bins && readErr == nil; j++ {
+			index := readVarint()
+			sketch.Bins[int(index)] = int(readVarint())
+		}
+
+		state.Buckets = append(state.Buckets, Bucket{
+			Start:     start,
+			DataPoint: statistics.DataPoint{Total: math.Float64frombits(binary.LittleEndian.Uint64(total)), Count: int(count)},
+			Sketch:    sketch,
+		})
+	}
+	if readErr != nil {
+		return nil, errInvalidState
+	}
+
+	/* Nothing can follow the state */
+	if _, err := reader.ReadByte(); err != io.EOF {
+		return nil, errInvalidState
+	}
+
+	return sorted(state)
+}
+
+/*
+A function that orders the buckets of a state read, which can't have two buckets of the same start.
+*/
+func sorted(state *State) (*State, error) {
+	sort.SliceStable(state.Buckets, func(i, j int) bool {
+		return state.Buckets[i].Start.Before(state.Buckets[j].Start)
+	})
+	for i := 1; i < len(state.Buckets); i++ {
+		if state.Buckets[i].Start.Equal(state.Buckets[i-1].Start) {
+			return nil, errInvalidState
+		}
+	}
+	return state, nil
+}
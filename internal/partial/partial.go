@@ -0,0 +1,167 @@
+/*
+Package partial holds the intermediate state of the moving average, the total delivery time, number of events and sketch of each bucket,
+so events sharded across machines can be aggregated separately and merged before the moving average is calculated.
+*/
+package partial
+
+import (
+	"context"
+	"errors"
+	"io"
+	"time"
+
+	"github.com/jmbds/unbabel-backend-engineering-challenge/internal/events"
+	"github.com/jmbds/unbabel-backend-engineering-challenge/internal/statistics"
+)
+
+/*
+A struct that holds the events of a bucket, the interval of a unit starting at Start.
+*/
+type Bucket struct {
+	Start     time.Time
+	DataPoint statistics.DataPoint
+	Sketch    *Sketch
+}
+
+/*
+A struct that holds the partial state of the events read by one machine, with a bucket per unit with events, ordered by Start.
+
+States are sums, so merging the states of any split of the events, even within a bucket, gives the state of all of them.
+*/
+type State struct {
+	Unit    time.Duration
+	Buckets []Bucket
+}
+
+/*
+A function that creates an empty state.
+
+Receives the unit of its buckets.
+Returns the state and an error if the unit is not positive.
+*/
+func NewState(unit time.Duration) (*State, error) {
+	if unit <= 0 {
+		return nil, errors.New("Unit has to be greater than 0, please provide a valid unit.")
+	}
+	return &State{Unit: unit, Buckets: make([]Bucket, 0)}, nil
+}
+
+/*
+A function that adds an event to the bucket of its timestamp.
+
+Events usually arrive in order, so buckets are searched from the last one, like the buckets of a sparse dataset.
+*/
+func (s *State) Add(timestamp time.Time, duration float64) {
+	bucket := s.bucket(timestamp.Truncate(s.Unit))
+	bucket.DataPoint.Total += duration
+	bucket.DataPoint.Count++
+	bucket.Sketch.Add(duration)
+}
+
+/*
+A function that adds the buckets of another state to the state.
+
+Receives the other state.
+Returns an error if the states have different units.
+*/
+func (s *State) Merge(other *State) error {
+	if other.Unit != s.Unit {
+		return errors.New("Partial states have different units, " + s.Unit.String() + " and " + other.Unit.String() + ". Please provide states of the same unit.")
+	}
+
+	for _, otherBucket := range other.Buckets {
+		bucket := s.bucket(otherBucket.Start)
+		bucket.DataPoint.Total += otherBucket.DataPoint.Total
+		bucket.DataPoint.Count += otherBucket.DataPoint.Count
+		bucket.Sketch.Merge(otherBucket.Sketch)
+	}
+
+	return nil
+}
+
+/*
+A function that returns the bucket starting at start, inserting an empty one if there is none.
+*/
+func (s *State) bucket(start time.Time) *Bucket {
+	position := len(s.Buckets)
+	for position > 0 && s.Buckets[position-1].Start.After(start) {
+		position--
+	}
+	if position > 0 && s.Buckets[position-1].Start.Equal(start) {
+		return &s.Buckets[position-1]
+	}
+
+	s.Buckets = append(s.Buckets, Bucket{})
+	copy(s.Buckets[position+1:], s.Buckets[position:])
+	s.Buckets[position] = Bucket{Start: start, Sketch: NewSketch()}
+	return &s.Buckets[position]
+}
+
+/*
+A function that returns the sketch of every event of the state.
+*/
+func (s *State) Sketch() *Sketch {
+	sketch := NewSketch()
+	for _, bucket := range s.Buckets {
+		sketch.Merge(bucket.Sketch)
+	}
+	return sketch
+}
+
+/*
+A function that converts the state into the dataset the moving average is calculated over.
+
+Like the dataset of the events, it starts one bucket before the first bucket with events.
+Returns the dataset and an error if the state has no events.
+*/
+func (s *State) Dataset() (statistics.SparseDataset, error) {
+	if len(s.Buckets) == 0 {
+		return statistics.SparseDataset{}, errors.New("Partial states have no events. Please provide states of at least one event.")
+	}
+
+	start := s.Buckets[0].Start.Add(-s.Unit)
+	dataset := statistics.SparseDataset{Buckets: make([]statistics.Bucket, 0, len(s.Buckets)), Start: start, Unit: s.Unit}
+	for _, bucket := range s.Buckets {
+		dataset.Add(int(bucket.Start.Sub(start)/s.Unit), bucket.DataPoint)
+	}
+
+	return dataset, nil
+}
+
+/*
+A function that reads the events of a file into a state, without requiring them to be ordered.
+
+Only translation_delivered events carry a delivery time, so the other events are skipped, like the moving average does.
+Receives the context, checked while reading, the state and the reader of the events.
+Returns the number of translation_delivered events read and an error.
+*/
+func ReadEvents(ctx context.Context, state *State, reader io.Reader) (int, error) {
+	source := events.NewFileSource(reader)
+	raw := events.RawEvent{}
+	count := 0
+
+	for {
+		line, err := source.Next(ctx)
+		if err == io.EOF {
+			return count, nil
+		}
+		if err != nil {
+			return count, err
+		}
+
+		if err := events.DecodeRawEvent(line, events.DefaultFields|events.FieldEventName, &raw); err != nil {
+			return count, err
+		}
+		event := raw.Event()
+		if !events.IsDelivered(event) {
+			continue
+		}
+		timestamp, err := raw.Time()
+		if err != nil {
+			return count, err
+		}
+
+		state.Add(timestamp, float64(event.Duration))
+		count++
+	}
+}
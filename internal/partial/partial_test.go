@@ -0,0 +1,171 @@
+package partial_test
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"math"
+	"reflect"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/jmbds/unbabel-backend-engineering-challenge/internal/events"
+	"github.com/jmbds/unbabel-backend-engineering-challenge/internal/partial"
+)
+
+const testEvents = `{"timestamp": "2018-12-26 18:11:08.509654","translation_id": "5aa5b2f39f7254a75aa5","source_language": "en","target_language": "fr","client_name": "airliberty","event_name": "translation_delivered","nr_words": 30, "duration": 20}
+{"timestamp": "2018-12-26 18:11:40.903159","translation_id": "5aa5b2f39f7254a75aa6","source_language": "en","target_language": "fr","client_name": "airliberty","event_name": "translation_delivered","nr_words": 30, "duration": 10}
+{"timestamp": "2018-12-26 18:15:19.903159","translation_id": "5aa5b2f39f7254a75aa4","source_language": "en","target_language": "fr","client_name": "airliberty","event_name": "translation_delivered","nr_words": 30, "duration": 31}
+{"timestamp": "2018-12-26 18:23:19.903159","translation_id": "5aa5b2f39f7254a75bb3","source_language": "en","target_language": "fr","client_name": "taxi-eats","event_name": "translation_delivered","nr_words": 100, "duration": 54}
+`
+
+/*
+A function that reads events into a new state of a minute.
+*/
+func readState(t *testing.T, content string) *partial.State {
+	state, err := partial.NewState(time.Minute)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, err := partial.ReadEvents(context.Background(), state, strings.NewReader(content)); err != nil {
+		t.Fatal(err)
+	}
+	return state
+}
+
+func TestSketch(t *testing.T) {
+	sketch := partial.NewSketch()
+	for value := 1; value <= 1000; value++ {
+		sketch.Add(float64(value))
+	}
+	sketch.Add(0)
+
+	testcases := []struct {
+		name     string
+		quantile float64
+		expected float64
+	}{
+		{"minimum", 0, 0},
+		{"median", 0.5, 500},
+		{"p95", 0.95, 950},
+		{"p99", 0.99, 990},
+		{"maximum", 1, 1000},
+	}
+
+	for _, tc := range testcases {
+		t.Run(tc.name, func(t *testing.T) {
+			got := sketch.Quantile(tc.quantile)
+			if math.Abs(got-tc.expected) > tc.expected*partial.SketchAccuracy {
+				t.Errorf("expected %v within %v, got %v", tc.expected, partial.SketchAccuracy, got)
+			}
+		})
+	}
+
+	if got := partial.NewSketch().Quantile(0.5); got != 0 {
+		t.Errorf("expected 0 for an empty sketch, got %v", got)
+	}
+}
+
+func TestMerge(t *testing.T) {
+	transactionDeliveredEvents, err := events.ReadEventsSource(context.Background(), events.NewFileSource(strings.NewReader(testEvents)), events.DefaultFields)
+	if err != nil {
+		t.Fatal(err)
+	}
+	expected, err := events.GroupEventsByUnit(context.Background(), transactionDeliveredEvents, time.Minute)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	/* Every split of the events, including within a minute and out of order, merges into the same dataset */
+	lines := strings.SplitAfter(testEvents, "\n")
+	for split := 0; split <= 4; split++ {
+		merged := readState(t, strings.Join(lines[split:], ""))
+		if err := merged.Merge(readState(t, strings.Join(lines[:split], ""))); err != nil {
+			t.Fatal(err)
+		}
+
+		got, err := merged.Dataset()
+		if err != nil {
+			t.Fatal(err)
+		}
+		if !reflect.DeepEqual(got, expected) {
+			t.Errorf("split at %d: expected %v, got %v", split, expected, got)
+		}
+		if count := merged.Sketch().Count(); count != 4 {
+			t.Errorf("split at %d: expected 4 events in the sketch, got %d", split, count)
+		}
+	}
+
+	hourly, err := partial.NewState(time.Hour)
+	if err != nil {
+		t.Fatal(err)
+	}
+	expectedError := errors.New("Partial states have different units, 1m0s and 1h0m0s. Please provide states of the same unit.")
+	if err := readState(t, testEvents).Merge(hourly); err == nil || err.Error() != expectedError.Error() {
+		t.Errorf("expected %v, got %v", expectedError, err)
+	}
+
+	empty := readState(t, "")
+	expectedError = errors.New("Partial states have no events. Please provide states of at least one event.")
+	if _, err := empty.Dataset(); err == nil || err.Error() != expectedError.Error() {
+		t.Errorf("expected %v, got %v", expectedError, err)
+	}
+}
+
+func TestReadWrite(t *testing.T) {
+	state := readState(t, testEvents)
+
+	for _, name := range []string{"json", "binary"} {
+		t.Run(name, func(t *testing.T) {
+			format, err := partial.ParseFormat(name)
+			if err != nil {
+				t.Fatal(err)
+			}
+
+			buffer := bytes.Buffer{}
+			if err := partial.Write(&buffer, state, format); err != nil {
+				t.Fatal(err)
+			}
+			got, err := partial.Read(&buffer)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if !reflect.DeepEqual(got, state) {
+				t.Errorf("expected %v, got %v", state, got)
+			}
+		})
+	}
+
+	binary := bytes.Buffer{}
+	if err := partial.Write(&binary, state, partial.FormatBinary); err != nil {
+		t.Fatal(err)
+	}
+
+	testcases := []struct {
+		name    string
+		content []byte
+	}{
+		{"empty", []byte{}},
+		{"invalid json", []byte(`{"unit": "1m0s", "buckets": [`)},
+		{"invalid unit", []byte(`{"unit": "a minute", "buckets": []}`)},
+		{"invalid start", []byte(`{"unit": "1m0s", "buckets": [{"start": "yesterday"}]}`)},
+		{"duplicate bucket", []byte(`{"unit": "1m0s", "buckets": [{"start": "2018-12-26 18:11:00"}, {"start": "2018-12-26 18:11:00"}]}`)},
+		{"truncated binary", binary.Bytes()[:binary.Len()-1]},
+		{"trailing binary", append(append([]byte{}, binary.Bytes()...), 0)},
+	}
+
+	expectedError := errors.New("Partial state is invalid. Please provide a state written by unbabel_cli partial.")
+	for _, tc := range testcases {
+		t.Run(tc.name, func(t *testing.T) {
+			if _, err := partial.Read(bytes.NewReader(tc.content)); err == nil || err.Error() != expectedError.Error() {
+				t.Errorf("expected %v, got %v", expectedError, err)
+			}
+		})
+	}
+
+	expectedError = errors.New("Unknown partial state format xml. Please provide json or binary.")
+	if _, err := partial.ParseFormat("xml"); err == nil || err.Error() != expectedError.Error() {
+		t.Errorf("expected %v, got %v", expectedError, err)
+	}
+}
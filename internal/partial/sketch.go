@@ -0,0 +1,108 @@
+package partial
+
+import (
+	"math"
+	"sort"
+)
+
+/* Relative error of the quantiles estimated by a sketch */
+const SketchAccuracy = 0.01
+
+/* Ratio between the bounds of each bin of a sketch */
+var sketchGamma = (1 + SketchAccuracy) / (1 - SketchAccuracy)
+
+/*
+A struct that holds a sketch of the distribution of delivery times, to estimate its quantiles.
+
+Values are counted in logarithmic bins, so any quantile is estimated within SketchAccuracy of its value,
+and the sketches of different machines are merged by summing their bins, in any order.
+Zero counts the values that are zero or lower, and Bins the other values by the index of their bin.
+*/
+type Sketch struct {
+	Zero int         `json:"zero"`
+	Bins map[int]int `json:"bins"`
+}
+
+/*
+A function that creates an empty sketch.
+*/
+func NewSketch() *Sketch {
+	return &Sketch{Bins: make(map[int]int)}
+}
+
+/*
+A function that adds a value to the sketch.
+*/
+func (s *Sketch) Add(value float64) {
+	if value <= 0 {
+		s.Zero++
+		return
+	}
+	s.Bins[int(math.Ceil(math.Log(value)/math.Log(sketchGamma)))]++
+}
+
+/*
+A function that adds the values of another sketch to the sketch.
+*/
+func (s *Sketch) Merge(other *Sketch) {
+	s.Zero += other.Zero
+	for index, count := range other.Bins {
+		s.Bins[index] += count
+	}
+}
+
+/*
+A function that returns the number of values added to the sketch.
+*/
+func (s *Sketch) Count() int {
+	count := s.Zero
+	for _, binCount := range s.Bins {
+		count += binCount
+	}
+	return count
+}
+
+/*
+A function that estimates a quantile of the values added to the sketch.
+
+Receives the quantile, between 0 and 1.
+Returns the estimated value, or 0 if the sketch is empty.
+*/
+func (s *Sketch) Quantile(quantile float64) float64 {
+	count := s.Count()
+	if count == 0 {
+		return 0
+	}
+
+	/* The rank of the value, counting from 0, by the nearest-rank method */
+	rank := int(math.Ceil(quantile*float64(count))) - 1
+	if rank < 0 {
+		rank = 0
+	}
+	if rank < s.Zero {
+		return 0
+	}
+	rank -= s.Zero
+
+	for _, index := range s.indexes() {
+		if rank < s.Bins[index] {
+			/* The value in the middle of the bounds of the bin, relative to both */
+			return 2 * math.Pow(sketchGamma, float64(index)) / (sketchGamma + 1)
+		}
+		rank -= s.Bins[index]
+	}
+
+	return 0
+}
+
+/*
+A function that lists the indexes of the bins of the sketch in increasing order.
+*/
+func (s *Sketch) indexes() []int {
+	indexes := make([]int, 0, len(s.Bins))
+	for index := range s.Bins {
+		indexes = append(indexes, index)
+	}
+	sort.Ints(indexes)
+	return indexes
+}
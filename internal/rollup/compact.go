@@ -0,0 +1,155 @@
+package rollup
+
+import (
+	"context"
+	"errors"
+	"sort"
+	"time"
+
+	"github.com/jmbds/unbabel-backend-engineering-challenge/internal/statistics"
+)
+
+/*
+A struct that holds how long the rollups of each resolution are kept, counted back from the end of their interval.
+
+A zero duration keeps the rollups of the resolution forever.
+*/
+type Retention struct {
+	Minute time.Duration
+	Hour   time.Duration
+	Day    time.Duration
+}
+
+/*
+A function that returns the retention of a resolution.
+*/
+func (r Retention) of(resolution Resolution) time.Duration {
+	switch resolution {
+	case Minute:
+		return r.Minute
+	case Hour:
+		return r.Hour
+	default:
+		return r.Day
+	}
+}
+
+/*
+A function that compacts a store, rolling the rollups of each resolution up into the coarser ones and dropping those past their retention.
+
+Rollups are sums, so the rollups of segments not rolled up yet are added to every coarser resolution, and the averages stay exact.
+Partitions are compacted one at a time, reading only the segments whose rollups fall in them, so the store is never read into memory at once.
+Every segment of a resolution is replaced by a single one per partition, in a single manifest replacement, so a crash leaves the store as it was.
+Receives the context, checked between partitions, the retention of each resolution and the current time.
+Returns the number of segments of the store once compacted and an error.
+*/
+func (s *Store) Compact(ctx context.Context, retention Retention, now time.Time) (int, error) {
+	next := s.manifest
+	next.Sequence++
+	next.Horizons = make(map[string]time.Time, len(Resolutions))
+	for name, horizon := range s.manifest.Horizons {
+		next.Horizons[name] = horizon
+	}
+
+	written := make([]Segment, 0)
+	for level, resolution := range Resolutions {
+		partitions, sources, err := s.compactionSources(level)
+		if err != nil {
+			return 0, err
+		}
+
+		/* Rollups ending before the cutoff are past their retention, and so are the partitions ending before it */
+		cutoff := time.Time{}
+		if duration := retention.of(resolution); duration > 0 {
+			cutoff = now.Add(-duration)
+			if horizon := cutoff.Truncate(resolution.Unit); horizon.After(next.Horizons[resolution.Name]) {
+				next.Horizons[resolution.Name] = horizon
+			}
+		}
+
+		for _, partition := range partitions {
+			if err := ctx.Err(); err != nil {
+				return 0, err
+			}
+
+			_, end, err := partitionBounds(resolution, partition)
+			if err != nil {
+				return 0, errors.New("Segment partition " + partition + " is invalid. Please provide a valid store.")
+			}
+			if !cutoff.IsZero() && !end.After(cutoff) {
+				continue
+			}
+
+			rollups := make(map[rollupKey]statistics.DataPoint)
+			for _, segment := range sources[partition] {
+				err := s.readSegment(segment, func(rollup Rollup) {
+					key := rollupKey{start: rollup.Start.Truncate(resolution.Unit), group: rollup.Group}
+					if cutoff.IsZero() || key.start.Add(resolution.Unit).After(cutoff) {
+						addRollup(rollups, key, rollup.DataPoint)
+					}
+				})
+				if err != nil {
+					return 0, err
+				}
+			}
+			if len(rollups) == 0 {
+				continue
+			}
+
+			segment := newSegment(resolution, partition, next.Sequence, true)
+			if err := s.writeSegment(segment, sortRollups(rollups)); err != nil {
+				return 0, err
+			}
+			written = append(written, segment)
+		}
+	}
+
+	if err := s.commit(next, written, s.manifest.Segments); err != nil {
+		return 0, err
+	}
+
+	return len(s.manifest.Segments), nil
+}
+
+/*
+A function that finds the segments whose rollups are compacted into each partition of a resolution.
+
+These are the segments of the resolution, and the segments of the finer ones not rolled up yet,
+whose partitions are always within a single partition of the resolution.
+Receives the index of the resolution in Resolutions.
+Returns the partitions in order, the segments of each one and an error if a segment is invalid.
+*/
+func (s *Store) compactionSources(level int) ([]string, map[string][]Segment, error) {
+	resolution := Resolutions[level]
+	partitions := make([]string, 0)
+	sources := make(map[string][]Segment)
+
+	for _, segment := range s.manifest.Segments {
+		segmentLevel := 0
+		for segmentLevel < len(Resolutions) && Resolutions[segmentLevel].Name != segment.Resolution {
+			segmentLevel++
+		}
+		if segmentLevel == len(Resolutions) {
+			return nil, nil, errors.New("Segment " + segment.Path + " is invalid. Please provide a valid store.")
+		}
+
+		/* Rollups already rolled up are only kept at their own resolution */
+		if segmentLevel > level || (segmentLevel < level && segment.RolledUp) {
+			continue
+		}
+
+		start, err := time.Parse(Resolutions[segmentLevel].Layout, segment.Partition)
+		if err != nil {
+			return nil, nil, errors.New("Segment " + segment.Path + " is invalid. Please provide a valid store.")
+		}
+		partition := start.Format(resolution.Layout)
+		if _, found := sources[partition]; !found {
+			partitions = append(partitions, partition)
+		}
+		sources[partition] = append(sources[partition], segment)
+	}
+
+	/* Partition names sort as their starts do */
+	sort.Strings(partitions)
+	return partitions, sources, nil
+}
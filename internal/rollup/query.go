@@ -0,0 +1,124 @@
+package rollup
+
+import (
+	"context"
+	"errors"
+	"time"
+
+	"github.com/jmbds/unbabel-backend-engineering-challenge/internal/events"
+	"github.com/jmbds/unbabel-backend-engineering-challenge/internal/statistics"
+)
+
+/*
+A struct that holds a query of the moving average of the rollups of a store.
+
+Group is the client to query, or an empty string for every client.
+From and To bound the interval of the values returned, from inclusive to exclusive, and are unbounded when zero.
+Unit is the interval of each bucket the moving average is calculated over, a multiple of a minute, and WindowSize the number of buckets in its window.
+*/
+type Query struct {
+	Group      string
+	From       time.Time
+	To         time.Time
+	Unit       time.Duration
+	WindowSize int
+}
+
+/*
+A function that calculates the moving average of the rollups of a store, as if it was calculated from the events ingested.
+
+Buckets before From are read to fill the window of the first values, but only values from From on are emitted.
+Without From, the values start one bucket before the first rollup, like the moving average of the events, so they only cover the rollups kept.
+Rollups are read from the coarsest resolution whose unit divides the unit of the query, so queries over long intervals stay small.
+Receives the context, the query and the function called with each moving average value and its interval.
+Returns an error if the query is invalid, reads rollups dropped past their retention, or no rollups match it.
+*/
+func (s *Store) Query(ctx context.Context, query Query, emit func(point statistics.Point) error) error {
+	if query.Unit < Minute.Unit || query.Unit%Minute.Unit != 0 {
+		return errors.New("Unit has to be a multiple of a minute, please provide a valid unit.")
+	}
+	if query.WindowSize < 1 {
+		return errors.New("Window Size has to be equal or greater than 1, please provide a valid Window Size.")
+	}
+	if !query.From.IsZero() && !query.To.IsZero() && !query.From.Before(query.To) {
+		return errors.New("The start of the query has to be before its end. Please provide a valid interval.")
+	}
+
+	from := query.From.Truncate(query.Unit)
+	readFrom := time.Time{}
+	if !query.From.IsZero() {
+		readFrom = from.Add(-time.Duration(query.WindowSize-1) * query.Unit)
+	}
+
+	/* Rollups dropped past their retention would read as buckets without events, so a query from before them is rejected */
+	resolution := queryResolution(query.Unit)
+	if horizon, found := s.manifest.Horizons[resolution.Name]; found && !readFrom.IsZero() && readFrom.Before(horizon) {
+		return errors.New("Rollups by " + resolution.Name + " before " + horizon.Format(events.OutputTimestampFormat) + " were dropped past their retention. Please query from then on, including the window, or with a unit of a coarser resolution.")
+	}
+
+	rollups, err := s.Read(ctx, resolution, readFrom, query.To)
+	if err != nil {
+		return err
+	}
+
+	dataset, err := groupRollups(rollups, query, readFrom)
+	if err != nil {
+		return err
+	}
+
+	return statistics.IterateMovingAverage(dataset, query.WindowSize, func(point statistics.Point) error {
+		if !query.From.IsZero() && point.Start.Before(from) {
+			return nil
+		}
+		return emit(point)
+	})
+}
+
+/*
+A function that picks the coarsest resolution whose unit divides the unit of a query, so the fewest rollups are read.
+*/
+func queryResolution(unit time.Duration) Resolution {
+	for i := len(Resolutions) - 1; i > 0; i-- {
+		if unit%Resolutions[i].Unit == 0 {
+			return Resolutions[i]
+		}
+	}
+	return Minute
+}
+
+/*
+A function that groups the rollups of the queried group into buckets of the unit of the query.
+
+Receives the rollups ordered by start, the query and the start of the first bucket, or zero to start one bucket before the first rollup.
+Returns the dataset and an error if no rollups match the query.
+*/
+func groupRollups(rollups []Rollup, query Query, start time.Time) (statistics.SparseDataset, error) {
+	dataset := statistics.SparseDataset{Buckets: make([]statistics.Bucket, 0), Start: start, Unit: query.Unit}
+	found := false
+
+	for _, rollup := range rollups {
+		if query.Group != "" && rollup.Group != query.Group {
+			continue
+		}
+
+		bucket := rollup.Start.Truncate(query.Unit)
+		if !found && dataset.Start.IsZero() {
+			dataset.Start = bucket.Add(-query.Unit)
+		}
+		found = true
+
+		dataset.Add(int(bucket.Sub(dataset.Start)/query.Unit), rollup.DataPoint)
+	}
+	if !found {
+		return statistics.SparseDataset{}, errors.New("No events found. Please provide a query matching the events ingested.")
+	}
+
+	/* Cover the whole interval queried, even after the last rollup */
+	if !query.To.IsZero() {
+		if length := int((query.To.Sub(dataset.Start) + query.Unit - 1) / query.Unit); length > dataset.Length {
+			dataset.Length = length
+		}
+	}
+
+	return dataset, nil
+}
@@ -0,0 +1,309 @@
+package rollup_test
+
+import (
+	"context"
+	"errors"
+	"os"
+	"path/filepath"
+	"reflect"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/jmbds/unbabel-backend-engineering-challenge/internal/events"
+	"github.com/jmbds/unbabel-backend-engineering-challenge/internal/rollup"
+	"github.com/jmbds/unbabel-backend-engineering-challenge/internal/statistics"
+)
+
+const testEvents = `{"timestamp": "2018-12-26 18:11:08.509654","translation_id": "5aa5b2f39f7254a75aa5","source_language": "en","target_language": "fr","client_name": "airliberty","event_name": "translation_delivered","nr_words": 30, "duration": 20}
+{"timestamp": "2018-12-26 18:15:19.903159","translation_id": "5aa5b2f39f7254a75aa4","source_language": "en","target_language": "fr","client_name": "airliberty","event_name": "translation_delivered","nr_words": 30, "duration": 31}
+{"timestamp": "2018-12-26 18:23:19.903159","translation_id": "5aa5b2f39f7254a75bb3","source_language": "en","target_language": "fr","client_name": "taxi-eats","event_name": "translation_delivered","nr_words": 100, "duration": 54}
+`
+
+/*
+A function that runs a query, returning every value emitted.
+*/
+func query(store *rollup.Store, q rollup.Query) ([]statistics.Point, error) {
+	points := []statistics.Point{}
+	err := store.Query(context.Background(), q, func(point statistics.Point) error {
+		points = append(points, point)
+		return nil
+	})
+	return points, err
+}
+
+/*
+A function that calculates the moving average of events directly, to compare with the queries.
+*/
+func movingAverage(t *testing.T, content string, unit time.Duration, windowSize int) []statistics.Point {
+	path := filepath.Join(t.TempDir(), "events.json")
+	if err := os.WriteFile(path, []byte(content), 0644); err != nil {
+		t.Fatal(err)
+	}
+	transactionDeliveredEvents, err := events.ReadEventsFile(context.Background(), path, events.DefaultFields)
+	if err != nil {
+		t.Fatal(err)
+	}
+	dataset, err := events.GroupEventsByUnit(context.Background(), transactionDeliveredEvents, unit)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	points := []statistics.Point{}
+	statistics.IterateMovingAverage(dataset, windowSize, func(point statistics.Point) error {
+		points = append(points, point)
+		return nil
+	})
+	return points
+}
+
+func TestIngest(t *testing.T) {
+	directory := t.TempDir()
+	inputFilepath := filepath.Join(directory, "events.json")
+	lines := strings.SplitAfter(testEvents, "\n")
+
+	/* The third line is still being written */
+	if err := os.WriteFile(inputFilepath, []byte(lines[0]+lines[1]+lines[2][:40]), 0644); err != nil {
+		t.Fatal(err)
+	}
+
+	store, err := rollup.Open(filepath.Join(directory, "store"))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	count, err := store.Ingest(context.Background(), inputFilepath)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if count != 2 {
+		t.Errorf("expected 2 events, got %d", count)
+	}
+
+	/* Only the rest of the file is ingested again, from a store opened again */
+	if err := os.WriteFile(inputFilepath, []byte(testEvents), 0644); err != nil {
+		t.Fatal(err)
+	}
+	store, err = rollup.Open(filepath.Join(directory, "store"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	for _, expected := range []int{1, 0} {
+		count, err = store.Ingest(context.Background(), inputFilepath)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if count != expected {
+			t.Errorf("expected %d events, got %d", expected, count)
+		}
+	}
+
+	expected := movingAverage(t, testEvents, time.Minute, 10)
+	got, err := query(store, rollup.Query{Unit: time.Minute, WindowSize: 10})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !reflect.DeepEqual(got, expected) {
+		t.Errorf("expected %v, got %v", expected, got)
+	}
+
+	/* A file that shrank was replaced, so ingesting it from its offset would skip events */
+	if err := os.WriteFile(inputFilepath, []byte(lines[0]), 0644); err != nil {
+		t.Fatal(err)
+	}
+	expectedError := errors.New("Input file " + inputFilepath + " is shorter than when it was ingested. Please ingest rotated files under a new name.")
+	if _, err := store.Ingest(context.Background(), inputFilepath); err == nil || err.Error() != expectedError.Error() {
+		t.Errorf("expected %v, got %v", expectedError, err)
+	}
+}
+
+func TestQuery(t *testing.T) {
+	directory := t.TempDir()
+	inputFilepath := filepath.Join(directory, "events.json")
+	if err := os.WriteFile(inputFilepath, []byte(testEvents), 0644); err != nil {
+		t.Fatal(err)
+	}
+
+	store, err := rollup.Open(filepath.Join(directory, "store"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, err := store.Ingest(context.Background(), inputFilepath); err != nil {
+		t.Fatal(err)
+	}
+
+	at := func(value string) time.Time {
+		parsed, err := time.Parse(events.OutputTimestampFormat, value)
+		if err != nil {
+			t.Fatal(err)
+		}
+		return parsed
+	}
+	point := func(start string, unit time.Duration, value float64) statistics.Point {
+		return statistics.Point{Start: at(start), End: at(start).Add(unit), Value: value}
+	}
+
+	testcases := []struct {
+		name          string
+		query         rollup.Query
+		expected      []statistics.Point
+		expectedError error
+	}{
+		{
+			"every client by 5 minutes",
+			rollup.Query{Unit: 5 * time.Minute, WindowSize: 2},
+			movingAverage(t, testEvents, 5*time.Minute, 2),
+			nil,
+		},
+		{
+			"a client over an interval",
+			rollup.Query{Group: "airliberty", From: at("2018-12-26 18:15:00"), To: at("2018-12-26 18:19:00"), Unit: time.Minute, WindowSize: 3},
+			[]statistics.Point{
+				point("2018-12-26 18:15:00", time.Minute, 31),
+				point("2018-12-26 18:16:00", time.Minute, 31),
+				point("2018-12-26 18:17:00", time.Minute, 31),
+				point("2018-12-26 18:18:00", time.Minute, 0),
+			},
+			nil,
+		},
+		{
+			"window filled before the interval",
+			rollup.Query{From: at("2018-12-26 18:20:00"), To: at("2018-12-26 18:30:00"), Unit: 5 * time.Minute, WindowSize: 3},
+			[]statistics.Point{
+				point("2018-12-26 18:20:00", 5*time.Minute, 35),
+				point("2018-12-26 18:25:00", 5*time.Minute, 42.5),
+			},
+			nil,
+		},
+		{
+			"a client without events",
+			rollup.Query{Group: "unknown", Unit: time.Minute, WindowSize: 10},
+			nil,
+			errors.New("No events found. Please provide a query matching the events ingested."),
+		},
+		{
+			"unit shorter than a minute",
+			rollup.Query{Unit: time.Second, WindowSize: 10},
+			nil,
+			errors.New("Unit has to be a multiple of a minute, please provide a valid unit."),
+		},
+		{
+			"invalid window size",
+			rollup.Query{Unit: time.Minute, WindowSize: 0},
+			nil,
+			errors.New("Window Size has to be equal or greater than 1, please provide a valid Window Size."),
+		},
+		{
+			"empty interval",
+			rollup.Query{From: at("2018-12-26 18:20:00"), To: at("2018-12-26 18:20:00"), Unit: time.Minute, WindowSize: 10},
+			nil,
+			errors.New("The start of the query has to be before its end. Please provide a valid interval."),
+		},
+	}
+
+	for _, tc := range testcases {
+		t.Run(tc.name, func(t *testing.T) {
+			got, err := query(store, tc.query)
+			if (err != nil) != (tc.expectedError != nil) || (err != nil && err.Error() != tc.expectedError.Error()) {
+				t.Fatalf("expected error %v, got %v", tc.expectedError, err)
+			}
+			if err == nil && !reflect.DeepEqual(got, tc.expected) {
+				t.Errorf("expected %v, got %v", tc.expected, got)
+			}
+		})
+	}
+}
+
+func TestCompact(t *testing.T) {
+	directory := t.TempDir()
+	lines := strings.SplitAfter(testEvents, "\n")
+	lateEvent := `{"timestamp": "2018-12-26 19:02:11.000000","translation_id": "5aa5b2f39f7254a75cc1","source_language": "en","target_language": "fr","client_name": "airliberty","event_name": "translation_delivered","nr_words": 30, "duration": 40}` + "\n"
+
+	store, err := rollup.Open(filepath.Join(directory, "store"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	ingest := func(name, content string) {
+		inputFilepath := filepath.Join(directory, name)
+		if err := os.WriteFile(inputFilepath, []byte(content), 0644); err != nil {
+			t.Fatal(err)
+		}
+		if _, err := store.Ingest(context.Background(), inputFilepath); err != nil {
+			t.Fatal(err)
+		}
+	}
+	compact := func(retention rollup.Retention, now time.Time, expectedSegments int) {
+		segments, err := store.Compact(context.Background(), retention, now)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if segments != expectedSegments {
+			t.Errorf("expected %d segments, got %d", expectedSegments, segments)
+		}
+	}
+	check := func(content string, unit time.Duration) {
+		expected := movingAverage(t, content, unit, 3)
+		got, err := query(store, rollup.Query{Unit: unit, WindowSize: 3})
+		if err != nil {
+			t.Fatal(err)
+		}
+		if !reflect.DeepEqual(got, expected) {
+			t.Errorf("expected %v by %v, got %v", expected, unit, got)
+		}
+	}
+
+	/* Each ingestion writes its own minute segment */
+	ingest("first.json", lines[0]+lines[1])
+	ingest("second.json", lines[2])
+	compact(rollup.Retention{}, time.Now(), 3)
+	for _, unit := range []time.Duration{time.Minute, 5 * time.Minute, time.Hour, 24 * time.Hour} {
+		check(testEvents, unit)
+	}
+
+	/* Events ingested after a rollup are read by every resolution, and rolled up only once */
+	ingest("late.json", lateEvent)
+	for _, unit := range []time.Duration{time.Minute, time.Hour, 24 * time.Hour} {
+		check(testEvents+lateEvent, unit)
+	}
+	compact(rollup.Retention{}, time.Now(), 3)
+	compact(rollup.Retention{}, time.Now(), 3)
+	for _, unit := range []time.Duration{time.Minute, time.Hour, 24 * time.Hour} {
+		check(testEvents+lateEvent, unit)
+	}
+
+	/* Minutes past their retention are dropped, while hours and days keep the exact averages */
+	now := time.Date(2018, 12, 27, 0, 0, 0, 0, time.UTC)
+	compact(rollup.Retention{Minute: time.Hour, Hour: 30 * 24 * time.Hour}, now, 2)
+	check(testEvents+lateEvent, time.Hour)
+	check(testEvents+lateEvent, 24*time.Hour)
+
+	/* Queries by minute can't read the minutes dropped, even to fill the window of the first value */
+	horizon := time.Date(2018, 12, 26, 23, 0, 0, 0, time.UTC)
+	retentionError := errors.New("Rollups by minute before 2018-12-26 23:00:00 were dropped past their retention. Please query from then on, including the window, or with a unit of a coarser resolution.")
+	testcases := []struct {
+		name          string
+		query         rollup.Query
+		expectedError error
+	}{
+		{"unbounded", rollup.Query{Unit: time.Minute, WindowSize: 3}, errors.New("No events found. Please provide a query matching the events ingested.")},
+		{"before the horizon", rollup.Query{From: horizon.Add(-time.Hour), Unit: 30 * time.Minute, WindowSize: 1}, retentionError},
+		{"window before the horizon", rollup.Query{From: horizon, Unit: time.Minute, WindowSize: 3}, retentionError},
+		{"after the horizon", rollup.Query{From: horizon.Add(2 * time.Minute), Unit: time.Minute, WindowSize: 3}, errors.New("No events found. Please provide a query matching the events ingested.")},
+	}
+	for _, tc := range testcases {
+		t.Run(tc.name, func(t *testing.T) {
+			if _, err := query(store, tc.query); err == nil || err.Error() != tc.expectedError.Error() {
+				t.Errorf("expected %v, got %v", tc.expectedError, err)
+			}
+		})
+	}
+
+	/* Replaced segments are removed */
+	entries, err := filepath.Glob(filepath.Join(directory, "store", "*", "*.jsonl"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(entries) != 2 {
+		t.Errorf("expected 2 segment files, got %v", entries)
+	}
+}
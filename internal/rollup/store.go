@@ -0,0 +1,495 @@
+package rollup
+
+import (
+	"bufio"
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"sort"
+	"time"
+
+	"github.com/jmbds/unbabel-backend-engineering-challenge/internal/events"
+	"github.com/jmbds/unbabel-backend-engineering-challenge/internal/output"
+	"github.com/jmbds/unbabel-backend-engineering-challenge/internal/statistics"
+)
+
+/* Name of the file listing the segments of a store and the inputs ingested into it */
+const manifestFilename = "manifest.json"
+
+/*
+A struct that holds the interval of time rollups are summed over, and how their segments are partitioned.
+
+Segments are partitioned by the Layout of the start of their rollups, so queries only read the partitions they need.
+*/
+type Resolution struct {
+	Name   string
+	Unit   time.Duration
+	Layout string
+}
+
+var (
+	/* Rollups of a minute, partitioned by day */
+	Minute = Resolution{Name: "minute", Unit: time.Minute, Layout: "2006-01-02"}
+	/* Rollups of an hour, partitioned by month */
+	Hour = Resolution{Name: "hour", Unit: time.Hour, Layout: "2006-01"}
+	/* Rollups of a day, partitioned by year */
+	Day = Resolution{Name: "day", Unit: 24 * time.Hour, Layout: "2006"}
+
+	/* Resolutions from the finest to the coarsest, each unit a multiple of the previous one */
+	Resolutions = []Resolution{Minute, Hour, Day}
+)
+
+/*
+A struct that holds the total delivery time and number of events of a group, over an interval starting at Start.
+*/
+type Rollup struct {
+	Start     time.Time
+	Group     string
+	DataPoint statistics.DataPoint
+}
+
+/*
+A struct that holds a rollup as it is written in a segment, one per line.
+*/
+type record struct {
+	Start string  `json:"start"`
+	Group string  `json:"group"`
+	Total float64 `json:"total"`
+	Count int     `json:"count"`
+}
+
+/*
+A struct that holds a segment of a store, a file with the rollups of a partition of a resolution, ordered by start and group.
+
+RolledUp is set once the rollups of the segment were added to the coarser resolutions, which otherwise still have to add them when read.
+*/
+type Segment struct {
+	Resolution string `json:"resolution"`
+	Partition  string `json:"partition"`
+	Path       string `json:"path"`
+	RolledUp   bool   `json:"rolled_up,omitempty"`
+}
+
+/*
+A struct that holds the state of a store, replaced atomically once new segments are written.
+
+Inputs holds the byte offset up to which each input file was ingested, by its absolute path.
+Sequence is the number of the last batch of segments written, used to name new segments.
+Horizons holds the start of the first rollups kept at each resolution, by its name, once older ones were dropped past their retention.
+*/
+type manifest struct {
+	Inputs   map[string]int64     `json:"inputs"`
+	Segments []Segment            `json:"segments"`
+	Sequence int                  `json:"sequence"`
+	Horizons map[string]time.Time `json:"horizons,omitempty"`
+}
+
+/*
+A struct that stores rollups of events by group, in segment files of a directory.
+
+Rollups are sums, so the rollups of the same interval and group in different segments are summed when read.
+Segments are only listed in the manifest once they were written, so a crash while writing leaves the store as it was.
+A store is meant to be written by a single process at a time.
+*/
+type Store struct {
+	dir      string
+	manifest manifest
+}
+
+/*
+A function that opens a store, creating its directory if it doesn't exist.
+
+Receives the path to the directory.
+Returns the Store and an error.
+*/
+func Open(dir string) (*Store, error) {
+	if err := os.MkdirAll(dir, 0755); err != nil {
+		return nil, err
+	}
+
+	store := &Store{dir: dir, manifest: manifest{Inputs: make(map[string]int64), Segments: []Segment{}}}
+
+	content, err := os.ReadFile(filepath.Join(dir, manifestFilename))
+	if errors.Is(err, os.ErrNotExist) {
+		return store, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+
+	if err := json.Unmarshal(content, &store.manifest); err != nil {
+		return nil, errors.New("Store manifest is invalid. Please provide a valid store.")
+	}
+	if store.manifest.Inputs == nil {
+		store.manifest.Inputs = make(map[string]int64)
+	}
+
+	return store, nil
+}
+
+/*
+A function that ingests the events appended to a file since it was last ingested, adding their rollups by client at minute resolution.
+
+Only complete lines are ingested, so a file that is still being written can be ingested again later.
+Events don't have to be ordered by timestamp, as rollups are sums.
+Receives the context, checked while reading, and the path to the file.
+Returns the number of translation_delivered events ingested and an error.
+*/
+func (s *Store) Ingest(ctx context.Context, inputFilepath string) (int, error) {
+	path, err := filepath.Abs(inputFilepath)
+	if err != nil {
+		return 0, err
+	}
+
+	file, err := os.Open(path)
+	if err != nil {
+		return 0, err
+	}
+	defer file.Close()
+
+	info, err := file.Stat()
+	if err != nil {
+		return 0, err
+	}
+
+	offset := s.manifest.Inputs[path]
+	if info.Size() < offset {
+		return 0, errors.New("Input file " + inputFilepath + " is shorter than when it was ingested. Please ingest rotated files under a new name.")
+	}
+	if _, err := file.Seek(offset, io.SeekStart); err != nil {
+		return 0, err
+	}
+
+	rollups := make(map[rollupKey]statistics.DataPoint)
+	reader := bufio.NewReader(file)
+	raw := events.RawEvent{}
+	count := 0
+
+	for lines := 0; ; lines++ {
+		if lines%4096 == 0 {
+			if err := ctx.Err(); err != nil {
+				return 0, err
+			}
+		}
+
+		line, err := reader.ReadBytes('\n')
+		if err == io.EOF {
+			break
+		}
+		if err != nil {
+			return 0, err
+		}
+		offset += int64(len(line))
+
+		if err := events.DecodeRawEvent(line, events.DefaultFields|events.FieldEventName|events.FieldClientName, &raw); err != nil {
+			return 0, err
+		}
+
+		/* Only translation_delivered events carry a delivery time */
+		event := raw.Event()
+		if !events.IsDelivered(event) {
+			continue
+		}
+
+		timestamp, err := raw.Time()
+		if err != nil {
+			return 0, err
+		}
+
+		key := rollupKey{start: timestamp.Truncate(Minute.Unit), group: event.ClientName}
+		addRollup(rollups, key, statistics.DataPoint{Total: float64(event.Duration), Count: 1})
+		count++
+	}
+
+	next := s.manifest
+	next.Inputs = make(map[string]int64, len(s.manifest.Inputs)+1)
+	for input, inputOffset := range s.manifest.Inputs {
+		next.Inputs[input] = inputOffset
+	}
+	next.Inputs[path] = offset
+
+	if err := s.write(next, []batch{{resolution: Minute, rollups: sortRollups(rollups)}}, nil); err != nil {
+		return 0, err
+	}
+
+	return count, nil
+}
+
+/*
+A struct that identifies a rollup while they are summed.
+*/
+type rollupKey struct {
+	start time.Time
+	group string
+}
+
+/*
+A function that lists rollups ordered by start and group.
+*/
+func sortRollups(rollups map[rollupKey]statistics.DataPoint) []Rollup {
+	sorted := make([]Rollup, 0, len(rollups))
+	for key, dataPoint := range rollups {
+		sorted = append(sorted, Rollup{Start: key.start, Group: key.group, DataPoint: dataPoint})
+	}
+	sort.Slice(sorted, func(i, j int) bool {
+		if !sorted[i].Start.Equal(sorted[j].Start) {
+			return sorted[i].Start.Before(sorted[j].Start)
+		}
+		return sorted[i].Group < sorted[j].Group
+	})
+	return sorted
+}
+
+/*
+A struct that holds rollups of a resolution to write into new segments.
+*/
+type batch struct {
+	resolution Resolution
+	rollups    []Rollup
+	rolledUp   bool
+}
+
+/*
+A function that writes batches of rollups into new segments, one per partition, and then replaces the manifest.
+
+Receives the manifest to save, the batches with their rollups ordered by start and group, and the segments they replace, which are removed.
+Returns an error.
+*/
+func (s *Store) write(next manifest, batches []batch, replaced []Segment) error {
+	next.Sequence++
+	written := make([]Segment, 0, len(batches))
+
+	for _, batch := range batches {
+		rollups := batch.rollups
+		for start := 0; start < len(rollups); {
+			partition := rollups[start].Start.Format(batch.resolution.Layout)
+			end := start
+			for end < len(rollups) && rollups[end].Start.Format(batch.resolution.Layout) == partition {
+				end++
+			}
+
+			segment := newSegment(batch.resolution, partition, next.Sequence, batch.rolledUp)
+			if err := s.writeSegment(segment, rollups[start:end]); err != nil {
+				return err
+			}
+			written = append(written, segment)
+			start = end
+		}
+	}
+
+	return s.commit(next, written, replaced)
+}
+
+/*
+A function that lists the segments written in the manifest, in place of the ones they replace, and then replaces the manifest.
+
+Receives the manifest to save, the segments written and the segments they replace, which are removed.
+Returns an error.
+*/
+func (s *Store) commit(next manifest, written []Segment, replaced []Segment) error {
+	next.Segments = make([]Segment, 0, len(s.manifest.Segments)+len(written))
+	for _, segment := range s.manifest.Segments {
+		if !containsSegment(replaced, segment) {
+			next.Segments = append(next.Segments, segment)
+		}
+	}
+	next.Segments = append(next.Segments, written...)
+
+	content, err := json.Marshal(next)
+	if err != nil {
+		return err
+	}
+	if err := output.WriteStringToFile(filepath.Join(s.dir, manifestFilename), string(content), output.ModeTruncate); err != nil {
+		return err
+	}
+	s.manifest = next
+
+	/* Replaced segments are no longer listed, so failing to remove them only leaves unused files behind */
+	for _, segment := range replaced {
+		os.Remove(filepath.Join(s.dir, segment.Path))
+	}
+
+	return nil
+}
+
+/*
+A function that names a new segment of a partition of a resolution, after the sequence of the batch it is written in.
+*/
+func newSegment(resolution Resolution, partition string, sequence int, rolledUp bool) Segment {
+	return Segment{
+		Resolution: resolution.Name,
+		Partition:  partition,
+		Path:       filepath.Join(resolution.Name, fmt.Sprintf("%s.%06d.jsonl", partition, sequence)),
+		RolledUp:   rolledUp,
+	}
+}
+
+/*
+A function that writes the rollups of a segment, one JSON line each.
+*/
+func (s *Store) writeSegment(segment Segment, rollups []Rollup) error {
+	if err := os.MkdirAll(filepath.Join(s.dir, filepath.Dir(segment.Path)), 0755); err != nil {
+		return err
+	}
+
+	file, err := output.Create(filepath.Join(s.dir, segment.Path), output.ModeTruncate)
+	if err != nil {
+		return err
+	}
+
+	encoder := json.NewEncoder(file)
+	for _, rollup := range rollups {
+		err := encoder.Encode(record{
+			Start: rollup.Start.Format(events.OutputTimestampFormat),
+			Group: rollup.Group,
+			Total: rollup.DataPoint.Total,
+			Count: rollup.DataPoint.Count,
+		})
+		if err != nil {
+			file.Abort()
+			return err
+		}
+	}
+
+	return file.Commit()
+}
+
+/*
+A function that checks if a list of segments has the given one.
+*/
+func containsSegment(segments []Segment, segment Segment) bool {
+	for _, candidate := range segments {
+		if candidate == segment {
+			return true
+		}
+	}
+	return false
+}
+
+/*
+A function that reads the rollups of a resolution starting in the interval from from, inclusive, to to, exclusive.
+
+Rollups of the same start and group in different segments are summed. Zero from and to leave the interval unbounded.
+Rollups of finer resolutions that were not rolled up yet are added too, so recent events are never missing.
+Receives the context, checked while reading, the resolution and the interval.
+Returns the rollups ordered by start and group, and an error.
+*/
+func (s *Store) Read(ctx context.Context, resolution Resolution, from, to time.Time) ([]Rollup, error) {
+	rollups := make(map[rollupKey]statistics.DataPoint)
+
+	for _, segment := range s.manifest.Segments {
+		if err := ctx.Err(); err != nil {
+			return []Rollup{}, err
+		}
+
+		segmentResolution, ok := findResolution(segment.Resolution)
+		if !ok {
+			return []Rollup{}, errors.New("Segment " + segment.Path + " is invalid. Please provide a valid store.")
+		}
+		if segmentResolution != resolution && (segment.RolledUp || segmentResolution.Unit >= resolution.Unit) {
+			continue
+		}
+		if !partitionOverlaps(segmentResolution, segment.Partition, from, to) {
+			continue
+		}
+
+		err := s.readSegment(segment, func(rollup Rollup) {
+			start := rollup.Start.Truncate(resolution.Unit)
+			if (!from.IsZero() && start.Before(from)) || (!to.IsZero() && !start.Before(to)) {
+				return
+			}
+			addRollup(rollups, rollupKey{start: start, group: rollup.Group}, rollup.DataPoint)
+		})
+		if err != nil {
+			return []Rollup{}, err
+		}
+	}
+
+	return sortRollups(rollups), nil
+}
+
+/*
+A function that finds a resolution by its name.
+*/
+func findResolution(name string) (Resolution, bool) {
+	for _, resolution := range Resolutions {
+		if resolution.Name == name {
+			return resolution, true
+		}
+	}
+	return Resolution{}, false
+}
+
+/*
+A function that adds a data point to the rollup of a key.
+*/
+func addRollup(rollups map[rollupKey]statistics.DataPoint, key rollupKey, dataPoint statistics.DataPoint) {
+	sum := rollups[key]
+	sum.Total += dataPoint.Total
+	sum.Count += dataPoint.Count
+	rollups[key] = sum
+}
+
+/*
+A function that checks if a partition may have rollups starting in the interval, which is unbounded where it is zero.
+*/
+func partitionOverlaps(resolution Resolution, partition string, from, to time.Time) bool {
+	start, end, err := partitionBounds(resolution, partition)
+	if err != nil {
+		return true
+	}
+
+	return (from.IsZero() || end.After(from)) && (to.IsZero() || start.Before(to))
+}
+
+/*
+A function that returns the interval of the rollups of a partition, from its start, inclusive, to its end, exclusive.
+*/
+func partitionBounds(resolution Resolution, partition string) (time.Time, time.Time, error) {
+	start, err := time.Parse(resolution.Layout, partition)
+	if err != nil {
+		return time.Time{}, time.Time{}, err
+	}
+
+	/* The end of a partition is the start of the next one, one unit of its layout later */
+	switch resolution.Layout {
+	case Minute.Layout:
+		return start, start.AddDate(0, 0, 1), nil
+	case Hour.Layout:
+		return start, start.AddDate(0, 1, 0), nil
+	default:
+		return start, start.AddDate(1, 0, 0), nil
+	}
+}
+
+/*
+A function that reads the rollups of a segment, calling visit with each one.
+*/
+func (s *Store) readSegment(segment Segment, visit func(rollup Rollup)) error {
+	file, err := os.Open(filepath.Join(s.dir, segment.Path))
+	if err != nil {
+		return err
+	}
+	defer file.Close()
+
+	scanner := bufio.NewScanner(file)
+	for scanner.Scan() {
+		line := record{}
+		if err := json.Unmarshal(scanner.Bytes(), &line); err != nil {
+			return errors.New("Segment " + segment.Path + " is invalid. Please provide a valid store.")
+		}
+
+		start, err := time.Parse(events.OutputTimestampFormat, line.Start)
+		if err != nil {
+			return errors.New("Segment " + segment.Path + " is invalid. Please provide a valid store.")
+		}
+
+		visit(Rollup{Start: start, Group: line.Group, DataPoint: statistics.DataPoint{Total: line.Total, Count: line.Count}})
+	}
+
+	return scanner.Err()
+}
@@ -0,0 +1,271 @@
+package sla
+
+import (
+	"encoding/json"
+	"errors"
+	"os"
+	"strconv"
+	"time"
+
+	"github.com/jmbds/unbabel-backend-engineering-challenge/internal/events"
+	"github.com/jmbds/unbabel-backend-engineering-challenge/internal/statistics"
+)
+
+/*
+A struct that holds an SLA threshold for the moving average.
+
+Limit is the value above which the moving average is considered in breach.
+Hysteresis is the margin below Limit the moving average has to drop to for the breach to be considered over.
+*/
+type Threshold struct {
+	Limit      float64 `json:"threshold"`
+	Hysteresis float64 `json:"hysteresis"`
+}
+
+/*
+A function that checks a threshold is valid, neither its Limit nor its Hysteresis being negative.
+
+Receives the name the threshold is reported by in the error.
+Returns an error if the threshold is invalid.
+*/
+func (t Threshold) validate(name string) error {
+	if t.Limit < 0 {
+		return errors.New("SLA threshold " + name + "has to be equal or greater than 0, please provide a valid threshold.")
+	}
+	if t.Hysteresis < 0 {
+		return errors.New("SLA hysteresis " + name + "has to be equal or greater than 0, please provide a valid hysteresis.")
+	}
+	return nil
+}
+
+/*
+A struct that holds the SLA thresholds to evaluate.
+
+The embedded Threshold is applied to the moving average of all events when HasThreshold is set, even if its Limit is 0.
+Clients holds the thresholds applied to the moving average of each client's events.
+*/
+type Config struct {
+	Threshold
+	HasThreshold bool
+	Clients      map[string]Threshold
+}
+
+/*
+A struct that holds an SLA configuration as it is written in a file, telling thresholds that are 0 apart from missing ones.
+*/
+type configFile struct {
+	Limit      *float64 `json:"threshold"`
+	Hysteresis float64  `json:"hysteresis"`
+	Clients    map[string]struct {
+		Limit      *float64 `json:"threshold"`
+		Hysteresis float64  `json:"hysteresis"`
+	} `json:"clients"`
+}
+
+/*
+A struct that holds an interval during which the moving average was in breach of its threshold.
+
+Client is empty for breaches of the global threshold.
+Start is the first bucket in breach and End is the first bucket after the breach was over.
+Peak is the highest moving average value during the breach.
+*/
+type Breach struct {
+	Client string
+	Start  time.Time
+	End    time.Time
+	Peak   float64
+}
+
+/*
+A function that returns how long a breach lasted.
+*/
+func (b *Breach) Duration() time.Duration {
+	return b.End.Sub(b.Start)
+}
+
+/*
+A function that loads the SLA configuration.
+
+Receives either a number, used as global threshold, or a path to a JSON file with global and per-client thresholds.
+Returns the SLA configuration and an error.
+*/
+func LoadConfig(value string) (Config, error) {
+	if limit, err := strconv.ParseFloat(value, 64); err == nil {
+		config := Config{Threshold: Threshold{Limit: limit}, HasThreshold: true}
+		if err := config.Threshold.validate(""); err != nil {
+			return Config{}, err
+		}
+		return config, nil
+	}
+
+	content, err := os.ReadFile(value)
+	if err != nil {
+		return Config{}, err
+	}
+
+	file := configFile{}
+	err = json.Unmarshal(content, &file)
+	if err != nil {
+		return Config{}, errors.New("SLA configuration is invalid. Please provide a threshold or a valid SLA file.")
+	}
+
+	config := Config{Threshold: Threshold{Hysteresis: file.Hysteresis}, HasThreshold: file.Limit != nil}
+	if file.Limit != nil {
+		config.Limit = *file.Limit
+	}
+	if err := config.Threshold.validate(""); err != nil {
+		return Config{}, err
+	}
+
+	if len(file.Clients) > 0 {
+		config.Clients = make(map[string]Threshold, len(file.Clients))
+	}
+	for client, clientThreshold := range file.Clients {
+		if clientThreshold.Limit == nil {
+			return Config{}, errors.New("SLA threshold of client " + client + " is missing. Please provide a threshold for every client.")
+		}
+		threshold := Threshold{Limit: *clientThreshold.Limit, Hysteresis: clientThreshold.Hysteresis}
+		if err := threshold.validate("of client " + client + " "); err != nil {
+			return Config{}, err
+		}
+		config.Clients[client] = threshold
+	}
+
+	return config, nil
+}
+
+/*
+A struct that detects breaches of a threshold one moving average value at a time, so they can be notified as they occur.
+
+A breach starts when a value goes above the threshold Limit, and only ends when a value drops to Limit - Hysteresis or lower,
+so values hovering around the threshold don't produce a breach per bucket.
+Breaches holds the breaches that are over, in the order they started.
+*/
+type Detector struct {
+	Client    string
+	Threshold Threshold
+	Breaches  []Breach
+
+	current *Breach
+	last    statistics.Point
+}
+
+/*
+A function that creates a Detector.
+
+Receives the client the breaches are of, empty for the global threshold, and the threshold.
+Returns the Detector.
+*/
+func NewDetector(client string, threshold Threshold) *Detector {
+	return &Detector{Client: client, Threshold: threshold, Breaches: make([]Breach, 0)}
+}
+
+/*
+A function that observes the next moving average value, reported at the end of its interval.
+
+Returns the breach and true when the value starts a breach, with its End not known yet, or false otherwise.
+*/
+func (d *Detector) Observe(point statistics.Point) (Breach, bool) {
+	d.last = point
+
+	if d.current == nil {
+		if point.Value > d.Threshold.Limit {
+			d.current = &Breach{Client: d.Client, Start: point.End, Peak: point.Value}
+			return *d.current, true
+		}
+		return Breach{}, false
+	}
+
+	if point.Value <= d.Threshold.Limit-d.Threshold.Hysteresis {
+		d.current.End = point.End
+		d.Breaches = append(d.Breaches, *d.current)
+		d.current = nil
+		return Breach{}, false
+	}
+
+	if point.Value > d.current.Peak {
+		d.current.Peak = point.Value
+	}
+	return Breach{}, false
+}
+
+/*
+A function that closes a breach that is still open after the last value, ending it one unit after that value.
+
+Returns every breach detected.
+*/
+func (d *Detector) Close() []Breach {
+	if d.current != nil {
+		d.current.End = d.last.End.Add(d.last.End.Sub(d.last.Start))
+		d.Breaches = append(d.Breaches, *d.current)
+		d.current = nil
+	}
+	return d.Breaches
+}
+
+/*
+A function that finds the intervals in which a moving average was in breach of a threshold.
+
+Receives the moving average values, each reported at the end of its interval, and the threshold.
+Returns the list of breaches, where a breach still open at the last value ends one unit after it.
+*/
+func DetectBreaches(averages statistics.TimeSeries, threshold Threshold) []Breach {
+	detector := NewDetector("", threshold)
+
+	/* Repeating a value can't start or end a breach, so each run is observed at its first and last values only */
+	for _, run := range averages.Runs {
+		detector.Observe(averages.At(run.Index))
+		if run.Length > 1 {
+			detector.Observe(averages.At(run.Index + run.Length - 1))
+		}
+	}
+	return detector.Close()
+}
+
+/*
+A function that serializes a breach into its JSON representation.
+
+Receives a breach, whose end and duration are left out while it is still open.
+Returns the JSON line for the breach, without a trailing newline, and an error.
+*/
+func MarshalBreach(breach Breach) ([]byte, error) {
+	type breachRecord struct {
+		Client   string  `json:"client,omitempty"`
+		Start    string  `json:"start"`
+		End      string  `json:"end,omitempty"`
+		Peak     float64 `json:"peak_average_delivery_time"`
+		Duration float64 `json:"duration_minutes,omitempty"`
+	}
+
+	record := breachRecord{
+		Client: breach.Client,
+		Start:  breach.Start.Format(events.OutputTimestampFormat),
+		Peak:   breach.Peak,
+	}
+	if !breach.End.IsZero() {
+		record.End = breach.End.Format(events.OutputTimestampFormat)
+		record.Duration = breach.Duration().Minutes()
+	}
+
+	return json.Marshal(record)
+}
+
+/*
+A function that generates the string output of the breach report.
+
+Receives a list of breaches.
+Returns the string output with one JSON line per breach and an error.
+*/
+func GenerateBreachReportOutput(breaches []Breach) (string, error) {
+	textToOutput := ""
+	for _, breach := range breaches {
+		line, err := MarshalBreach(breach)
+		if err != nil {
+			return "", err
+		}
+
+		textToOutput += string(line) + "\n"
+	}
+
+	return textToOutput, nil
+}
@@ -0,0 +1,232 @@
+package sla_test
+
+import (
+	"errors"
+	"reflect"
+	"testing"
+	"time"
+
+	"github.com/jmbds/unbabel-backend-engineering-challenge/internal/sla"
+	"github.com/jmbds/unbabel-backend-engineering-challenge/internal/statistics"
+)
+
+func TestLoadConfig(t *testing.T) {
+	testcases := []struct {
+		name          string
+		value         string
+		expected      sla.Config
+		expectedError error
+	}{
+		{
+			"valid case - global threshold",
+			"30.5",
+			sla.Config{Threshold: sla.Threshold{Limit: 30.5}, HasThreshold: true},
+			errors.New(""),
+		},
+		{
+			"valid case - global threshold of 0",
+			"0",
+			sla.Config{HasThreshold: true},
+			errors.New(""),
+		},
+		{
+			"valid case - file",
+			"testcases/sla.json",
+			sla.Config{
+				Threshold:    sla.Threshold{Limit: 30, Hysteresis: 2},
+				HasThreshold: true,
+				Clients:      map[string]sla.Threshold{"airliberty": {Limit: 25}},
+			},
+			errors.New(""),
+		},
+		{
+			"valid case - client threshold of 0",
+			"testcases/zero_sla.json",
+			sla.Config{Clients: map[string]sla.Threshold{"airliberty": {Limit: 0}}},
+			errors.New(""),
+		},
+		{
+			"invalid case - negative threshold",
+			"-5",
+			sla.Config{},
+			errors.New("SLA threshold has to be equal or greater than 0, please provide a valid threshold."),
+		},
+		{
+			"invalid case - negative hysteresis",
+			"testcases/negative_hysteresis_sla.json",
+			sla.Config{},
+			errors.New("SLA hysteresis has to be equal or greater than 0, please provide a valid hysteresis."),
+		},
+		{
+			"invalid case - client without threshold",
+			"testcases/missing_threshold_sla.json",
+			sla.Config{},
+			errors.New("SLA threshold of client airliberty is missing. Please provide a threshold for every client."),
+		},
+		{
+			"invalid case - file not found",
+			"testcases/not_found.json",
+			sla.Config{},
+			errors.New("open testcases/not_found.json: no such file or directory"),
+		},
+		{
+			"invalid case - invalid format",
+			"testcases/invalid_sla.json",
+			sla.Config{},
+			errors.New("SLA configuration is invalid. Please provide a threshold or a valid SLA file."),
+		},
+	}
+
+	for _, tc := range testcases {
+		t.Run(tc.name, func(t *testing.T) {
+			got, err := sla.LoadConfig(tc.value)
+			if err != nil && err.Error() != tc.expectedError.Error() {
+				t.Errorf("Unexpected error: %s", err.Error())
+			}
+
+			if !reflect.DeepEqual(got, tc.expected) {
+				t.Errorf("expected %v, got %v", tc.expected, got)
+			}
+		})
+	}
+}
+
+func TestDetectBreaches(t *testing.T) {
+	start := time.Date(2018, 12, 26, 18, 11, 0, 0, time.UTC)
+
+	testcases := []struct {
+		name      string
+		averages  []float64
+		threshold sla.Threshold
+		expected  []sla.Breach
+	}{
+		{
+			"no breach",
+			[]float64{0, 20, 20, 25.5},
+			sla.Threshold{Limit: 30},
+			[]sla.Breach{},
+		},
+		{
+			"breach closed",
+			[]float64{0, 20, 31, 42.5, 20},
+			sla.Threshold{Limit: 30},
+			[]sla.Breach{
+				{Start: start.Add(2 * time.Minute), End: start.Add(4 * time.Minute), Peak: 42.5},
+			},
+		},
+		{
+			"breach open at the end",
+			[]float64{0, 20, 31, 42.5},
+			sla.Threshold{Limit: 30},
+			[]sla.Breach{
+				{Start: start.Add(2 * time.Minute), End: start.Add(4 * time.Minute), Peak: 42.5},
+			},
+		},
+		{
+			"flapping without hysteresis",
+			[]float64{31, 29, 31, 29},
+			sla.Threshold{Limit: 30},
+			[]sla.Breach{
+				{Start: start, End: start.Add(1 * time.Minute), Peak: 31},
+				{Start: start.Add(2 * time.Minute), End: start.Add(3 * time.Minute), Peak: 31},
+			},
+		},
+		{
+			"flapping with hysteresis",
+			[]float64{31, 29, 31, 29, 27},
+			sla.Threshold{Limit: 30, Hysteresis: 2},
+			[]sla.Breach{
+				{Start: start, End: start.Add(4 * time.Minute), Peak: 31},
+			},
+		},
+	}
+
+	for _, tc := range testcases {
+		t.Run(tc.name, func(t *testing.T) {
+			/* Each average is reported at the end of its interval */
+			averages := statistics.NewTimeSeries(start.Add(-time.Minute), time.Minute, tc.averages)
+			got := sla.DetectBreaches(averages, tc.threshold)
+
+			if !reflect.DeepEqual(got, tc.expected) {
+				t.Errorf("expected %v, got %v", tc.expected, got)
+			}
+		})
+	}
+}
+
+func TestDetectorObserve(t *testing.T) {
+	start := time.Date(2018, 12, 26, 18, 11, 0, 0, time.UTC)
+	averages := statistics.NewTimeSeries(start.Add(-time.Minute), time.Minute, []float64{20, 31, 42.5, 20, 35})
+
+	/* Each breach is returned by the value that starts it, before it is over */
+	detector := sla.NewDetector("airliberty", sla.Threshold{Limit: 30})
+	started := []sla.Breach{}
+	for i := 0; i < averages.Length; i++ {
+		if breach, ok := detector.Observe(averages.At(i)); ok {
+			started = append(started, breach)
+		}
+	}
+	expectedStarted := []sla.Breach{
+		{Client: "airliberty", Start: start.Add(time.Minute), Peak: 31},
+		{Client: "airliberty", Start: start.Add(4 * time.Minute), Peak: 35},
+	}
+	if !reflect.DeepEqual(started, expectedStarted) {
+		t.Errorf("expected %v, got %v", expectedStarted, started)
+	}
+
+	expected := []sla.Breach{
+		{Client: "airliberty", Start: start.Add(time.Minute), End: start.Add(3 * time.Minute), Peak: 42.5},
+		{Client: "airliberty", Start: start.Add(4 * time.Minute), End: start.Add(5 * time.Minute), Peak: 35},
+	}
+	if got := detector.Close(); !reflect.DeepEqual(got, expected) {
+		t.Errorf("expected %v, got %v", expected, got)
+	}
+
+	/* A breach that just started has no end yet */
+	line, err := sla.MarshalBreach(expectedStarted[0])
+	if err != nil {
+		t.Fatal(err)
+	}
+	expectedLine := `{"client":"airliberty","start":"2018-12-26 18:12:00","peak_average_delivery_time":31}`
+	if string(line) != expectedLine {
+		t.Errorf("expected %s, got %s", expectedLine, line)
+	}
+}
+
+func TestGenerateBreachReportOutput(t *testing.T) {
+	start := time.Date(2018, 12, 26, 18, 22, 0, 0, time.UTC)
+
+	testcases := []struct {
+		name     string
+		breaches []sla.Breach
+		expected string
+	}{
+		{
+			"valid case",
+			[]sla.Breach{
+				{Start: start, End: start.Add(3 * time.Minute), Peak: 42.5},
+				{Client: "taxi-eats", Start: start.Add(time.Minute), End: start.Add(11 * time.Minute), Peak: 54},
+			},
+			"{\"start\":\"2018-12-26 18:22:00\",\"end\":\"2018-12-26 18:25:00\",\"peak_average_delivery_time\":42.5,\"duration_minutes\":3}\n" +
+				"{\"client\":\"taxi-eats\",\"start\":\"2018-12-26 18:23:00\",\"end\":\"2018-12-26 18:33:00\",\"peak_average_delivery_time\":54,\"duration_minutes\":10}\n",
+		},
+		{
+			"no breaches",
+			[]sla.Breach{},
+			"",
+		},
+	}
+
+	for _, tc := range testcases {
+		t.Run(tc.name, func(t *testing.T) {
+			got, err := sla.GenerateBreachReportOutput(tc.breaches)
+			if err != nil {
+				t.Errorf("Unexpected error: %s", err.Error())
+			}
+
+			if got != tc.expected {
+				t.Errorf("expected %v, got %v", tc.expected, got)
+			}
+		})
+	}
+}
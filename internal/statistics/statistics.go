@@ -2,6 +2,8 @@ package statistics
 
 import (
 	"errors"
+	"sort"
+	"time"
 )
 
 /*
@@ -30,54 +32,354 @@ func (dp *DataPoint) CalculateAverage() float64 {
 }
 
 /*
-A function to calculate the Moving Average given an array of datapoints and a window size.
+A struct that holds the state of a moving window over datapoints.
 
-A datapoint is a struct that contains a value and the number of occurrences.
-The window size is the length of previous datapoints used to calculate the moving average.
+Size is the maximum number of datapoints in the window.
+Queue holds the last K datapoints pushed, where K is at most Size.
+Data holds the Total and Count of all datapoints in Queue.
+*/
+type MovingWindow struct {
+	Size  int         `json:"size"`
+	Queue []DataPoint `json:"queue"`
+	Data  DataPoint   `json:"data"`
+}
+
+/*
+A function to create an empty moving window.
 
-Returns an array of float values, each one being the moving average in the corresponding window, and an error.
+Returns the moving window and an error if the window size is lower than 1.
 */
-func CalculateMovingAverage(dataPoints []DataPoint, windowSize int) ([]float64, error) {
-	if len(dataPoints) == 0 {
-		return []float64{}, errors.New("Dataset was empty, please provide a valid dataset.")
-	}
+func NewMovingWindow(windowSize int) (*MovingWindow, error) {
 	if windowSize < 1 {
-		return []float64{}, errors.New("Window Size has to be equal or greater than 1, please provide a valid Window Size.")
+		return nil, errors.New("Window Size has to be equal or greater than 1, please provide a valid Window Size.")
 	}
 
-	movingAverage := make([]float64, 0)
+	return &MovingWindow{Size: windowSize, Queue: make([]DataPoint, 0, windowSize+1)}, nil
+}
 
-	/*	Struct with Total Duration and NrEvents in Window	*/
-	windowData := DataPoint{Total: 0, Count: 0}
+/*
+A function to push a datapoint into the moving window.
 
-	/*	Queue with last K elements from dataset. Where K is at most the windowSize.	*/
-	queue := make([]DataPoint, 0, windowSize+1)
+Returns the average of the window after the datapoint was pushed.
+*/
+func (w *MovingWindow) Push(dataPoint DataPoint) float64 {
+	w.Queue = append(w.Queue, dataPoint)
 
+	/*
+		Verify if the queue has reached its maximum capacity (windowSize).
+		If the queue is full, remove the first element from the queue.
+		If the queue isn't full, it implies that there's no data point to remove, so we initialize it with a value of 0.
+	*/
 	tail := DataPoint{}
+	if len(w.Queue) > w.Size {
+		tail, w.Queue = w.Queue[0], w.Queue[1:]
+	}
+
+	/*
+		Update the Total Duration and NrEvents in Window.
+		We remove the tail element that left the queue and add the datapoint that was just appended.
+	*/
+	w.Data.Total = w.Data.Total - tail.Total + dataPoint.Total
+	w.Data.Count = w.Data.Count - tail.Count + dataPoint.Count
+
+	return w.Data.CalculateAverage()
+}
+
+/*
+A function to check if the moving window holds no occurrences, in which case pushing empty datapoints doesn't change it.
+*/
+func (w *MovingWindow) Empty() bool {
+	return w.Data.Count == 0 && w.Data.Total == 0
+}
+
+/*
+A struct that holds a datapoint and its position in a dataset.
+
+Index is the number of time units between the start of the dataset and the datapoint.
+*/
+type Bucket struct {
+	Index     int
+	DataPoint DataPoint
+}
+
+/*
+A struct that holds a dataset without storing its empty datapoints.
+
+Length is the number of datapoints in the dataset, including the empty ones.
+Buckets holds the datapoints with occurrences, ordered by Index.
+Start is the start of the interval of the first datapoint, and Unit the length of the interval of each datapoint.
+Both are zero for datasets that aren't bound to time.
+*/
+type SparseDataset struct {
+	Length  int
+	Buckets []Bucket
+	Start   time.Time
+	Unit    time.Duration
+}
+
+/*
+A function to create a sparse dataset from a list of datapoints.
+
+Returns the sparse dataset, holding only the datapoints with occurrences.
+*/
+func NewSparseDataset(dataPoints []DataPoint) SparseDataset {
+	dataset := SparseDataset{Length: len(dataPoints), Buckets: make([]Bucket, 0)}
+	for i, dataPoint := range dataPoints {
+		if dataPoint != (DataPoint{}) {
+			dataset.Buckets = append(dataset.Buckets, Bucket{Index: i, DataPoint: dataPoint})
+		}
+	}
+	return dataset
+}
+
+/*
+A function to add a datapoint to the dataset at the given index.
+
+The datapoint is summed with the one already at that index, and the dataset grows if the index is past its end.
+Adding in increasing order of index is the fast path, other indexes are inserted in place.
+*/
+func (d *SparseDataset) Add(index int, dataPoint DataPoint) {
+	if index >= d.Length {
+		d.Length = index + 1
+	}
+
+	/* Find the position of the bucket, starting from the end since data usually arrives in order */
+	position := len(d.Buckets)
+	for position > 0 && d.Buckets[position-1].Index > index {
+		position--
+	}
+
+	if position > 0 && d.Buckets[position-1].Index == index {
+		d.Buckets[position-1].DataPoint.Total += dataPoint.Total
+		d.Buckets[position-1].DataPoint.Count += dataPoint.Count
+		return
+	}
+
+	d.Buckets = append(d.Buckets, Bucket{})
+	copy(d.Buckets[position+1:], d.Buckets[position:])
+	d.Buckets[position] = Bucket{Index: index, DataPoint: dataPoint}
+}
+
+/*
+A struct that holds a value and the interval of time it was calculated for.
+
+The interval goes from Start, inclusive, to End, exclusive.
+*/
+type Point struct {
+	Start time.Time
+	End   time.Time
+	Value float64
+}
+
+/*
+A function that returns the number of units the interval of a point spans, which is more than one for a run of equal values.
+*/
+func (p Point) Units(unit time.Duration) int {
+	return int(p.End.Sub(p.Start) / unit)
+}
+
+/*
+A function that returns the first unit of the interval of a point, with its value.
+*/
+func (p Point) First(unit time.Duration) Point {
+	return Point{Start: p.Start, End: p.Start.Add(unit), Value: p.Value}
+}
+
+/*
+A function that calls emit with every unit of the interval of a point, each with the value of the point, stopping at the first error.
+
+Receives the unit and the function called with each unit.
+Returns an error.
+*/
+func (p Point) Each(unit time.Duration, emit func(point Point) error) error {
+	for start := p.Start; start.Before(p.End); start = start.Add(unit) {
+		if err := emit(Point{Start: start, End: start.Add(unit), Value: p.Value}); err != nil {
+			return err
+		}
+	}
+	return nil
+}
 
-	for i := 0; i < len(dataPoints); i++ {
-		queue = append(queue, dataPoints[i])
-
-		/*
-			Verify if the queue has reached its maximum capacity (windowSize).
-			If the queue is full, remove the first element from the queue.
-			If the queue isn't full, it implies that there's no data point to remove, so we initialize it with a value of 0.
-		*/
-		if len(queue) > windowSize {
-			tail, queue = queue[0], queue[1:]
-		} else {
-			tail = DataPoint{}
+/*
+A struct that holds a value repeated over consecutive intervals of a time series.
+
+Index is the number of time units between the start of the time series and the first interval, and Length the number of intervals.
+*/
+type Run struct {
+	Index  int
+	Length int
+	Value  float64
+}
+
+/*
+A struct that holds values calculated for consecutive intervals of time, storing consecutive equal values once.
+
+Start is the start of the interval of the first value, and Unit the length of the interval of each value.
+Length is the number of values, and Runs holds every value, ordered by Index, with the same value repeated over consecutive intervals in a single run,
+so long stretches without events take as much memory as a single value.
+*/
+type TimeSeries struct {
+	Start  time.Time
+	Unit   time.Duration
+	Length int
+	Runs   []Run
+}
+
+/*
+A function to create a time series from a list of values.
+*/
+func NewTimeSeries(start time.Time, unit time.Duration, values []float64) TimeSeries {
+	ts := TimeSeries{Start: start, Unit: unit, Runs: make([]Run, 0)}
+	for _, value := range values {
+		ts.Append(value, 1)
+	}
+	return ts
+}
+
+/*
+A function to add a value repeated over the given number of intervals to the end of the time series.
+*/
+func (ts *TimeSeries) Append(value float64, length int) {
+	if last := len(ts.Runs) - 1; last >= 0 && ts.Runs[last].Value == value {
+		ts.Runs[last].Length += length
+	} else {
+		ts.Runs = append(ts.Runs, Run{Index: ts.Length, Length: length, Value: value})
+	}
+	ts.Length += length
+}
+
+/*
+A function that returns the value at the given index along with its interval.
+*/
+func (ts TimeSeries) At(index int) Point {
+	run := sort.Search(len(ts.Runs), func(i int) bool { return ts.Runs[i].Index+ts.Runs[i].Length > index })
+	start := ts.Start.Add(time.Duration(index) * ts.Unit)
+	return Point{Start: start, End: start.Add(ts.Unit), Value: ts.Runs[run].Value}
+}
+
+/*
+A function that calls emit with every value of the time series along with its interval, in order.
+*/
+func (ts TimeSeries) Each(emit func(point Point) error) error {
+	for _, run := range ts.Runs {
+		for index := run.Index; index < run.Index+run.Length; index++ {
+			start := ts.Start.Add(time.Duration(index) * ts.Unit)
+			if err := emit(Point{Start: start, End: start.Add(ts.Unit), Value: run.Value}); err != nil {
+				return err
+			}
 		}
+	}
+	return nil
+}
+
+/*
+A function that returns the end of the interval of the last value, or Start if the time series is empty.
+*/
+func (ts TimeSeries) End() time.Time {
+	return ts.Start.Add(time.Duration(ts.Length) * ts.Unit)
+}
 
-		/*
-			Update the Total Duration and NrEvents in Window.
-			We remove the tail element that left the queue and add the datapoint that was just appended.
-		*/
-		windowData.Total = windowData.Total - tail.Total + dataPoints[i].Total
-		windowData.Count = windowData.Count - tail.Count + dataPoints[i].Count
+/*
+A function to iterate over the Moving Window of a sparse dataset, given a window size, one run of equal windows at a time.
+
+Empty datapoints are produced lazily while iterating, and once the window only holds empty datapoints,
+the rest of an empty stretch is emitted as a single run of zeros, without touching the window or visiting each of its datapoints.
+Receives the dataset, the window size and the function called with each run of moving average values and the Total and Count of their window.
+Returns an error if the dataset or window size are invalid, or emit fails.
+*/
+func IterateMovingWindowRuns(dataset SparseDataset, windowSize int, emit func(run Run, data DataPoint) error) error {
+	if dataset.Length == 0 {
+		return errors.New("Dataset was empty, please provide a valid dataset.")
+	}
+
+	window, err := NewMovingWindow(windowSize)
+	if err != nil {
+		return err
+	}
+
+	next := 0
+	for index := 0; index < dataset.Length; {
+		if next < len(dataset.Buckets) && dataset.Buckets[next].Index == index {
+			if err := emit(Run{Index: index, Length: 1, Value: window.Push(dataset.Buckets[next].DataPoint)}, window.Data); err != nil {
+				return err
+			}
+			next++
+			index++
+			continue
+		}
+
+		if !window.Empty() {
+			if err := emit(Run{Index: index, Length: 1, Value: window.Push(DataPoint{})}, window.Data); err != nil {
+				return err
+			}
+			index++
+			continue
+		}
+
+		/* Skip to the next datapoint with occurrences, or the end of the dataset */
+		end := dataset.Length
+		if next < len(dataset.Buckets) {
+			end = dataset.Buckets[next].Index
+		}
+		if err := emit(Run{Index: index, Length: end - index, Value: 0}, DataPoint{}); err != nil {
+			return err
+		}
+		index = end
+	}
+
+	return nil
+}
+
+/*
+A function to iterate over the Moving Average of a sparse dataset, given a window size, one run of equal values at a time.
+
+Receives the dataset, the window size and the function called with each run of moving average values.
+Returns an error if the dataset or window size are invalid, or emit fails.
+*/
+func IterateMovingAverageRuns(dataset SparseDataset, windowSize int, emit func(run Run) error) error {
+	return IterateMovingWindowRuns(dataset, windowSize, func(run Run, data DataPoint) error {
+		return emit(run)
+	})
+}
+
+/*
+A function to iterate over the Moving Average of a sparse dataset, given a window size.
+
+Runs of equal values are expanded into one call per datapoint, so every value can be written, while nothing is buffered.
+Receives the dataset, the window size and the function called with the moving average of each datapoint and its interval.
+Returns an error if the dataset or window size are invalid, or emit fails.
+*/
+func IterateMovingAverage(dataset SparseDataset, windowSize int, emit func(point Point) error) error {
+	return IterateMovingAverageRuns(dataset, windowSize, func(run Run) error {
+		for index := run.Index; index < run.Index+run.Length; index++ {
+			start := dataset.Start.Add(time.Duration(index) * dataset.Unit)
+			if err := emit(Point{Start: start, End: start.Add(dataset.Unit), Value: run.Value}); err != nil {
+				return err
+			}
+		}
+		return nil
+	})
+}
+
+/*
+A function to calculate the Moving Average given a dataset and a window size.
+
+A dataset holds datapoints, structs that contain a value and the number of occurrences.
+The window size is the length of previous datapoints used to calculate the moving average.
+
+Returns a time series with the moving average of each window, over the same intervals as the dataset, and an error.
+The time series takes memory proportional to the datapoints with occurrences and the window size, not to the length of the dataset.
+*/
+func CalculateMovingAverage(dataset SparseDataset, windowSize int) (TimeSeries, error) {
+	movingAverage := TimeSeries{Start: dataset.Start, Unit: dataset.Unit, Runs: make([]Run, 0)}
 
-		/*	Calculate the average for the curent window and append to movingAverage	*/
-		movingAverage = append(movingAverage, windowData.CalculateAverage())
+	err := IterateMovingAverageRuns(dataset, windowSize, func(run Run) error {
+		/*	Append the average for the curent window to movingAverage	*/
+		movingAverage.Append(run.Value, run.Length)
+		return nil
+	})
+	if err != nil {
+		return TimeSeries{Runs: []Run{}}, err
 	}
 
 	return movingAverage, nil
@@ -4,6 +4,7 @@ import (
 	"errors"
 	"reflect"
 	"testing"
+	"time"
 
 	"github.com/jmbds/unbabel-backend-engineering-challenge/internal/statistics"
 )
@@ -93,14 +94,190 @@ func TestCalculateMovingAverage(t *testing.T) {
 
 	for _, tc := range testcases {
 		t.Run(tc.name, func(t *testing.T) {
-			got, err := statistics.CalculateMovingAverage(tc.dataset, tc.windowSize)
+			got, err := statistics.CalculateMovingAverage(statistics.NewSparseDataset(tc.dataset), tc.windowSize)
 			if err != nil && err.Error() != tc.expectedError.Error() {
 				t.Errorf("Unexpected error: %s", err.Error())
 			}
 
+			expected := statistics.NewTimeSeries(time.Time{}, 0, tc.expected)
+			if !reflect.DeepEqual(got, expected) {
+				t.Errorf("expected %v, got %v", expected, got)
+			}
+		})
+	}
+}
+
+func TestCalculateMovingAverageIntervals(t *testing.T) {
+	start := time.Date(2018, 12, 26, 18, 10, 0, 0, time.UTC)
+	dataset := statistics.SparseDataset{Length: 3, Buckets: []statistics.Bucket{
+		{Index: 1, DataPoint: statistics.DataPoint{Total: 20, Count: 1}},
+	}, Start: start, Unit: time.Hour}
+
+	got, err := statistics.CalculateMovingAverage(dataset, 10)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	expected := []statistics.Point{
+		{Start: start, End: start.Add(time.Hour), Value: 0},
+		{Start: start.Add(time.Hour), End: start.Add(2 * time.Hour), Value: 20},
+		{Start: start.Add(2 * time.Hour), End: start.Add(3 * time.Hour), Value: 20},
+	}
+	for i := range expected {
+		if point := got.At(i); point != expected[i] {
+			t.Errorf("expected %v, got %v", expected[i], point)
+		}
+	}
+
+	if got.End() != start.Add(3*time.Hour) {
+		t.Errorf("expected %v, got %v", start.Add(3*time.Hour), got.End())
+	}
+}
+
+func TestSparseDatasetAdd(t *testing.T) {
+	testcases := []struct {
+		name     string
+		indexes  []int
+		expected statistics.SparseDataset
+	}{
+		{
+			"in order",
+			[]int{1, 5, 13},
+			statistics.SparseDataset{Length: 14, Buckets: []statistics.Bucket{
+				{Index: 1, DataPoint: statistics.DataPoint{Total: 10, Count: 1}},
+				{Index: 5, DataPoint: statistics.DataPoint{Total: 10, Count: 1}},
+				{Index: 13, DataPoint: statistics.DataPoint{Total: 10, Count: 1}},
+			}},
+		},
+		{
+			"same index",
+			[]int{1, 1, 5},
+			statistics.SparseDataset{Length: 6, Buckets: []statistics.Bucket{
+				{Index: 1, DataPoint: statistics.DataPoint{Total: 20, Count: 2}},
+				{Index: 5, DataPoint: statistics.DataPoint{Total: 10, Count: 1}},
+			}},
+		},
+		{
+			"out of order",
+			[]int{13, 1, 5, 1},
+			statistics.SparseDataset{Length: 14, Buckets: []statistics.Bucket{
+				{Index: 1, DataPoint: statistics.DataPoint{Total: 20, Count: 2}},
+				{Index: 5, DataPoint: statistics.DataPoint{Total: 10, Count: 1}},
+				{Index: 13, DataPoint: statistics.DataPoint{Total: 10, Count: 1}},
+			}},
+		},
+	}
+
+	for _, tc := range testcases {
+		t.Run(tc.name, func(t *testing.T) {
+			got := statistics.SparseDataset{}
+			for _, index := range tc.indexes {
+				got.Add(index, statistics.DataPoint{Total: 10, Count: 1})
+			}
+
 			if !reflect.DeepEqual(got, tc.expected) {
 				t.Errorf("expected %v, got %v", tc.expected, got)
 			}
 		})
 	}
 }
+
+func TestIterateMovingAverage(t *testing.T) {
+	/* Two datapoints a year of seconds apart */
+	dataset := statistics.SparseDataset{Length: 31536001, Buckets: []statistics.Bucket{
+		{Index: 0, DataPoint: statistics.DataPoint{Total: 20, Count: 1}},
+		{Index: 31536000, DataPoint: statistics.DataPoint{Total: 40, Count: 1}},
+	}, Unit: time.Second}
+
+	count, nonZero := 0, map[int]float64{}
+	err := statistics.IterateMovingAverage(dataset, 3, func(point statistics.Point) error {
+		count++
+		if point.Value != 0 {
+			nonZero[int(point.Start.Sub(dataset.Start)/time.Second)] = point.Value
+		}
+		return nil
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if count != dataset.Length {
+		t.Errorf("expected %d values, got %d", dataset.Length, count)
+	}
+
+	expected := map[int]float64{0: 20, 1: 20, 2: 20, 31536000: 40}
+	if !reflect.DeepEqual(nonZero, expected) {
+		t.Errorf("expected %v, got %v", expected, nonZero)
+	}
+
+	emitError := errors.New("emit failed")
+	err = statistics.IterateMovingAverage(dataset, 3, func(point statistics.Point) error { return emitError })
+	if err != emitError {
+		t.Errorf("expected %v, got %v", emitError, err)
+	}
+}
+
+func TestCalculateMovingAverageRuns(t *testing.T) {
+	/* A year of minutes with events only at both ends */
+	length := 365 * 24 * 60
+	dataset := statistics.SparseDataset{Length: length, Buckets: []statistics.Bucket{
+		{Index: 0, DataPoint: statistics.DataPoint{Total: 20, Count: 1}},
+		{Index: length - 1, DataPoint: statistics.DataPoint{Total: 40, Count: 1}},
+	}, Start: time.Date(2018, 1, 1, 0, 0, 0, 0, time.UTC), Unit: time.Minute}
+
+	got, err := statistics.CalculateMovingAverage(dataset, 3)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	/* The window keeps the first event for three minutes, and the empty stretch after it is a single run */
+	expected := []statistics.Run{
+		{Index: 0, Length: 3, Value: 20},
+		{Index: 3, Length: length - 4, Value: 0},
+		{Index: length - 1, Length: 1, Value: 40},
+	}
+	if !reflect.DeepEqual(got.Runs, expected) || got.Length != length {
+		t.Errorf("expected %v over %d values, got %v over %d", expected, length, got.Runs, got.Length)
+	}
+	if point := got.At(length / 2); point.Value != 0 || !point.Start.Equal(dataset.Start.Add(time.Duration(length/2)*time.Minute)) {
+		t.Errorf("expected an empty value in the middle of the stretch, got %v", point)
+	}
+
+	/* Runs are emitted without visiting each value of the empty stretch, after the window drains the first event */
+	runs := 0
+	err = statistics.IterateMovingAverageRuns(dataset, 3, func(run statistics.Run) error {
+		runs++
+		return nil
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if runs != 6 {
+		t.Errorf("expected 6 runs, got %d", runs)
+	}
+}
+
+func TestIterateMovingWindowRuns(t *testing.T) {
+	dataset := statistics.SparseDataset{Length: 6, Buckets: []statistics.Bucket{
+		{Index: 0, DataPoint: statistics.DataPoint{Total: 20, Count: 1}},
+		{Index: 1, DataPoint: statistics.DataPoint{Total: 31, Count: 1}},
+		{Index: 5, DataPoint: statistics.DataPoint{Total: 54, Count: 1}},
+	}}
+
+	/* Each value comes with the Total and Count of its window, and the empty stretch with an empty window */
+	expected := []statistics.DataPoint{{Total: 20, Count: 1}, {Total: 51, Count: 2}, {Total: 31, Count: 1}, {}, {}, {Total: 54, Count: 1}}
+	got := []statistics.DataPoint{}
+	err := statistics.IterateMovingWindowRuns(dataset, 2, func(run statistics.Run, data statistics.DataPoint) error {
+		if run.Value != data.CalculateAverage() {
+			t.Errorf("expected %v at %d, got %v", data.CalculateAverage(), run.Index, run.Value)
+		}
+		got = append(got, data)
+		return nil
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !reflect.DeepEqual(got, expected) {
+		t.Errorf("expected %v, got %v", expected, got)
+	}
+}
@@ -0,0 +1,294 @@
+/*
+Package summary collects summary statistics of a whole input, like the events of each client and the worst moving average,
+while the moving average is calculated.
+*/
+package summary
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"math"
+	"sort"
+	"strings"
+	"time"
+
+	"github.com/jmbds/unbabel-backend-engineering-challenge/internal/events"
+	"github.com/jmbds/unbabel-backend-engineering-challenge/internal/statistics"
+)
+
+/*
+A type that selects how a report is written.
+*/
+type Format string
+
+const (
+	/* A single JSON line */
+	FormatJSON Format = "json"
+	/* A human readable table */
+	FormatTable Format = "table"
+)
+
+/*
+A function that parses the name of a report format.
+
+Returns the format and an error if the name is not json or table.
+*/
+func ParseFormat(name string) (Format, error) {
+	switch format := Format(strings.ToLower(name)); format {
+	case FormatJSON, FormatTable:
+		return format, nil
+	}
+	return "", errors.New("Unknown stats format " + name + ". Please provide json or table.")
+}
+
+/*
+A struct that holds the number of events of a client or language pair.
+*/
+type Count struct {
+	Name   string
+	Events int
+}
+
+/*
+A struct that holds the summary statistics of an input.
+
+Clients and LanguagePairs are ordered from the most events to the least, and language pairs are named source-target.
+Durations are over every event, with the median and the 95th percentile by nearest rank.
+BusiestMinute is the start of the minute with the most events, and WorstWindowDate the date of the largest moving average,
+at the end of its interval like in the output file. First and Last are the timestamps of the first and last events.
+*/
+type Report struct {
+	Events              int
+	Clients             []Count
+	LanguagePairs       []Count
+	MeanDuration        float64
+	MedianDuration      float64
+	P95Duration         float64
+	BusiestMinute       time.Time
+	BusiestMinuteEvents int
+	WorstWindowAverage  float64
+	WorstWindowDate     time.Time
+	First               time.Time
+	Last                time.Time
+}
+
+/*
+A function that returns the time covered by the events of a report, from the first to the last.
+*/
+func (r Report) Span() time.Duration {
+	return r.Last.Sub(r.First)
+}
+
+/*
+A struct that collects the summary statistics of an input, observing each value of its moving average as it is calculated.
+*/
+type Collector struct {
+	report    Report
+	durations []float64
+	observed  bool
+}
+
+/*
+A function that creates a Collector from the events of an input and their buckets.
+
+Receives the events, ordered by timestamp, and the events grouped by unit.
+Returns the Collector and an error if a timestamp is invalid.
+*/
+func NewCollector(transactionDeliveredEvents []events.EventTranslationDelivered, dataset statistics.SparseDataset) (*Collector, error) {
+	c := &Collector{report: Report{Events: len(transactionDeliveredEvents)}, durations: make([]float64, 0, len(transactionDeliveredEvents))}
+	if len(transactionDeliveredEvents) == 0 {
+		return c, nil
+	}
+
+	clients := map[string]int{}
+	languagePairs := map[string]int{}
+	total := 0.0
+	for _, event := range transactionDeliveredEvents {
+		clients[event.ClientName]++
+		languagePairs[event.SourceLanguage+"-"+event.TargetLanguage]++
+		total += float64(event.Duration)
+		c.durations = append(c.durations, float64(event.Duration))
+	}
+	c.report.Clients = sortCounts(clients)
+	c.report.LanguagePairs = sortCounts(languagePairs)
+	c.report.MeanDuration = total / float64(len(transactionDeliveredEvents))
+
+	var err error
+	if c.report.First, err = time.Parse(events.InputTimestampFormat, transactionDeliveredEvents[0].Timestamp); err != nil {
+		return nil, errors.New("Invalid date format. Please provide dates in the following format: " + events.InputTimestampFormat + "\n")
+	}
+	if c.report.Last, err = time.Parse(events.InputTimestampFormat, transactionDeliveredEvents[len(transactionDeliveredEvents)-1].Timestamp); err != nil {
+		return nil, errors.New("Invalid date format. Please provide dates in the following format: " + events.InputTimestampFormat + "\n")
+	}
+
+	/* The earliest of the buckets with the most events */
+	for _, bucket := range dataset.Buckets {
+		if bucket.DataPoint.Count > c.report.BusiestMinuteEvents {
+			c.report.BusiestMinuteEvents = bucket.DataPoint.Count
+			c.report.BusiestMinute = dataset.Start.Add(time.Duration(bucket.Index) * dataset.Unit)
+		}
+	}
+
+	return c, nil
+}
+
+/*
+A function that sorts counts from the most events to the least, and then by name.
+*/
+func sortCounts(counts map[string]int) []Count {
+	sorted := make([]Count, 0, len(counts))
+	for name, count := range counts {
+		sorted = append(sorted, Count{Name: name, Events: count})
+	}
+	sort.Slice(sorted, func(i, j int) bool {
+		if sorted[i].Events != sorted[j].Events {
+			return sorted[i].Events > sorted[j].Events
+		}
+		return sorted[i].Name < sorted[j].Name
+	})
+	return sorted
+}
+
+/*
+A function that observes a value of the moving average, keeping the earliest of the largest ones.
+*/
+func (c *Collector) Observe(point statistics.Point) {
+	if !c.observed || point.Value > c.report.WorstWindowAverage {
+		c.report.WorstWindowAverage = point.Value
+		c.report.WorstWindowDate = point.End
+		c.observed = true
+	}
+}
+
+/*
+A function that returns the report of the events and the moving average values observed so far.
+*/
+func (c *Collector) Report() Report {
+	report := c.report
+	if len(c.durations) > 0 {
+		sorted := append([]float64{}, c.durations...)
+		sort.Float64s(sorted)
+		report.MedianDuration = quantile(sorted, 0.5)
+		report.P95Duration = quantile(sorted, 0.95)
+	}
+	return report
+}
+
+/*
+A function that returns the quantile of sorted values by nearest rank, the smallest value with at least that fraction of the values at or below it.
+*/
+func quantile(sorted []float64, fraction float64) float64 {
+	rank := int(math.Ceil(fraction*float64(len(sorted)))) - 1
+	if rank < 0 {
+		rank = 0
+	}
+	return sorted[rank]
+}
+
+/*
+A function that rounds a value to one decimal place, like the moving average values.
+*/
+func round(value float64) float64 {
+	return math.Round(value*10) / 10
+}
+
+/*
+A function that formats a date in the output format, or an empty string if it is not set.
+*/
+func formatDate(date time.Time) string {
+	if date.IsZero() {
+		return ""
+	}
+	return date.Format(events.OutputTimestampFormat)
+}
+
+/*
+A function that serializes a report into its JSON representation.
+
+Receives the report.
+Returns the JSON line of the report, without a trailing newline, and an error.
+*/
+func MarshalReport(report Report) ([]byte, error) {
+	type reportRecord struct {
+		Events                int            `json:"events"`
+		EventsPerClient       map[string]int `json:"events_per_client"`
+		EventsPerLanguagePair map[string]int `json:"events_per_language_pair"`
+		MeanDuration          float64        `json:"mean_duration"`
+		MedianDuration        float64        `json:"median_duration"`
+		P95Duration           float64        `json:"p95_duration"`
+		BusiestMinute         string         `json:"busiest_minute,omitempty"`
+		BusiestMinuteEvents   int            `json:"busiest_minute_events"`
+		WorstWindowAverage    float64        `json:"worst_average_delivery_time"`
+		WorstWindowDate       string         `json:"worst_average_delivery_time_date,omitempty"`
+		FirstEvent            string         `json:"first_event,omitempty"`
+		LastEvent             string         `json:"last_event,omitempty"`
+		SpanSeconds           float64        `json:"span_seconds"`
+	}
+
+	record := reportRecord{
+		Events:                report.Events,
+		EventsPerClient:       map[string]int{},
+		EventsPerLanguagePair: map[string]int{},
+		MeanDuration:          round(report.MeanDuration),
+		MedianDuration:        report.MedianDuration,
+		P95Duration:           report.P95Duration,
+		BusiestMinute:         formatDate(report.BusiestMinute),
+		BusiestMinuteEvents:   report.BusiestMinuteEvents,
+		WorstWindowAverage:    round(report.WorstWindowAverage),
+		WorstWindowDate:       formatDate(report.WorstWindowDate),
+		FirstEvent:            formatDate(report.First),
+		LastEvent:             formatDate(report.Last),
+		SpanSeconds:           report.Span().Round(time.Second).Seconds(),
+	}
+	for _, client := range report.Clients {
+		record.EventsPerClient[client.Name] = client.Events
+	}
+	for _, languagePair := range report.LanguagePairs {
+		record.EventsPerLanguagePair[languagePair.Name] = languagePair.Events
+	}
+
+	return json.Marshal(record)
+}
+
+/*
+A function that generates the human readable report.
+
+Receives the report.
+Returns the report as a string, with the overall statistics followed by the events of each client and language pair.
+*/
+func GenerateReportOutput(report Report) string {
+	textToOutput := fmt.Sprintf("%-22s %d\n", "Events:", report.Events)
+	if report.Events > 0 {
+		textToOutput += fmt.Sprintf("%-22s %s to %s (%s)\n", "Span:", formatDate(report.First), formatDate(report.Last), report.Span().Round(time.Second))
+	}
+	textToOutput += fmt.Sprintf("%-22s %.1f\n", "Mean duration:", report.MeanDuration)
+	textToOutput += fmt.Sprintf("%-22s %g\n", "Median duration:", report.MedianDuration)
+	textToOutput += fmt.Sprintf("%-22s %g\n", "P95 duration:", report.P95Duration)
+	if report.BusiestMinuteEvents > 0 {
+		textToOutput += fmt.Sprintf("%-22s %s (%d events)\n", "Busiest minute:", formatDate(report.BusiestMinute), report.BusiestMinuteEvents)
+	}
+	if !report.WorstWindowDate.IsZero() {
+		textToOutput += fmt.Sprintf("%-22s %.1f at %s\n", "Worst moving average:", report.WorstWindowAverage, formatDate(report.WorstWindowDate))
+	}
+
+	textToOutput += generateCountsOutput("CLIENT", report.Clients)
+	textToOutput += generateCountsOutput("LANGUAGE PAIR", report.LanguagePairs)
+
+	return textToOutput
+}
+
+/*
+A function that generates a table of the events of each client or language pair, or an empty string if there are none.
+*/
+func generateCountsOutput(title string, counts []Count) string {
+	if len(counts) == 0 {
+		return ""
+	}
+
+	textToOutput := fmt.Sprintf("\n%-22s %8s\n", title, "EVENTS")
+	for _, count := range counts {
+		textToOutput += fmt.Sprintf("%-22s %8d\n", count.Name, count.Events)
+	}
+	return textToOutput
+}
@@ -0,0 +1,130 @@
+package summary_test
+
+import (
+	"context"
+	"errors"
+	"reflect"
+	"testing"
+	"time"
+
+	"github.com/jmbds/unbabel-backend-engineering-challenge/internal/events"
+	"github.com/jmbds/unbabel-backend-engineering-challenge/internal/statistics"
+	"github.com/jmbds/unbabel-backend-engineering-challenge/internal/summary"
+)
+
+var testEvents = []events.EventTranslationDelivered{
+	{Timestamp: "2018-12-26 18:11:08.509654", SourceLanguage: "en", TargetLanguage: "fr", ClientName: "airliberty", Duration: 20},
+	{Timestamp: "2018-12-26 18:12:19.903159", SourceLanguage: "en", TargetLanguage: "de", ClientName: "taxi-eats", Duration: 40},
+	{Timestamp: "2018-12-26 18:12:49.903159", SourceLanguage: "en", TargetLanguage: "fr", ClientName: "airliberty", Duration: 60},
+	{Timestamp: "2018-12-26 18:14:19.903159", SourceLanguage: "en", TargetLanguage: "fr", ClientName: "airliberty", Duration: 30},
+}
+
+/*
+A function that collects the report of events, observing every value of their moving average.
+*/
+func collect(t *testing.T, transactionDeliveredEvents []events.EventTranslationDelivered) summary.Report {
+	dataset, err := events.GroupEventsByUnit(context.Background(), transactionDeliveredEvents, time.Minute)
+	if err != nil {
+		t.Fatal(err)
+	}
+	collector, err := summary.NewCollector(transactionDeliveredEvents, dataset)
+	if err != nil {
+		t.Fatal(err)
+	}
+	err = statistics.IterateMovingAverage(dataset, 2, func(point statistics.Point) error {
+		collector.Observe(point)
+		return nil
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	return collector.Report()
+}
+
+func TestCollector(t *testing.T) {
+	expected := summary.Report{
+		Events:              4,
+		Clients:             []summary.Count{{Name: "airliberty", Events: 3}, {Name: "taxi-eats", Events: 1}},
+		LanguagePairs:       []summary.Count{{Name: "en-fr", Events: 3}, {Name: "en-de", Events: 1}},
+		MeanDuration:        37.5,
+		MedianDuration:      30,
+		P95Duration:         60,
+		BusiestMinute:       time.Date(2018, 12, 26, 18, 12, 0, 0, time.UTC),
+		BusiestMinuteEvents: 2,
+		WorstWindowAverage:  50,
+		WorstWindowDate:     time.Date(2018, 12, 26, 18, 14, 0, 0, time.UTC),
+		First:               time.Date(2018, 12, 26, 18, 11, 8, 509654000, time.UTC),
+		Last:                time.Date(2018, 12, 26, 18, 14, 19, 903159000, time.UTC),
+	}
+	if got := collect(t, testEvents); !reflect.DeepEqual(got, expected) {
+		t.Errorf("expected %v, got %v", expected, got)
+	}
+
+	collector, err := summary.NewCollector([]events.EventTranslationDelivered{}, statistics.SparseDataset{Buckets: make([]statistics.Bucket, 0)})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if got := collector.Report(); !reflect.DeepEqual(got, summary.Report{}) {
+		t.Errorf("expected an empty report, got %v", got)
+	}
+}
+
+func TestParseFormat(t *testing.T) {
+	testcases := []struct {
+		name          string
+		expected      summary.Format
+		expectedError error
+	}{
+		{"json", summary.FormatJSON, nil},
+		{"Table", summary.FormatTable, nil},
+		{"xml", "", errors.New("Unknown stats format xml. Please provide json or table.")},
+	}
+
+	for _, tc := range testcases {
+		t.Run(tc.name, func(t *testing.T) {
+			got, err := summary.ParseFormat(tc.name)
+			if tc.expectedError != nil {
+				if err == nil || err.Error() != tc.expectedError.Error() {
+					t.Errorf("expected %v, got %v", tc.expectedError, err)
+				}
+				return
+			}
+			if err != nil || got != tc.expected {
+				t.Errorf("expected %v, got %v and %v", tc.expected, got, err)
+			}
+		})
+	}
+}
+
+func TestReportOutput(t *testing.T) {
+	report := collect(t, testEvents)
+
+	expected := `{"events":4,"events_per_client":{"airliberty":3,"taxi-eats":1},"events_per_language_pair":{"en-de":1,"en-fr":3},"mean_duration":37.5,"median_duration":30,"p95_duration":60,"busiest_minute":"2018-12-26 18:12:00","busiest_minute_events":2,"worst_average_delivery_time":50,"worst_average_delivery_time_date":"2018-12-26 18:14:00","first_event":"2018-12-26 18:11:08","last_event":"2018-12-26 18:14:19","span_seconds":191}`
+	got, err := summary.MarshalReport(report)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if string(got) != expected {
+		t.Errorf("expected %s, got %s", expected, got)
+	}
+
+	expected = `Events:                4
+Span:                  2018-12-26 18:11:08 to 2018-12-26 18:14:19 (3m11s)
+Mean duration:         37.5
+Median duration:       30
+P95 duration:          60
+Busiest minute:        2018-12-26 18:12:00 (2 events)
+Worst moving average:  50.0 at 2018-12-26 18:14:00
+
+CLIENT                   EVENTS
+airliberty                    3
+taxi-eats                     1
+
+LANGUAGE PAIR            EVENTS
+en-fr                         3
+en-de                         1
+`
+	if got := summary.GenerateReportOutput(report); got != expected {
+		t.Errorf("expected %s, got %s", expected, got)
+	}
+}
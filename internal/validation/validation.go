@@ -0,0 +1,304 @@
+package validation
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"sort"
+	"strings"
+	"time"
+
+	"github.com/jmbds/unbabel-backend-engineering-challenge/internal/events"
+)
+
+/* Number of offending line numbers kept as samples for each rule */
+const MaxSamples = 5
+
+/*
+A rule every line of the events file is checked against.
+*/
+type Rule string
+
+const (
+	RuleInvalidJSON            Rule = "invalid_json"
+	RuleMissingField           Rule = "missing_field"
+	RuleInvalidTimestamp       Rule = "invalid_timestamp"
+	RuleNegativeValue          Rule = "negative_value"
+	RuleUnknownEventName       Rule = "unknown_event_name"
+	RuleInvalidLanguageCode    Rule = "invalid_language_code"
+	RuleUnorderedTimestamp     Rule = "unordered_timestamp"
+	RuleDuplicateTranslationId Rule = "duplicate_translation_id"
+)
+
+/*
+How serious a violation of a rule is.
+*/
+type Severity int
+
+const (
+	SeverityIgnore Severity = iota
+	SeverityWarning
+	SeverityError
+)
+
+/* Event names known to the application */
+var KnownEventNames = map[string]bool{
+	"translation_requested": true,
+	"translation_delivered": true,
+}
+
+/*
+A function that returns the default severity of each rule.
+
+Violations that break the moving average are errors, and the ones that only hint at bad data are warnings.
+*/
+func DefaultSeverities() map[Rule]Severity {
+	return map[Rule]Severity{
+		RuleInvalidJSON:            SeverityError,
+		RuleMissingField:           SeverityError,
+		RuleInvalidTimestamp:       SeverityError,
+		RuleNegativeValue:          SeverityError,
+		RuleUnorderedTimestamp:     SeverityError,
+		RuleUnknownEventName:       SeverityWarning,
+		RuleInvalidLanguageCode:    SeverityWarning,
+		RuleDuplicateTranslationId: SeverityWarning,
+	}
+}
+
+/*
+A function that parses a severity name.
+
+Returns the severity and an error if the name is not ignore, warning or error.
+*/
+func ParseSeverity(name string) (Severity, error) {
+	switch name {
+	case "ignore":
+		return SeverityIgnore, nil
+	case "warning":
+		return SeverityWarning, nil
+	case "error":
+		return SeverityError, nil
+	}
+	return SeverityIgnore, errors.New("Invalid severity " + name + ". Please provide one of ignore, warning or error.")
+}
+
+/*
+A function that returns the name of a severity.
+*/
+func (s Severity) String() string {
+	switch s {
+	case SeverityWarning:
+		return "warning"
+	case SeverityError:
+		return "error"
+	}
+	return "ignore"
+}
+
+/*
+A function that parses severity overrides, given as a comma separated list of rule=severity pairs.
+
+Receives the default severities and the overrides.
+Returns the severities with the overrides applied and an error.
+*/
+func ParseSeverities(defaults map[Rule]Severity, overrides string) (map[Rule]Severity, error) {
+	severities := make(map[Rule]Severity, len(defaults))
+	for rule, severity := range defaults {
+		severities[rule] = severity
+	}
+
+	if overrides == "" {
+		return severities, nil
+	}
+
+	for _, override := range strings.Split(overrides, ",") {
+		rule, name, found := strings.Cut(strings.TrimSpace(override), "=")
+		if _, known := defaults[Rule(rule)]; !found || !known {
+			return nil, errors.New("Invalid severity override " + override + ". Please provide overrides as rule=severity.")
+		}
+
+		severity, err := ParseSeverity(name)
+		if err != nil {
+			return nil, err
+		}
+		severities[Rule(rule)] = severity
+	}
+
+	return severities, nil
+}
+
+/*
+A struct that holds the result of validating an events file.
+
+Lines is the number of lines checked.
+Counts holds the number of lines violating each rule, and Samples the first line numbers violating it.
+*/
+type Report struct {
+	Lines   int
+	Counts  map[Rule]int
+	Samples map[Rule][]int
+}
+
+/*
+A function that adds a violation of a rule at the given line number to the report.
+*/
+func (r *Report) add(rule Rule, line int) {
+	r.Counts[rule]++
+	if len(r.Samples[rule]) < MaxSamples {
+		r.Samples[rule] = append(r.Samples[rule], line)
+	}
+}
+
+/*
+A function that counts the violations of rules with the given severity.
+*/
+func (r *Report) Violations(severities map[Rule]Severity, severity Severity) int {
+	violations := 0
+	for rule, count := range r.Counts {
+		if severities[rule] == severity {
+			violations += count
+		}
+	}
+	return violations
+}
+
+/*
+A struct with every field of an event as a pointer, to tell missing fields apart from zero values.
+*/
+type record struct {
+	Timestamp      *string `json:"timestamp"`
+	TranslationId  *string `json:"translation_id"`
+	SourceLanguage *string `json:"source_language"`
+	TargetLanguage *string `json:"target_language"`
+	ClientName     *string `json:"client_name"`
+	EventName      *string `json:"event_name"`
+	Duration       *int    `json:"duration"`
+	NrWords        *int    `json:"nr_words"`
+}
+
+/*
+A function that checks every line of an events file against the event schema.
+
+Receives the context, checked before each line, and a reader with the events, one per line.
+Returns the report with the violations found and an error if the input couldn't be read or the context was cancelled,
+in which case the report holds the lines checked so far.
+*/
+func Validate(ctx context.Context, reader io.Reader) (Report, error) {
+	report := Report{Counts: make(map[Rule]int), Samples: make(map[Rule][]int)}
+
+	var previousTimestamp time.Time
+	translationIds := make(map[string]bool)
+
+	/* Lines are read without a length limit, so an overlong line is reported like any other instead of stopping the report */
+	source := events.NewFileSource(reader)
+	for {
+		if err := ctx.Err(); err != nil {
+			return report, err
+		}
+
+		content, err := source.Next(ctx)
+		if err == io.EOF {
+			return report, nil
+		}
+		if err != nil {
+			return report, err
+		}
+
+		report.Lines++
+		line := report.Lines
+
+		event := record{}
+		if err := json.Unmarshal(content, &event); err != nil {
+			report.add(RuleInvalidJSON, line)
+			continue
+		}
+
+		/* Only delivered events carry a duration */
+		requested := event.EventName != nil && *event.EventName == "translation_requested"
+		if event.Timestamp == nil || event.TranslationId == nil || event.SourceLanguage == nil || event.TargetLanguage == nil ||
+			event.ClientName == nil || event.EventName == nil || (event.Duration == nil && !requested) || event.NrWords == nil {
+			report.add(RuleMissingField, line)
+		}
+
+		if event.Timestamp != nil {
+			timestamp, err := time.Parse(events.InputTimestampFormat, *event.Timestamp)
+			if err != nil {
+				report.add(RuleInvalidTimestamp, line)
+			} else {
+				if timestamp.Before(previousTimestamp) {
+					report.add(RuleUnorderedTimestamp, line)
+				} else {
+					previousTimestamp = timestamp
+				}
+			}
+		}
+
+		if (event.Duration != nil && *event.Duration < 0) || (event.NrWords != nil && *event.NrWords < 0) {
+			report.add(RuleNegativeValue, line)
+		}
+
+		if event.EventName != nil && !KnownEventNames[*event.EventName] {
+			report.add(RuleUnknownEventName, line)
+		}
+
+		if (event.SourceLanguage != nil && !IsLanguageCode(*event.SourceLanguage)) || (event.TargetLanguage != nil && !IsLanguageCode(*event.TargetLanguage)) {
+			report.add(RuleInvalidLanguageCode, line)
+		}
+
+		/* A translation is requested once and delivered once, so requests are tracked apart from deliveries */
+		if event.TranslationId != nil {
+			key := *event.TranslationId
+			if requested {
+				key = "translation_requested|" + key
+			}
+			if translationIds[key] {
+				report.add(RuleDuplicateTranslationId, line)
+			}
+			translationIds[key] = true
+		}
+	}
+}
+
+/*
+A function that generates the human readable validation report.
+
+Receives the report and the severity of each rule. Rules without violations or that are ignored are left out.
+Returns the report as a string.
+*/
+func GenerateReportOutput(report Report, severities map[Rule]Severity) string {
+	rules := make([]Rule, 0, len(report.Counts))
+	for rule := range report.Counts {
+		if severities[rule] != SeverityIgnore {
+			rules = append(rules, rule)
+		}
+	}
+
+	/* Errors first, then by name */
+	sort.Slice(rules, func(i, j int) bool {
+		if severities[rules[i]] != severities[rules[j]] {
+			return severities[rules[i]] > severities[rules[j]]
+		}
+		return rules[i] < rules[j]
+	})
+
+	textToOutput := fmt.Sprintf("Lines checked: %d\nErrors: %d\nWarnings: %d\n", report.Lines,
+		report.Violations(severities, SeverityError), report.Violations(severities, SeverityWarning))
+
+	if len(rules) == 0 {
+		return textToOutput
+	}
+
+	textToOutput += fmt.Sprintf("\n%-26s %-8s %8s  %s\n", "RULE", "SEVERITY", "LINES", "SAMPLE LINES")
+	for _, rule := range rules {
+		samples := make([]string, 0, len(report.Samples[rule]))
+		for _, sample := range report.Samples[rule] {
+			samples = append(samples, fmt.Sprint(sample))
+		}
+
+		textToOutput += fmt.Sprintf("%-26s %-8s %8d  %s\n", rule, severities[rule], report.Counts[rule], strings.Join(samples, ", "))
+	}
+
+	return textToOutput
+}
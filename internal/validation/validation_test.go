@@ -0,0 +1,227 @@
+package validation_test
+
+import (
+	"context"
+	"errors"
+	"os"
+	"reflect"
+	"strings"
+	"testing"
+
+	"github.com/jmbds/unbabel-backend-engineering-challenge/internal/validation"
+)
+
+func TestValidate(t *testing.T) {
+	testcases := []struct {
+		name     string
+		filepath string
+		expected validation.Report
+	}{
+		{
+			"valid case",
+			"testcases/events.json",
+			validation.Report{Lines: 3, Counts: map[validation.Rule]int{}, Samples: map[validation.Rule][]int{}},
+		},
+		{
+			"valid case - requested events",
+			"testcases/requested_events.json",
+			validation.Report{
+				Lines: 6,
+				Counts: map[validation.Rule]int{
+					validation.RuleMissingField:           1,
+					validation.RuleUnknownEventName:       1,
+					validation.RuleDuplicateTranslationId: 1,
+				},
+				Samples: map[validation.Rule][]int{
+					validation.RuleMissingField:           {4},
+					validation.RuleUnknownEventName:       {4},
+					validation.RuleDuplicateTranslationId: {5},
+				},
+			},
+		},
+		{
+			"invalid case",
+			"testcases/invalid_events.json",
+			validation.Report{
+				Lines: 3,
+				Counts: map[validation.Rule]int{
+					validation.RuleInvalidJSON:            1,
+					validation.RuleMissingField:           1,
+					validation.RuleNegativeValue:          1,
+					validation.RuleUnorderedTimestamp:     1,
+					validation.RuleDuplicateTranslationId: 1,
+					validation.RuleInvalidLanguageCode:    1,
+					validation.RuleUnknownEventName:       1,
+				},
+				Samples: map[validation.Rule][]int{
+					validation.RuleInvalidJSON:            {3},
+					validation.RuleMissingField:           {2},
+					validation.RuleNegativeValue:          {2},
+					validation.RuleUnorderedTimestamp:     {2},
+					validation.RuleDuplicateTranslationId: {2},
+					validation.RuleInvalidLanguageCode:    {1},
+					validation.RuleUnknownEventName:       {2},
+				},
+			},
+		},
+	}
+
+	for _, tc := range testcases {
+		t.Run(tc.name, func(t *testing.T) {
+			file, err := os.Open(tc.filepath)
+			if err != nil {
+				t.Fatal(err)
+			}
+			defer file.Close()
+
+			got, err := validation.Validate(context.Background(), file)
+			if err != nil {
+				t.Errorf("Unexpected error: %s", err.Error())
+			}
+
+			if !reflect.DeepEqual(got, tc.expected) {
+				t.Errorf("expected %v, got %v", tc.expected, got)
+			}
+		})
+	}
+}
+
+func TestValidateLongLine(t *testing.T) {
+	content, err := os.ReadFile("testcases/events.json")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	/* A line longer than a bufio.Scanner token is reported, and the lines after it are still checked */
+	long := "{\"padding\": \"" + strings.Repeat("a", 70*1024) + "\"\n"
+	got, err := validation.Validate(context.Background(), strings.NewReader(long+string(content)))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	expected := validation.Report{
+		Lines:   4,
+		Counts:  map[validation.Rule]int{validation.RuleInvalidJSON: 1},
+		Samples: map[validation.Rule][]int{validation.RuleInvalidJSON: {1}},
+	}
+	if !reflect.DeepEqual(got, expected) {
+		t.Errorf("expected %v, got %v", expected, got)
+	}
+}
+
+func TestValidateCancelled(t *testing.T) {
+	ctx, cancel := context.WithCancel(context.Background())
+	cancel()
+
+	got, err := validation.Validate(ctx, strings.NewReader("{}\n{}\n"))
+	if !errors.Is(err, context.Canceled) {
+		t.Errorf("expected %v, got %v", context.Canceled, err)
+	}
+	if got.Lines != 0 {
+		t.Errorf("expected %d lines, got %d", 0, got.Lines)
+	}
+}
+
+func TestParseSeverities(t *testing.T) {
+	testcases := []struct {
+		name          string
+		overrides     string
+		expected      map[validation.Rule]validation.Severity
+		expectedError error
+	}{
+		{
+			"valid case",
+			"duplicate_translation_id=error, negative_value=ignore",
+			map[validation.Rule]validation.Severity{
+				validation.RuleInvalidJSON:            validation.SeverityError,
+				validation.RuleMissingField:           validation.SeverityError,
+				validation.RuleInvalidTimestamp:       validation.SeverityError,
+				validation.RuleNegativeValue:          validation.SeverityIgnore,
+				validation.RuleUnorderedTimestamp:     validation.SeverityError,
+				validation.RuleUnknownEventName:       validation.SeverityWarning,
+				validation.RuleInvalidLanguageCode:    validation.SeverityWarning,
+				validation.RuleDuplicateTranslationId: validation.SeverityError,
+			},
+			errors.New(""),
+		},
+		{
+			"invalid case - unknown rule",
+			"unknown_rule=error",
+			nil,
+			errors.New("Invalid severity override unknown_rule=error. Please provide overrides as rule=severity."),
+		},
+		{
+			"invalid case - unknown severity",
+			"negative_value=fatal",
+			nil,
+			errors.New("Invalid severity fatal. Please provide one of ignore, warning or error."),
+		},
+	}
+
+	for _, tc := range testcases {
+		t.Run(tc.name, func(t *testing.T) {
+			got, err := validation.ParseSeverities(validation.DefaultSeverities(), tc.overrides)
+			if err != nil && err.Error() != tc.expectedError.Error() {
+				t.Errorf("Unexpected error: %s", err.Error())
+			}
+
+			if !reflect.DeepEqual(got, tc.expected) {
+				t.Errorf("expected %v, got %v", tc.expected, got)
+			}
+		})
+	}
+}
+
+func TestIsLanguageCode(t *testing.T) {
+	testcases := []struct {
+		value    string
+		expected bool
+	}{
+		{"en", true},
+		{"pt-BR", true},
+		{"pt_br", true},
+		{"xx", false},
+		{"EN", false},
+		{"eng", false},
+		{"en-USA", false},
+		{"", false},
+	}
+
+	for _, tc := range testcases {
+		t.Run(tc.value, func(t *testing.T) {
+			if got := validation.IsLanguageCode(tc.value); got != tc.expected {
+				t.Errorf("expected %v, got %v", tc.expected, got)
+			}
+		})
+	}
+}
+
+func TestGenerateReportOutput(t *testing.T) {
+	report := validation.Report{
+		Lines: 12,
+		Counts: map[validation.Rule]int{
+			validation.RuleDuplicateTranslationId: 7,
+			validation.RuleInvalidJSON:            1,
+			validation.RuleNegativeValue:          2,
+		},
+		Samples: map[validation.Rule][]int{
+			validation.RuleDuplicateTranslationId: {2, 3, 4, 5, 6},
+			validation.RuleInvalidJSON:            {12},
+			validation.RuleNegativeValue:          {1, 9},
+		},
+	}
+
+	severities, err := validation.ParseSeverities(validation.DefaultSeverities(), "negative_value=ignore")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	expected := "Lines checked: 12\nErrors: 1\nWarnings: 7\n\n" +
+		"RULE                       SEVERITY    LINES  SAMPLE LINES\n" +
+		"invalid_json               error           1  12\n" +
+		"duplicate_translation_id   warning         7  2, 3, 4, 5, 6\n"
+
+	if got := validation.GenerateReportOutput(report, severities); got != expected {
+		t.Errorf("expected %v, got %v", expected, got)
+	}
+}
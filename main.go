@@ -1,90 +1,429 @@
 package main
 
 import (
-	"bufio"
+	"context"
+	"errors"
 	"flag"
 	"fmt"
 	"os"
+	"os/signal"
+	"strings"
+	"syscall"
 	"time"
 
-	"github.com/jmbds/unbabel-backend-engineering-challenge/internal/events"
-	"github.com/jmbds/unbabel-backend-engineering-challenge/internal/statistics"
+	"github.com/jmbds/unbabel-backend-engineering-challenge/internal/anomaly"
+	"github.com/jmbds/unbabel-backend-engineering-challenge/internal/output"
+	"github.com/jmbds/unbabel-backend-engineering-challenge/internal/summary"
+	"github.com/jmbds/unbabel-backend-engineering-challenge/pkg/movingaverage"
+	"github.com/jmbds/unbabel-backend-engineering-challenge/pkg/sqlsink"
 )
 
+/* Exit code of a run interrupted by SIGINT, following the shell convention of 128 + the signal number */
+const exitInterrupted = 130
+
+/*
+An error set as the cause of the cancellation of a run, holding the signal that interrupted it.
+*/
+type signalError struct {
+	signal os.Signal
+}
+
+func (e *signalError) Error() string {
+	return "Received " + e.signal.String() + "."
+}
+
+/*
+A function that returns the exit code of a run interrupted by a signal, 128 + the signal number like shells do,
+so SIGINT exits with 130 and SIGTERM with 143.
+*/
+func exitCode(cause error) int {
+	received := &signalError{}
+	if errors.As(cause, &received) {
+		if number, ok := received.signal.(syscall.Signal); ok {
+			return 128 + int(number)
+		}
+	}
+	return exitInterrupted
+}
+
 /* The entrypoint of our CLI Application */
 func main() {
-	if err := run(); err != nil {
+	/* Cancel the run on SIGINT or SIGTERM so it stops gracefully, while a second signal terminates it right away */
+	ctx, cancel := context.WithCancelCause(context.Background())
+	signals := make(chan os.Signal, 1)
+	signal.Notify(signals, os.Interrupt, syscall.SIGTERM)
+	go func() {
+		received := <-signals
+		signal.Stop(signals)
+		cancel(&signalError{signal: received})
+	}()
+
+	err := run(ctx, os.Args[1:])
+	signal.Stop(signals)
+	if err != nil {
 		fmt.Fprintf(os.Stderr, "%s\n", err)
+		if errors.Is(err, context.Canceled) {
+			os.Exit(exitCode(context.Cause(ctx)))
+		}
 		os.Exit(1)
 	}
 }
 
+/*
+An error returned when a run is interrupted, with a summary of the work completed before the interruption.
+*/
+type interruptedError struct {
+	summary string
+}
+
+func (e *interruptedError) Error() string {
+	return "Interrupted. " + e.summary
+}
+
+func (e *interruptedError) Unwrap() error {
+	return context.Canceled
+}
+
+/*
+A function that replaces an error caused by cancellation with an interruptedError holding the summary, leaving other errors as they are.
+
+An interruptedError already summarizing the work completed is kept.
+*/
+func interrupted(err error, summary string) error {
+	var interruption *interruptedError
+	if errors.As(err, &interruption) {
+		return err
+	}
+	if errors.Is(err, context.Canceled) {
+		return &interruptedError{summary: summary}
+	}
+	return err
+}
+
 /* An abstraction of the main function to allow error returns */
-func run() error {
+func run(ctx context.Context, args []string) error {
+	/* Dispatch subcommands, defaulting to the moving average */
+	if len(args) > 0 {
+		switch args[0] {
+		case "validate":
+			return runValidate(ctx, args[1:])
+		case "serve":
+			return runServe(ctx, args[1:])
+		case "ingest":
+			return runIngest(ctx, args[1:])
+		case "query":
+			return runQuery(ctx, args[1:])
+		case "rollup":
+			return runRollup(ctx, args[1:])
+		case "partial":
+			return runPartial(ctx, args[1:])
+		case "merge":
+			return runMerge(ctx, args[1:])
+		case "forecast":
+			return runForecast(ctx, args[1:])
+		case "compare":
+			return runCompare(ctx, args[1:])
+		case "consume":
+			return runConsume(ctx, args[1:])
+		}
+	}
+
 	var (
-		inputFilepath  string
-		outputFilepath string
-		windowSize     int
+		inputFiles         = inputFilesFlag{values: []string{"events.json"}}
+		outputFilepath     string
+		windowSize         int
+		slaValue           string
+		slaOutputFilepath  string
+		notifications      hookFlags
+		checkpointFilepath string
+		checkpointInterval int
+		resume             bool
+		workers            int
+		dedupeKey          string
+		dedupeWindow       time.Duration
+		joinRequests       bool
+		joinHorizon        time.Duration
+		appendOutput       bool
+		noClobber          bool
+		anomalyMethod      string
+		anomalyWindow      int
+		anomalyThreshold   float64
+		anomalyFilepath    string
+		statsFormat        string
+		statsFilepath      string
+		sqlDialect         string
+		sqlDataSource      string
+		sqlTable           string
+		sqlGroupBy         string
 	)
 
-	flag.StringVar(&inputFilepath, "input_file", "events.json", "path to input file containing events")
-	flag.StringVar(&outputFilepath, "output_file", "aggregated_events.out.json", "path to aggregated output file")
-	flag.IntVar(&windowSize, "window_size", 10, "size of time window for moving average")
-	flag.Parse()
+	flags := flag.NewFlagSet("unbabel_cli", flag.ExitOnError)
+	flags.Var(&inputFiles, "input_file", "path or glob pattern of input files containing events, can be repeated")
+	flags.StringVar(&outputFilepath, "output_file", "aggregated_events.out.json", "path to aggregated output file")
+	flags.IntVar(&windowSize, "window_size", 10, "size of time window for moving average")
+	flags.StringVar(&slaValue, "sla", "", "SLA threshold, or path to file with global and per-client thresholds")
+	flags.StringVar(&slaOutputFilepath, "sla_output_file", "sla_breaches.out.json", "path to SLA breach report file")
+	notifications.register(flags)
+	flags.StringVar(&checkpointFilepath, "checkpoint_file", "", "path to checkpoint file, saved periodically to resume the aggregation")
+	flags.IntVar(&checkpointInterval, "checkpoint_interval", 10000, "number of events between checkpoints")
+	flags.BoolVar(&resume, "resume", false, "resume the aggregation from the checkpoint file, appending to the output file")
+	flags.IntVar(&workers, "workers", 1, "number of workers reading the input file")
+	flags.StringVar(&dedupeKey, "dedupe", "", "drop duplicate events with the same key, which can only be translation_id")
+	flags.DurationVar(&dedupeWindow, "dedupe_window", time.Hour, "how long keys are remembered for deduplication with checkpoints")
+	flags.BoolVar(&joinRequests, "join_requests", false, "derive delivery times from translation_requested and translation_delivered events")
+	flags.DurationVar(&joinHorizon, "join_horizon", 24*time.Hour, "how long a translation_requested event waits for its delivery when joining requests")
+	flags.BoolVar(&appendOutput, "append", false, "append to the output files instead of replacing them")
+	flags.BoolVar(&noClobber, "no_clobber", false, "fail instead of replacing existing output files")
+	flags.StringVar(&anomalyMethod, "anomaly", "", "annotate the output with anomaly scores by method zscore, mad or seasonal")
+	flags.IntVar(&anomalyWindow, "anomaly_window", 60, "number of previous values the zscore and mad anomaly methods compare with")
+	flags.Float64Var(&anomalyThreshold, "anomaly_threshold", 3, "absolute anomaly score from which a value is an anomaly")
+	flags.StringVar(&anomalyFilepath, "anomaly_output_file", "anomalies.out.json", "path to anomalies report file")
+	flags.StringVar(&statsFormat, "stats", "", "report summary statistics of the input as json or table")
+	flags.StringVar(&statsFilepath, "stats_output_file", "", "path to summary statistics file, printed by default")
+	flags.StringVar(&sqlDataSource, "sql_dsn", "", "data source of a SQL database to also write the moving average to")
+	flags.StringVar(&sqlDialect, "sql_driver", "sqlite", "SQL database of --sql_dsn, sqlite or postgres")
+	flags.StringVar(&sqlTable, "sql_table", "moving_averages", "SQL table the moving average is written to, created if it doesn't exist")
+	flags.StringVar(&sqlGroupBy, "sql_group_by", "", "also write the moving average of each group to the SQL table, which can only be client_name")
+	if err := flags.Parse(args); err != nil {
+		return err
+	}
 
-	/* Read and parse the input file */
-	transactionDeliveredEvents, err := events.ReadAndUnmarshallEventsFile(inputFilepath)
+	outputMode, err := output.ParseMode(appendOutput, noClobber)
 	if err != nil {
 		return err
 	}
 
-	/* Format the events to an array of TimeframeData for Moving Average calculation */
-	eventsGroupedByMinute, err := events.GroupEventsByUnit(transactionDeliveredEvents, time.Minute)
+	var detector *anomaly.Detector
+	if anomalyMethod != "" {
+		method, err := anomaly.ParseMethod(anomalyMethod)
+		if err != nil {
+			return err
+		}
+		if detector, err = anomaly.NewDetector(method, anomalyWindow, anomalyThreshold); err != nil {
+			return err
+		}
+	}
+
+	var format summary.Format
+	if statsFormat != "" {
+		if format, err = summary.ParseFormat(statsFormat); err != nil {
+			return err
+		}
+	}
+
+	dialect, err := sqlsink.ParseDialect(sqlDialect)
 	if err != nil {
 		return err
 	}
+	if err := validateSQLGroupBy(sqlGroupBy); err != nil {
+		return err
+	}
 
-	/* Calculate the Moving Average */
-	movingAverage, err := statistics.CalculateMovingAverage(eventsGroupedByMinute, windowSize)
+	/* Configure the aggregation, reading the client of each event only when the SLA or the summary statistics need it */
+	options := []movingaverage.Option{
+		movingaverage.WithWindowSize(windowSize),
+		movingaverage.WithDedupe(dedupeKey),
+		movingaverage.WithJoinRequests(joinRequests),
+		movingaverage.WithJoinHorizon(joinHorizon),
+	}
+	if checkpointFilepath == "" {
+		options = append(options, movingaverage.WithWorkers(workers))
+	}
+	if slaValue != "" || sqlGroupBy != "" {
+		options = append(options, movingaverage.WithFields(movingaverage.FieldClientName))
+	}
+	if format != "" {
+		options = append(options, movingaverage.WithFields(movingaverage.FieldClientName|movingaverage.FieldSourceLanguage|movingaverage.FieldTargetLanguage))
+	}
+
+	aggregator, err := movingaverage.New(options...)
 	if err != nil {
 		return err
 	}
 
-	/* Generate Moving Averate Output as string */
-	output, err := events.GenerateMinuteMovingAverageOutput(transactionDeliveredEvents, movingAverage)
+	inputFilepaths, err := movingaverage.ExpandInputFiles(inputFiles.values)
 	if err != nil {
 		return err
 	}
 
-	/* Output Moving Average to file */
-	return WriteStringToFile(outputFilepath, output)
+	/* Calculate the Moving Average while reading the input, saving checkpoints on the way */
+	if checkpointFilepath != "" {
+		if slaValue != "" {
+			return errors.New("SLA evaluation is not available with checkpoints. Please run without --checkpoint_file.")
+		}
+		if detector != nil {
+			return errors.New("Anomaly detection is not available with checkpoints. Please run without --checkpoint_file.")
+		}
+		if format != "" {
+			return errors.New("Summary statistics are not available with checkpoints. Please run without --checkpoint_file.")
+		}
+		if sqlDataSource != "" {
+			return errors.New("Writing to a SQL database is not available with checkpoints. Please run without --checkpoint_file.")
+		}
+		if workers > 1 {
+			return errors.New("Parallel reading is not available with checkpoints. Please run without --workers.")
+		}
+		if joinRequests {
+			return errors.New("Joining requests is not available with checkpoints. Please run without --join_requests.")
+		}
+		if len(inputFilepaths) > 1 {
+			return errors.New("Multiple input files are not available with checkpoints. Please provide a single --input_file.")
+		}
+		if outputMode == output.ModeAppend {
+			return errors.New("Appending is not available with checkpoints. Please run without --append.")
+		}
+		if outputMode == output.ModeNoClobber && !resume {
+			if _, err := os.Stat(outputFilepath); err == nil {
+				return errors.New("Output file " + outputFilepath + " already exists. Please remove it or run without --no_clobber.")
+			}
+		}
+
+		deduplicator := newDeduplicator(dedupeKey, dedupeWindow)
+		err := RunWithCheckpoints(ctx, inputFilepaths[0], outputFilepath, checkpointFilepath, windowSize, checkpointInterval, resume, deduplicator)
+		if err == nil && deduplicator != nil {
+			fmt.Printf("Dropped %d duplicate events.\n", deduplicator.Dropped)
+		}
+		return err
+	}
+	if resume {
+		return errors.New("Nothing to resume from. Please provide a --checkpoint_file.")
+	}
+
+	/* Read, parse and group the events by minute for Moving Average calculation */
+	batch, err := aggregator.Read(ctx, inputFilepaths...)
+	if err != nil {
+		return interrupted(err, "No events were aggregated, and the output file was left untouched.")
+	}
+	if joinRequests {
+		fmt.Printf("Dropped %d delivered events without a request.\n", batch.UnmatchedDeliveries)
+		fmt.Printf("Dropped %d requests without a delivery within %s.\n", batch.ExpiredRequests, joinHorizon)
+	}
+	if dedupeKey != "" {
+		fmt.Printf("Dropped %d duplicate events.\n", batch.DuplicatesDropped)
+	}
+
+	/* Collect the summary statistics and evaluate the SLA while the Moving Average is calculated */
+	var collector *summary.Collector
+	if format != "" {
+		if collector, err = summary.NewCollector(batch.Events, batch.Dataset); err != nil {
+			return err
+		}
+	}
+	var monitor *slaMonitor
+	if slaValue != "" {
+		notifier, err := notifications.notifier(outputFilepath, windowSize)
+		if err != nil {
+			return err
+		}
+		if monitor, err = newSLAMonitor(slaValue, notifier); err != nil {
+			return err
+		}
+	}
+	var observe func(point movingaverage.Point)
+	if collector != nil || monitor != nil {
+		observe = func(point movingaverage.Point) {
+			if collector != nil {
+				collector.Observe(point)
+			}
+			if monitor != nil {
+				monitor.Observe(ctx, point)
+			}
+		}
+	}
+
+	/* Calculate the Moving Average, writing each value to the output file as soon as it is calculated */
+	if detector != nil {
+		err = writeAnomalies(ctx, aggregator, detector, observe, outputFilepath, anomalyFilepath, outputMode, batch.Dataset)
+	} else {
+		err = writeMovingAverage(ctx, aggregator, observe, outputFilepath, outputMode, batch.Dataset)
+	}
+	if err != nil {
+		return interrupted(err, fmt.Sprintf("Aggregated %d events, but the output file was left untouched.", len(batch.Events)))
+	}
+
+	/* Upsert the Moving Average into the SQL table, once the output file is complete */
+	if sqlDataSource != "" {
+		rows, err := writeSQL(ctx, aggregator, dialect, sqlDataSource, sqlTable, sqlGroupBy, windowSize, batch)
+		if err != nil {
+			return interrupted(err, "The moving average was written to "+outputFilepath+", but the SQL table was left untouched.")
+		}
+		fmt.Printf("Wrote %d rows to the %s table.\n", rows, sqlTable)
+	}
+
+	if collector != nil {
+		if err := writeStats(collector.Report(), format, statsFilepath, outputMode); err != nil {
+			return err
+		}
+	}
+
+	/* Report the intervals in which the Moving Average breached the SLA */
+	if monitor != nil {
+		err := EvaluateSLA(ctx, monitor, aggregator, slaOutputFilepath, outputMode, batch.Events)
+		return interrupted(err, "The moving average was written to "+outputFilepath+", but the SLA breach report was not.")
+	}
+
+	return nil
 }
 
 /*
-A function that writes a string into a file.
+A function that calculates the moving average and writes it to the output file, one line at a time.
 
-Receives a path to a file and the string value to write to the file.
+The output file only replaces the previous one once every line was written.
+When the context is cancelled, the output file is replaced with the values written so far instead,
+each the moving average of a completed minute, and an interruptedError is returned.
+Receives the context, the aggregator, the function observing each value as it is written or nil,
+the path to the output file and how to write it, and the events grouped by minute.
 Returns an error.
 */
-func WriteStringToFile(filepath, output string) error {
-	file, err := os.OpenFile(filepath, os.O_CREATE|os.O_APPEND|os.O_WRONLY, 0644)
+func writeMovingAverage(ctx context.Context, aggregator *movingaverage.Aggregator, observe func(point movingaverage.Point), outputFilepath string, outputMode output.Mode, eventsGroupedByMinute movingaverage.Dataset) error {
+	file, err := output.Create(outputFilepath, outputMode)
 	if err != nil {
 		return err
 	}
-	defer file.Close()
 
-	err = file.Truncate(0)
-	if err != nil {
-		return err
+	written := 0
+	encoder := movingaverage.NewEncoder(file)
+	err = aggregator.Iterate(ctx, eventsGroupedByMinute, func(point movingaverage.Point) error {
+		if observe != nil {
+			observe(point)
+		}
+		if err := encoder.Encode(point); err != nil {
+			return err
+		}
+		written++
+		return nil
+	})
+	if errors.Is(err, context.Canceled) {
+		if err := file.Commit(); err != nil {
+			return err
+		}
+		return &interruptedError{summary: fmt.Sprintf("Wrote %d minutes to %s before stopping.", written, outputFilepath)}
 	}
-
-	_, err = file.Seek(0, 0)
 	if err != nil {
+		file.Abort()
 		return err
 	}
 
-	writer := bufio.NewWriter(file)
-	writer.WriteString(output)
+	return file.Commit()
+}
+
+/*
+A flag that collects every value it is given, replacing its default on the first one.
+*/
+type inputFilesFlag struct {
+	values []string
+	set    bool
+}
+
+func (f *inputFilesFlag) String() string {
+	return strings.Join(f.values, ",")
+}
 
-	return writer.Flush()
+func (f *inputFilesFlag) Set(value string) error {
+	if !f.set {
+		f.values = []string{}
+		f.set = true
+	}
+	f.values = append(f.values, value)
+	return nil
 }
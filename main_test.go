@@ -1,9 +1,829 @@
 package main
 
-import "testing"
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"strings"
+	"syscall"
+	"testing"
+	"time"
+
+	"github.com/jmbds/unbabel-backend-engineering-challenge/internal/anomaly"
+	"github.com/jmbds/unbabel-backend-engineering-challenge/internal/events"
+	"github.com/jmbds/unbabel-backend-engineering-challenge/internal/output"
+	"github.com/jmbds/unbabel-backend-engineering-challenge/pkg/kafka"
+	"github.com/jmbds/unbabel-backend-engineering-challenge/pkg/movingaverage"
+)
 
 func TestRun(t *testing.T) {
-	if err := run(); err != nil {
+	if err := run(context.Background(), []string{}); err != nil {
+		t.Fatal(err)
+	}
+}
+
+func TestRunValidate(t *testing.T) {
+	testcases := []struct {
+		name          string
+		args          []string
+		expectedError bool
+	}{
+		{"valid file", []string{"validate", "--input_file", "events.json"}, false},
+		{"invalid file", []string{"validate", "--input_file", "internal/validation/testcases/invalid_events.json"}, true},
+		{"ignored violations", []string{"validate", "--input_file", "internal/validation/testcases/invalid_events.json", "--severity", "invalid_json=ignore,missing_field=warning,negative_value=warning,unordered_timestamp=warning"}, false},
+		{"failing on warnings", []string{"validate", "--input_file", "events.json", "--fail_on", "warning"}, false},
+	}
+
+	for _, tc := range testcases {
+		t.Run(tc.name, func(t *testing.T) {
+			if err := run(context.Background(), tc.args); (err != nil) != tc.expectedError {
+				t.Errorf("Unexpected error: %v", err)
+			}
+		})
+	}
+}
+
+func TestRunDedupe(t *testing.T) {
+	directory := t.TempDir()
+	inputFilepath := filepath.Join(directory, "events.json")
+
+	content, err := os.ReadFile("events.json")
+	if err != nil {
+		t.Fatal(err)
+	}
+	lines := strings.SplitAfter(string(content), "\n")
+
+	/* Repeat the second event, which would otherwise change the averages */
+	duplicated := lines[0] + lines[1] + lines[1] + lines[2]
+	if err := os.WriteFile(inputFilepath, []byte(duplicated), 0644); err != nil {
+		t.Fatal(err)
+	}
+
+	expectedFilepath := filepath.Join(directory, "expected.json")
+	if err := run(context.Background(), []string{"--output_file", expectedFilepath}); err != nil {
+		t.Fatal(err)
+	}
+	expected, err := os.ReadFile(expectedFilepath)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	testcases := []struct {
+		name string
+		args []string
+	}{
+		{"batch", []string{}},
+		{"parallel", []string{"--workers", "2"}},
+		{"checkpoints", []string{"--checkpoint_file", filepath.Join(directory, "checkpoint.json")}},
+	}
+
+	for _, tc := range testcases {
+		t.Run(tc.name, func(t *testing.T) {
+			outputFilepath := filepath.Join(directory, tc.name+".json")
+			args := append([]string{"--input_file", inputFilepath, "--output_file", outputFilepath, "--dedupe", "translation_id"}, tc.args...)
+			if err := run(context.Background(), args); err != nil {
+				t.Fatal(err)
+			}
+
+			got, err := os.ReadFile(outputFilepath)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if string(got) != string(expected) {
+				t.Errorf("expected %v, got %v", string(expected), string(got))
+			}
+		})
+	}
+
+	if err := run(context.Background(), []string{"--input_file", inputFilepath, "--dedupe", "client_name"}); err == nil {
+		t.Errorf("expected an error for an unsupported deduplication key")
+	}
+}
+
+func TestRunJoinRequests(t *testing.T) {
+	outputFilepath := filepath.Join(t.TempDir(), "aggregated_events.out.json")
+
+	/* Only the first two translations have a request, delivered 20 and 31 seconds later */
+	expected := "{\"date\": \"2018-12-26 18:11:00\", \"average_delivery_time\": 0}\n" +
+		"{\"date\": \"2018-12-26 18:12:00\", \"average_delivery_time\": 20}\n" +
+		"{\"date\": \"2018-12-26 18:13:00\", \"average_delivery_time\": 20}\n" +
+		"{\"date\": \"2018-12-26 18:14:00\", \"average_delivery_time\": 20}\n" +
+		"{\"date\": \"2018-12-26 18:15:00\", \"average_delivery_time\": 20}\n" +
+		"{\"date\": \"2018-12-26 18:16:00\", \"average_delivery_time\": 25.5}\n"
+
+	if err := run(context.Background(), []string{"--input_file", "internal/events/testcases/requested_events.json", "--output_file", outputFilepath, "--join_requests"}); err != nil {
+		t.Fatal(err)
+	}
+
+	got, err := os.ReadFile(outputFilepath)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if string(got) != expected {
+		t.Errorf("expected %v, got %v", expected, string(got))
+	}
+}
+
+func TestRunMultipleInputFiles(t *testing.T) {
+	directory := t.TempDir()
+
+	expectedFilepath := filepath.Join(directory, "expected.json")
+	if err := run(context.Background(), []string{"--input_file", "internal/events/testcases/events.json", "--output_file", expectedFilepath}); err != nil {
+		t.Fatal(err)
+	}
+	expected, err := os.ReadFile(expectedFilepath)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	testcases := []struct {
+		name string
+		args []string
+	}{
+		{"glob pattern", []string{"--input_file", "internal/events/testcases/rotated/*.json"}},
+		{"repeated flag", []string{"--input_file", "internal/events/testcases/rotated/events-2.json", "--input_file", "internal/events/testcases/rotated/events-1.json"}},
+	}
+
+	for _, tc := range testcases {
+		t.Run(tc.name, func(t *testing.T) {
+			outputFilepath := filepath.Join(directory, strings.ReplaceAll(tc.name, " ", "_")+".json")
+			if err := run(context.Background(), append(tc.args, "--output_file", outputFilepath)); err != nil {
+				t.Fatal(err)
+			}
+
+			got, err := os.ReadFile(outputFilepath)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if string(got) != string(expected) {
+				t.Errorf("expected %v, got %v", string(expected), string(got))
+			}
+		})
+	}
+
+	if err := run(context.Background(), []string{"--input_file", "internal/events/testcases/rotated/*.json", "--checkpoint_file", filepath.Join(directory, "checkpoint.json")}); err == nil {
+		t.Error("expected an error combining multiple input files with checkpoints")
+	}
+}
+
+func TestRunOutputModes(t *testing.T) {
+	outputFilepath := filepath.Join(t.TempDir(), "aggregated_events.out.json")
+
+	if err := run(context.Background(), []string{"--output_file", outputFilepath, "--no_clobber"}); err != nil {
+		t.Fatal(err)
+	}
+	expected, err := os.ReadFile(outputFilepath)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if err := run(context.Background(), []string{"--output_file", outputFilepath, "--no_clobber"}); err == nil {
+		t.Error("expected an error replacing an existing output file with --no_clobber")
+	}
+
+	if err := run(context.Background(), []string{"--output_file", outputFilepath, "--append"}); err != nil {
+		t.Fatal(err)
+	}
+	got, err := os.ReadFile(outputFilepath)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if string(got) != string(expected)+string(expected) {
+		t.Errorf("expected %v, got %v", string(expected)+string(expected), string(got))
+	}
+}
+
+func TestRunInterrupted(t *testing.T) {
+	outputFilepath := filepath.Join(t.TempDir(), "aggregated_events.out.json")
+
+	ctx, cancel := context.WithCancel(context.Background())
+	cancel()
+
+	err := run(ctx, []string{"--output_file", outputFilepath})
+	if !errors.Is(err, context.Canceled) {
+		t.Fatalf("expected %v, got %v", context.Canceled, err)
+	}
+	if _, err := os.Stat(outputFilepath); !os.IsNotExist(err) {
+		t.Errorf("expected no output file, got %v", err)
+	}
+
+	if err := run(ctx, []string{"validate"}); !errors.Is(err, context.Canceled) {
+		t.Errorf("expected %v, got %v", context.Canceled, err)
+	}
+}
+
+func TestWriteMovingAverageInterrupted(t *testing.T) {
+	outputFilepath := filepath.Join(t.TempDir(), "aggregated_events.out.json")
+	if err := os.WriteFile(outputFilepath, []byte("old\n"), 0644); err != nil {
+		t.Fatal(err)
+	}
+
+	aggregator, err := movingaverage.New()
+	if err != nil {
+		t.Fatal(err)
+	}
+	batch, err := aggregator.Read(context.Background(), "events.json")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	/* The run is interrupted halfway, while the fifth minute is written */
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	observed := 0
+	observe := func(point movingaverage.Point) {
+		if observed++; observed == 5 {
+			cancel()
+		}
+	}
+
+	err = writeMovingAverage(ctx, aggregator, observe, outputFilepath, output.ModeTruncate, batch.Dataset)
+	expectedError := errors.New("Interrupted. Wrote 5 minutes to " + outputFilepath + " before stopping.")
+	if err == nil || err.Error() != expectedError.Error() || !errors.Is(err, context.Canceled) {
+		t.Fatalf("expected %v, got %v", expectedError, err)
+	}
+
+	/* The minutes completed before the interruption replace the previous output */
+	expected := "{\"date\": \"2018-12-26 18:11:00\", \"average_delivery_time\": 0}\n" +
+		"{\"date\": \"2018-12-26 18:12:00\", \"average_delivery_time\": 20}\n" +
+		"{\"date\": \"2018-12-26 18:13:00\", \"average_delivery_time\": 20}\n" +
+		"{\"date\": \"2018-12-26 18:14:00\", \"average_delivery_time\": 20}\n" +
+		"{\"date\": \"2018-12-26 18:15:00\", \"average_delivery_time\": 20}\n"
+	got, err := os.ReadFile(outputFilepath)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if string(got) != expected {
+		t.Errorf("expected %v, got %v", expected, string(got))
+	}
+}
+
+func TestExitCode(t *testing.T) {
+	testcases := []struct {
+		name     string
+		cause    error
+		expected int
+	}{
+		{"SIGINT", &signalError{signal: syscall.SIGINT}, 130},
+		{"SIGTERM", &signalError{signal: syscall.SIGTERM}, 143},
+		{"no signal", context.Canceled, 130},
+	}
+
+	for _, tc := range testcases {
+		t.Run(tc.name, func(t *testing.T) {
+			if got := exitCode(tc.cause); got != tc.expected {
+				t.Errorf("expected %d, got %d", tc.expected, got)
+			}
+		})
+	}
+}
+
+func TestRunServe(t *testing.T) {
+	directory := t.TempDir()
+	expectedFilepath := filepath.Join(directory, "expected.json")
+	outputFilepath := filepath.Join(directory, "aggregated_events.out.json")
+
+	if err := run(context.Background(), []string{"--output_file", expectedFilepath}); err != nil {
+		t.Fatal(err)
+	}
+	expected, err := os.ReadFile(expectedFilepath)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	/* The last minute is only complete once a later event is appended, so it isn't written */
+	lines := strings.SplitAfter(strings.TrimSuffix(string(expected), "\n"), "\n")
+	expectedOutput := strings.Join(lines[:len(lines)-1], "")
+
+	ctx, cancel := context.WithTimeout(context.Background(), 200*time.Millisecond)
+	defer cancel()
+
+	err = run(ctx, []string{"serve", "--output_file", outputFilepath, "--listen", "127.0.0.1:0", "--poll_interval", "10ms"})
+	if !errors.Is(err, context.DeadlineExceeded) {
+		t.Fatalf("expected %v, got %v", context.DeadlineExceeded, err)
+	}
+
+	got, err := os.ReadFile(outputFilepath)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if string(got) != expectedOutput {
+		t.Errorf("expected %v, got %v", expectedOutput, string(got))
+	}
+}
+
+func TestRunIngestAndQuery(t *testing.T) {
+	directory := t.TempDir()
+	storeDir := filepath.Join(directory, "store")
+	expectedFilepath := filepath.Join(directory, "expected.json")
+	outputFilepath := filepath.Join(directory, "aggregated_events.out.json")
+
+	if err := run(context.Background(), []string{"--output_file", expectedFilepath}); err != nil {
+		t.Fatal(err)
+	}
+	if err := run(context.Background(), []string{"ingest", "--store", storeDir}); err != nil {
+		t.Fatal(err)
+	}
+	if err := run(context.Background(), []string{"query", "--store", storeDir, "--output_file", outputFilepath}); err != nil {
+		t.Fatal(err)
+	}
+
+	expected, err := os.ReadFile(expectedFilepath)
+	if err != nil {
+		t.Fatal(err)
+	}
+	got, err := os.ReadFile(outputFilepath)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if string(got) != string(expected) {
+		t.Errorf("expected %v, got %v", string(expected), string(got))
+	}
+
+	if err := run(context.Background(), []string{"query", "--store", storeDir, "--from", "yesterday"}); err == nil {
+		t.Errorf("expected an invalid date error")
+	}
+}
+
+func TestRunPartialAndMerge(t *testing.T) {
+	testcases := []struct {
+		name          string
+		inputFilepath string
+	}{
+		{"delivered events", "events.json"},
+		{"mixed event types", "internal/events/testcases/requested_events.json"},
+	}
+
+	for _, tc := range testcases {
+		t.Run(tc.name, func(t *testing.T) {
+			directory := t.TempDir()
+			expectedFilepath := filepath.Join(directory, "expected.json")
+			outputFilepath := filepath.Join(directory, "aggregated_events.out.json")
+
+			if err := run(context.Background(), []string{"--input_file", tc.inputFilepath, "--output_file", expectedFilepath}); err != nil {
+				t.Fatal(err)
+			}
+
+			/* Shard the events across two machines, one writing a JSON state and the other a binary one */
+			content, err := os.ReadFile(tc.inputFilepath)
+			if err != nil {
+				t.Fatal(err)
+			}
+			lines := strings.SplitAfter(string(content), "\n")
+			shards := []string{strings.Join(lines[:len(lines)/2], ""), strings.Join(lines[len(lines)/2:], "")}
+			for i, format := range []string{"json", "binary"} {
+				shardFilepath := filepath.Join(directory, fmt.Sprintf("events.%d.json", i))
+				if err := os.WriteFile(shardFilepath, []byte(shards[i]), 0644); err != nil {
+					t.Fatal(err)
+				}
+				partialFilepath := filepath.Join(directory, fmt.Sprintf("events.%d.partial", i))
+				if err := run(context.Background(), []string{"partial", "--input_file", shardFilepath, "--output_file", partialFilepath, "--format", format}); err != nil {
+					t.Fatal(err)
+				}
+			}
+
+			if err := run(context.Background(), []string{"merge", "--input_file", filepath.Join(directory, "*.partial"), "--output_file", outputFilepath}); err != nil {
+				t.Fatal(err)
+			}
+
+			expected, err := os.ReadFile(expectedFilepath)
+			if err != nil {
+				t.Fatal(err)
+			}
+			got, err := os.ReadFile(outputFilepath)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if string(got) != string(expected) {
+				t.Errorf("expected %v, got %v", string(expected), string(got))
+			}
+		})
+	}
+}
+
+func TestRunAnomalies(t *testing.T) {
+	directory := t.TempDir()
+	expectedFilepath := filepath.Join(directory, "expected.json")
+	outputFilepath := filepath.Join(directory, "aggregated_events.out.json")
+	anomaliesFilepath := filepath.Join(directory, "anomalies.out.json")
+
+	if err := run(context.Background(), []string{"--output_file", expectedFilepath}); err != nil {
+		t.Fatal(err)
+	}
+	if err := run(context.Background(), []string{"--output_file", outputFilepath, "--anomaly", "zscore", "--anomaly_window", "5", "--anomaly_threshold", "1", "--anomaly_output_file", anomaliesFilepath}); err != nil {
+		t.Fatal(err)
+	}
+
+	expected, err := os.ReadFile(expectedFilepath)
+	if err != nil {
+		t.Fatal(err)
+	}
+	got, err := os.ReadFile(outputFilepath)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	/* Every record is annotated, keeping its date and average */
+	expectedLines := strings.Split(strings.TrimSpace(string(expected)), "\n")
+	gotLines := strings.Split(strings.TrimSpace(string(got)), "\n")
+	if len(gotLines) != len(expectedLines) {
+		t.Fatalf("expected %d records, got %d", len(expectedLines), len(gotLines))
+	}
+	for i := range gotLines {
+		if !strings.HasPrefix(gotLines[i], strings.TrimSuffix(expectedLines[i], "}")+", \"anomaly_score\": ") {
+			t.Errorf("expected %s to be annotated, got %s", expectedLines[i], gotLines[i])
+		}
+	}
+
+	/* The jump of the average at 18:24 stands out of the previous values */
+	report, err := os.ReadFile(anomaliesFilepath)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !strings.Contains(string(report), `"date":"2018-12-26 18:24:00"`) {
+		t.Errorf("expected an anomaly at 18:24, got %s", report)
+	}
+
+	expectedError := errors.New("Anomaly detection is not available with checkpoints. Please run without --checkpoint_file.")
+	err = run(context.Background(), []string{"--output_file", outputFilepath, "--anomaly", "mad", "--checkpoint_file", filepath.Join(directory, "checkpoint.json")})
+	if err == nil || err.Error() != expectedError.Error() {
+		t.Errorf("expected %v, got %v", expectedError, err)
+	}
+}
+
+func TestRunForecast(t *testing.T) {
+	directory := t.TempDir()
+	inputFilepath := filepath.Join(directory, "events.json")
+	outputFilepath := filepath.Join(directory, "forecast.out.json")
+
+	/* Two days of events, every half an hour, slower in the afternoon */
+	content := strings.Builder{}
+	start := time.Date(2018, 12, 24, 0, 0, 0, 0, time.UTC)
+	for timestamp := start; timestamp.Before(start.AddDate(0, 0, 2)); timestamp = timestamp.Add(30 * time.Minute) {
+		duration := 20
+		if timestamp.Hour() >= 12 {
+			duration = 40
+		}
+		fmt.Fprintf(&content, `{"timestamp": "%s","translation_id": "5aa5b2f39f7254a75aa5","source_language": "en","target_language": "fr","client_name": "airliberty","event_name": "translation_delivered","nr_words": 30, "duration": %d}`+"\n",
+			timestamp.Format(events.InputTimestampFormat), duration)
+	}
+	if err := os.WriteFile(inputFilepath, []byte(content.String()), 0644); err != nil {
+		t.Fatal(err)
+	}
+
+	if err := run(context.Background(), []string{"forecast", "--input_file", inputFilepath, "--output_file", outputFilepath, "--horizon", "3h"}); err != nil {
+		t.Fatal(err)
+	}
+	got, err := os.ReadFile(outputFilepath)
+	if err != nil {
+		t.Fatal(err)
+	}
+	lines := strings.Split(strings.TrimSpace(string(got)), "\n")
+	if len(lines) != 3 || !strings.HasPrefix(lines[0], `{"date": "2018-12-26 01:00:00", "average_delivery_time": `) {
+		t.Errorf("expected 3 predictions from 2018-12-26 01:00:00, got %s", got)
+	}
+
+	testcases := []struct {
+		name          string
+		args          []string
+		expectedError error
+	}{
+		{"too short", []string{"forecast", "--output_file", outputFilepath}, errors.New("Forecasting needs at least two seasons of events. Please provide a longer input.")},
+		{"unit not dividing a day", []string{"forecast", "--output_file", outputFilepath, "--unit", "7h"}, errors.New("Unit has to be a multiple of a minute dividing a day, please provide a valid unit.")},
+		{"horizon not a multiple of the unit", []string{"forecast", "--output_file", outputFilepath, "--horizon", "90m"}, errors.New("Horizon has to be a multiple of the unit, please provide a valid horizon.")},
+	}
+	for _, tc := range testcases {
+		t.Run(tc.name, func(t *testing.T) {
+			if err := run(context.Background(), tc.args); err == nil || err.Error() != tc.expectedError.Error() {
+				t.Errorf("expected %v, got %v", tc.expectedError, err)
+			}
+		})
+	}
+}
+
+func TestRunCompare(t *testing.T) {
+	directory := t.TempDir()
+	outputFilepath := filepath.Join(directory, "comparison.out.json")
+	summaryFilepath := filepath.Join(directory, "comparison_summary.out.json")
+
+	if err := run(context.Background(), []string{"compare", "--client_a", "airliberty", "--client_b", "taxi-eats", "--output_file", outputFilepath, "--summary_file", summaryFilepath}); err != nil {
+		t.Fatal(err)
+	}
+	got, err := os.ReadFile(outputFilepath)
+	if err != nil {
+		t.Fatal(err)
+	}
+	lines := strings.Split(strings.TrimSpace(string(got)), "\n")
+	if len(lines) != 14 || lines[0] != `{"date": "2018-12-26 18:11:00", "date_b": "2018-12-26 18:11:00", "average_delivery_time_a": 0, "average_delivery_time_b": 0}` {
+		t.Errorf("expected 14 aligned buckets from 2018-12-26 18:11:00, got %s", got)
+	}
+	summary, err := os.ReadFile(summaryFilepath)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !strings.HasPrefix(string(summary), `{"buckets":14,"compared_buckets":1,"events_a":2,"events_b":1,`) {
+		t.Errorf("expected the summary of 1 of 14 buckets compared of 2 and 1 events, got %s", summary)
+	}
+
+	testcases := []struct {
+		name          string
+		args          []string
+		expectedError error
+	}{
+		{"period of B without one of A", []string{"--from_b", "2018-12-26"}, errors.New("The period of B is aligned with the one of A. Please provide both --from_a and --from_b.")},
+		{"language pair of B without events", []string{"--source_language_a", "en", "--target_language_a", "fr", "--target_language_b", "de"}, errors.New("No events of B to compare. Please provide a selection of B with events.")},
+	}
+	for _, tc := range testcases {
+		t.Run(tc.name, func(t *testing.T) {
+			args := append([]string{"compare", "--output_file", outputFilepath, "--summary_file", summaryFilepath}, tc.args...)
+			if err := run(context.Background(), args); err == nil || err.Error() != tc.expectedError.Error() {
+				t.Errorf("expected %v, got %v", tc.expectedError, err)
+			}
+		})
+	}
+}
+
+func TestRunConsume(t *testing.T) {
+	directory := t.TempDir()
+	inputFilepath := filepath.Join(directory, "events.json")
+	expectedFilepath := filepath.Join(directory, "expected.json")
+	outputFilepath := filepath.Join(directory, "aggregated_events.out.json")
+
+	/* Events every 23 seconds for an hour, produced to two partitions in turns */
+	broker := kafka.NewFakeBroker()
+	broker.CreateTopic("events", 2)
+	start := time.Date(2018, 12, 26, 18, 0, 0, 0, time.UTC)
+	lines := []string{}
+	for i := 0; i < 160; i++ {
+		line := fmt.Sprintf("{\"timestamp\": \"%s\", \"event_name\": \"translation_delivered\", \"duration\": %d}", start.Add(time.Duration(i)*23*time.Second).Format(events.InputTimestampFormat), i%37)
+		lines = append(lines, line)
+		if _, err := broker.Produce("events", int32(i%2), nil, []byte(line)); err != nil {
+			t.Fatal(err)
+		}
+	}
+	if err := os.WriteFile(inputFilepath, []byte(strings.Join(lines, "\n")+"\n"), 0644); err != nil {
+		t.Fatal(err)
+	}
+	if err := run(context.Background(), []string{"--input_file", inputFilepath, "--output_file", expectedFilepath}); err != nil {
+		t.Fatal(err)
+	}
+	expected, err := os.ReadFile(expectedFilepath)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	defer func(original func(addresses []string) kafka.Broker) { newBroker = original }(newBroker)
+	newBroker = func(addresses []string) kafka.Broker { return broker }
+
+	/* Events are held back for a window, so the minutes written are the first ones of the aggregation of the file */
+	consume := func() string {
+		ctx, cancel := context.WithTimeout(context.Background(), 200*time.Millisecond)
+		defer cancel()
+		err := run(ctx, []string{"consume", "--output_file", outputFilepath, "--member", "a", "--poll_interval", "10ms"})
+		if !errors.Is(err, context.DeadlineExceeded) {
+			t.Fatalf("expected %v, got %v", context.DeadlineExceeded, err)
+		}
+		got, err := os.ReadFile(outputFilepath)
+		if err != nil {
+			t.Fatal(err)
+		}
+		return string(got)
+	}
+
+	got := consume()
+	if strings.Count(got, "\n") < 40 || !strings.HasPrefix(string(expected), got) {
+		t.Errorf("expected the first minutes of %v, got %v", string(expected), got)
+	}
+
+	/* Every minute written was committed, so consuming again resumes without writing any */
+	if again := consume(); again != got {
+		t.Errorf("expected %v, got %v", got, again)
+	}
+}
+
+func TestRunSQL(t *testing.T) {
+	directory := t.TempDir()
+	outputFilepath := filepath.Join(directory, "aggregated_events.out.json")
+	databaseFilepath := filepath.Join(directory, "averages.db")
+
+	testcases := []struct {
+		name          string
+		args          []string
+		expectedError error
+	}{
+		{"valid case", []string{"--sql_dsn", databaseFilepath}, nil},
+		{"valid case - written again", []string{"--sql_dsn", databaseFilepath, "--sql_driver", "sqlite3"}, nil},
+		{"valid case - grouped by client", []string{"--sql_dsn", databaseFilepath, "--sql_group_by", "client_name"}, nil},
+		{"invalid case - group key", []string{"--sql_dsn", databaseFilepath, "--sql_group_by", "source_language"}, errors.New("Invalid SQL group key source_language. Please provide client_name.")},
+		{"invalid case - driver", []string{"--sql_dsn", databaseFilepath, "--sql_driver", "mysql"}, errors.New("Unknown SQL dialect mysql. Please provide sqlite or postgres.")},
+		{"invalid case - table", []string{"--sql_dsn", databaseFilepath, "--sql_table", "averages;"}, errors.New("Invalid table name averages;. Please provide a name made only of letters, digits and underscores.")},
+		{"invalid case - checkpoints", []string{"--sql_dsn", databaseFilepath, "--checkpoint_file", filepath.Join(directory, "checkpoint.json")}, errors.New("Writing to a SQL database is not available with checkpoints. Please run without --checkpoint_file.")},
+	}
+
+	for _, tc := range testcases {
+		t.Run(tc.name, func(t *testing.T) {
+			err := run(context.Background(), append([]string{"--output_file", outputFilepath}, tc.args...))
+			if (err != nil) != (tc.expectedError != nil) || (err != nil && err.Error() != tc.expectedError.Error()) {
+				t.Fatalf("expected error %v, got %v", tc.expectedError, err)
+			}
+		})
+	}
+
+	/* Writing again upserts the same rows, so the table has one row per minute */
+	db, err := sql.Open("sqlite", databaseFilepath)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer db.Close()
+
+	var rows, events int
+	var total, average float64
+	if err := db.QueryRow("SELECT COUNT(*) FROM moving_averages WHERE group_key = ''").Scan(&rows); err != nil {
+		t.Fatal(err)
+	}
+	if rows != 14 {
+		t.Errorf("expected 14 rows, got %d", rows)
+	}
+	err = db.QueryRow("SELECT average_delivery_time, window_total_delivery_time, window_events FROM moving_averages WHERE group_key = '' AND window_size = 10 ORDER BY bucket_end DESC LIMIT 1").Scan(&average, &total, &events)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if average != 42.5 || total != 85 || events != 2 {
+		t.Errorf("expected 42.5 from 85 over 2 events, got %v from %v over %d", average, total, events)
+	}
+
+	/* Grouped by client, the moving average of each client's events is written under its name */
+	err = db.QueryRow("SELECT average_delivery_time, window_total_delivery_time, window_events FROM moving_averages WHERE group_key = 'taxi-eats' AND window_size = 10 ORDER BY bucket_end DESC LIMIT 1").Scan(&average, &total, &events)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if average != 54 || total != 54 || events != 1 {
+		t.Errorf("expected 54 from 54 over 1 event, got %v from %v over %d", average, total, events)
+	}
+}
+
+func TestRunStats(t *testing.T) {
+	directory := t.TempDir()
+	expectedFilepath := filepath.Join(directory, "expected.json")
+	outputFilepath := filepath.Join(directory, "aggregated_events.out.json")
+	statsFilepath := filepath.Join(directory, "stats.out.json")
+
+	if err := run(context.Background(), []string{"--output_file", expectedFilepath}); err != nil {
+		t.Fatal(err)
+	}
+	if err := run(context.Background(), []string{"--output_file", outputFilepath, "--stats", "json", "--stats_output_file", statsFilepath}); err != nil {
+		t.Fatal(err)
+	}
+
+	/* The moving average is the same with summary statistics */
+	expected, err := os.ReadFile(expectedFilepath)
+	if err != nil {
+		t.Fatal(err)
+	}
+	got, err := os.ReadFile(outputFilepath)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if string(got) != string(expected) {
+		t.Errorf("expected %s, got %s", expected, got)
+	}
+
+	stats, err := os.ReadFile(statsFilepath)
+	if err != nil {
+		t.Fatal(err)
+	}
+	expectedStats := `{"events":3,"events_per_client":{"airliberty":2,"taxi-eats":1},"events_per_language_pair":{"en-fr":3},"mean_duration":35,"median_duration":31,"p95_duration":54,"busiest_minute":"2018-12-26 18:11:00","busiest_minute_events":1,"worst_average_delivery_time":42.5,"worst_average_delivery_time_date":"2018-12-26 18:24:00","first_event":"2018-12-26 18:11:08","last_event":"2018-12-26 18:23:19","span_seconds":731}` + "\n"
+	if string(stats) != expectedStats {
+		t.Errorf("expected %s, got %s", expectedStats, stats)
+	}
+
+	testcases := []struct {
+		name          string
+		args          []string
+		expectedError error
+	}{
+		{"unknown format", []string{"--output_file", outputFilepath, "--stats", "xml"}, errors.New("Unknown stats format xml. Please provide json or table.")},
+		{"with checkpoints", []string{"--output_file", outputFilepath, "--stats", "table", "--checkpoint_file", filepath.Join(directory, "checkpoint.json")}, errors.New("Summary statistics are not available with checkpoints. Please run without --checkpoint_file.")},
+	}
+	for _, tc := range testcases {
+		t.Run(tc.name, func(t *testing.T) {
+			if err := run(context.Background(), tc.args); err == nil || err.Error() != tc.expectedError.Error() {
+				t.Errorf("expected %v, got %v", tc.expectedError, err)
+			}
+		})
+	}
+}
+
+func TestRunSLANotifications(t *testing.T) {
+	directory := t.TempDir()
+	outputFilepath := filepath.Join(directory, "aggregated_events.out.json")
+	breachesFilepath := filepath.Join(directory, "sla_breaches.out.json")
+
+	bodies := make(chan string, 10)
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		content, _ := io.ReadAll(r.Body)
+		bodies <- string(content)
+	}))
+	defer server.Close()
+
+	/* The breach is notified once, even when the same events are aggregated again */
+	statePath := filepath.Join(directory, "sla_notifications.json")
+	args := []string{"--output_file", outputFilepath, "--sla", "30", "--sla_output_file", breachesFilepath, "--sla_webhook", server.URL, "--hook_state_file", statePath}
+	for i := 0; i < 2; i++ {
+		if err := run(context.Background(), args); err != nil {
+			t.Fatal(err)
+		}
+	}
+	expected := `{"start":"2018-12-26 18:22:00","peak_average_delivery_time":31}`
+	if len(bodies) != 1 {
+		t.Fatalf("expected a single notification, got %d", len(bodies))
+	}
+	if got := <-bodies; got != expected {
+		t.Errorf("expected %s, got %s", expected, got)
+	}
+
+	/* Without a state file, the breaches notified are remembered next to the output file */
+	defaultOutputFilepath := filepath.Join(directory, "default.out.json")
+	if err := run(context.Background(), []string{"--output_file", defaultOutputFilepath, "--sla", "30", "--sla_output_file", breachesFilepath, "--sla_webhook", server.URL}); err != nil {
 		t.Fatal(err)
 	}
+	if _, err := os.Stat(defaultOutputFilepath + ".sla_notifications.json"); err != nil {
+		t.Errorf("expected the state next to the output file, got %v", err)
+	}
+	<-bodies
+
+	/* While serving, the breach is notified as soon as the minute starting it is complete */
+	ctx, cancel := context.WithTimeout(context.Background(), 200*time.Millisecond)
+	defer cancel()
+	err := run(ctx, []string{"serve", "--output_file", outputFilepath, "--listen", "127.0.0.1:0", "--poll_interval", "10ms", "--sla", "30", "--sla_webhook", server.URL, "--hook_state_file", filepath.Join(directory, "serve_notifications.json")})
+	if !errors.Is(err, context.DeadlineExceeded) {
+		t.Fatalf("expected %v, got %v", context.DeadlineExceeded, err)
+	}
+	if len(bodies) != 1 {
+		t.Fatalf("expected a single notification while serving, got %d", len(bodies))
+	}
+	if got := <-bodies; got != expected {
+		t.Errorf("expected %s, got %s", expected, got)
+	}
+
+	expectedError := errors.New("SLA breaches are only notified while serving. Please provide --sla_webhook or --sla_command.")
+	if err := run(context.Background(), []string{"serve", "--output_file", outputFilepath, "--sla", "30"}); err == nil || err.Error() != expectedError.Error() {
+		t.Errorf("expected %v, got %v", expectedError, err)
+	}
+}
+
+func TestWriteAnomaliesInterrupted(t *testing.T) {
+	directory := t.TempDir()
+	outputFilepath := filepath.Join(directory, "aggregated_events.out.json")
+	anomalyFilepath := filepath.Join(directory, "anomalies.out.json")
+	if err := os.WriteFile(outputFilepath, []byte("old\n"), 0644); err != nil {
+		t.Fatal(err)
+	}
+
+	aggregator, err := movingaverage.New()
+	if err != nil {
+		t.Fatal(err)
+	}
+	batch, err := aggregator.Read(context.Background(), "events.json")
+	if err != nil {
+		t.Fatal(err)
+	}
+	detector, err := anomaly.NewDetector(anomaly.MethodZScore, 60, 3)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	/* The run is interrupted halfway, while the fifth minute is written */
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	observed := 0
+	observe := func(point movingaverage.Point) {
+		if observed++; observed == 5 {
+			cancel()
+		}
+	}
+
+	err = writeAnomalies(ctx, aggregator, detector, observe, outputFilepath, anomalyFilepath, output.ModeTruncate, batch.Dataset)
+	expectedError := errors.New("Interrupted. Wrote 5 minutes to " + outputFilepath + " and 0 anomalies to " + anomalyFilepath + " before stopping.")
+	if err == nil || err.Error() != expectedError.Error() || !errors.Is(err, context.Canceled) {
+		t.Fatalf("expected %v, got %v", expectedError, err)
+	}
+
+	/* The minutes completed before the interruption replace the previous output, along with the report */
+	got, err := os.ReadFile(outputFilepath)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if lines := strings.Count(string(got), "\n"); lines != 5 {
+		t.Errorf("expected 5 minutes, got %s", got)
+	}
+	if _, err := os.Stat(anomalyFilepath); err != nil {
+		t.Errorf("expected the anomalies report to be written, got %v", err)
+	}
 }
@@ -0,0 +1,179 @@
+package main
+
+import (
+	"context"
+	"flag"
+	"fmt"
+	"os"
+	"time"
+
+	"github.com/jmbds/unbabel-backend-engineering-challenge/internal/events"
+	"github.com/jmbds/unbabel-backend-engineering-challenge/internal/output"
+	"github.com/jmbds/unbabel-backend-engineering-challenge/internal/partial"
+	"github.com/jmbds/unbabel-backend-engineering-challenge/internal/statistics"
+)
+
+/*
+A function that runs the partial subcommand, writing the partial state of the events of the input files, to be merged with the states of other machines.
+
+Receives the context and the subcommand arguments.
+Returns an error.
+*/
+func runPartial(ctx context.Context, args []string) error {
+	var (
+		inputFiles     = inputFilesFlag{values: []string{"events.json"}}
+		outputFilepath string
+		formatName     string
+	)
+
+	flags := flag.NewFlagSet("unbabel_cli partial", flag.ExitOnError)
+	flags.Var(&inputFiles, "input_file", "path or glob pattern of input files containing events, can be repeated")
+	flags.StringVar(&outputFilepath, "output_file", "partial.out.json", "path to partial state file")
+	flags.StringVar(&formatName, "format", "json", "format of the partial state, json or binary")
+	if err := flags.Parse(args); err != nil {
+		return err
+	}
+
+	format, err := partial.ParseFormat(formatName)
+	if err != nil {
+		return err
+	}
+
+	inputFilepaths, err := events.ExpandInputFiles(inputFiles.values)
+	if err != nil {
+		return err
+	}
+
+	/* Partial states are per minute, like the moving average */
+	state, err := partial.NewState(time.Minute)
+	if err != nil {
+		return err
+	}
+
+	count := 0
+	for _, inputFilepath := range inputFilepaths {
+		file, err := os.Open(inputFilepath)
+		if err != nil {
+			return err
+		}
+		read, err := partial.ReadEvents(ctx, state, file)
+		file.Close()
+		if err != nil {
+			return interrupted(err, "The partial state was not written.")
+		}
+		count += read
+	}
+
+	if err := writePartialState(outputFilepath, state, format); err != nil {
+		return err
+	}
+	fmt.Printf("Wrote the partial state of %d events to %s.\n", count, outputFilepath)
+
+	return nil
+}
+
+/*
+A function that runs the merge subcommand, merging the partial states of many machines and writing the moving average of all their events.
+
+Receives the context and the subcommand arguments.
+Returns an error.
+*/
+func runMerge(ctx context.Context, args []string) error {
+	var (
+		inputFiles            = inputFilesFlag{values: []string{"partial.out.json"}}
+		outputFilepath        string
+		windowSize            int
+		partialOutputFilepath string
+		formatName            string
+	)
+
+	flags := flag.NewFlagSet("unbabel_cli merge", flag.ExitOnError)
+	flags.Var(&inputFiles, "input_file", "path or glob pattern of partial state files, can be repeated")
+	flags.StringVar(&outputFilepath, "output_file", "aggregated_events.out.json", "path to aggregated output file")
+	flags.IntVar(&windowSize, "window_size", 10, "size of time window for moving average")
+	flags.StringVar(&partialOutputFilepath, "partial_output_file", "", "path to write the merged partial state to, to merge it again later")
+	flags.StringVar(&formatName, "format", "json", "format of the merged partial state, json or binary")
+	if err := flags.Parse(args); err != nil {
+		return err
+	}
+
+	format, err := partial.ParseFormat(formatName)
+	if err != nil {
+		return err
+	}
+	if _, err := statistics.NewMovingWindow(windowSize); err != nil {
+		return err
+	}
+
+	inputFilepaths, err := events.ExpandInputFiles(inputFiles.values)
+	if err != nil {
+		return err
+	}
+
+	var merged *partial.State
+	for _, inputFilepath := range inputFilepaths {
+		if err := ctx.Err(); err != nil {
+			return interrupted(err, "The output file was left untouched.")
+		}
+
+		file, err := os.Open(inputFilepath)
+		if err != nil {
+			return err
+		}
+		state, err := partial.Read(file)
+		file.Close()
+		if err != nil {
+			return err
+		}
+
+		if merged == nil {
+			merged = state
+		} else if err := merged.Merge(state); err != nil {
+			return err
+		}
+	}
+
+	dataset, err := merged.Dataset()
+	if err != nil {
+		return err
+	}
+
+	file, err := output.Create(outputFilepath, output.ModeTruncate)
+	if err != nil {
+		return err
+	}
+	if err := statistics.IterateMovingAverage(dataset, windowSize, events.NewRecordWriter(file).WritePoint); err != nil {
+		file.Abort()
+		return err
+	}
+	if err := file.Commit(); err != nil {
+		return err
+	}
+
+	if partialOutputFilepath != "" {
+		if err := writePartialState(partialOutputFilepath, merged, format); err != nil {
+			return err
+		}
+	}
+
+	sketch := merged.Sketch()
+	fmt.Printf("Merged %d partial states of %d events. Delivery time p50 %.1f, p95 %.1f and p99 %.1f.\n",
+		len(inputFilepaths), sketch.Count(), sketch.Quantile(0.5), sketch.Quantile(0.95), sketch.Quantile(0.99))
+
+	return nil
+}
+
+/*
+A function that writes a partial state to a file atomically.
+*/
+func writePartialState(path string, state *partial.State, format partial.Format) error {
+	file, err := output.Create(path, output.ModeTruncate)
+	if err != nil {
+		return err
+	}
+	if err := partial.Write(file, state, format); err != nil {
+		file.Abort()
+		return err
+	}
+	return file.Commit()
+}
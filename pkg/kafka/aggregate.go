@@ -0,0 +1,193 @@
+package kafka
+
+import (
+	"context"
+	"encoding/base64"
+	"encoding/binary"
+	"errors"
+	"math"
+	"strconv"
+	"time"
+
+	"github.com/jmbds/unbabel-backend-engineering-challenge/internal/events"
+	"github.com/jmbds/unbabel-backend-engineering-challenge/internal/statistics"
+	"github.com/jmbds/unbabel-backend-engineering-challenge/pkg/movingaverage"
+)
+
+const (
+	/* The largest metadata brokers accept with committed offsets by default */
+	MaxMetadataSize = 4096
+
+	/* The committed state holds a version, the last bucket, the window size and total, the queue length and the queue */
+	stateVersion    = 1
+	stateHeaderSize = 1 + 8 + 4 + 16 + 4
+	dataPointSize   = 16
+
+	/* The largest window whose state fits the metadata, once encoded as base64 */
+	MaxWindowSize = (MaxMetadataSize/4*3 - stateHeaderSize) / dataPointSize
+)
+
+/*
+A function that calculates the moving average of the events consumed from a topic, until the context is cancelled.
+
+The consumer joins its group, and the state of the moving window is restored from the metadata committed with its offsets.
+Records are reordered within the window, unless the consumer was given a Lateness of its own.
+Every time buckets are flushed, the offsets of the events aggregated before the bucket still being filled are committed,
+along with the state of the moving window, so the aggregation resumes from there after a restart or a rebalance.
+Buckets emitted after the last commit are emitted again when resuming, so they are delivered at least once.
+Receives the context, the consumer, the window size, the function called with each moving average value
+and the function called to make the values emitted so far durable, before the offsets are committed.
+Returns an error, which is the error of the context once cancelled.
+*/
+func Aggregate(ctx context.Context, consumer *Consumer, windowSize int, emit func(point movingaverage.Point) error, flush func() error) error {
+	if windowSize > MaxWindowSize {
+		return errors.New("Window Size has to be at most " + strconv.Itoa(MaxWindowSize) + " to fit the committed metadata, please provide a smaller Window Size.")
+	}
+	if consumer.Lateness == 0 {
+		consumer.Lateness = time.Duration(windowSize) * time.Minute
+	}
+
+	for {
+		if err := consumer.Join(); err != nil {
+			return err
+		}
+
+		err := aggregate(ctx, consumer, windowSize, emit, flush)
+		if !errors.Is(err, ErrRebalanceInProgress) {
+			return err
+		}
+	}
+}
+
+/*
+A function that aggregates the events consumed, from the committed offsets, until the group rebalances or an error occurs.
+*/
+func aggregate(ctx context.Context, consumer *Consumer, windowSize int, emit func(point movingaverage.Point) error, flush func() error) error {
+	aggregator, err := events.NewStreamAggregator(windowSize, time.Minute, nil)
+	if err != nil {
+		return err
+	}
+
+	/* Restore the aggregation from the committed metadata */
+	if metadata := consumer.Metadata(); metadata != "" {
+		window, lastBucket, err := decodeState(metadata)
+		if err != nil {
+			return err
+		}
+		if window.Size != windowSize {
+			return errors.New("Offsets were committed with a different window size. Please provide the same window size to resume.")
+		}
+
+		aggregator.Window = &window
+		aggregator.Next = lastBucket.Add(time.Minute)
+		aggregator.Started = true
+	}
+
+	flushed := false
+	aggregator.Emit = func(point statistics.Point) error {
+		flushed = true
+		return point.Each(aggregator.Unit, emit)
+	}
+
+	raw := events.RawEvent{}
+	for {
+		line, err := consumer.Next(ctx)
+		if err != nil {
+			return err
+		}
+
+		if err := events.DecodeRawEvent(line, events.DefaultFields|events.FieldEventName, &raw); err != nil {
+			return err
+		}
+
+		/* Only translation_delivered events carry a delivery time */
+		event := raw.Event()
+		if !events.IsDelivered(event) {
+			continue
+		}
+
+		/* Records consumed again after resuming, up to the committed offsets, were already aggregated */
+		err = aggregator.Add(event)
+		if errors.Is(err, events.ErrUnorderedEvents) {
+			continue
+		}
+		if err != nil {
+			return err
+		}
+		if !flushed {
+			continue
+		}
+		flushed = false
+
+		/* The event just added is the first of the pending bucket, so it is left out of the commit along with the bucket */
+		if err := flush(); err != nil {
+			return err
+		}
+		if err := consumer.Commit(encodeState(*aggregator.Window, aggregator.Next.Add(-time.Minute))); err != nil {
+			return err
+		}
+	}
+}
+
+/*
+A function that encodes the state of the moving window and the last bucket flushed as committed metadata.
+
+The state is encoded in binary as base64, which takes at most MaxMetadataSize bytes for windows up to MaxWindowSize.
+*/
+func encodeState(window statistics.MovingWindow, lastBucket time.Time) string {
+	state := make([]byte, 0, stateHeaderSize+len(window.Queue)*dataPointSize)
+	state = append(state, stateVersion)
+	state = binary.BigEndian.AppendUint64(state, uint64(lastBucket.Unix()))
+	state = binary.BigEndian.AppendUint32(state, uint32(window.Size))
+	state = appendDataPoint(state, window.Data)
+	state = binary.BigEndian.AppendUint32(state, uint32(len(window.Queue)))
+	for _, dataPoint := range window.Queue {
+		state = appendDataPoint(state, dataPoint)
+	}
+
+	return base64.StdEncoding.EncodeToString(state)
+}
+
+/*
+A function that decodes the state of the moving window and the last bucket flushed from committed metadata.
+*/
+func decodeState(metadata string) (statistics.MovingWindow, time.Time, error) {
+	invalid := errors.New("Committed metadata is invalid. Please provide a consumer group committed by unbabel_cli.")
+
+	state, err := base64.StdEncoding.DecodeString(metadata)
+	if err != nil || len(state) < stateHeaderSize || state[0] != stateVersion {
+		return statistics.MovingWindow{}, time.Time{}, invalid
+	}
+
+	lastBucket := time.Unix(int64(binary.BigEndian.Uint64(state[1:9])), 0).UTC()
+	window := statistics.MovingWindow{Size: int(binary.BigEndian.Uint32(state[9:13])), Data: readDataPoint(state[13:29])}
+	length := int(binary.BigEndian.Uint32(state[29:33]))
+	if length > window.Size || len(state) != stateHeaderSize+length*dataPointSize {
+		return statistics.MovingWindow{}, time.Time{}, invalid
+	}
+
+	window.Queue = make([]statistics.DataPoint, 0, window.Size+1)
+	for offset := stateHeaderSize; offset < len(state); offset += dataPointSize {
+		window.Queue = append(window.Queue, readDataPoint(state[offset:offset+dataPointSize]))
+	}
+
+	return window, lastBucket, nil
+}
+
+/*
+A function that appends the total and count of a datapoint to an encoded state.
+*/
+func appendDataPoint(state []byte, dataPoint statistics.DataPoint) []byte {
+	state = binary.BigEndian.AppendUint64(state, math.Float64bits(dataPoint.Total))
+	return binary.BigEndian.AppendUint64(state, uint64(dataPoint.Count))
+}
+
+/*
+A function that reads the total and count of a datapoint from an encoded state.
+*/
+func readDataPoint(state []byte) statistics.DataPoint {
+	return statistics.DataPoint{
+		Total: math.Float64frombits(binary.BigEndian.Uint64(state[0:8])),
+		Count: int(binary.BigEndian.Uint64(state[8:16])),
+	}
+}
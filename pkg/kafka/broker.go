@@ -0,0 +1,287 @@
+/*
+Package kafka consumes events from a Kafka-compatible message bus, so the moving average is calculated directly off the stream.
+
+The requests made to the broker are described by the Broker interface, which KafkaBroker implements over the Kafka protocol,
+and FakeBroker implements in-process for tests.
+*/
+package kafka
+
+import (
+	"errors"
+	"sort"
+	"sync"
+)
+
+var (
+	/* Error returned when the members of a group changed, so its consumers have to join it again */
+	ErrRebalanceInProgress = errors.New("The consumer group is rebalancing. Please join the group again.")
+	/* Error returned for a topic or partition the broker doesn't have */
+	ErrUnknownTopicOrPartition = errors.New("Unknown topic or partition. Please provide an existing topic.")
+	/* Error returned for a member that is not part of the group */
+	ErrUnknownMember = errors.New("Unknown member of the consumer group. Please join the group first.")
+	/* Error returned for metadata larger than the broker accepts with committed offsets */
+	ErrOffsetMetadataTooLarge = errors.New("Committed metadata is too large. Please provide a smaller Window Size.")
+)
+
+/*
+A struct that holds a record of a partition of a topic, with the offset it was appended at.
+*/
+type Record struct {
+	Topic     string
+	Partition int32
+	Offset    int64
+	Key       []byte
+	Value     []byte
+}
+
+/*
+A struct that holds the partitions assigned to a member of a consumer group, for a generation of the group.
+*/
+type Assignment struct {
+	Generation int
+	Partitions []int32
+}
+
+/*
+A struct that holds the offset committed by a consumer group for a partition, with the metadata committed with it.
+
+Offset is the offset of the next record to consume.
+*/
+type CommittedOffset struct {
+	Offset   int64
+	Metadata string
+}
+
+/*
+An interface of the requests a consumer makes to a Kafka-compatible broker.
+
+It is small enough to be implemented over any Kafka client, like KafkaBroker does, and by FakeBroker in tests.
+JoinGroup adds a member to the consumer group of a topic, rebalancing its partitions, and returns the assignment of the member.
+Heartbeat returns ErrRebalanceInProgress once the generation of the member is no longer the current one.
+Fetch returns up to maxRecords records of a partition, starting at the offset, and no records once the end of the partition is reached.
+CommitOffsets commits offsets for the group, failing with ErrRebalanceInProgress if the generation is not the current one,
+and with ErrOffsetMetadataTooLarge if the metadata is larger than MaxMetadataSize.
+FetchOffsets returns the offsets committed for the group, by partition.
+*/
+type Broker interface {
+	JoinGroup(group, topic, member string) (Assignment, error)
+	LeaveGroup(group, member string) error
+	Heartbeat(group, member string, generation int) error
+	Fetch(topic string, partition int32, offset int64, maxRecords int) ([]Record, error)
+	CommitOffsets(group, member string, generation int, offsets map[int32]CommittedOffset) error
+	FetchOffsets(group string) (map[int32]CommittedOffset, error)
+}
+
+/*
+A struct that implements an in-process Broker, holding topics and consumer groups in memory.
+
+Partitions are assigned to the members of a group in ranges, in the order of their names. It is safe to use from several goroutines.
+*/
+type FakeBroker struct {
+	mutex  sync.Mutex
+	topics map[string][][]Record
+	groups map[string]*fakeGroup
+}
+
+/*
+A struct that holds the state of a consumer group of a FakeBroker.
+*/
+type fakeGroup struct {
+	topic      string
+	generation int
+	members    []string
+	offsets    map[int32]CommittedOffset
+}
+
+/*
+A function that creates an empty FakeBroker.
+*/
+func NewFakeBroker() *FakeBroker {
+	return &FakeBroker{topics: make(map[string][][]Record), groups: make(map[string]*fakeGroup)}
+}
+
+/*
+A function that creates a topic with the given number of partitions, if it doesn't exist yet.
+*/
+func (b *FakeBroker) CreateTopic(topic string, partitions int) {
+	b.mutex.Lock()
+	defer b.mutex.Unlock()
+
+	if _, found := b.topics[topic]; !found {
+		b.topics[topic] = make([][]Record, partitions)
+	}
+}
+
+/*
+A function that appends a record to a partition of a topic.
+
+Returns the offset of the record and an error if the topic or partition doesn't exist.
+*/
+func (b *FakeBroker) Produce(topic string, partition int32, key, value []byte) (int64, error) {
+	b.mutex.Lock()
+	defer b.mutex.Unlock()
+
+	partitions, found := b.topics[topic]
+	if !found || partition < 0 || int(partition) >= len(partitions) {
+		return 0, ErrUnknownTopicOrPartition
+	}
+
+	offset := int64(len(partitions[partition]))
+	partitions[partition] = append(partitions[partition], Record{
+		Topic:     topic,
+		Partition: partition,
+		Offset:    offset,
+		Key:       append([]byte{}, key...),
+		Value:     append([]byte{}, value...),
+	})
+	return offset, nil
+}
+
+func (b *FakeBroker) JoinGroup(group, topic, member string) (Assignment, error) {
+	b.mutex.Lock()
+	defer b.mutex.Unlock()
+
+	if _, found := b.topics[topic]; !found {
+		return Assignment{}, ErrUnknownTopicOrPartition
+	}
+
+	state, found := b.groups[group]
+	if !found {
+		state = &fakeGroup{topic: topic, offsets: make(map[int32]CommittedOffset)}
+		b.groups[group] = state
+	}
+	if state.topic != topic {
+		return Assignment{}, errors.New("The consumer group consumes another topic. Please provide a different group.")
+	}
+
+	/* Only a new member starts a new generation, so members joining again after a rebalance all get the same one */
+	if state.memberIndex(member) < 0 {
+		state.members = append(state.members, member)
+		sort.Strings(state.members)
+		state.generation++
+	}
+
+	return b.assignment(state, member), nil
+}
+
+func (b *FakeBroker) LeaveGroup(group, member string) error {
+	b.mutex.Lock()
+	defer b.mutex.Unlock()
+
+	state, found := b.groups[group]
+	if !found || state.memberIndex(member) < 0 {
+		return ErrUnknownMember
+	}
+
+	index := state.memberIndex(member)
+	state.members = append(state.members[:index], state.members[index+1:]...)
+	state.generation++
+	return nil
+}
+
+func (b *FakeBroker) Heartbeat(group, member string, generation int) error {
+	b.mutex.Lock()
+	defer b.mutex.Unlock()
+
+	return b.checkGeneration(group, member, generation)
+}
+
+func (b *FakeBroker) Fetch(topic string, partition int32, offset int64, maxRecords int) ([]Record, error) {
+	b.mutex.Lock()
+	defer b.mutex.Unlock()
+
+	partitions, found := b.topics[topic]
+	if !found || partition < 0 || int(partition) >= len(partitions) {
+		return nil, ErrUnknownTopicOrPartition
+	}
+
+	records := partitions[partition]
+	if offset < 0 || offset >= int64(len(records)) {
+		return []Record{}, nil
+	}
+
+	end := offset + int64(maxRecords)
+	if end > int64(len(records)) {
+		end = int64(len(records))
+	}
+	return append([]Record{}, records[offset:end]...), nil
+}
+
+func (b *FakeBroker) CommitOffsets(group, member string, generation int, offsets map[int32]CommittedOffset) error {
+	b.mutex.Lock()
+	defer b.mutex.Unlock()
+
+	if err := b.checkGeneration(group, member, generation); err != nil {
+		return err
+	}
+
+	for _, offset := range offsets {
+		if len(offset.Metadata) > MaxMetadataSize {
+			return ErrOffsetMetadataTooLarge
+		}
+	}
+
+	state := b.groups[group]
+	for partition, offset := range offsets {
+		state.offsets[partition] = offset
+	}
+	return nil
+}
+
+func (b *FakeBroker) FetchOffsets(group string) (map[int32]CommittedOffset, error) {
+	b.mutex.Lock()
+	defer b.mutex.Unlock()
+
+	offsets := make(map[int32]CommittedOffset)
+	if state, found := b.groups[group]; found {
+		for partition, offset := range state.offsets {
+			offsets[partition] = offset
+		}
+	}
+	return offsets, nil
+}
+
+/*
+A function that checks the member is part of the group, at its current generation.
+*/
+func (b *FakeBroker) checkGeneration(group, member string, generation int) error {
+	state, found := b.groups[group]
+	if !found || state.memberIndex(member) < 0 {
+		return ErrUnknownMember
+	}
+	if state.generation != generation {
+		return ErrRebalanceInProgress
+	}
+	return nil
+}
+
+/*
+A function that assigns a range of the partitions of the topic to a member, by its place in the group.
+*/
+func (b *FakeBroker) assignment(state *fakeGroup, member string) Assignment {
+	partitions := rangeAssignment(len(b.topics[state.topic]), len(state.members), state.memberIndex(member))
+	return Assignment{Generation: state.generation, Partitions: partitions}
+}
+
+/*
+A function that returns the range of partitions assigned to the member at the given place among the members of a group.
+*/
+func rangeAssignment(partitions, members, index int) []int32 {
+	assignment := []int32{}
+	for partition := index * partitions / members; partition < (index+1)*partitions/members; partition++ {
+		assignment = append(assignment, int32(partition))
+	}
+	return assignment
+}
+
+/*
+A function that returns the place of a member in the group, or -1 if it isn't part of it.
+*/
+func (g *fakeGroup) memberIndex(member string) int {
+	for index, name := range g.members {
+		if name == member {
+			return index
+		}
+	}
+	return -1
+}
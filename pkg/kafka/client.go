@@ -0,0 +1,407 @@
+package kafka
+
+import (
+	"context"
+	"errors"
+	"io"
+	"sort"
+	"sync"
+	"time"
+
+	kafkago "github.com/segmentio/kafka-go"
+)
+
+/*
+A struct that implements Broker over the Kafka protocol, so a Consumer reads from a Kafka cluster.
+
+Members are told apart by their names, carried with their subscription, and the leader of the group assigns
+the partitions in ranges, in the order of their names, like FakeBroker. Timeout bounds each request to the cluster,
+and SessionTimeout the time without heartbeats after which the coordinator removes a member from the group.
+It is safe to use from several goroutines.
+*/
+type KafkaBroker struct {
+	Client         *kafkago.Client
+	Timeout        time.Duration
+	SessionTimeout time.Duration
+
+	mutex  sync.Mutex
+	groups map[string]*kafkaGroup
+}
+
+/*
+A struct that holds the topic consumed by a group and the ids the coordinator gave its members, by name.
+*/
+type kafkaGroup struct {
+	topic      string
+	partitions int
+	members    map[string]string
+}
+
+/*
+A function that creates a KafkaBroker.
+
+Receives the addresses of the brokers of the cluster, as host:port.
+Returns the KafkaBroker, with a timeout of 10 seconds per request and a session timeout of 30 seconds.
+*/
+func NewKafkaBroker(addresses ...string) *KafkaBroker {
+	return &KafkaBroker{
+		Client:         &kafkago.Client{Addr: kafkago.TCP(addresses...)},
+		Timeout:        10 * time.Second,
+		SessionTimeout: 30 * time.Second,
+		groups:         make(map[string]*kafkaGroup),
+	}
+}
+
+func (b *KafkaBroker) JoinGroup(group, topic, member string) (Assignment, error) {
+	ctx, cancel := context.WithTimeout(context.Background(), b.SessionTimeout+b.Timeout)
+	defer cancel()
+
+	partitions, err := b.partitions(ctx, topic)
+	if err != nil {
+		return Assignment{}, err
+	}
+
+	state := b.group(group, topic, partitions)
+	request := &kafkago.JoinGroupRequest{
+		GroupID:          group,
+		MemberID:         b.memberId(state, member),
+		SessionTimeout:   b.SessionTimeout,
+		RebalanceTimeout: b.SessionTimeout,
+		ProtocolType:     "consumer",
+		Protocols: []kafkago.GroupProtocol{{
+			Name:     "range",
+			Metadata: kafkago.GroupProtocolSubscription{Topics: []string{topic}, UserData: []byte(member)},
+		}},
+	}
+
+	/* A new member is given an id by the coordinator, and has to join again with it */
+	response, err := b.Client.JoinGroup(ctx, request)
+	if err == nil && errors.Is(response.Error, kafkago.MemberIDRequired) {
+		request.MemberID = response.MemberID
+		response, err = b.Client.JoinGroup(ctx, request)
+	}
+	if err != nil {
+		return Assignment{}, err
+	}
+	if response.Error != nil {
+		return Assignment{}, b.brokerError(state, member, response.Error)
+	}
+	b.setMemberId(state, member, response.MemberID)
+
+	/* The leader assigns the partitions to every member, the others get their assignment from the coordinator */
+	syncRequest := &kafkago.SyncGroupRequest{
+		GroupID:      group,
+		GenerationID: response.GenerationID,
+		MemberID:     response.MemberID,
+		ProtocolType: "consumer",
+		ProtocolName: response.ProtocolName,
+	}
+	if response.LeaderID == response.MemberID {
+		syncRequest.Assignments = leaderAssignments(topic, partitions, response.Members)
+	}
+
+	synced, err := b.Client.SyncGroup(ctx, syncRequest)
+	if err != nil {
+		return Assignment{}, err
+	}
+	if synced.Error != nil {
+		return Assignment{}, b.brokerError(state, member, synced.Error)
+	}
+
+	assignment := Assignment{Generation: response.GenerationID, Partitions: []int32{}}
+	for _, partition := range synced.Assignment.AssignedPartitions[topic] {
+		assignment.Partitions = append(assignment.Partitions, int32(partition))
+	}
+	sort.Slice(assignment.Partitions, func(i, j int) bool { return assignment.Partitions[i] < assignment.Partitions[j] })
+	return assignment, nil
+}
+
+func (b *KafkaBroker) LeaveGroup(group, member string) error {
+	ctx, cancel := context.WithTimeout(context.Background(), b.Timeout)
+	defer cancel()
+
+	state, memberId, err := b.member(group, member)
+	if err != nil {
+		return err
+	}
+
+	response, err := b.Client.LeaveGroup(ctx, &kafkago.LeaveGroupRequest{
+		GroupID: group,
+		Members: []kafkago.LeaveGroupRequestMember{{ID: memberId}},
+	})
+	if err != nil {
+		return err
+	}
+	b.setMemberId(state, member, "")
+	if response.Error != nil {
+		return b.brokerError(state, member, response.Error)
+	}
+	return nil
+}
+
+func (b *KafkaBroker) Heartbeat(group, member string, generation int) error {
+	ctx, cancel := context.WithTimeout(context.Background(), b.Timeout)
+	defer cancel()
+
+	state, memberId, err := b.member(group, member)
+	if err != nil {
+		return err
+	}
+
+	response, err := b.Client.Heartbeat(ctx, &kafkago.HeartbeatRequest{
+		GroupID:      group,
+		GenerationID: int32(generation),
+		MemberID:     memberId,
+	})
+	if err != nil {
+		return err
+	}
+	if response.Error != nil {
+		return b.brokerError(state, member, response.Error)
+	}
+	return nil
+}
+
+func (b *KafkaBroker) Fetch(topic string, partition int32, offset int64, maxRecords int) ([]Record, error) {
+	ctx, cancel := context.WithTimeout(context.Background(), b.Timeout)
+	defer cancel()
+
+	request := &kafkago.FetchRequest{
+		Topic:     topic,
+		Partition: int(partition),
+		Offset:    offset,
+		MinBytes:  1,
+		MaxBytes:  1 << 20,
+		MaxWait:   100 * time.Millisecond,
+	}
+	response, err := b.Client.Fetch(ctx, request)
+	if err != nil {
+		return nil, err
+	}
+
+	/* Offsets before the start of the log were removed by retention, so the partition is read from its first offset */
+	if errors.Is(response.Error, kafkago.OffsetOutOfRange) {
+		request.Offset = kafkago.FirstOffset
+		if response, err = b.Client.Fetch(ctx, request); err != nil {
+			return nil, err
+		}
+	}
+	if response.Error != nil {
+		return nil, b.brokerError(nil, "", response.Error)
+	}
+
+	/* Batches may start before the offset requested, so the records before it are skipped */
+	records := []Record{}
+	for len(records) < maxRecords {
+		record, err := response.Records.ReadRecord()
+		if errors.Is(err, io.EOF) {
+			break
+		}
+		if err != nil {
+			return nil, err
+		}
+		if record.Offset < offset {
+			continue
+		}
+
+		key, err := kafkago.ReadAll(record.Key)
+		if err != nil {
+			return nil, err
+		}
+		value, err := kafkago.ReadAll(record.Value)
+		if err != nil {
+			return nil, err
+		}
+		records = append(records, Record{Topic: topic, Partition: partition, Offset: record.Offset, Key: key, Value: value})
+	}
+	return records, nil
+}
+
+func (b *KafkaBroker) CommitOffsets(group, member string, generation int, offsets map[int32]CommittedOffset) error {
+	ctx, cancel := context.WithTimeout(context.Background(), b.Timeout)
+	defer cancel()
+
+	state, memberId, err := b.member(group, member)
+	if err != nil {
+		return err
+	}
+
+	commits := make([]kafkago.OffsetCommit, 0, len(offsets))
+	for partition, offset := range offsets {
+		if len(offset.Metadata) > MaxMetadataSize {
+			return ErrOffsetMetadataTooLarge
+		}
+		commits = append(commits, kafkago.OffsetCommit{Partition: int(partition), Offset: offset.Offset, Metadata: offset.Metadata})
+	}
+
+	response, err := b.Client.OffsetCommit(ctx, &kafkago.OffsetCommitRequest{
+		GroupID:      group,
+		GenerationID: generation,
+		MemberID:     memberId,
+		Topics:       map[string][]kafkago.OffsetCommit{state.topic: commits},
+	})
+	if err != nil {
+		return err
+	}
+	for _, partition := range response.Topics[state.topic] {
+		if partition.Error != nil {
+			return b.brokerError(state, member, partition.Error)
+		}
+	}
+	return nil
+}
+
+func (b *KafkaBroker) FetchOffsets(group string) (map[int32]CommittedOffset, error) {
+	ctx, cancel := context.WithTimeout(context.Background(), b.Timeout)
+	defer cancel()
+
+	b.mutex.Lock()
+	state, found := b.groups[group]
+	b.mutex.Unlock()
+	if !found {
+		return nil, ErrUnknownMember
+	}
+
+	partitions := make([]int, state.partitions)
+	for partition := range partitions {
+		partitions[partition] = partition
+	}
+
+	response, err := b.Client.OffsetFetch(ctx, &kafkago.OffsetFetchRequest{
+		GroupID: group,
+		Topics:  map[string][]int{state.topic: partitions},
+	})
+	if err != nil {
+		return nil, err
+	}
+	if response.Error != nil {
+		return nil, b.brokerError(state, "", response.Error)
+	}
+
+	/* Partitions without a committed offset have an offset of -1 */
+	offsets := make(map[int32]CommittedOffset)
+	for _, partition := range response.Topics[state.topic] {
+		if partition.Error != nil {
+			return nil, b.brokerError(state, "", partition.Error)
+		}
+		if partition.CommittedOffset >= 0 {
+			offsets[int32(partition.Partition)] = CommittedOffset{Offset: partition.CommittedOffset, Metadata: partition.Metadata}
+		}
+	}
+	return offsets, nil
+}
+
+/*
+A function that returns the number of partitions of a topic, from the metadata of the cluster.
+*/
+func (b *KafkaBroker) partitions(ctx context.Context, topic string) (int, error) {
+	metadata, err := b.Client.Metadata(ctx, &kafkago.MetadataRequest{Topics: []string{topic}})
+	if err != nil {
+		return 0, err
+	}
+	for _, found := range metadata.Topics {
+		if found.Name != topic {
+			continue
+		}
+		if found.Error != nil {
+			return 0, b.brokerError(nil, "", found.Error)
+		}
+		return len(found.Partitions), nil
+	}
+	return 0, ErrUnknownTopicOrPartition
+}
+
+/*
+A function that returns the state of a group, creating it on the first join.
+*/
+func (b *KafkaBroker) group(group, topic string, partitions int) *kafkaGroup {
+	b.mutex.Lock()
+	defer b.mutex.Unlock()
+
+	state, found := b.groups[group]
+	if !found {
+		state = &kafkaGroup{members: make(map[string]string)}
+		b.groups[group] = state
+	}
+	state.topic = topic
+	state.partitions = partitions
+	return state
+}
+
+/*
+A function that returns the state of a group and the id of one of its members, failing if the member never joined it.
+*/
+func (b *KafkaBroker) member(group, member string) (*kafkaGroup, string, error) {
+	b.mutex.Lock()
+	defer b.mutex.Unlock()
+
+	state, found := b.groups[group]
+	if !found || state.members[member] == "" {
+		return nil, "", ErrUnknownMember
+	}
+	return state, state.members[member], nil
+}
+
+/*
+A function that returns the id the coordinator gave a member, or an empty id if it has none.
+*/
+func (b *KafkaBroker) memberId(state *kafkaGroup, member string) string {
+	b.mutex.Lock()
+	defer b.mutex.Unlock()
+	return state.members[member]
+}
+
+/*
+A function that stores the id the coordinator gave a member, or forgets it with an empty id.
+*/
+func (b *KafkaBroker) setMemberId(state *kafkaGroup, member, memberId string) {
+	b.mutex.Lock()
+	defer b.mutex.Unlock()
+	state.members[member] = memberId
+}
+
+/*
+A function that maps the errors of the Kafka protocol to the errors of Broker.
+
+A member the coordinator doesn't know anymore, usually after its session expired, has to join the group again with a new id,
+so it is forgotten and the group is rebalancing for it.
+*/
+func (b *KafkaBroker) brokerError(state *kafkaGroup, member string, err error) error {
+	switch {
+	case errors.Is(err, kafkago.RebalanceInProgress), errors.Is(err, kafkago.IllegalGeneration):
+		return ErrRebalanceInProgress
+	case errors.Is(err, kafkago.UnknownMemberId):
+		if state != nil && member != "" {
+			b.setMemberId(state, member, "")
+		}
+		return ErrRebalanceInProgress
+	case errors.Is(err, kafkago.UnknownTopicOrPartition):
+		return ErrUnknownTopicOrPartition
+	case errors.Is(err, kafkago.OffsetMetadataTooLarge):
+		return ErrOffsetMetadataTooLarge
+	}
+	return err
+}
+
+/*
+A function that assigns the partitions of a topic to the members of a group in ranges, in the order of their names.
+*/
+func leaderAssignments(topic string, partitions int, members []kafkago.JoinGroupResponseMember) []kafkago.SyncGroupRequestAssignment {
+	sorted := append([]kafkago.JoinGroupResponseMember{}, members...)
+	sort.Slice(sorted, func(i, j int) bool {
+		return string(sorted[i].Metadata.UserData) < string(sorted[j].Metadata.UserData)
+	})
+
+	assignments := make([]kafkago.SyncGroupRequestAssignment, 0, len(sorted))
+	for index, member := range sorted {
+		assigned := []int{}
+		for _, partition := range rangeAssignment(partitions, len(sorted), index) {
+			assigned = append(assigned, int(partition))
+		}
+		assignments = append(assignments, kafkago.SyncGroupRequestAssignment{
+			MemberID:   member.ID,
+			Assignment: kafkago.GroupProtocolAssignment{AssignedPartitions: map[string][]int{topic: assigned}},
+		})
+	}
+	return assignments
+}
@@ -0,0 +1,259 @@
+package kafka_test
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"net"
+	"reflect"
+	"strings"
+	"sync"
+	"testing"
+
+	"github.com/jmbds/unbabel-backend-engineering-challenge/pkg/kafka"
+	"github.com/segmentio/kafka-go/protocol"
+	"github.com/segmentio/kafka-go/protocol/fetch"
+	"github.com/segmentio/kafka-go/protocol/heartbeat"
+	"github.com/segmentio/kafka-go/protocol/joingroup"
+	"github.com/segmentio/kafka-go/protocol/leavegroup"
+	"github.com/segmentio/kafka-go/protocol/metadata"
+	"github.com/segmentio/kafka-go/protocol/offsetcommit"
+	"github.com/segmentio/kafka-go/protocol/offsetfetch"
+	"github.com/segmentio/kafka-go/protocol/syncgroup"
+)
+
+/* Error codes of the Kafka protocol answered by the fake coordinator */
+const (
+	codeUnknownTopicOrPartition = 3
+	codeUnknownMemberId         = 25
+	codeRebalanceInProgress     = 27
+	codeMemberIdRequired        = 79
+)
+
+/*
+A struct that answers the requests of a Kafka client in-process, reading the records of a FakeBroker.
+
+It coordinates a single consumer group, whose first member leads it, without waiting for the other members to join again.
+*/
+type fakeTransport struct {
+	mutex       sync.Mutex
+	broker      *kafka.FakeBroker
+	topic       string
+	partitions  int
+	generation  int32
+	members     []joingroup.ResponseMember
+	assignments map[string][]byte
+	offsets     map[int32]offsetcommit.RequestPartition
+	nextMember  int
+}
+
+func (t *fakeTransport) RoundTrip(ctx context.Context, addr net.Addr, request protocol.Message) (protocol.Message, error) {
+	t.mutex.Lock()
+	defer t.mutex.Unlock()
+
+	switch request := request.(type) {
+	case *metadata.Request:
+		response := &metadata.Response{Brokers: []metadata.ResponseBroker{{NodeID: 1, Host: "localhost", Port: 9092}}}
+		for _, name := range request.TopicNames {
+			topic := metadata.ResponseTopic{Name: name}
+			if name != t.topic {
+				topic.ErrorCode = codeUnknownTopicOrPartition
+			}
+			for partition := 0; name == t.topic && partition < t.partitions; partition++ {
+				topic.Partitions = append(topic.Partitions, metadata.ResponsePartition{PartitionIndex: int32(partition), LeaderID: 1})
+			}
+			response.Topics = append(response.Topics, topic)
+		}
+		return response, nil
+
+	case *joingroup.Request:
+		if request.MemberID == "" {
+			t.nextMember++
+			return &joingroup.Response{ErrorCode: codeMemberIdRequired, MemberID: fmt.Sprintf("member-%d", t.nextMember)}, nil
+		}
+		if t.memberIndex(request.MemberID) < 0 {
+			t.members = append(t.members, joingroup.ResponseMember{MemberID: request.MemberID, Metadata: request.Protocols[0].Metadata})
+			t.generation++
+		}
+		response := &joingroup.Response{
+			GenerationID: t.generation,
+			ProtocolType: request.ProtocolType,
+			ProtocolName: request.Protocols[0].Name,
+			LeaderID:     t.members[0].MemberID,
+			MemberID:     request.MemberID,
+		}
+		if response.LeaderID == request.MemberID {
+			response.Members = t.members
+		}
+		return response, nil
+
+	case *syncgroup.Request:
+		if code := t.check(request.MemberID, request.GenerationID); code != 0 {
+			return &syncgroup.Response{ErrorCode: code}, nil
+		}
+		for _, assignment := range request.Assignments {
+			t.assignments[assignment.MemberID] = assignment.Assignment
+		}
+		return &syncgroup.Response{ProtocolType: request.ProtocolType, ProtocolName: request.ProtocolName, Assignments: t.assignments[request.MemberID]}, nil
+
+	case *heartbeat.Request:
+		return &heartbeat.Response{ErrorCode: t.check(request.MemberID, request.GenerationID)}, nil
+
+	case *leavegroup.Request:
+		for _, member := range request.Members {
+			if index := t.memberIndex(member.MemberID); index >= 0 {
+				t.members = append(t.members[:index], t.members[index+1:]...)
+				t.generation++
+			}
+		}
+		return &leavegroup.Response{}, nil
+
+	case *offsetcommit.Request:
+		code := t.check(request.MemberID, request.GenerationID)
+		response := &offsetcommit.Response{}
+		for _, topic := range request.Topics {
+			partitions := []offsetcommit.ResponsePartition{}
+			for _, partition := range topic.Partitions {
+				if code == 0 {
+					t.offsets[partition.PartitionIndex] = partition
+				}
+				partitions = append(partitions, offsetcommit.ResponsePartition{PartitionIndex: partition.PartitionIndex, ErrorCode: code})
+			}
+			response.Topics = append(response.Topics, offsetcommit.ResponseTopic{Name: topic.Name, Partitions: partitions})
+		}
+		return response, nil
+
+	case *offsetfetch.Request:
+		response := &offsetfetch.Response{}
+		for _, topic := range request.Topics {
+			partitions := []offsetfetch.ResponsePartition{}
+			for _, index := range topic.PartitionIndexes {
+				partition := offsetfetch.ResponsePartition{PartitionIndex: index, CommittedOffset: -1}
+				if offset, found := t.offsets[index]; found {
+					partition.CommittedOffset = offset.CommittedOffset
+					partition.Metadata = offset.CommittedMetadata
+				}
+				partitions = append(partitions, partition)
+			}
+			response.Topics = append(response.Topics, offsetfetch.ResponseTopic{Name: topic.Name, Partitions: partitions})
+		}
+		return response, nil
+
+	case *fetch.Request:
+		requested := request.Topics[0].Partitions[0]
+		records, err := t.broker.Fetch(request.Topics[0].Topic, requested.Partition, requested.FetchOffset, 3)
+		if err != nil {
+			return nil, err
+		}
+		recordSet := make([]protocol.Record, 0, len(records))
+		for _, record := range records {
+			recordSet = append(recordSet, protocol.Record{Offset: record.Offset, Key: protocol.NewBytes(record.Key), Value: protocol.NewBytes(record.Value)})
+		}
+		return &fetch.Response{Topics: []fetch.ResponseTopic{{
+			Topic: request.Topics[0].Topic,
+			Partitions: []fetch.ResponsePartition{{
+				Partition: requested.Partition,
+				RecordSet: protocol.RecordSet{Version: 2, Records: protocol.NewRecordReader(recordSet...)},
+			}},
+		}}}, nil
+	}
+
+	return nil, fmt.Errorf("unexpected request %T", request)
+}
+
+func (t *fakeTransport) memberIndex(memberId string) int {
+	for index, member := range t.members {
+		if member.MemberID == memberId {
+			return index
+		}
+	}
+	return -1
+}
+
+func (t *fakeTransport) check(memberId string, generation int32) int16 {
+	if t.memberIndex(memberId) < 0 {
+		return codeUnknownMemberId
+	}
+	if generation != t.generation {
+		return codeRebalanceInProgress
+	}
+	return 0
+}
+
+func TestKafkaBroker(t *testing.T) {
+	records := kafka.NewFakeBroker()
+	records.CreateTopic("events", 2)
+	produce(t, records, 0, "2018-12-26 18:11:08.509654")
+	produce(t, records, 1, "2018-12-26 18:12:19.903159")
+	produce(t, records, 0, "2018-12-26 18:15:19.903159")
+
+	transport := &fakeTransport{
+		broker:      records,
+		topic:       "events",
+		partitions:  2,
+		assignments: make(map[string][]byte),
+		offsets:     make(map[int32]offsetcommit.RequestPartition),
+	}
+	broker := kafka.NewKafkaBroker("localhost:9092")
+	broker.Client.Transport = transport
+
+	if _, err := broker.JoinGroup("aggregators", "unknown", "a"); !errors.Is(err, kafka.ErrUnknownTopicOrPartition) {
+		t.Errorf("expected %v, got %v", kafka.ErrUnknownTopicOrPartition, err)
+	}
+
+	/* The only member leads the group and is assigned every partition */
+	consumer := kafka.NewConsumer(broker, "aggregators", "events", "a")
+	consumer.MaxRecords = 2
+	if err := consumer.Join(); err != nil {
+		t.Fatal(err)
+	}
+
+	expected := []string{"2018-12-26 18:11:08.509654", "2018-12-26 18:12:19.903159", "2018-12-26 18:15:19.903159"}
+	for _, timestamp := range expected {
+		line, err := consumer.Next(context.Background())
+		if err != nil {
+			t.Fatal(err)
+		}
+		if !strings.Contains(string(line), timestamp) {
+			t.Errorf("expected %s, got %s", timestamp, string(line))
+		}
+	}
+
+	if err := consumer.Commit("state"); err != nil {
+		t.Fatal(err)
+	}
+	offsets, err := broker.FetchOffsets("aggregators")
+	if err != nil {
+		t.Fatal(err)
+	}
+	expectedOffsets := map[int32]kafka.CommittedOffset{0: {Offset: 1, Metadata: "state"}, 1: {Offset: 1, Metadata: "state"}}
+	if !reflect.DeepEqual(offsets, expectedOffsets) {
+		t.Errorf("expected %v, got %v", expectedOffsets, offsets)
+	}
+
+	/* Errors of the protocol are returned as the errors of Broker */
+	testcases := []struct {
+		name          string
+		request       func() error
+		expectedError error
+	}{
+		{"stale generation", func() error { return broker.Heartbeat("aggregators", "a", 0) }, kafka.ErrRebalanceInProgress},
+		{"metadata too large", func() error {
+			return broker.CommitOffsets("aggregators", "a", 1, map[int32]kafka.CommittedOffset{0: {Metadata: strings.Repeat("x", kafka.MaxMetadataSize+1)}})
+		}, kafka.ErrOffsetMetadataTooLarge},
+		{"left the group", func() error {
+			if err := broker.LeaveGroup("aggregators", "a"); err != nil {
+				return err
+			}
+			return broker.Heartbeat("aggregators", "a", 1)
+		}, kafka.ErrUnknownMember},
+	}
+
+	for _, tc := range testcases {
+		t.Run(tc.name, func(t *testing.T) {
+			if err := tc.request(); !errors.Is(err, tc.expectedError) {
+				t.Errorf("expected %v, got %v", tc.expectedError, err)
+			}
+		})
+	}
+}
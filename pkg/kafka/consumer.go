@@ -0,0 +1,308 @@
+package kafka
+
+import (
+	"container/heap"
+	"context"
+	"time"
+
+	"github.com/jmbds/unbabel-backend-engineering-challenge/internal/events"
+)
+
+/*
+A struct that consumes the partitions assigned to a member of a consumer group, as an events.Source.
+
+Records of every partition are returned in the order of the timestamp of their event, holding each record back
+until a record Lateness newer was fetched, so records up to Lateness out of order, within a partition or across partitions, are reordered.
+Records older than one already returned can't be reordered anymore, so they are dropped and counted in Late.
+MaxRecords is the number of records fetched from a partition at a time,
+and PollInterval the wait before fetching again from partitions that had no new records.
+*/
+type Consumer struct {
+	Broker       Broker
+	Group        string
+	Topic        string
+	Member       string
+	MaxRecords   int
+	PollInterval time.Duration
+	Lateness     time.Duration
+	Late         int
+
+	assignment Assignment
+	cursors    []*partitionCursor
+	held       heldRecords
+	newest     time.Time
+	returned   time.Time
+	last       *heldRecord
+	metadata   string
+	raw        events.RawEvent
+}
+
+/*
+A struct that holds the position of the consumer in a partition.
+
+FetchOffset is the offset after the last record fetched.
+*/
+type partitionCursor struct {
+	partition   int32
+	fetchOffset int64
+	caughtUp    bool
+	fetchedAt   time.Time
+}
+
+/*
+A struct that holds a record fetched and not yet returned, with the timestamp of its event.
+*/
+type heldRecord struct {
+	record    Record
+	timestamp time.Time
+}
+
+/*
+A min-heap of the records held back, ordered by timestamp, then by partition and offset.
+*/
+type heldRecords []*heldRecord
+
+func (h heldRecords) Len() int { return len(h) }
+
+func (h heldRecords) Less(i, j int) bool {
+	if !h[i].timestamp.Equal(h[j].timestamp) {
+		return h[i].timestamp.Before(h[j].timestamp)
+	}
+	if h[i].record.Partition != h[j].record.Partition {
+		return h[i].record.Partition < h[j].record.Partition
+	}
+	return h[i].record.Offset < h[j].record.Offset
+}
+
+func (h heldRecords) Swap(i, j int) { h[i], h[j] = h[j], h[i] }
+
+func (h *heldRecords) Push(x any) { *h = append(*h, x.(*heldRecord)) }
+
+func (h *heldRecords) Pop() any {
+	old := *h
+	last := old[len(old)-1]
+	*h = old[:len(old)-1]
+	return last
+}
+
+/*
+A function that creates a Consumer, which has to join its group before consuming.
+
+Receives the broker, the consumer group, the topic and the name of the member of the group.
+Returns the Consumer, fetching 500 records at a time, polling every second and returning records as soon as they are fetched.
+*/
+func NewConsumer(broker Broker, group, topic, member string) *Consumer {
+	return &Consumer{
+		Broker:       broker,
+		Group:        group,
+		Topic:        topic,
+		Member:       member,
+		MaxRecords:   500,
+		PollInterval: time.Second,
+	}
+}
+
+/*
+A function that joins the consumer group, starting each assigned partition at the offset committed for it, or at its beginning.
+
+Records held back are discarded, so joining again after a rebalance starts over from the committed offsets.
+Returns an error.
+*/
+func (c *Consumer) Join() error {
+	assignment, err := c.Broker.JoinGroup(c.Group, c.Topic, c.Member)
+	if err != nil {
+		return err
+	}
+
+	committed, err := c.Broker.FetchOffsets(c.Group)
+	if err != nil {
+		return err
+	}
+
+	c.assignment = assignment
+	c.cursors = make([]*partitionCursor, 0, len(assignment.Partitions))
+	c.held = heldRecords{}
+	c.newest = time.Time{}
+	c.returned = time.Time{}
+	c.last = nil
+
+	for _, partition := range assignment.Partitions {
+		offset := committed[partition]
+		c.cursors = append(c.cursors, &partitionCursor{partition: partition, fetchOffset: offset.Offset})
+	}
+	c.metadata = sharedMetadata(committed, assignment.Partitions)
+
+	return nil
+}
+
+/*
+A function that returns the metadata committed for every partition, or an empty string if any of them was not committed with the same one.
+*/
+func sharedMetadata(committed map[int32]CommittedOffset, partitions []int32) string {
+	metadata := ""
+	for index, partition := range partitions {
+		offset, found := committed[partition]
+		if !found || (index > 0 && offset.Metadata != metadata) {
+			return ""
+		}
+		metadata = offset.Metadata
+	}
+	return metadata
+}
+
+/*
+A function that returns the metadata committed with the offsets the consumer started from, or an empty string if there is none.
+
+The metadata is only restored if every assigned partition was committed with the same one, which may not be the case after a rebalance.
+*/
+func (c *Consumer) Metadata() string {
+	return c.metadata
+}
+
+/*
+A function that returns the value of the next record, waiting for new records until the context is cancelled.
+
+Returns the value, which is only valid until Next is called again, and an error,
+which is ErrRebalanceInProgress when the group has to be joined again.
+*/
+func (c *Consumer) Next(ctx context.Context) ([]byte, error) {
+	for {
+		if err := ctx.Err(); err != nil {
+			return nil, err
+		}
+
+		if held := c.release(); held != nil {
+			c.last = held
+			c.returned = held.timestamp
+			return held.record.Value, nil
+		}
+
+		fetched, err := c.fetch()
+		if err != nil {
+			return nil, err
+		}
+		if fetched {
+			continue
+		}
+
+		select {
+		case <-ctx.Done():
+			return nil, ctx.Err()
+		case <-time.After(c.PollInterval):
+		}
+	}
+}
+
+/*
+A function that takes the oldest record held, if a record Lateness newer than it was fetched.
+*/
+func (c *Consumer) release() *heldRecord {
+	if len(c.held) == 0 || c.held[0].timestamp.After(c.newest.Add(-c.Lateness)) {
+		return nil
+	}
+	return heap.Pop(&c.held).(*heldRecord)
+}
+
+/*
+A function that fetches records of the partitions, unless they were caught up less than a poll interval ago.
+
+Returns whether any record was fetched, and an error.
+*/
+func (c *Consumer) fetch() (bool, error) {
+	now := time.Now()
+	heartbeat := false
+	fetched := false
+
+	for _, cursor := range c.cursors {
+		if cursor.caughtUp && now.Sub(cursor.fetchedAt) < c.PollInterval {
+			continue
+		}
+
+		/* Check the assignment is still current before fetching more records */
+		if !heartbeat {
+			if err := c.Broker.Heartbeat(c.Group, c.Member, c.assignment.Generation); err != nil {
+				return false, err
+			}
+			heartbeat = true
+		}
+
+		records, err := c.Broker.Fetch(c.Topic, cursor.partition, cursor.fetchOffset, c.MaxRecords)
+		if err != nil {
+			return false, err
+		}
+
+		cursor.caughtUp = len(records) == 0
+		cursor.fetchedAt = now
+		for _, record := range records {
+			cursor.fetchOffset = record.Offset + 1
+			fetched = true
+			c.hold(record)
+		}
+	}
+
+	return fetched, nil
+}
+
+/*
+A function that holds a record back until it can be returned in order, dropping it if a newer record was already returned.
+*/
+func (c *Consumer) hold(record Record) {
+	timestamp := c.timestamp(record)
+	if timestamp.Before(c.returned) {
+		c.Late++
+		return
+	}
+
+	heap.Push(&c.held, &heldRecord{record: record, timestamp: timestamp})
+	if timestamp.After(c.newest) {
+		c.newest = timestamp
+	}
+}
+
+/*
+A function that returns the timestamp of the event in a record, or the zero time if it has none, so it is returned right away.
+*/
+func (c *Consumer) timestamp(record Record) time.Time {
+	if err := events.DecodeRawEvent(record.Value, events.FieldTimestamp, &c.raw); err != nil {
+		return time.Time{}
+	}
+	timestamp, err := c.raw.Time()
+	if err != nil {
+		return time.Time{}
+	}
+	return timestamp
+}
+
+/*
+A function that commits, for each partition, the offset of its first record not yet returned, with the metadata.
+
+Records held back and the last record returned are left to be consumed again, as the last record is the first of the bucket
+still being aggregated when a bucket is flushed. Records after them that were already returned are consumed again too,
+so they have to be skipped when resuming.
+Returns an error, which is ErrRebalanceInProgress when the group has to be joined again.
+*/
+func (c *Consumer) Commit(metadata string) error {
+	offsets := make(map[int32]CommittedOffset, len(c.cursors))
+	for _, cursor := range c.cursors {
+		offsets[cursor.partition] = CommittedOffset{Offset: cursor.fetchOffset, Metadata: metadata}
+	}
+
+	pending := append(heldRecords{}, c.held...)
+	if c.last != nil {
+		pending = append(pending, c.last)
+	}
+	for _, held := range pending {
+		if offset := offsets[held.record.Partition]; held.record.Offset < offset.Offset {
+			offsets[held.record.Partition] = CommittedOffset{Offset: held.record.Offset, Metadata: metadata}
+		}
+	}
+
+	return c.Broker.CommitOffsets(c.Group, c.Member, c.assignment.Generation, offsets)
+}
+
+/*
+A function that leaves the consumer group, so its partitions are assigned to the other members.
+*/
+func (c *Consumer) Close() error {
+	return c.Broker.LeaveGroup(c.Group, c.Member)
+}
@@ -0,0 +1,357 @@
+package kafka_test
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"reflect"
+	"sort"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/jmbds/unbabel-backend-engineering-challenge/internal/events"
+	"github.com/jmbds/unbabel-backend-engineering-challenge/internal/statistics"
+	"github.com/jmbds/unbabel-backend-engineering-challenge/pkg/kafka"
+	"github.com/jmbds/unbabel-backend-engineering-challenge/pkg/movingaverage"
+)
+
+func TestFakeBrokerGroups(t *testing.T) {
+	broker := kafka.NewFakeBroker()
+	broker.CreateTopic("events", 4)
+
+	first, err := broker.JoinGroup("aggregators", "events", "a")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !reflect.DeepEqual(first.Partitions, []int32{0, 1, 2, 3}) {
+		t.Errorf("expected every partition, got %v", first.Partitions)
+	}
+
+	second, err := broker.JoinGroup("aggregators", "events", "b")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !reflect.DeepEqual(second.Partitions, []int32{2, 3}) {
+		t.Errorf("expected the second half of the partitions, got %v", second.Partitions)
+	}
+
+	/* The first member has to join again, and can't commit with its old generation */
+	if err := broker.Heartbeat("aggregators", "a", first.Generation); err != kafka.ErrRebalanceInProgress {
+		t.Errorf("expected %v, got %v", kafka.ErrRebalanceInProgress, err)
+	}
+	if err := broker.CommitOffsets("aggregators", "a", first.Generation, map[int32]kafka.CommittedOffset{0: {Offset: 1}}); err != kafka.ErrRebalanceInProgress {
+		t.Errorf("expected %v, got %v", kafka.ErrRebalanceInProgress, err)
+	}
+
+	rejoined, err := broker.JoinGroup("aggregators", "events", "a")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if rejoined.Generation != second.Generation || !reflect.DeepEqual(rejoined.Partitions, []int32{0, 1}) {
+		t.Errorf("expected the first half of the partitions at generation %d, got %v", second.Generation, rejoined)
+	}
+
+	/* Once the second member leaves, the first one gets every partition back */
+	if err := broker.LeaveGroup("aggregators", "b"); err != nil {
+		t.Fatal(err)
+	}
+	if err := broker.Heartbeat("aggregators", "b", second.Generation); err != kafka.ErrUnknownMember {
+		t.Errorf("expected %v, got %v", kafka.ErrUnknownMember, err)
+	}
+	last, err := broker.JoinGroup("aggregators", "events", "a")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !reflect.DeepEqual(last.Partitions, []int32{0, 1, 2, 3}) {
+		t.Errorf("expected every partition, got %v", last.Partitions)
+	}
+
+	if _, err := broker.JoinGroup("aggregators", "unknown", "a"); err != kafka.ErrUnknownTopicOrPartition {
+		t.Errorf("expected %v, got %v", kafka.ErrUnknownTopicOrPartition, err)
+	}
+}
+
+func TestConsumer(t *testing.T) {
+	broker := kafka.NewFakeBroker()
+	broker.CreateTopic("events", 2)
+
+	/* Each partition is ordered by timestamp, but they are interleaved */
+	produce(t, broker, 0, "2018-12-26 18:11:08.509654")
+	produce(t, broker, 1, "2018-12-26 18:12:19.903159")
+	produce(t, broker, 0, "2018-12-26 18:15:19.903159")
+	produce(t, broker, 1, "2018-12-26 18:15:19.903159")
+	produce(t, broker, 0, "2018-12-26 18:23:19.903159")
+
+	consumer := kafka.NewConsumer(broker, "aggregators", "events", "a")
+	consumer.MaxRecords = 2
+	if err := consumer.Join(); err != nil {
+		t.Fatal(err)
+	}
+
+	expected := []string{
+		"2018-12-26 18:11:08.509654",
+		"2018-12-26 18:12:19.903159",
+		"2018-12-26 18:15:19.903159",
+		"2018-12-26 18:15:19.903159",
+	}
+	for _, timestamp := range expected {
+		line, err := consumer.Next(context.Background())
+		if err != nil {
+			t.Fatal(err)
+		}
+		if !strings.Contains(string(line), timestamp) {
+			t.Errorf("expected %s, got %s", timestamp, string(line))
+		}
+	}
+
+	/* The last record returned, the second of partition 1, is left out of the commit */
+	if err := consumer.Commit("state"); err != nil {
+		t.Fatal(err)
+	}
+	offsets, err := broker.FetchOffsets("aggregators")
+	if err != nil {
+		t.Fatal(err)
+	}
+	expectedOffsets := map[int32]kafka.CommittedOffset{0: {Offset: 2, Metadata: "state"}, 1: {Offset: 1, Metadata: "state"}}
+	if !reflect.DeepEqual(offsets, expectedOffsets) {
+		t.Errorf("expected %v, got %v", expectedOffsets, offsets)
+	}
+
+	/* Joining again starts from the committed offsets */
+	if err := consumer.Join(); err != nil {
+		t.Fatal(err)
+	}
+	if consumer.Metadata() != "state" {
+		t.Errorf("expected state, got %s", consumer.Metadata())
+	}
+	line, err := consumer.Next(context.Background())
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !strings.Contains(string(line), "2018-12-26 18:15:19.903159") {
+		t.Errorf("expected the uncommitted record, got %s", string(line))
+	}
+
+	/* Without new records, it waits until the context is cancelled */
+	consumer.PollInterval = time.Millisecond
+	consumer.Next(context.Background())
+	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Millisecond)
+	defer cancel()
+	if _, err := consumer.Next(ctx); !errors.Is(err, context.DeadlineExceeded) {
+		t.Errorf("expected %v, got %v", context.DeadlineExceeded, err)
+	}
+}
+
+func TestConsumerLateness(t *testing.T) {
+	broker := kafka.NewFakeBroker()
+	broker.CreateTopic("events", 1)
+
+	/* The third record is reordered, while the last one is too late once newer records were returned */
+	produce(t, broker, 0, "2018-12-26 18:10:00.000000")
+	produce(t, broker, 0, "2018-12-26 18:10:40.000000")
+	produce(t, broker, 0, "2018-12-26 18:10:20.000000")
+	produce(t, broker, 0, "2018-12-26 18:12:00.000000")
+	produce(t, broker, 0, "2018-12-26 18:10:05.000000")
+
+	consumer := kafka.NewConsumer(broker, "aggregators", "events", "a")
+	consumer.MaxRecords = 2
+	consumer.PollInterval = time.Millisecond
+	consumer.Lateness = time.Minute
+	if err := consumer.Join(); err != nil {
+		t.Fatal(err)
+	}
+
+	expected := []string{
+		"2018-12-26 18:10:00.000000",
+		"2018-12-26 18:10:20.000000",
+		"2018-12-26 18:10:40.000000",
+	}
+	for _, timestamp := range expected {
+		line, err := consumer.Next(context.Background())
+		if err != nil {
+			t.Fatal(err)
+		}
+		if !strings.Contains(string(line), timestamp) {
+			t.Errorf("expected %s, got %s", timestamp, string(line))
+		}
+	}
+
+	/* The newest record is held back until a record a minute newer is consumed */
+	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Millisecond)
+	defer cancel()
+	if _, err := consumer.Next(ctx); !errors.Is(err, context.DeadlineExceeded) {
+		t.Errorf("expected %v, got %v", context.DeadlineExceeded, err)
+	}
+	if consumer.Late != 1 {
+		t.Errorf("expected 1 late record, got %d", consumer.Late)
+	}
+
+	/* Neither the held record nor the last one returned are committed */
+	if err := consumer.Commit("state"); err != nil {
+		t.Fatal(err)
+	}
+	offsets, err := broker.FetchOffsets("aggregators")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if offsets[0].Offset != 1 {
+		t.Errorf("expected offset 1, got %d", offsets[0].Offset)
+	}
+}
+
+func TestAggregate(t *testing.T) {
+	testcases := []struct {
+		name       string
+		partitions int
+		swapped    bool
+		stopAfter  []int
+	}{
+		{"single partition", 1, false, []int{}},
+		{"several partitions", 3, false, []int{}},
+		{"resumed after every flush", 3, false, []int{5, 20, 21, 30}},
+		{"out of order within the window", 1, true, []int{}},
+		{"out of order across partitions", 2, true, []int{5, 20}},
+	}
+
+	for _, tc := range testcases {
+		t.Run(tc.name, func(t *testing.T) {
+			broker := kafka.NewFakeBroker()
+			broker.CreateTopic("events", tc.partitions)
+
+			/* Events every 23 seconds for an hour, spread over the partitions in turns, with every pair swapped if out of order */
+			start := time.Date(2018, 12, 26, 18, 0, 0, 0, time.UTC)
+			last := start.Add(159 * 23 * time.Second)
+			transactionDeliveredEvents := []events.EventTranslationDelivered{}
+			for i := 0; i < 160; i++ {
+				j := i
+				if tc.swapped {
+					j = i ^ 1
+				}
+				timestamp := start.Add(time.Duration(j) * 23 * time.Second)
+				value := fmt.Sprintf("{\"timestamp\": \"%s\", \"event_name\": \"translation_delivered\", \"duration\": %d}", timestamp.Format(events.InputTimestampFormat), j%37)
+				if _, err := broker.Produce("events", int32(i%tc.partitions), nil, []byte(value)); err != nil {
+					t.Fatal(err)
+				}
+
+				/* Events are held back until one a window newer is consumed, so the last ten minutes aren't aggregated */
+				if !timestamp.After(last.Add(-10 * time.Minute)) {
+					transactionDeliveredEvents = append(transactionDeliveredEvents, events.EventTranslationDelivered{Timestamp: timestamp.Format(events.InputTimestampFormat), Duration: j % 37})
+				}
+			}
+			sort.Slice(transactionDeliveredEvents, func(i, j int) bool {
+				return transactionDeliveredEvents[i].Timestamp < transactionDeliveredEvents[j].Timestamp
+			})
+
+			/* The bucket of the last event aggregated is never complete, so it isn't expected */
+			dataset, err := events.GroupEventsByUnit(context.Background(), transactionDeliveredEvents, time.Minute)
+			if err != nil {
+				t.Fatal(err)
+			}
+			expected := []movingaverage.Point{}
+			statistics.IterateMovingAverage(dataset, 10, func(point statistics.Point) error {
+				expected = append(expected, movingaverage.Point(point))
+				return nil
+			})
+			expected = expected[:len(expected)-1]
+
+			/* Stop the aggregation after some buckets, and resume it with a new consumer of the same group */
+			got := []movingaverage.Point{}
+			stops := append(tc.stopAfter, len(expected))
+			for run, stop := range stops {
+				ctx, cancel := context.WithCancel(context.Background())
+				consumer := kafka.NewConsumer(broker, "aggregators", "events", fmt.Sprintf("member-%d", run))
+				consumer.MaxRecords = 7
+				consumer.PollInterval = time.Millisecond
+
+				emitted := []movingaverage.Point{}
+				err := kafka.Aggregate(ctx, consumer, 10, func(point movingaverage.Point) error {
+					emitted = append(emitted, point)
+					if len(got)+len(emitted) >= stop {
+						cancel()
+					}
+					return nil
+				}, func() error {
+					got = append(got, emitted...)
+					emitted = emitted[:0]
+					return nil
+				})
+				cancel()
+				if !errors.Is(err, context.Canceled) {
+					t.Fatalf("expected %v, got %v", context.Canceled, err)
+				}
+				if err := consumer.Close(); err != nil {
+					t.Fatal(err)
+				}
+				if consumer.Late != 0 {
+					t.Errorf("expected no late records, got %d", consumer.Late)
+				}
+			}
+
+			if !reflect.DeepEqual(got, expected) {
+				t.Errorf("expected %v, got %v", expected, got)
+			}
+		})
+	}
+}
+
+func TestAggregateMaxWindowSize(t *testing.T) {
+	testcases := []struct {
+		name          string
+		windowSize    int
+		expectedError error
+	}{
+		{"valid case - largest window", kafka.MaxWindowSize, context.Canceled},
+		{"invalid case - window too large", kafka.MaxWindowSize + 1, errors.New("Window Size has to be at most 189 to fit the committed metadata, please provide a smaller Window Size.")},
+	}
+
+	for _, tc := range testcases {
+		t.Run(tc.name, func(t *testing.T) {
+			broker := kafka.NewFakeBroker()
+			broker.CreateTopic("events", 1)
+
+			/* An event every minute fills every bucket of the window, so its whole queue is committed */
+			start := time.Date(2018, 12, 26, 18, 0, 0, 0, time.UTC)
+			for i := 0; i < 2*tc.windowSize+2; i++ {
+				produce(t, broker, 0, start.Add(time.Duration(i)*time.Minute).Format(events.InputTimestampFormat))
+			}
+
+			ctx, cancel := context.WithCancel(context.Background())
+			defer cancel()
+			consumer := kafka.NewConsumer(broker, "aggregators", "events", "a")
+			consumer.PollInterval = time.Millisecond
+
+			emitted := 0
+			err := kafka.Aggregate(ctx, consumer, tc.windowSize, func(point movingaverage.Point) error {
+				emitted++
+				return nil
+			}, func() error {
+				if emitted > tc.windowSize {
+					cancel()
+				}
+				return nil
+			})
+			if err.Error() != tc.expectedError.Error() {
+				t.Fatalf("expected %v, got %v", tc.expectedError, err)
+			}
+			if tc.expectedError != context.Canceled {
+				return
+			}
+
+			offsets, err := broker.FetchOffsets("aggregators")
+			if err != nil {
+				t.Fatal(err)
+			}
+			if size := len(offsets[0].Metadata); size == 0 || size > kafka.MaxMetadataSize {
+				t.Errorf("expected metadata of at most %d bytes, got %d", kafka.MaxMetadataSize, size)
+			}
+		})
+	}
+}
+
+func produce(t *testing.T, broker *kafka.FakeBroker, partition int32, timestamp string) {
+	value := fmt.Sprintf("{\"timestamp\": \"%s\", \"duration\": 20}", timestamp)
+	if _, err := broker.Produce("events", partition, nil, []byte(value)); err != nil {
+		t.Fatal(err)
+	}
+}
@@ -0,0 +1,392 @@
+/*
+Package movingaverage calculates the moving average of translation delivery times.
+
+Events are read from files ordered by timestamp, grouped into buckets of a unit of time,
+and the moving average of each bucket is calculated over a window of buckets and encoded as one JSON line per bucket.
+*/
+package movingaverage
+
+import (
+	"context"
+	"errors"
+	"io"
+	"time"
+
+	"github.com/jmbds/unbabel-backend-engineering-challenge/internal/events"
+	"github.com/jmbds/unbabel-backend-engineering-challenge/internal/statistics"
+)
+
+/*
+A struct that holds a translation event, as read from the input.
+
+The types of the package are aliases of the ones the unbabel_cli aggregates with, so they are passed along without conversions.
+*/
+type Event = events.EventTranslationDelivered
+
+/*
+A set of fields of Event, used to select which fields are decoded.
+*/
+type Field = events.Field
+
+const (
+	FieldTimestamp      = events.FieldTimestamp
+	FieldTranslationId  = events.FieldTranslationId
+	FieldSourceLanguage = events.FieldSourceLanguage
+	FieldTargetLanguage = events.FieldTargetLanguage
+	FieldClientName     = events.FieldClientName
+	FieldEventName      = events.FieldEventName
+	FieldDuration       = events.FieldDuration
+	FieldNrWords        = events.FieldNrWords
+
+	/* The fields required to calculate the moving average */
+	DefaultFields = events.DefaultFields
+	AllFields     = events.AllFields
+)
+
+/*
+A struct that holds the total delivery time and number of events in a bucket.
+*/
+type DataPoint = statistics.DataPoint
+
+/*
+A struct that holds a bucket with events and its position in a Dataset.
+*/
+type Bucket = statistics.Bucket
+
+/*
+A struct that holds buckets of events over consecutive intervals of time, storing only the buckets with events.
+
+Length is the number of buckets, including the empty ones, and Buckets the ones with events, ordered by Index.
+Start is the start of the interval of the first bucket, and Unit the length of the interval of each bucket.
+*/
+type Dataset = statistics.SparseDataset
+
+/*
+A struct that holds a value and the interval of time it was calculated for, from Start, inclusive, to End, exclusive.
+*/
+type Point = statistics.Point
+
+/*
+A struct that holds values calculated for consecutive intervals of time.
+
+Consecutive equal values are stored once, so long stretches without events take as much memory as a single value.
+*/
+type TimeSeries struct {
+	series statistics.TimeSeries
+}
+
+/*
+A function that returns the start of the interval of the first value.
+*/
+func (ts TimeSeries) Start() time.Time {
+	return ts.series.Start
+}
+
+/*
+A function that returns the end of the interval of the last value, or the start if the time series is empty.
+*/
+func (ts TimeSeries) End() time.Time {
+	return ts.series.End()
+}
+
+/*
+A function that returns the number of values.
+*/
+func (ts TimeSeries) Len() int {
+	return ts.series.Length
+}
+
+/*
+A function that returns the value at the given index, between 0 and Len, along with its interval.
+*/
+func (ts TimeSeries) At(index int) Point {
+	return ts.series.At(index)
+}
+
+/*
+A function that calls emit with every value along with its interval, in order, stopping at the first error.
+*/
+func (ts TimeSeries) Each(emit func(point Point) error) error {
+	return ts.series.Each(emit)
+}
+
+/*
+A struct that reads, groups and calculates the moving average of events, as configured by its options.
+*/
+type Aggregator struct {
+	config config
+}
+
+/*
+A struct that holds the events read by an Aggregator, grouped into buckets.
+
+Events are the translation_delivered events, in timestamp order, and Dataset their delivery times grouped by unit.
+DuplicatesDropped is the number of events dropped by deduplication,
+UnmatchedDeliveries the number of deliveries dropped for not having a request when joining requests,
+and ExpiredRequests the number of requests dropped for not having a delivery within the join horizon.
+*/
+type Batch struct {
+	Events              []Event
+	Dataset             Dataset
+	DuplicatesDropped   int
+	UnmatchedDeliveries int
+	ExpiredRequests     int
+}
+
+/*
+A function that creates an Aggregator.
+
+Receives the options, applied in order over the defaults.
+Returns the Aggregator and an error if any option is invalid, or if options that can't be combined are set.
+*/
+func New(options ...Option) (*Aggregator, error) {
+	config := defaultConfig()
+	for _, option := range options {
+		if err := option(&config); err != nil {
+			return nil, err
+		}
+	}
+
+	/* Requests and deliveries are joined in timestamp order, which parallel reading doesn't preserve */
+	if config.joinRequests && config.workers > 1 {
+		return nil, errors.New("Parallel reading is not available when joining requests. Please run without --workers.")
+	}
+
+	return &Aggregator{config: config}, nil
+}
+
+/*
+A function that expands a list of paths and glob patterns into the files to read.
+
+Patterns are expanded in lexical order, and paths without any pattern are kept as they are.
+Receives the paths and patterns.
+Returns the list of files and an error if a pattern is malformed or matches no file.
+*/
+func ExpandInputFiles(patterns []string) ([]string, error) {
+	return events.ExpandInputFiles(patterns)
+}
+
+/*
+A function that reads events files and groups their translation_delivered events into buckets.
+
+Several files are merged in timestamp order, and a single file is read in parallel with more than one worker.
+Receives the context, checked while reading and grouping, and the paths to the files, each ordered by timestamp.
+Returns the batch of events and an error.
+*/
+func (a *Aggregator) Read(ctx context.Context, filepaths ...string) (Batch, error) {
+	if len(filepaths) == 0 {
+		return Batch{}, errors.New("No input files. Please provide at least one input file.")
+	}
+	if len(filepaths) > 1 && a.config.workers > 1 {
+		return Batch{}, errors.New("Parallel reading is not available with multiple input files. Please run without --workers.")
+	}
+	var (
+		batch Batch
+		err   error
+	)
+	switch {
+	case a.config.joinRequests:
+		batch, err = a.readAndJoin(ctx, filepaths)
+	case a.config.workers > 1:
+		batch, err = a.readParallel(ctx, filepaths[0])
+	default:
+		batch, err = a.readAndGroup(ctx, filepaths)
+	}
+	if err != nil {
+		return Batch{}, err
+	}
+
+	/* Drop duplicate events, grouping the remaining ones again if any was dropped */
+	if a.config.dedupeKey != "" {
+		batch.Events, batch.DuplicatesDropped = events.DeduplicateEvents(batch.Events)
+		if batch.DuplicatesDropped > 0 {
+			batch.Dataset, err = events.GroupEventsByUnit(ctx, batch.Events, a.config.unit)
+			if err != nil {
+				return Batch{}, err
+			}
+		}
+	}
+
+	return batch, nil
+}
+
+/*
+A function that reads the events files, keeping only the events with a delivery time, and groups them.
+*/
+func (a *Aggregator) readAndGroup(ctx context.Context, filepaths []string) (Batch, error) {
+	var (
+		transactionDeliveredEvents []events.EventTranslationDelivered
+		err                        error
+	)
+	if len(filepaths) == 1 {
+		transactionDeliveredEvents, err = events.ReadEventsFile(ctx, filepaths[0], a.config.fields)
+	} else {
+		transactionDeliveredEvents, err = events.MergeEventsFiles(ctx, filepaths, a.config.fields)
+	}
+	if err != nil {
+		return Batch{}, err
+	}
+	transactionDeliveredEvents = events.FilterDeliveredEvents(transactionDeliveredEvents)
+
+	dataset, err := events.GroupEventsByUnit(ctx, transactionDeliveredEvents, a.config.unit)
+	if err != nil {
+		return Batch{}, err
+	}
+
+	return Batch{Events: transactionDeliveredEvents, Dataset: dataset}, nil
+}
+
+/*
+A function that reads and groups a single events file with several workers.
+*/
+func (a *Aggregator) readParallel(ctx context.Context, filepath string) (Batch, error) {
+	transactionDeliveredEvents, dataset, err := events.ReadAndGroupEventsFile(ctx, filepath, a.config.unit, a.config.workers, a.config.fields)
+	if err != nil {
+		return Batch{}, err
+	}
+
+	/* Other event types were grouped with the delivered events, so group again without them */
+	deliveredEvents := events.FilterDeliveredEvents(transactionDeliveredEvents)
+	if len(deliveredEvents) == len(transactionDeliveredEvents) {
+		return Batch{Events: transactionDeliveredEvents, Dataset: dataset}, nil
+	}
+
+	dataset, err = events.GroupEventsByUnit(ctx, deliveredEvents, a.config.unit)
+	if err != nil {
+		return Batch{}, err
+	}
+
+	return Batch{Events: deliveredEvents, Dataset: dataset}, nil
+}
+
+/*
+A function that reads the events files, derives delivery times by joining requests and deliveries, and groups them.
+*/
+func (a *Aggregator) readAndJoin(ctx context.Context, filepaths []string) (Batch, error) {
+	registeredEvents, err := events.NewRegistry().ReadEventsFiles(ctx, filepaths)
+	if err != nil {
+		return Batch{}, err
+	}
+
+	transactionDeliveredEvents, stats, err := events.JoinDeliveryTimes(registeredEvents, a.config.joinHorizon)
+	if err != nil {
+		return Batch{}, err
+	}
+
+	dataset, err := events.GroupEventsByUnit(ctx, transactionDeliveredEvents, a.config.unit)
+	if err != nil {
+		return Batch{}, err
+	}
+
+	return Batch{Events: transactionDeliveredEvents, Dataset: dataset, UnmatchedDeliveries: stats.Unmatched, ExpiredRequests: stats.Expired}, nil
+}
+
+/*
+A function that groups events into buckets of the configured unit.
+
+Receives the context, checked while grouping, and the events, ordered by timestamp.
+Returns the dataset and an error.
+*/
+func (a *Aggregator) Group(ctx context.Context, transactionDeliveredEvents []Event) (Dataset, error) {
+	return events.GroupEventsByUnit(ctx, transactionDeliveredEvents, a.config.unit)
+}
+
+/*
+A function that calculates the moving average of a dataset over the configured window size.
+
+Receives the context, checked after each bucket, and the dataset.
+Returns the moving average of each bucket and an error.
+*/
+func (a *Aggregator) MovingAverage(ctx context.Context, dataset Dataset) (TimeSeries, error) {
+	movingAverage := statistics.TimeSeries{Start: dataset.Start, Unit: dataset.Unit, Runs: make([]statistics.Run, 0)}
+
+	err := statistics.IterateMovingAverageRuns(dataset, a.config.windowSize, func(run statistics.Run) error {
+		if err := ctx.Err(); err != nil {
+			return err
+		}
+		movingAverage.Append(run.Value, run.Length)
+		return nil
+	})
+	if err != nil {
+		return TimeSeries{}, err
+	}
+
+	return TimeSeries{series: movingAverage}, nil
+}
+
+/*
+A function that calculates the moving average of a dataset, calling a function with each value as soon as it is calculated.
+
+Receives the context, checked after each bucket, the dataset and the function called with each moving average value.
+Returns an error.
+*/
+func (a *Aggregator) Iterate(ctx context.Context, dataset Dataset, emit func(point Point) error) error {
+	return statistics.IterateMovingAverage(dataset, a.config.windowSize, func(point Point) error {
+		if err := ctx.Err(); err != nil {
+			return err
+		}
+		return emit(point)
+	})
+}
+
+/*
+A function that calculates the moving average of a dataset, calling a function with each value and the Total and Count of its window.
+
+Receives the context, checked after each bucket, the dataset and the function called with each moving average value and its window.
+Returns an error.
+*/
+func (a *Aggregator) IterateWindows(ctx context.Context, dataset Dataset, emit func(point Point, window DataPoint) error) error {
+	return statistics.IterateMovingWindowRuns(dataset, a.config.windowSize, func(run statistics.Run, data DataPoint) error {
+		for index := run.Index; index < run.Index+run.Length; index++ {
+			if err := ctx.Err(); err != nil {
+				return err
+			}
+			start := dataset.Start.Add(time.Duration(index) * dataset.Unit)
+			if err := emit(Point{Start: start, End: start.Add(dataset.Unit), Value: run.Value}, data); err != nil {
+				return err
+			}
+		}
+		return nil
+	})
+}
+
+/*
+A function that calculates the moving average of a dataset and encodes each value as soon as it is calculated.
+
+Receives the context, checked after each bucket, the writer and the dataset.
+Returns an error.
+*/
+func (a *Aggregator) Write(ctx context.Context, writer io.Writer, dataset Dataset) error {
+	return a.Iterate(ctx, dataset, NewEncoder(writer).Encode)
+}
+
+/*
+A struct that encodes moving average values as JSON lines, with the date and average_delivery_time of each value.
+*/
+type Encoder struct {
+	writer *events.RecordWriter
+}
+
+/*
+A function that creates an Encoder.
+
+Receives the writer the lines are written to, which should be buffered.
+Returns the Encoder.
+*/
+func NewEncoder(writer io.Writer) *Encoder {
+	return &Encoder{writer: events.NewRecordWriter(writer)}
+}
+
+/*
+A function that encodes a moving average value, dated at the end of its interval.
+*/
+func (e *Encoder) Encode(point Point) error {
+	return e.writer.WritePoint(point)
+}
+
+/*
+A function that returns the number of bytes encoded so far.
+*/
+func (e *Encoder) Written() int64 {
+	return e.writer.Written
+}
@@ -0,0 +1,232 @@
+package movingaverage_test
+
+import (
+	"context"
+	"errors"
+	"os"
+	"reflect"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/jmbds/unbabel-backend-engineering-challenge/pkg/movingaverage"
+)
+
+const expectedOutput = "{\"date\": \"2018-12-26 18:11:00\", \"average_delivery_time\": 0}\n" +
+	"{\"date\": \"2018-12-26 18:12:00\", \"average_delivery_time\": 20}\n" +
+	"{\"date\": \"2018-12-26 18:13:00\", \"average_delivery_time\": 20}\n" +
+	"{\"date\": \"2018-12-26 18:14:00\", \"average_delivery_time\": 20}\n" +
+	"{\"date\": \"2018-12-26 18:15:00\", \"average_delivery_time\": 20}\n" +
+	"{\"date\": \"2018-12-26 18:16:00\", \"average_delivery_time\": 25.5}\n" +
+	"{\"date\": \"2018-12-26 18:17:00\", \"average_delivery_time\": 25.5}\n" +
+	"{\"date\": \"2018-12-26 18:18:00\", \"average_delivery_time\": 25.5}\n" +
+	"{\"date\": \"2018-12-26 18:19:00\", \"average_delivery_time\": 25.5}\n" +
+	"{\"date\": \"2018-12-26 18:20:00\", \"average_delivery_time\": 25.5}\n" +
+	"{\"date\": \"2018-12-26 18:21:00\", \"average_delivery_time\": 25.5}\n" +
+	"{\"date\": \"2018-12-26 18:22:00\", \"average_delivery_time\": 31}\n" +
+	"{\"date\": \"2018-12-26 18:23:00\", \"average_delivery_time\": 31}\n" +
+	"{\"date\": \"2018-12-26 18:24:00\", \"average_delivery_time\": 42.5}\n"
+
+func TestNew(t *testing.T) {
+	testcases := []struct {
+		name          string
+		options       []movingaverage.Option
+		expectedError error
+	}{
+		{"valid case - defaults", []movingaverage.Option{}, errors.New("")},
+		{"valid case - every option", []movingaverage.Option{
+			movingaverage.WithWindowSize(5),
+			movingaverage.WithUnit(time.Hour),
+			movingaverage.WithWorkers(4),
+			movingaverage.WithFields(movingaverage.FieldClientName),
+			movingaverage.WithDedupe("translation_id"),
+			movingaverage.WithJoinHorizon(time.Hour),
+		}, errors.New("")},
+		{"invalid case - window size", []movingaverage.Option{movingaverage.WithWindowSize(0)}, errors.New("Window Size has to be equal or greater than 1, please provide a valid Window Size.")},
+		{"invalid case - unit", []movingaverage.Option{movingaverage.WithUnit(0)}, errors.New("Unit has to be greater than 0, please provide a valid unit.")},
+		{"invalid case - workers", []movingaverage.Option{movingaverage.WithWorkers(0)}, errors.New("Number of workers has to be equal or greater than 1, please provide a valid number of workers.")},
+		{"invalid case - dedupe key", []movingaverage.Option{movingaverage.WithDedupe("client_name")}, errors.New("Invalid deduplication key client_name. Please provide translation_id.")},
+		{"invalid case - join horizon", []movingaverage.Option{movingaverage.WithJoinHorizon(0)}, errors.New("Join horizon has to be greater than 0, please provide a valid join horizon.")},
+		{"invalid case - workers joining requests", []movingaverage.Option{movingaverage.WithWorkers(2), movingaverage.WithJoinRequests(true)}, errors.New("Parallel reading is not available when joining requests. Please run without --workers.")},
+	}
+
+	for _, tc := range testcases {
+		t.Run(tc.name, func(t *testing.T) {
+			_, err := movingaverage.New(tc.options...)
+			if err != nil && err.Error() != tc.expectedError.Error() {
+				t.Errorf("Unexpected error: %s", err.Error())
+			}
+			if err == nil && tc.expectedError.Error() != "" {
+				t.Errorf("expected error %s", tc.expectedError.Error())
+			}
+		})
+	}
+}
+
+func TestAggregatorRead(t *testing.T) {
+	cancelled, cancel := context.WithCancel(context.Background())
+	cancel()
+
+	testcases := []struct {
+		name          string
+		ctx           context.Context
+		options       []movingaverage.Option
+		filepaths     []string
+		expected      int
+		expectedError error
+	}{
+		{"valid case", context.Background(), []movingaverage.Option{}, []string{"testcases/events.json"}, 3, errors.New("")},
+		{"valid case - parallel", context.Background(), []movingaverage.Option{movingaverage.WithWorkers(2)}, []string{"testcases/events.json"}, 3, errors.New("")},
+		{"valid case - merged files", context.Background(), []movingaverage.Option{}, []string{"testcases/events.json", "testcases/events.json"}, 6, errors.New("")},
+		{"valid case - dedupe", context.Background(), []movingaverage.Option{movingaverage.WithDedupe("translation_id")}, []string{"testcases/events.json", "testcases/events.json"}, 3, errors.New("")},
+		{"invalid case - no files", context.Background(), []movingaverage.Option{}, []string{}, 0, errors.New("No input files. Please provide at least one input file.")},
+		{"invalid case - file not found", context.Background(), []movingaverage.Option{}, []string{"testcases/not_found.json"}, 0, errors.New("open testcases/not_found.json: no such file or directory")},
+		{"invalid case - cancelled", cancelled, []movingaverage.Option{}, []string{"testcases/events.json"}, 0, context.Canceled},
+	}
+
+	for _, tc := range testcases {
+		t.Run(tc.name, func(t *testing.T) {
+			aggregator, err := movingaverage.New(tc.options...)
+			if err != nil {
+				t.Fatal(err)
+			}
+
+			got, err := aggregator.Read(tc.ctx, tc.filepaths...)
+			if err != nil && err.Error() != tc.expectedError.Error() {
+				t.Errorf("Unexpected error: %s", err.Error())
+			}
+
+			if len(got.Events) != tc.expected {
+				t.Errorf("expected %d events, got %d", tc.expected, len(got.Events))
+			}
+			if tc.expected > 0 && got.Dataset.Length != 14 {
+				t.Errorf("expected %d buckets, got %d", 14, got.Dataset.Length)
+			}
+		})
+	}
+}
+
+func TestAggregatorReadFields(t *testing.T) {
+	aggregator, err := movingaverage.New(movingaverage.WithFields(movingaverage.FieldClientName))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	batch, err := aggregator.Read(context.Background(), "testcases/events.json")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	/* Only the selected fields are decoded, on top of the ones the moving average needs */
+	expected := movingaverage.Event{Timestamp: "2018-12-26 18:11:08.509654", ClientName: "airliberty", EventName: "translation_delivered", Duration: 20}
+	if len(batch.Events) == 0 || batch.Events[0] != expected {
+		t.Errorf("expected %v, got %v", expected, batch.Events)
+	}
+
+	expectedBucket := movingaverage.Bucket{Index: 1, DataPoint: movingaverage.DataPoint{Total: 20, Count: 1}}
+	if len(batch.Dataset.Buckets) == 0 || batch.Dataset.Buckets[0] != expectedBucket {
+		t.Errorf("expected %v, got %v", expectedBucket, batch.Dataset.Buckets)
+	}
+}
+
+func TestAggregatorWrite(t *testing.T) {
+	aggregator, err := movingaverage.New(movingaverage.WithWindowSize(10))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	batch, err := aggregator.Read(context.Background(), "testcases/events.json")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	got := strings.Builder{}
+	if err := aggregator.Write(context.Background(), &got, batch.Dataset); err != nil {
+		t.Fatal(err)
+	}
+	if got.String() != expectedOutput {
+		t.Errorf("expected %v, got %v", expectedOutput, got.String())
+	}
+
+	movingAverage, err := aggregator.MovingAverage(context.Background(), batch.Dataset)
+	if err != nil {
+		t.Fatal(err)
+	}
+	expected := []float64{0, 20, 20, 20, 20, 25.5, 25.5, 25.5, 25.5, 25.5, 25.5, 31, 31, 42.5}
+	for i := range expected {
+		if point := movingAverage.At(i); point.Value != expected[i] {
+			t.Errorf("expected %v at %d, got %v", expected[i], i, point.Value)
+		}
+	}
+	if movingAverage.Len() != len(expected) {
+		t.Errorf("expected %d values, got %d", len(expected), movingAverage.Len())
+	}
+
+	values := make([]float64, 0, len(expected))
+	err = movingAverage.Each(func(point movingaverage.Point) error {
+		values = append(values, point.Value)
+		return nil
+	})
+	if err != nil || !reflect.DeepEqual(values, expected) {
+		t.Errorf("expected %v, got %v and %v", expected, values, err)
+	}
+
+	/* Each value comes with the Total and Count of its window, which it is the average of */
+	windows := []movingaverage.DataPoint{}
+	err = aggregator.IterateWindows(context.Background(), batch.Dataset, func(point movingaverage.Point, window movingaverage.DataPoint) error {
+		if window.Count > 0 && point.Value != window.Total/float64(window.Count) {
+			t.Errorf("expected %v at %v, got %v", window.Total/float64(window.Count), point.End, point.Value)
+		}
+		windows = append(windows, window)
+		return nil
+	})
+	if err != nil || len(windows) != len(expected) || windows[len(windows)-1] != (movingaverage.DataPoint{Total: 85, Count: 2}) {
+		t.Errorf("expected %d windows ending with 85 over 2 events, got %v and %v", len(expected), windows, err)
+	}
+
+	/* A cancelled context stops writing after the current bucket */
+	ctx, cancel := context.WithCancel(context.Background())
+	count := 0
+	err = aggregator.Iterate(ctx, batch.Dataset, func(point movingaverage.Point) error {
+		count++
+		cancel()
+		return nil
+	})
+	if !errors.Is(err, context.Canceled) {
+		t.Errorf("expected %v, got %v", context.Canceled, err)
+	}
+	if count != 1 {
+		t.Errorf("expected %d values, got %d", 1, count)
+	}
+}
+
+func Example() {
+	aggregator, err := movingaverage.New(movingaverage.WithWindowSize(10), movingaverage.WithUnit(time.Minute))
+	if err != nil {
+		panic(err)
+	}
+
+	batch, err := aggregator.Read(context.Background(), "testcases/events.json")
+	if err != nil {
+		panic(err)
+	}
+
+	if err := aggregator.Write(context.Background(), os.Stdout, batch.Dataset); err != nil {
+		panic(err)
+	}
+	// Output:
+	// {"date": "2018-12-26 18:11:00", "average_delivery_time": 0}
+	// {"date": "2018-12-26 18:12:00", "average_delivery_time": 20}
+	// {"date": "2018-12-26 18:13:00", "average_delivery_time": 20}
+	// {"date": "2018-12-26 18:14:00", "average_delivery_time": 20}
+	// {"date": "2018-12-26 18:15:00", "average_delivery_time": 20}
+	// {"date": "2018-12-26 18:16:00", "average_delivery_time": 25.5}
+	// {"date": "2018-12-26 18:17:00", "average_delivery_time": 25.5}
+	// {"date": "2018-12-26 18:18:00", "average_delivery_time": 25.5}
+	// {"date": "2018-12-26 18:19:00", "average_delivery_time": 25.5}
+	// {"date": "2018-12-26 18:20:00", "average_delivery_time": 25.5}
+	// {"date": "2018-12-26 18:21:00", "average_delivery_time": 25.5}
+	// {"date": "2018-12-26 18:22:00", "average_delivery_time": 31}
+	// {"date": "2018-12-26 18:23:00", "average_delivery_time": 31}
+	// {"date": "2018-12-26 18:24:00", "average_delivery_time": 42.5}
+}
@@ -0,0 +1,131 @@
+package movingaverage
+
+import (
+	"errors"
+	"time"
+
+	"github.com/jmbds/unbabel-backend-engineering-challenge/internal/events"
+)
+
+/*
+A function that configures an Aggregator.
+*/
+type Option func(*config) error
+
+/*
+A struct that holds the configuration of an Aggregator.
+*/
+type config struct {
+	windowSize   int
+	unit         time.Duration
+	workers      int
+	fields       Field
+	dedupeKey    string
+	joinRequests bool
+	joinHorizon  time.Duration
+}
+
+/*
+A function that returns the default configuration, matching the unbabel_cli defaults.
+*/
+func defaultConfig() config {
+	return config{
+		windowSize:  10,
+		unit:        time.Minute,
+		workers:     1,
+		fields:      DefaultFields | FieldEventName,
+		joinHorizon: 24 * time.Hour,
+	}
+}
+
+/*
+A function that sets the number of buckets the moving average is calculated over. Defaults to 10.
+*/
+func WithWindowSize(windowSize int) Option {
+	return func(c *config) error {
+		if windowSize < 1 {
+			return errors.New("Window Size has to be equal or greater than 1, please provide a valid Window Size.")
+		}
+		c.windowSize = windowSize
+		return nil
+	}
+}
+
+/*
+A function that sets the interval of time covered by each bucket. Defaults to a minute.
+*/
+func WithUnit(unit time.Duration) Option {
+	return func(c *config) error {
+		if unit <= 0 {
+			return errors.New("Unit has to be greater than 0, please provide a valid unit.")
+		}
+		c.unit = unit
+		return nil
+	}
+}
+
+/*
+A function that sets the number of workers reading a single input file in parallel. Defaults to 1.
+*/
+func WithWorkers(workers int) Option {
+	return func(c *config) error {
+		if workers < 1 {
+			return errors.New("Number of workers has to be equal or greater than 1, please provide a valid number of workers.")
+		}
+		c.workers = workers
+		return nil
+	}
+}
+
+/*
+A function that adds fields to decode from each event, on top of the ones the moving average needs.
+
+Fields that are not decoded are left empty in the events returned by Read.
+*/
+func WithFields(fields Field) Option {
+	return func(c *config) error {
+		c.fields |= fields
+		return nil
+	}
+}
+
+/*
+A function that drops events with the same key as an earlier event. The only key available is translation_id.
+*/
+func WithDedupe(key string) Option {
+	return func(c *config) error {
+		if err := events.ValidateDedupeKey(key); err != nil {
+			return err
+		}
+		c.dedupeKey = key
+		if key == events.DedupeKeyTranslationId {
+			c.fields |= FieldTranslationId
+		}
+		return nil
+	}
+}
+
+/*
+A function that derives delivery times from the translation_requested event of each translation, instead of the duration field.
+*/
+func WithJoinRequests(joinRequests bool) Option {
+	return func(c *config) error {
+		c.joinRequests = joinRequests
+		return nil
+	}
+}
+
+/*
+A function that sets how long a translation_requested event waits for its delivery when joining requests. Defaults to 24h.
+
+The horizon is independent of the window size: requests pending for longer are dropped and counted in ExpiredRequests.
+*/
+func WithJoinHorizon(horizon time.Duration) Option {
+	return func(c *config) error {
+		if horizon <= 0 {
+			return errors.New("Join horizon has to be greater than 0, please provide a valid join horizon.")
+		}
+		c.joinHorizon = horizon
+		return nil
+	}
+}
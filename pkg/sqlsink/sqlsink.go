@@ -0,0 +1,206 @@
+/*
+Package sqlsink writes moving average values to a SQL table, so they can be queried by other tools.
+
+It only depends on database/sql, so the driver of the database, like SQLite or PostgreSQL, is registered by the program using it.
+Each value is upserted by its interval, group key and window size, so writing the same values again leaves the table unchanged,
+along with the total delivery time and number of events of its window, so averages over longer periods can be derived from the table.
+*/
+package sqlsink
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"strconv"
+	"strings"
+
+	"github.com/jmbds/unbabel-backend-engineering-challenge/pkg/movingaverage"
+)
+
+/*
+The SQL dialect of a database, which sets how query parameters are written.
+*/
+type Dialect int
+
+const (
+	/* SQLite 3.24 or later, with ? parameters */
+	DialectSQLite Dialect = iota
+	/* PostgreSQL 9.5 or later, with $1 parameters */
+	DialectPostgres
+)
+
+/*
+A function that returns the dialect for the name of a database, sqlite or postgres.
+
+Returns the dialect and an error if the name is unknown.
+*/
+func ParseDialect(name string) (Dialect, error) {
+	switch strings.ToLower(name) {
+	case "sqlite", "sqlite3":
+		return DialectSQLite, nil
+	case "postgres", "postgresql":
+		return DialectPostgres, nil
+	}
+	return DialectSQLite, errors.New("Unknown SQL dialect " + name + ". Please provide sqlite or postgres.")
+}
+
+/*
+A function that returns the query parameter at a position, starting at 1.
+*/
+func (d Dialect) parameter(position int) string {
+	if d == DialectPostgres {
+		return "$" + strconv.Itoa(position)
+	}
+	return "?"
+}
+
+/*
+A struct that upserts moving average values into a table of a database.
+*/
+type Sink struct {
+	db      *sql.DB
+	dialect Dialect
+	table   string
+}
+
+/*
+A function that creates a Sink, creating its table if it doesn't exist yet.
+
+The table has one row per value, keyed by the end of its interval, the group key and the window size,
+with the average, the total delivery time and the number of events of its window.
+Receives the context, the database, its dialect and the name of the table, made only of letters, digits and underscores.
+Returns the Sink and an error.
+*/
+func New(ctx context.Context, db *sql.DB, dialect Dialect, table string) (*Sink, error) {
+	if !validIdentifier(table) {
+		return nil, errors.New("Invalid table name " + table + ". Please provide a name made only of letters, digits and underscores.")
+	}
+
+	sink := &Sink{db: db, dialect: dialect, table: table}
+	if _, err := db.ExecContext(ctx, sink.schema()); err != nil {
+		return nil, err
+	}
+
+	return sink, nil
+}
+
+/*
+A function that returns the statement creating the table.
+*/
+func (s *Sink) schema() string {
+	return "CREATE TABLE IF NOT EXISTS " + s.table + " (" +
+		"bucket_start TIMESTAMP NOT NULL, " +
+		"bucket_end TIMESTAMP NOT NULL, " +
+		"group_key VARCHAR(255) NOT NULL, " +
+		"window_size INTEGER NOT NULL, " +
+		"average_delivery_time DOUBLE PRECISION NOT NULL, " +
+		"window_total_delivery_time DOUBLE PRECISION NOT NULL, " +
+		"window_events INTEGER NOT NULL, " +
+		"PRIMARY KEY (bucket_end, group_key, window_size))"
+}
+
+/*
+A function that returns the statement upserting a value.
+*/
+func (s *Sink) upsert() string {
+	parameters := make([]string, 7)
+	for i := range parameters {
+		parameters[i] = s.dialect.parameter(i + 1)
+	}
+
+	return "INSERT INTO " + s.table + " (bucket_start, bucket_end, group_key, window_size, average_delivery_time, window_total_delivery_time, window_events) " +
+		"VALUES (" + strings.Join(parameters, ", ") + ") " +
+		"ON CONFLICT (bucket_end, group_key, window_size) DO UPDATE SET " +
+		"bucket_start = excluded.bucket_start, average_delivery_time = excluded.average_delivery_time, " +
+		"window_total_delivery_time = excluded.window_total_delivery_time, window_events = excluded.window_events"
+}
+
+/*
+A struct that upserts the values of a moving average in a single transaction.
+
+Values are only visible to other readers once the batch is committed, and none of them are written if it is aborted.
+*/
+type Batch struct {
+	ctx        context.Context
+	tx         *sql.Tx
+	statement  *sql.Stmt
+	group      string
+	windowSize int
+	Rows       int
+}
+
+/*
+A function that starts a batch of values of a moving average.
+
+Receives the context, the group key of the values, like a client name or an empty string for every event, and the window size they were calculated over.
+Returns the Batch and an error.
+*/
+func (s *Sink) Begin(ctx context.Context, group string, windowSize int) (*Batch, error) {
+	tx, err := s.db.BeginTx(ctx, nil)
+	if err != nil {
+		return nil, err
+	}
+
+	statement, err := tx.PrepareContext(ctx, s.upsert())
+	if err != nil {
+		tx.Rollback()
+		return nil, err
+	}
+
+	return &Batch{ctx: ctx, tx: tx, statement: statement, group: group, windowSize: windowSize}, nil
+}
+
+/*
+A function that sets the group key of the values written next, so the values of several groups are written in the same transaction.
+*/
+func (b *Batch) SetGroup(group string) {
+	b.group = group
+}
+
+/*
+A function that upserts a moving average value with the Total and Count of its window,
+so it can be used as the function called with each value by movingaverage.Aggregator.IterateWindows.
+*/
+func (b *Batch) Write(point movingaverage.Point, window movingaverage.DataPoint) error {
+	_, err := b.statement.ExecContext(b.ctx, point.Start.UTC(), point.End.UTC(), b.group, b.windowSize, point.Value, window.Total, window.Count)
+	if err != nil {
+		return err
+	}
+
+	b.Rows++
+	return nil
+}
+
+/*
+A function that commits the values written.
+*/
+func (b *Batch) Commit() error {
+	b.statement.Close()
+	return b.tx.Commit()
+}
+
+/*
+A function that discards the values written.
+*/
+func (b *Batch) Abort() error {
+	b.statement.Close()
+	return b.tx.Rollback()
+}
+
+/*
+A function that checks a name is a valid SQL identifier, so it can be written in a statement without quoting.
+*/
+func validIdentifier(name string) bool {
+	if name == "" {
+		return false
+	}
+	for i, c := range name {
+		switch {
+		case c == '_', c >= 'a' && c <= 'z', c >= 'A' && c <= 'Z':
+		case c >= '0' && c <= '9' && i > 0:
+		default:
+			return false
+		}
+	}
+	return true
+}
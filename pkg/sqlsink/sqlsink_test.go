@@ -0,0 +1,316 @@
+package sqlsink_test
+
+import (
+	"context"
+	"database/sql"
+	"database/sql/driver"
+	"errors"
+	"path/filepath"
+	"reflect"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/jmbds/unbabel-backend-engineering-challenge/pkg/movingaverage"
+	"github.com/jmbds/unbabel-backend-engineering-challenge/pkg/sqlsink"
+	_ "modernc.org/sqlite"
+)
+
+/*
+A database/sql driver that records the statements executed, with their arguments, and the transactions committed or rolled back.
+*/
+type recordingDriver struct {
+	mutex      sync.Mutex
+	statements []recordedStatement
+	commits    int
+	rollbacks  int
+}
+
+type recordedStatement struct {
+	query string
+	args  []driver.Value
+}
+
+type recordingConn struct{ driver *recordingDriver }
+type recordingStmt struct {
+	driver *recordingDriver
+	query  string
+}
+type recordingTx struct{ driver *recordingDriver }
+
+func (d *recordingDriver) Open(name string) (driver.Conn, error) {
+	return &recordingConn{driver: d}, nil
+}
+
+func (c *recordingConn) Prepare(query string) (driver.Stmt, error) {
+	return &recordingStmt{driver: c.driver, query: query}, nil
+}
+func (c *recordingConn) Close() error              { return nil }
+func (c *recordingConn) Begin() (driver.Tx, error) { return &recordingTx{driver: c.driver}, nil }
+
+func (s *recordingStmt) Close() error  { return nil }
+func (s *recordingStmt) NumInput() int { return -1 }
+func (s *recordingStmt) Exec(args []driver.Value) (driver.Result, error) {
+	s.driver.mutex.Lock()
+	defer s.driver.mutex.Unlock()
+	s.driver.statements = append(s.driver.statements, recordedStatement{query: s.query, args: args})
+	return driver.RowsAffected(1), nil
+}
+func (s *recordingStmt) Query(args []driver.Value) (driver.Rows, error) {
+	return nil, errors.New("Queries are not supported.")
+}
+
+func (t *recordingTx) Commit() error {
+	t.driver.mutex.Lock()
+	defer t.driver.mutex.Unlock()
+	t.driver.commits++
+	return nil
+}
+func (t *recordingTx) Rollback() error {
+	t.driver.mutex.Lock()
+	defer t.driver.mutex.Unlock()
+	t.driver.rollbacks++
+	return nil
+}
+
+var recorder = &recordingDriver{}
+
+func init() {
+	sql.Register("recording", recorder)
+}
+
+/*
+A function that opens a database on the recording driver, forgetting everything recorded so far.
+*/
+func openRecording(t *testing.T) *sql.DB {
+	recorder.mutex.Lock()
+	recorder.statements, recorder.commits, recorder.rollbacks = nil, 0, 0
+	recorder.mutex.Unlock()
+
+	db, err := sql.Open("recording", "")
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() { db.Close() })
+	return db
+}
+
+func TestParseDialect(t *testing.T) {
+	testcases := []struct {
+		name          string
+		input         string
+		expected      sqlsink.Dialect
+		expectedError error
+	}{
+		{"sqlite", "sqlite", sqlsink.DialectSQLite, nil},
+		{"sqlite3", "SQLite3", sqlsink.DialectSQLite, nil},
+		{"postgres", "postgres", sqlsink.DialectPostgres, nil},
+		{"postgresql", "PostgreSQL", sqlsink.DialectPostgres, nil},
+		{"unknown dialect", "mysql", sqlsink.DialectSQLite, errors.New("Unknown SQL dialect mysql. Please provide sqlite or postgres.")},
+	}
+
+	for _, tc := range testcases {
+		t.Run(tc.name, func(t *testing.T) {
+			got, err := sqlsink.ParseDialect(tc.input)
+			if (err != nil) != (tc.expectedError != nil) || (err != nil && err.Error() != tc.expectedError.Error()) {
+				t.Fatalf("expected error %v, got %v", tc.expectedError, err)
+			}
+			if got != tc.expected {
+				t.Errorf("expected %v, got %v", tc.expected, got)
+			}
+		})
+	}
+}
+
+func TestNew(t *testing.T) {
+	testcases := []struct {
+		name          string
+		table         string
+		expectedError error
+	}{
+		{"valid table", "moving_averages", nil},
+		{"table with digits", "averages_2018", nil},
+		{"empty table", "", errors.New("Invalid table name . Please provide a name made only of letters, digits and underscores.")},
+		{"table starting with a digit", "2018_averages", errors.New("Invalid table name 2018_averages. Please provide a name made only of letters, digits and underscores.")},
+		{"injected table", "averages; DROP TABLE users", errors.New("Invalid table name averages; DROP TABLE users. Please provide a name made only of letters, digits and underscores.")},
+	}
+
+	for _, tc := range testcases {
+		t.Run(tc.name, func(t *testing.T) {
+			db := openRecording(t)
+
+			_, err := sqlsink.New(context.Background(), db, sqlsink.DialectSQLite, tc.table)
+			if (err != nil) != (tc.expectedError != nil) || (err != nil && err.Error() != tc.expectedError.Error()) {
+				t.Fatalf("expected error %v, got %v", tc.expectedError, err)
+			}
+			if err != nil {
+				if len(recorder.statements) != 0 {
+					t.Errorf("expected no statements, got %v", recorder.statements)
+				}
+				return
+			}
+
+			if len(recorder.statements) != 1 || !strings.HasPrefix(recorder.statements[0].query, "CREATE TABLE IF NOT EXISTS "+tc.table+" (") {
+				t.Errorf("expected the table to be created, got %v", recorder.statements)
+			}
+		})
+	}
+}
+
+func TestBatch(t *testing.T) {
+	end := time.Date(2018, 12, 26, 18, 12, 0, 0, time.UTC)
+	points := []movingaverage.Point{
+		{Start: end.Add(-time.Minute), End: end, Value: 20},
+		{Start: end, End: end.Add(time.Minute), Value: 25.5},
+	}
+	windows := []movingaverage.DataPoint{{Total: 20, Count: 1}, {Total: 51, Count: 2}}
+
+	testcases := []struct {
+		name              string
+		dialect           sqlsink.Dialect
+		commit            bool
+		expectedParameter string
+		expectedCommits   int
+		expectedRollbacks int
+	}{
+		{"sqlite committed", sqlsink.DialectSQLite, true, "VALUES (?, ?, ?, ?, ?, ?, ?)", 1, 0},
+		{"postgres committed", sqlsink.DialectPostgres, true, "VALUES ($1, $2, $3, $4, $5, $6, $7)", 1, 0},
+		{"aborted", sqlsink.DialectSQLite, false, "VALUES (?, ?, ?, ?, ?, ?, ?)", 0, 1},
+	}
+
+	for _, tc := range testcases {
+		t.Run(tc.name, func(t *testing.T) {
+			db := openRecording(t)
+
+			sink, err := sqlsink.New(context.Background(), db, tc.dialect, "moving_averages")
+			if err != nil {
+				t.Fatal(err)
+			}
+
+			batch, err := sink.Begin(context.Background(), "airliberty", 10)
+			if err != nil {
+				t.Fatal(err)
+			}
+			for i, point := range points {
+				if err := batch.Write(point, windows[i]); err != nil {
+					t.Fatal(err)
+				}
+			}
+			if tc.commit {
+				err = batch.Commit()
+			} else {
+				err = batch.Abort()
+			}
+			if err != nil {
+				t.Fatal(err)
+			}
+
+			if batch.Rows != len(points) {
+				t.Errorf("expected %d rows, got %d", len(points), batch.Rows)
+			}
+			if recorder.commits != tc.expectedCommits || recorder.rollbacks != tc.expectedRollbacks {
+				t.Errorf("expected %d commits and %d rollbacks, got %d and %d", tc.expectedCommits, tc.expectedRollbacks, recorder.commits, recorder.rollbacks)
+			}
+
+			/* The schema is followed by one upsert per value */
+			upserts := recorder.statements[1:]
+			if len(upserts) != len(points) {
+				t.Fatalf("expected %d upserts, got %v", len(points), upserts)
+			}
+			for i, upsert := range upserts {
+				if !strings.Contains(upsert.query, tc.expectedParameter) || !strings.Contains(upsert.query, "ON CONFLICT (bucket_end, group_key, window_size) DO UPDATE SET") {
+					t.Errorf("expected an upsert, got %s", upsert.query)
+				}
+
+				expectedArgs := []driver.Value{points[i].Start, points[i].End, "airliberty", int64(10), points[i].Value, windows[i].Total, int64(windows[i].Count)}
+				if !reflect.DeepEqual(upsert.args, expectedArgs) {
+					t.Errorf("expected %v, got %v", expectedArgs, upsert.args)
+				}
+			}
+		})
+	}
+}
+
+func TestSinkSQLite(t *testing.T) {
+	db, err := sql.Open("sqlite", filepath.Join(t.TempDir(), "averages.db"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer db.Close()
+
+	sink, err := sqlsink.New(context.Background(), db, sqlsink.DialectSQLite, "moving_averages")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	end := time.Date(2018, 12, 26, 18, 12, 0, 0, time.UTC)
+	write := func(values []float64, commit bool) {
+		batch, err := sink.Begin(context.Background(), "airliberty", 10)
+		if err != nil {
+			t.Fatal(err)
+		}
+		for i, value := range values {
+			start := end.Add(time.Duration(i-1) * time.Minute)
+			if err := batch.Write(movingaverage.Point{Start: start, End: start.Add(time.Minute), Value: value}, movingaverage.DataPoint{Total: 2 * value, Count: 2}); err != nil {
+				t.Fatal(err)
+			}
+		}
+		if commit {
+			err = batch.Commit()
+		} else {
+			err = batch.Abort()
+		}
+		if err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	testcases := []struct {
+		name     string
+		values   []float64
+		commit   bool
+		expected []float64
+	}{
+		{"inserted", []float64{20, 25.5}, true, []float64{20, 25.5}},
+		{"upserted", []float64{20, 31, 42.5}, true, []float64{20, 31, 42.5}},
+		{"aborted", []float64{0, 0, 0, 0}, false, []float64{20, 31, 42.5}},
+	}
+
+	for _, tc := range testcases {
+		t.Run(tc.name, func(t *testing.T) {
+			write(tc.values, tc.commit)
+
+			rows, err := db.Query("SELECT bucket_end, group_key, window_size, average_delivery_time, window_total_delivery_time, window_events FROM moving_averages ORDER BY bucket_end")
+			if err != nil {
+				t.Fatal(err)
+			}
+			defer rows.Close()
+
+			got := []float64{}
+			for rows.Next() {
+				var (
+					bucketEnd time.Time
+					group     string
+					window    int
+					average   float64
+					total     float64
+					events    int
+				)
+				if err := rows.Scan(&bucketEnd, &group, &window, &average, &total, &events); err != nil {
+					t.Fatal(err)
+				}
+				if !bucketEnd.Equal(end.Add(time.Duration(len(got))*time.Minute)) || group != "airliberty" || window != 10 || total != 2*average || events != 2 {
+					t.Errorf("unexpected row %v %s %d %v %v %d", bucketEnd, group, window, average, total, events)
+				}
+				got = append(got, average)
+			}
+			if err := rows.Err(); err != nil {
+				t.Fatal(err)
+			}
+			if !reflect.DeepEqual(got, tc.expected) {
+				t.Errorf("expected %v, got %v", tc.expected, got)
+			}
+		})
+	}
+}
@@ -0,0 +1,206 @@
+package main
+
+import (
+	"bufio"
+	"context"
+	"errors"
+	"flag"
+	"fmt"
+	"net"
+	"net/http"
+	"os"
+	"time"
+
+	"github.com/jmbds/unbabel-backend-engineering-challenge/internal/events"
+	"github.com/jmbds/unbabel-backend-engineering-challenge/internal/metrics"
+	"github.com/jmbds/unbabel-backend-engineering-challenge/internal/sla"
+	"github.com/jmbds/unbabel-backend-engineering-challenge/internal/statistics"
+)
+
+/* Time given to in-flight scrapes to complete when the server stops */
+const shutdownTimeout = 5 * time.Second
+
+/*
+A function that runs the serve subcommand, following the input file and exposing metrics of the aggregation on /metrics.
+
+The moving average of each minute is written to the output file as soon as the minute is complete,
+and SLA breaches are notified as soon as the minute that starts them is complete.
+Lines that can't be aggregated are counted as parse errors and skipped, instead of stopping the aggregation.
+Receives the context, which stops the server when cancelled, and the subcommand arguments.
+Returns an error, which is an interruption once the server was started.
+*/
+func runServe(ctx context.Context, args []string) error {
+	var (
+		inputFilepath  string
+		outputFilepath string
+		windowSize     int
+		listenAddress  string
+		pollInterval   time.Duration
+		slaValue       string
+		notifications  hookFlags
+	)
+
+	flags := flag.NewFlagSet("unbabel_cli serve", flag.ExitOnError)
+	flags.StringVar(&inputFilepath, "input_file", "events.json", "path to input file containing events, followed as it grows or is rotated")
+	flags.StringVar(&outputFilepath, "output_file", "aggregated_events.out.json", "path to aggregated output file")
+	flags.IntVar(&windowSize, "window_size", 10, "size of time window for moving average")
+	flags.StringVar(&listenAddress, "listen", ":9100", "address to serve /metrics on")
+	flags.DurationVar(&pollInterval, "poll_interval", time.Second, "wait before reading the input file again once its end is reached")
+	flags.StringVar(&slaValue, "sla", "", "SLA threshold, or path to file with global and per-client thresholds")
+	notifications.register(flags)
+	if err := flags.Parse(args); err != nil {
+		return err
+	}
+	if pollInterval <= 0 {
+		return errors.New("Poll interval has to be greater than 0, please provide a valid poll interval.")
+	}
+
+	collector := metrics.NewCollector(windowSize, time.Now)
+	aggregator, err := events.NewStreamAggregator(windowSize, time.Minute, nil)
+	if err != nil {
+		return err
+	}
+
+	/* Breaches are notified while following, so the SLA is only useful with a webhook or a command */
+	var monitor *slaMonitor
+	if slaValue != "" {
+		notifier, err := notifications.notifier(outputFilepath, windowSize)
+		if err != nil {
+			return err
+		}
+		if notifier == nil {
+			return errors.New("SLA breaches are only notified while serving. Please provide --sla_webhook or --sla_command.")
+		}
+		if monitor, err = newSLAMonitor(slaValue, notifier); err != nil {
+			return err
+		}
+	}
+	clientAggregators, err := newClientAggregators(ctx, monitor, windowSize)
+	if err != nil {
+		return err
+	}
+
+	/* The input file is opened again when following it, but a missing one is reported before serving */
+	if _, err := os.Stat(inputFilepath); err != nil {
+		return err
+	}
+
+	output, err := os.Create(outputFilepath)
+	if err != nil {
+		return err
+	}
+	defer output.Close()
+
+	/* Flush each record as soon as it is written, so the output file is as current as the metrics */
+	writer := bufio.NewWriter(output)
+	recordWriter := events.NewRecordWriter(writer)
+	aggregator.Emit = func(point statistics.Point) error {
+		if err := point.Each(aggregator.Unit, recordWriter.WritePoint); err != nil {
+			return err
+		}
+		collector.ObservePoint(point, point.Units(aggregator.Unit), aggregator.Window.Data)
+		if monitor != nil {
+			monitor.Observe(ctx, point)
+			reportNotifyErrors(monitor)
+		}
+		return writer.Flush()
+	}
+
+	listener, err := net.Listen("tcp", listenAddress)
+	if err != nil {
+		return err
+	}
+
+	mux := http.NewServeMux()
+	mux.Handle("/metrics", collector)
+	server := &http.Server{Handler: mux}
+	go server.Serve(listener)
+	defer func() {
+		shutdownCtx, cancel := context.WithTimeout(context.Background(), shutdownTimeout)
+		defer cancel()
+		server.Shutdown(shutdownCtx)
+	}()
+	fmt.Printf("Serving metrics on http://%s/metrics\n", listener.Addr())
+
+	count := 0
+	raw := events.RawEvent{}
+	fields := events.DefaultFields | events.FieldEventName | events.FieldClientName | events.FieldSourceLanguage | events.FieldTargetLanguage
+
+	err = events.FollowEventsFile(ctx, inputFilepath, pollInterval, func(line []byte) error {
+		if err := events.DecodeRawEvent(line, fields, &raw); err != nil {
+			collector.ObserveParseError(metrics.ReasonInvalidJson)
+			return nil
+		}
+
+		/* Only translation_delivered events carry a delivery time */
+		event := raw.Event()
+		if !events.IsDelivered(event) {
+			return nil
+		}
+
+		timestamp, err := raw.Time()
+		if err != nil {
+			collector.ObserveParseError(metrics.ReasonInvalidTimestamp)
+			return nil
+		}
+
+		err = aggregator.Add(event)
+		if errors.Is(err, events.ErrUnorderedEvents) {
+			collector.ObserveParseError(metrics.ReasonUnorderedTimestamp)
+			return nil
+		}
+		if err != nil {
+			return err
+		}
+
+		if clientAggregator, ok := clientAggregators[event.ClientName]; ok {
+			if err := clientAggregator.Add(event); err != nil {
+				return err
+			}
+		}
+
+		collector.ObserveEvent(event, timestamp)
+		count++
+		return nil
+	})
+
+	return interrupted(err, fmt.Sprintf("Read %d events and wrote %d minutes to %s.", count, recordWriter.Records, outputFilepath))
+}
+
+/*
+A function that creates a stream aggregator for each client with an SLA threshold,
+evaluating the moving average of the client's events against its threshold as it is calculated.
+
+Receives the context, the SLA monitor or nil, and the window size.
+Returns the stream aggregator of each client and an error.
+*/
+func newClientAggregators(ctx context.Context, monitor *slaMonitor, windowSize int) (map[string]*events.StreamAggregator, error) {
+	clientAggregators := make(map[string]*events.StreamAggregator)
+	if monitor == nil {
+		return clientAggregators, nil
+	}
+
+	for _, client := range monitor.clients() {
+		detector := sla.NewDetector(client, monitor.config.Clients[client])
+		aggregator, err := events.NewStreamAggregator(windowSize, time.Minute, func(point statistics.Point) error {
+			monitor.observe(ctx, detector, point)
+			reportNotifyErrors(monitor)
+			return nil
+		})
+		if err != nil {
+			return nil, err
+		}
+		clientAggregators[client] = aggregator
+	}
+	return clientAggregators, nil
+}
+
+/*
+A function that prints the notifications that could not be delivered, so a failing webhook doesn't stop the server.
+*/
+func reportNotifyErrors(monitor *slaMonitor) {
+	for _, err := range monitor.notifyErrors {
+		fmt.Fprintf(os.Stderr, "SLA breach notification failed: %s\n", err)
+	}
+	monitor.notifyErrors = monitor.notifyErrors[:0]
+}
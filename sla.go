@@ -0,0 +1,187 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"flag"
+	"sort"
+	"time"
+
+	"github.com/jmbds/unbabel-backend-engineering-challenge/internal/hooks"
+	"github.com/jmbds/unbabel-backend-engineering-challenge/internal/output"
+	"github.com/jmbds/unbabel-backend-engineering-challenge/internal/sla"
+	"github.com/jmbds/unbabel-backend-engineering-challenge/internal/statistics"
+	"github.com/jmbds/unbabel-backend-engineering-challenge/pkg/movingaverage"
+)
+
+/*
+A struct that holds the flags configuring SLA breach notifications, shared by the moving average and the serve subcommand.
+*/
+type hookFlags struct {
+	webhook   string
+	command   string
+	retries   int
+	backoff   time.Duration
+	stateFile string
+}
+
+/*
+A function that registers the SLA breach notification flags.
+*/
+func (f *hookFlags) register(flags *flag.FlagSet) {
+	flags.StringVar(&f.webhook, "sla_webhook", "", "URL to POST SLA breaches to")
+	flags.StringVar(&f.command, "sla_command", "", "command to execute on SLA breaches, receiving the breach on stdin")
+	flags.IntVar(&f.retries, "hook_retries", 3, "number of retries for failed SLA breach notifications")
+	flags.DurationVar(&f.backoff, "hook_backoff", time.Second, "wait before the first retry of a failed SLA breach notification, doubled on each retry")
+	flags.StringVar(&f.stateFile, "hook_state_file", "", "path to the file of SLA breaches already notified, so later runs don't notify them again, next to the output file by default")
+}
+
+/*
+A function that creates the notifier configured by the flags.
+
+Breaches are remembered next to the output file unless a state file is set, so runs writing different outputs don't share them,
+and only for a window past the latest breach delivered, so the state doesn't grow forever.
+Receives the path to the output file and the window size, in minutes.
+Returns the notifier, or nil if neither a webhook nor a command is set, and an error.
+*/
+func (f *hookFlags) notifier(outputFilepath string, windowSize int) (*hooks.Notifier, error) {
+	if f.webhook == "" && f.command == "" {
+		return nil, nil
+	}
+
+	stateFile := f.stateFile
+	if stateFile == "" {
+		stateFile = outputFilepath + ".sla_notifications.json"
+	}
+	notifier, err := hooks.NewNotifier(f.webhook, f.command, f.retries, f.backoff, stateFile)
+	if err != nil {
+		return nil, err
+	}
+	notifier.Horizon = time.Duration(windowSize) * time.Minute
+	return notifier, nil
+}
+
+/*
+A struct that evaluates moving averages against the SLA thresholds while they are calculated,
+notifying each breach as soon as it starts.
+
+Global is the detector of the global threshold, nil when there is none.
+Delivery errors are kept instead of stopping the aggregation, and returned once it is over.
+*/
+type slaMonitor struct {
+	config       sla.Config
+	global       *sla.Detector
+	notifier     *hooks.Notifier
+	notifyErrors []error
+}
+
+/*
+A function that creates an slaMonitor.
+
+Receives the SLA threshold or file and an optional notifier.
+Returns the slaMonitor and an error if the SLA configuration is invalid.
+*/
+func newSLAMonitor(slaValue string, notifier *hooks.Notifier) (*slaMonitor, error) {
+	config, err := sla.LoadConfig(slaValue)
+	if err != nil {
+		return nil, err
+	}
+
+	monitor := &slaMonitor{config: config, notifier: notifier}
+	if config.HasThreshold {
+		monitor.global = sla.NewDetector("", config.Threshold)
+	}
+	return monitor, nil
+}
+
+/*
+A function that observes a moving average value with a detector, notifying the breach it starts, if any.
+*/
+func (m *slaMonitor) observe(ctx context.Context, detector *sla.Detector, point statistics.Point) {
+	/* Equal values after the first one never start or end a breach, so a run is observed through its first bucket */
+	breach, started := detector.Observe(point.First(time.Minute))
+	if !started || m.notifier == nil {
+		return
+	}
+	if err := m.notifier.Notify(ctx, breach); err != nil {
+		m.notifyErrors = append(m.notifyErrors, err)
+	}
+}
+
+/*
+A function that observes a value of the moving average of all events against the global threshold.
+*/
+func (m *slaMonitor) Observe(ctx context.Context, point statistics.Point) {
+	if m.global != nil {
+		m.observe(ctx, m.global, point)
+	}
+}
+
+/*
+A function that returns the clients with a threshold, in a stable order.
+*/
+func (m *slaMonitor) clients() []string {
+	clients := make([]string, 0, len(m.config.Clients))
+	for client := range m.config.Clients {
+		clients = append(clients, client)
+	}
+	sort.Strings(clients)
+	return clients
+}
+
+/*
+A function that evaluates the moving average against the SLA thresholds and writes the breach report.
+
+Receives the context, the monitor that observed the moving average of all events, the aggregator that calculated it,
+the path to the report file and how to write it, and the list of events.
+Per-client thresholds are evaluated on a moving average calculated from that client's events only, notifying each breach as it is found.
+Returns an error, joining the errors of every notification that could not be delivered.
+*/
+func EvaluateSLA(ctx context.Context, monitor *slaMonitor, aggregator *movingaverage.Aggregator, outputFilepath string, outputMode output.Mode, transactionDeliveredEvents []movingaverage.Event) error {
+	breaches := make([]sla.Breach, 0)
+
+	/* The global threshold was evaluated while the moving average of all events was calculated */
+	if monitor.global != nil {
+		breaches = append(breaches, monitor.global.Close()...)
+	}
+
+	/* Evaluate each client threshold on the moving average of the client's events */
+	for _, client := range monitor.clients() {
+		clientEvents := make([]movingaverage.Event, 0)
+		for _, event := range transactionDeliveredEvents {
+			if event.ClientName == client {
+				clientEvents = append(clientEvents, event)
+			}
+		}
+		if len(clientEvents) == 0 {
+			continue
+		}
+
+		clientEventsGroupedByMinute, err := aggregator.Group(ctx, clientEvents)
+		if err != nil {
+			return err
+		}
+
+		detector := sla.NewDetector(client, monitor.config.Clients[client])
+		err = aggregator.Iterate(ctx, clientEventsGroupedByMinute, func(point movingaverage.Point) error {
+			monitor.observe(ctx, detector, point)
+			return nil
+		})
+		if err != nil {
+			return err
+		}
+		breaches = append(breaches, detector.Close()...)
+	}
+
+	breachReportOutput, err := sla.GenerateBreachReportOutput(breaches)
+	if err != nil {
+		return err
+	}
+
+	err = output.WriteStringToFile(outputFilepath, breachReportOutput, outputMode)
+	if err != nil {
+		return err
+	}
+
+	return errors.Join(monitor.notifyErrors...)
+}
@@ -0,0 +1,93 @@
+package main
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"sort"
+
+	_ "github.com/jackc/pgx/v5/stdlib"
+	"github.com/jmbds/unbabel-backend-engineering-challenge/pkg/movingaverage"
+	"github.com/jmbds/unbabel-backend-engineering-challenge/pkg/sqlsink"
+	_ "modernc.org/sqlite"
+)
+
+/* The database/sql driver registered for each SQL dialect */
+var sqlDrivers = map[sqlsink.Dialect]string{
+	sqlsink.DialectSQLite:   "sqlite",
+	sqlsink.DialectPostgres: "pgx",
+}
+
+/* The only key the moving average can be grouped by in the SQL table, besides every event */
+const sqlGroupByClient = "client_name"
+
+/*
+A function that checks the key the moving average is grouped by in the SQL table, which can only be client_name, or empty for none.
+*/
+func validateSQLGroupBy(key string) error {
+	if key != "" && key != sqlGroupByClient {
+		return errors.New("Invalid SQL group key " + key + ". Please provide " + sqlGroupByClient + ".")
+	}
+	return nil
+}
+
+/*
+A function that upserts the moving average into a SQL table, with the total delivery time and number of events of each window.
+
+The moving average of every event is written with an empty group key and, when grouped by client_name,
+the moving average of each client's events with the client name as its group key. Events without a client are only in the former.
+Every value is written in a single transaction, so the table is left untouched if any of them fails or the context is cancelled.
+Receives the context, the aggregator, the dialect and data source of the database, the name of the table, the key to group by, the window size and the batch of events read.
+Returns the number of values written and an error.
+*/
+func writeSQL(ctx context.Context, aggregator *movingaverage.Aggregator, dialect sqlsink.Dialect, dataSource, table, groupBy string, windowSize int, batch movingaverage.Batch) (int, error) {
+	db, err := sql.Open(sqlDrivers[dialect], dataSource)
+	if err != nil {
+		return 0, err
+	}
+	defer db.Close()
+
+	sink, err := sqlsink.New(ctx, db, dialect, table)
+	if err != nil {
+		return 0, err
+	}
+
+	/* Every event is aggregated together, so the values have an empty group key */
+	sqlBatch, err := sink.Begin(ctx, "", windowSize)
+	if err != nil {
+		return 0, err
+	}
+	if err := aggregator.IterateWindows(ctx, batch.Dataset, sqlBatch.Write); err != nil {
+		sqlBatch.Abort()
+		return 0, err
+	}
+
+	if groupBy == sqlGroupByClient {
+		clientEvents := make(map[string][]movingaverage.Event)
+		for _, event := range batch.Events {
+			if event.ClientName != "" {
+				clientEvents[event.ClientName] = append(clientEvents[event.ClientName], event)
+			}
+		}
+
+		clients := make([]string, 0, len(clientEvents))
+		for client := range clientEvents {
+			clients = append(clients, client)
+		}
+		sort.Strings(clients)
+
+		for _, client := range clients {
+			clientEventsGroupedByMinute, err := aggregator.Group(ctx, clientEvents[client])
+			if err == nil {
+				sqlBatch.SetGroup(client)
+				err = aggregator.IterateWindows(ctx, clientEventsGroupedByMinute, sqlBatch.Write)
+			}
+			if err != nil {
+				sqlBatch.Abort()
+				return 0, err
+			}
+		}
+	}
+
+	return sqlBatch.Rows, sqlBatch.Commit()
+}
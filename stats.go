@@ -0,0 +1,33 @@
+package main
+
+import (
+	"fmt"
+
+	"github.com/jmbds/unbabel-backend-engineering-challenge/internal/output"
+	"github.com/jmbds/unbabel-backend-engineering-challenge/internal/summary"
+)
+
+/*
+A function that writes the summary statistics of the input, as JSON or a human readable table.
+
+Receives the report, its format, the path to the summary statistics file, or an empty string to print it, and how to write it.
+Returns an error.
+*/
+func writeStats(report summary.Report, format summary.Format, statsFilepath string, outputMode output.Mode) error {
+	var textToOutput string
+	if format == summary.FormatJSON {
+		line, err := summary.MarshalReport(report)
+		if err != nil {
+			return err
+		}
+		textToOutput = string(line) + "\n"
+	} else {
+		textToOutput = summary.GenerateReportOutput(report)
+	}
+
+	if statsFilepath == "" {
+		fmt.Print(textToOutput)
+		return nil
+	}
+	return output.WriteStringToFile(statsFilepath, textToOutput, outputMode)
+}
@@ -0,0 +1,164 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"flag"
+	"fmt"
+	"time"
+
+	"github.com/jmbds/unbabel-backend-engineering-challenge/internal/events"
+	"github.com/jmbds/unbabel-backend-engineering-challenge/internal/output"
+	"github.com/jmbds/unbabel-backend-engineering-challenge/internal/rollup"
+)
+
+/*
+A function that runs the ingest subcommand, adding the rollups of the events appended to the input files since they were last ingested to a store.
+
+Receives the context and the subcommand arguments.
+Returns an error.
+*/
+func runIngest(ctx context.Context, args []string) error {
+	var (
+		inputFiles = inputFilesFlag{values: []string{"events.json"}}
+		storeDir   string
+	)
+
+	flags := flag.NewFlagSet("unbabel_cli ingest", flag.ExitOnError)
+	flags.Var(&inputFiles, "input_file", "path or glob pattern of input files containing events, can be repeated")
+	flags.StringVar(&storeDir, "store", "rollups", "path to the directory of the store")
+	if err := flags.Parse(args); err != nil {
+		return err
+	}
+
+	inputFilepaths, err := events.ExpandInputFiles(inputFiles.values)
+	if err != nil {
+		return err
+	}
+
+	store, err := rollup.Open(storeDir)
+	if err != nil {
+		return err
+	}
+
+	for _, inputFilepath := range inputFilepaths {
+		count, err := store.Ingest(ctx, inputFilepath)
+		if err != nil {
+			return interrupted(err, "The events of "+inputFilepath+" were not ingested, and the store was left untouched.")
+		}
+		fmt.Printf("Ingested %d events from %s.\n", count, inputFilepath)
+	}
+
+	return nil
+}
+
+/*
+A function that runs the rollup subcommand, rolling the minute rollups of a store up into hours and days and dropping those past their retention.
+
+Receives the context and the subcommand arguments.
+Returns an error.
+*/
+func runRollup(ctx context.Context, args []string) error {
+	var (
+		storeDir  string
+		retention rollup.Retention
+	)
+
+	flags := flag.NewFlagSet("unbabel_cli rollup", flag.ExitOnError)
+	flags.StringVar(&storeDir, "store", "rollups", "path to the directory of the store")
+	flags.DurationVar(&retention.Minute, "minute_retention", 0, "how long minute rollups are kept, forever when 0")
+	flags.DurationVar(&retention.Hour, "hour_retention", 0, "how long hour rollups are kept, forever when 0")
+	flags.DurationVar(&retention.Day, "day_retention", 0, "how long day rollups are kept, forever when 0")
+	if err := flags.Parse(args); err != nil {
+		return err
+	}
+
+	if retention.Minute < 0 || retention.Hour < 0 || retention.Day < 0 {
+		return errors.New("Retention has to be equal or greater than 0, please provide a valid retention.")
+	}
+
+	store, err := rollup.Open(storeDir)
+	if err != nil {
+		return err
+	}
+
+	segments, err := store.Compact(ctx, retention, time.Now())
+	if err != nil {
+		return interrupted(err, "The store was left untouched.")
+	}
+	fmt.Printf("Compacted the store into %d segments.\n", segments)
+
+	return nil
+}
+
+/*
+A function that runs the query subcommand, writing the moving average of the rollups of a store to the output file.
+
+Receives the context and the subcommand arguments.
+Returns an error.
+*/
+func runQuery(ctx context.Context, args []string) error {
+	var (
+		storeDir       string
+		outputFilepath string
+		client         string
+		from           string
+		to             string
+		unit           time.Duration
+		windowSize     int
+	)
+
+	flags := flag.NewFlagSet("unbabel_cli query", flag.ExitOnError)
+	flags.StringVar(&storeDir, "store", "rollups", "path to the directory of the store")
+	flags.StringVar(&outputFilepath, "output_file", "aggregated_events.out.json", "path to aggregated output file")
+	flags.StringVar(&client, "client", "", "client to query, every client by default")
+	flags.StringVar(&from, "from", "", "start of the interval to query, as YYYY-MM-DD or YYYY-MM-DD HH:MM:SS")
+	flags.StringVar(&to, "to", "", "end of the interval to query, exclusive, as YYYY-MM-DD or YYYY-MM-DD HH:MM:SS")
+	flags.DurationVar(&unit, "unit", time.Minute, "interval of each bucket of the moving average, a multiple of a minute")
+	flags.IntVar(&windowSize, "window_size", 10, "size of time window for moving average")
+	if err := flags.Parse(args); err != nil {
+		return err
+	}
+
+	query := rollup.Query{Group: client, Unit: unit, WindowSize: windowSize}
+	var err error
+	if query.From, err = parseQueryTime(from); err != nil {
+		return err
+	}
+	if query.To, err = parseQueryTime(to); err != nil {
+		return err
+	}
+
+	store, err := rollup.Open(storeDir)
+	if err != nil {
+		return err
+	}
+
+	file, err := output.Create(outputFilepath, output.ModeTruncate)
+	if err != nil {
+		return err
+	}
+
+	err = store.Query(ctx, query, events.NewRecordWriter(file).WritePoint)
+	if err != nil {
+		file.Abort()
+		return interrupted(err, "The output file was left untouched.")
+	}
+
+	return file.Commit()
+}
+
+/*
+A function that parses the bound of a query, which is zero when empty.
+*/
+func parseQueryTime(value string) (time.Time, error) {
+	if value == "" {
+		return time.Time{}, nil
+	}
+	for _, layout := range []string{events.OutputTimestampFormat, "2006-01-02"} {
+		if parsed, err := time.Parse(layout, value); err == nil {
+			return parsed, nil
+		}
+	}
+	return time.Time{}, errors.New("Invalid date " + value + ". Please provide dates as YYYY-MM-DD or YYYY-MM-DD HH:MM:SS.")
+}
@@ -0,0 +1,73 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"flag"
+	"fmt"
+	"os"
+
+	"github.com/jmbds/unbabel-backend-engineering-challenge/internal/validation"
+)
+
+/*
+A function that runs the validate subcommand, printing a data-quality report of the input file.
+
+Receives the context and the subcommand arguments. When interrupted, the report of the lines checked so far is printed.
+Returns an error if the input couldn't be read, or it has violations of the severity given by --fail_on or higher.
+*/
+func runValidate(ctx context.Context, args []string) error {
+	var (
+		inputFilepath     string
+		failOn            string
+		severityOverrides string
+	)
+
+	flags := flag.NewFlagSet("unbabel_cli validate", flag.ExitOnError)
+	flags.StringVar(&inputFilepath, "input_file", "events.json", "path to input file containing events")
+	flags.StringVar(&failOn, "fail_on", "error", "lowest severity that makes validation fail: warning or error")
+	flags.StringVar(&severityOverrides, "severity", "", "comma separated rule=severity overrides, with severity one of ignore, warning or error")
+	if err := flags.Parse(args); err != nil {
+		return err
+	}
+
+	threshold, err := validation.ParseSeverity(failOn)
+	if err != nil {
+		return err
+	}
+
+	severities, err := validation.ParseSeverities(validation.DefaultSeverities(), severityOverrides)
+	if err != nil {
+		return err
+	}
+
+	file, err := os.Open(inputFilepath)
+	if err != nil {
+		return err
+	}
+	defer file.Close()
+
+	report, err := validation.Validate(ctx, file)
+	if errors.Is(err, context.Canceled) {
+		fmt.Print(validation.GenerateReportOutput(report, severities))
+		return interrupted(err, fmt.Sprintf("Validation stopped after %d lines.", report.Lines))
+	}
+	if err != nil {
+		return err
+	}
+
+	fmt.Print(validation.GenerateReportOutput(report, severities))
+
+	/* Count the violations at or above the failing severity */
+	failures := 0
+	for severity := threshold; severity <= validation.SeverityError; severity++ {
+		if severity != validation.SeverityIgnore {
+			failures += report.Violations(severities, severity)
+		}
+	}
+	if failures > 0 {
+		return fmt.Errorf("Validation failed with %d violations of severity %s or higher.", failures, threshold)
+	}
+
+	return nil
+}